@@ -0,0 +1,41 @@
+package abstract
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Selects the variant of base64 which a scheme uses to encode the salt and
+// digest of new hashes. Implementations of the same format disagree on the
+// alphabet and padding, so choosing another implementation's variant makes
+// passlib's output match it byte for byte. Schemes accepting an encoding
+// verify hashes in any of these variants.
+type Base64Encoding int
+
+const (
+	// The scheme's usual encoding.
+	Base64Default Base64Encoding = iota
+
+	// The standard alphabet, padded with '=' (RFC 4648 section 4).
+	Base64Std
+
+	// The standard alphabet without padding, as used by PHC strings.
+	Base64RawStd
+
+	// The standard alphabet with '.' in place of '+', without padding, as
+	// used by Python passlib's PBKDF2 hashes.
+	Base64Adapted
+)
+
+// Encodes src. Base64Default encodes as Base64RawStd; schemes substitute
+// their usual encoding before calling this.
+func (e Base64Encoding) Encode(src []byte) string {
+	switch e {
+	case Base64Std:
+		return base64.StdEncoding.EncodeToString(src)
+	case Base64Adapted:
+		return strings.Replace(base64.RawStdEncoding.EncodeToString(src), "+", ".", -1)
+	default:
+		return base64.RawStdEncoding.EncodeToString(src)
+	}
+}
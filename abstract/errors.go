@@ -2,14 +2,53 @@
 // plus supporting error definitions.
 package abstract
 
+import "errors"
 import "fmt"
 
 // Indicates that password verification failed because the provided password
 // does not match the provided hash.
-var ErrInvalidPassword = fmt.Errorf("invalid password")
+var ErrPasswordMismatch = fmt.Errorf("invalid password")
+
+// The original name of ErrPasswordMismatch; they are the same error.
+var ErrInvalidPassword = ErrPasswordMismatch
 
 // Indicates that password verification is not possible because the hashing
 // scheme used by the hash provided is not supported.
-var ErrUnsupportedScheme = fmt.Errorf("unsupported scheme")
+var ErrNoMatchingScheme = fmt.Errorf("unsupported scheme")
+
+// The original name of ErrNoMatchingScheme; they are the same error.
+var ErrUnsupportedScheme = ErrNoMatchingScheme
+
+// Indicates that password verification is not possible because the hash is
+// malformed or has invalid parameters. Schemes return more specific errors
+// which wrap this one, so test for it using errors.Is.
+var ErrInvalidHash = fmt.Errorf("invalid hash")
+
+type invalidHashError struct {
+	err error
+}
+
+func (e *invalidHashError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidHashError) Unwrap() error {
+	return e.err
+}
+
+func (e *invalidHashError) Is(target error) bool {
+	return target == ErrInvalidHash
+}
+
+// Marks err, which describes why a hash is malformed, as an invalid hash
+// error. The result has the same message as err, and errors.Is reports it as
+// matching both err and ErrInvalidHash. Returns nil if err is nil.
+func InvalidHash(err error) error {
+	if err == nil || errors.Is(err, ErrInvalidHash) {
+		return err
+	}
+
+	return &invalidHashError{err}
+}
 
 // © 2014 Hugo Landau <hlandau@devever.net>  MIT License
@@ -0,0 +1,82 @@
+package abstract
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Parses integer parameters into the variables pointed to by fields, for
+// implementing ParamScheme.WithParams. Returns an error naming the first
+// parameter, in lexical order, which is not in fields or is not a
+// non-negative decimal integer.
+func ParseIntParams(params map[string]string, fields map[string]*int) error {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("unknown parameter %q", name)
+		}
+
+		n, err := strconv.ParseUint(params[name], 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for parameter %q", params[name], name)
+		}
+
+		*field = int(n)
+	}
+
+	return nil
+}
+
+// Like ParseIntParams, but also returns an error if any of fields is not in
+// params, for implementing Splittable.JoinHash.
+func ParseAllIntParams(params map[string]string, fields map[string]*int) error {
+	if err := ParseIntParams(params, fields); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := params[name]; !ok {
+			return fmt.Errorf("missing parameter %q", name)
+		}
+	}
+
+	return nil
+}
+
+// Compares the parameters recorded in a hash with a scheme's target
+// parameters, for implementing Scheme.NeedsUpdate. Returns -1 if any stored
+// parameter is below its target, 0 if every stored parameter equals its
+// target, and +1 otherwise. Only parameters present in both maps are
+// compared, so a scheme may omit those a particular hash does not record.
+func CompareParams(stored, target map[string]uint64) int {
+	result := 0
+	for name, want := range target {
+		have, ok := stored[name]
+		if !ok {
+			continue
+		}
+
+		if have < want {
+			return -1
+		}
+
+		if have > want {
+			result = 1
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,39 @@
+package abstract
+
+import "testing"
+
+func TestCompareParams(t *testing.T) {
+	target := map[string]uint64{"N": 16384, "r": 8}
+
+	for i, tst := range []struct {
+		stored map[string]uint64
+		result int
+	}{
+		{map[string]uint64{"N": 8192, "r": 8}, -1},
+		{map[string]uint64{"N": 16384, "r": 8}, 0},
+		{map[string]uint64{"N": 32768, "r": 8}, 1},
+		{map[string]uint64{"N": 32768, "r": 4}, -1},
+		{map[string]uint64{"N": 16384}, 0},
+		{map[string]uint64{"N": 16384, "r": 8, "p": 0}, 0},
+		{map[string]uint64{}, 0},
+	} {
+		if r := CompareParams(tst.stored, target); r != tst.result {
+			t.Errorf("test %d: got %d, expected %d", i, r, tst.result)
+		}
+	}
+}
+
+func TestParseAllIntParams(t *testing.T) {
+	var N, r int
+	fields := map[string]*int{"N": &N, "r": &r}
+
+	if err := ParseAllIntParams(map[string]string{"N": "16384", "r": "8"}, fields); err != nil || N != 16384 || r != 8 {
+		t.Fatalf("got %d, %d, %v", N, r, err)
+	}
+
+	for _, params := range []map[string]string{{"N": "16384"}, {"N": "16384", "r": "8", "p": "1"}, {"N": "x", "r": "8"}} {
+		if err := ParseAllIntParams(params, fields); err == nil {
+			t.Errorf("%v: expected an error", params)
+		}
+	}
+}
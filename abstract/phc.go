@@ -0,0 +1,217 @@
+package abstract
+
+import "encoding/base64"
+import "fmt"
+import "strings"
+
+// Indicates that a string is not a valid PHC string.
+var ErrInvalidPHC = fmt.Errorf("invalid PHC string")
+
+// A single name=value parameter of a PHC string.
+type PHCParam struct {
+	Name, Value string
+}
+
+// The fields of a string in the PHC string format:
+//
+//   $id[$v=version][$param=value(,param=value)*][$salt[$hash]]
+//
+// Salt and Hash hold the decoded bytes of the salt and hash, which are
+// encoded as unpadded standard base64. Either may be nil if absent; a hash
+// cannot be present without a salt.
+type PHCParams struct {
+	// The identifier of the scheme, e.g. "argon2id".
+	ID string
+
+	// The version, or "" if there is no version field.
+	Version string
+
+	// The parameters, in the order in which they appear.
+	Params []PHCParam
+
+	Salt []byte
+	Hash []byte
+}
+
+// Returns the value of the named parameter, and whether it was present.
+func (p *PHCParams) Param(name string) (value string, ok bool) {
+	for _, param := range p.Params {
+		if param.Name == name {
+			return param.Value, true
+		}
+	}
+
+	return "", false
+}
+
+var phcBase64 = base64.RawStdEncoding
+
+// The maximum length of an identifier or parameter name.
+const phcMaxNameLength = 32
+
+// Parses a string in the PHC string format. Both complete hashes and stubs
+// (strings without a hash, or without a salt and hash) are accepted.
+//
+// Identifiers and parameter names must consist of 1-32 characters from
+// [a-z0-9-]; parameter values of characters from [a-zA-Z0-9/+.-]. Parameter
+// names must not be repeated. The version, if present, must be decimal.
+func ParsePHC(stub string) (*PHCParams, error) {
+	if !strings.HasPrefix(stub, "$") {
+		return nil, ErrInvalidPHC
+	}
+
+	fields := strings.Split(stub[1:], "$")
+	if len(fields) > 5 {
+		return nil, ErrInvalidPHC
+	}
+
+	p := &PHCParams{ID: fields[0]}
+	if !isPHCName(p.ID) {
+		return nil, ErrInvalidPHC
+	}
+	fields = fields[1:]
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		p.Version = fields[0][2:]
+		if !isPHCDecimal(p.Version) {
+			return nil, ErrInvalidPHC
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 && strings.Contains(fields[0], "=") {
+		for _, pair := range strings.Split(fields[0], ",") {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				return nil, ErrInvalidPHC
+			}
+
+			param := PHCParam{Name: pair[:i], Value: pair[i+1:]}
+			if !isPHCName(param.Name) || !isPHCValue(param.Value) {
+				return nil, ErrInvalidPHC
+			}
+
+			if _, dup := p.Param(param.Name); dup {
+				return nil, ErrInvalidPHC
+			}
+
+			p.Params = append(p.Params, param)
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) > 2 {
+		return nil, ErrInvalidPHC
+	}
+
+	var err error
+	if len(fields) > 0 {
+		if p.Salt, err = decodePHCBase64(fields[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fields) > 1 {
+		if p.Hash, err = decodePHCBase64(fields[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Formats p as a PHC string. It is the inverse of ParsePHC; fields which are
+// empty are omitted, except that a salt field is always written if there is
+// a hash.
+func FormatPHC(p *PHCParams) string {
+	var b strings.Builder
+
+	b.WriteString("$")
+	b.WriteString(p.ID)
+
+	if p.Version != "" {
+		b.WriteString("$v=")
+		b.WriteString(p.Version)
+	}
+
+	for i, param := range p.Params {
+		if i == 0 {
+			b.WriteString("$")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(param.Name)
+		b.WriteString("=")
+		b.WriteString(param.Value)
+	}
+
+	if p.Salt != nil || p.Hash != nil {
+		b.WriteString("$")
+		b.WriteString(phcBase64.EncodeToString(p.Salt))
+	}
+
+	if p.Hash != nil {
+		b.WriteString("$")
+		b.WriteString(phcBase64.EncodeToString(p.Hash))
+	}
+
+	return b.String()
+}
+
+func decodePHCBase64(s string) ([]byte, error) {
+	if s == "" {
+		return nil, ErrInvalidPHC
+	}
+
+	b, err := phcBase64.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidPHC
+	}
+
+	return b, nil
+}
+
+func isPHCName(s string) bool {
+	if len(s) == 0 || len(s) > phcMaxNameLength {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isPHCValue(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') &&
+			c != '/' && c != '+' && c != '.' && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isPHCDecimal(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
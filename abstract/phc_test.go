@@ -0,0 +1,83 @@
+package abstract
+
+import "bytes"
+import "testing"
+
+func TestParsePHC(t *testing.T) {
+	h := "$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo"
+
+	p, err := ParsePHC(h)
+	if err != nil {
+		t.Fatalf("err parsing: %v", err)
+	}
+
+	if p.ID != "argon2id" || p.Version != "19" || len(p.Params) != 3 {
+		t.Fatalf("unexpected result: %#v", p)
+	}
+
+	for i, name := range []string{"m", "t", "p"} {
+		if p.Params[i].Name != name {
+			t.Errorf("parameter %d: got %q, expected %q", i, p.Params[i].Name, name)
+		}
+	}
+
+	if v, ok := p.Param("t"); !ok || v != "4" {
+		t.Errorf("unexpected value for t: %q %v", v, ok)
+	}
+
+	if !bytes.Equal(p.Salt, []byte("5rrNPDMR0rRbaxdl")) || len(p.Hash) != 32 {
+		t.Errorf("unexpected salt or hash: %q %x", p.Salt, p.Hash)
+	}
+
+	if s := FormatPHC(p); s != h {
+		t.Errorf("round trip mismatch: %q", s)
+	}
+}
+
+func TestParsePHCStubs(t *testing.T) {
+	for _, s := range []string{
+		"$scheme",
+		"$scheme$v=1",
+		"$scheme$a=1",
+		"$scheme$c2FsdA",
+		"$scheme$v=1$a=1,b=x/+.-Y$c2FsdA",
+		"$scheme$a=1$c2FsdA$aGFzaA",
+	} {
+		p, err := ParsePHC(s)
+		if err != nil {
+			t.Errorf("err parsing %q: %v", s, err)
+			continue
+		}
+
+		if f := FormatPHC(p); f != s {
+			t.Errorf("round trip mismatch: %q != %q", f, s)
+		}
+	}
+}
+
+func TestParsePHCInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"scheme",
+		"$",
+		"$Scheme",
+		"$scheme-name-which-is-far-too-long-to-be-valid",
+		"$scheme$v=",
+		"$scheme$v=x",
+		"$scheme$a=1,a=2",
+		"$scheme$a=1,b",
+		"$scheme$a=1,=2",
+		"$scheme$a=",
+		"$scheme$a=$",
+		"$scheme$a=1$c2FsdA$aGFzaA$extra",
+		"$scheme$v=1$a=1$c2FsdA$aGFzaA$extra",
+		"$scheme$c2FsdA==",
+		"$scheme$c2Fsd!",
+		"$scheme$c2FsdA$",
+		"$scheme$$aGFzaA",
+	} {
+		if _, err := ParsePHC(s); err != ErrInvalidPHC {
+			t.Errorf("expected ErrInvalidPHC for %q, got %v", s, err)
+		}
+	}
+}
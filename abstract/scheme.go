@@ -1,5 +1,7 @@
 package abstract
 
+import "io"
+
 // The Scheme interface provides an abstract interface to an implementation
 // of a particular password hashing scheme. The Scheme generates password
 // hashes from passwords, verifies passwords using password hashes, randomly
@@ -24,6 +26,12 @@ type Scheme interface {
 	Verify(password, hash string) (err error)
 
 	// Returns true iff this crypter supports the given stub.
+	//
+	// Implementations should match the scheme's whole identifier, such as
+	// "$argon2i$" rather than "$argon2", so that no two schemes claim the
+	// same hash, but need not check the rest of the stub: a malformed hash
+	// with the right identifier should be claimed, so that Verify reports
+	// it as invalid rather than as belonging to no scheme.
 	SupportsStub(stub string) bool
 
 	// Returns true iff this stub needs an update.
@@ -32,3 +40,157 @@ type Scheme interface {
 	// Make a stub with the configured defaults. The salt is generated randomly.
 	//MakeStub() (string, error)
 }
+
+// ByteScheme is implemented by schemes which can hash and verify passwords
+// held in byte slices without copying them into strings, so that callers can
+// zero the password after use. Implementations must not retain the slice.
+type ByteScheme interface {
+	Scheme
+
+	// Like Hash, but takes the password as a byte slice.
+	HashBytes(password []byte) (string, error)
+
+	// Like Verify, but takes the password as a byte slice.
+	VerifyBytes(password []byte, hash string) error
+}
+
+// FIPSScheme is implemented by schemes which can report whether they use
+// only FIPS-approved primitives. Schemes which do not implement it are
+// treated as not approved.
+type FIPSScheme interface {
+	Scheme
+
+	// Returns true iff the scheme uses only FIPS-approved primitives.
+	FIPSApproved() bool
+}
+
+// Deprecatable is implemented by schemes which are weak whatever their
+// parameters, such as md5-crypt and des-crypt, so that contexts upgrade their
+// hashes wherever the scheme appears in the list. Schemes which do not
+// implement it are treated as not deprecated.
+type Deprecatable interface {
+	Scheme
+
+	// Returns true iff hashes using the scheme should always be upgraded.
+	IsDeprecated() bool
+}
+
+// ParamReader is implemented by schemes which can report the parameters
+// encoded in a hash, such as its cost, without verifying a password.
+type ParamReader interface {
+	Scheme
+
+	// Returns the parameters of hash, keyed by name, as decimal strings.
+	// Returns an error wrapping ErrInvalidHash if the hash is malformed.
+	ReadParams(hash string) (map[string]string, error)
+}
+
+// SaltReaderScheme is implemented by schemes which can read the random bytes
+// for new salts from a caller-supplied source rather than crypto/rand, so
+// that tests can produce reproducible hashes.
+type SaltReaderScheme interface {
+	Scheme
+
+	// Like Hash, but takes the password as a byte slice and reads salt bytes
+	// from saltReader.
+	HashWithSaltReader(password []byte, saltReader io.Reader) (string, error)
+}
+
+// Describable is implemented by schemes which can summarise their
+// configuration for humans, for example in startup logs.
+type Describable interface {
+	Scheme
+
+	// Returns the scheme's name and the parameters used for new hashes, e.g.
+	// "bcrypt(cost=12)".
+	Describe() string
+}
+
+// ParamScheme is implemented by schemes with tunable parameters, such as a
+// cost, so that their configuration can be saved and restored.
+type ParamScheme interface {
+	Scheme
+
+	// Returns the parameters used for new hashes, keyed by name, as decimal
+	// strings. Where the scheme also implements ParamReader, the names are
+	// the same.
+	Params() map[string]string
+
+	// Returns a new scheme like this one, but with the given parameters in
+	// place of its own; parameters not given keep their current values.
+	// Returns an error if a parameter is unknown or invalid.
+	WithParams(params map[string]string) (Scheme, error)
+}
+
+// StrengthScheme is implemented by schemes which can estimate how hard a
+// hash is to crack, so that hashes from different schemes can be compared
+// against a single policy threshold.
+//
+// Strengths are in bits: the base-2 logarithm of the approximate work needed
+// to test one guess against the hash, in units of one SHA-256 compression
+// (hashing one 64-byte block). Each additional bit doubles the cost of an
+// offline attack. The figures are rough, and memory hardness is not counted,
+// so memory-hard schemes such as argon2 and scrypt are stronger against
+// GPUs and ASICs than their strength alone suggests.
+//
+// Within a scheme, strength must increase with every cost parameter, such as
+// bcrypt's cost or argon2's time and memory, so that hashes can be ranked by
+// it, e.g. on a dashboard.
+type StrengthScheme interface {
+	Scheme
+
+	// Returns the strength of hash. Returns an error wrapping ErrInvalidHash
+	// if the hash is malformed.
+	Strength(hash string) (float64, error)
+}
+
+// StrengthEstimator is another name for StrengthScheme, which schemes
+// implement to be scored by passlib.EstimateStrength.
+type StrengthEstimator = StrengthScheme
+
+// The resources needed to hash one password, as reported by Coster.
+type Cost struct {
+	// The approximate peak memory used, in bytes, not counting small fixed
+	// overheads. Zero for schemes which are not memory-hard, such as pbkdf2.
+	Memory uint64
+
+	// The number of threads used, which is 1 for most schemes.
+	Threads int
+
+	// The parameters governing the time taken, keyed by the names used by
+	// ParamScheme, e.g. {"rounds": 600000} for pbkdf2-sha256 or
+	// {"time": 2, "memory": 19456} for argon2id.
+	Time map[string]uint64
+
+	// The strength a hash with these parameters would have; see
+	// StrengthScheme. This doubles as a rough class of CPU cost.
+	Strength float64
+}
+
+// Coster is implemented by schemes with tunable parameters which can report
+// the cost of hashing with them analytically, without hashing, e.g. for
+// capacity planning.
+type Coster interface {
+	Scheme
+
+	// Returns the cost of hashing a password with the parameters used for
+	// new hashes.
+	EstimateCost() Cost
+}
+
+// Splittable is implemented by schemes whose hashes can be split into a
+// salt, a digest and parameters, for storage in separate columns, and later
+// reassembled.
+type Splittable interface {
+	Scheme
+
+	// Splits hash into its raw salt and digest and the parameters needed to
+	// reassemble it, keyed by name as decimal strings. Returns an error
+	// wrapping ErrInvalidHash if the hash is malformed or is a stub.
+	SplitHash(hash string) (salt, digest []byte, params map[string]string, err error)
+
+	// Reassembles a hash split by SplitHash. The result verifies the same
+	// passwords as the original hash, but is in the scheme's canonical form,
+	// so need not be identical to it.
+	JoinHash(salt, digest []byte, params map[string]string) (string, error)
+}
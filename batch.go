@@ -0,0 +1,127 @@
+package passlib
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Hashes many passwords using the context, with at most concurrency hashes
+// in progress at once. The results are aligned with passwords: hashes[i] is
+// the hash of passwords[i], or "" if hashing it failed with errs[i]. An error
+// hashing one password does not stop the others from being hashed.
+//
+// Each hash in progress by a memory-hard scheme needs its own working memory,
+// so peak memory use is roughly concurrency times the footprint of a single
+// hash: memory KiB for argon2, or 128*N*r bytes for scrypt (16 MiB and
+// 32 MiB with the recommended parameters). Choose concurrency so that this
+// fits comfortably in the memory available, and no higher than the number of
+// CPUs, beyond which there is no gain. Note that argon2 already uses several
+// threads per hash. If concurrency is less than 1, one password is hashed at
+// a time.
+func (ctx *Context) HashBatch(passwords []string, concurrency int) (hashes []string, errs []error) {
+	hashes = make([]string, len(passwords))
+	errs = make([]error, len(passwords))
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if concurrency > len(passwords) {
+		concurrency = len(passwords)
+	}
+
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				hashes[i], errs[i] = ctx.Hash(passwords[i])
+			}
+		}()
+	}
+
+	for i := range passwords {
+		indices <- i
+	}
+	close(indices)
+
+	wg.Wait()
+	return
+}
+
+// Uses the default context to hash many passwords. See Context.HashBatch.
+func HashBatch(passwords []string, concurrency int) (hashes []string, errs []error) {
+	return DefaultContext.HashBatch(passwords, concurrency)
+}
+
+// Indicates that VerifyMultiple matched none of the hashes, and that at least
+// one of them could not be verified at all, e.g. because it is malformed.
+// errors.Is reports it as matching abstract.ErrPasswordMismatch.
+type ErrNoHashMatched struct {
+	// The error verifying each hash, aligned with the hashes passed to
+	// VerifyMultiple.
+	Errs []error
+}
+
+func (e *ErrNoHashMatched) Error() string {
+	n := 0
+	for _, err := range e.Errs {
+		if err != abstract.ErrPasswordMismatch {
+			n++
+		}
+	}
+	return fmt.Sprintf("%v (%d of %d hashes could not be verified)", abstract.ErrPasswordMismatch, n, len(e.Errs))
+}
+
+func (e *ErrNoHashMatched) Is(target error) bool {
+	return target == abstract.ErrPasswordMismatch
+}
+
+// Verifies password against each of hashes in turn, e.g. the credentials of
+// several accounts being merged, and returns the index of the first which it
+// matches. Later hashes are not tried once one matches; a hash which cannot be
+// verified, e.g. because it is malformed or no scheme supports it, does not
+// stop the rest from being tried. No upgrade hash is produced.
+//
+// Each hash costs a full verification, so hashes should be few. If none
+// matches, index is -1 and err is abstract.ErrPasswordMismatch, or an
+// *ErrNoHashMatched recording every hash's error if any failed for some
+// other reason.
+//
+// A hash which the password matches but which is weaker than the context's
+// MinimumStrength still matches: its index is returned, with the
+// *ErrHashTooWeak which Verify would return.
+func (ctx *Context) VerifyMultiple(password string, hashes []string) (index int, err error) {
+	errs := make([]error, len(hashes))
+	mismatch := true
+	for i, hash := range hashes {
+		errs[i] = ctx.VerifyNoUpgrade(password, hash)
+		if errs[i] == nil {
+			return i, nil
+		}
+		var weak *ErrHashTooWeak
+		if errors.As(errs[i], &weak) {
+			return i, errs[i]
+		}
+		if errs[i] != abstract.ErrPasswordMismatch {
+			mismatch = false
+		}
+	}
+
+	if mismatch {
+		return -1, abstract.ErrPasswordMismatch
+	}
+	return -1, &ErrNoHashMatched{Errs: errs}
+}
+
+// Uses the default context to verify a password against several hashes. See
+// Context.VerifyMultiple.
+func VerifyMultiple(password string, hashes []string) (index int, err error) {
+	return DefaultContext.VerifyMultiple(password, hashes)
+}
@@ -0,0 +1,252 @@
+package passlib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Indicates that DecodeHashBinary was passed bytes which EncodeHashBinary
+// could not have produced.
+var ErrInvalidBinaryHash = fmt.Errorf("invalid binary hash")
+
+// The encodings of a field of a binary hash, i.e. of a part of the hash
+// between '$' separators. Each field begins with a byte holding its kind in
+// the top three bits and a number in the rest: the value of a decimal field,
+// otherwise the length of the field in characters. Numbers from 31 on are
+// stored as 31, followed by a uvarint holding the excess. Then follow the
+// bytes of a literal field, or the packed characters of the others.
+const (
+	fieldLiteral    = iota // the bytes of the field
+	fieldDecimal           // a canonical decimal integer
+	fieldHash64            // 6 bits per character
+	fieldBase64            // 6 bits per character
+	fieldBase64Pad1        // as fieldBase64, followed by "="
+	fieldBase64Pad2        // as fieldBase64, followed by "=="
+	fieldHexLower          // 4 bits per character
+	fieldHexUpper          // as fieldHexLower
+
+	fieldKindShift = 5
+	fieldSmallMax  = 1<<fieldKindShift - 1
+)
+
+const (
+	hash64Alphabet   = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	base64Alphabet   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	hexLowerAlphabet = "0123456789abcdef"
+	hexUpperAlphabet = "0123456789ABCDEF"
+)
+
+// Encodes a hash made by one of the built-in schemes compactly, for stores
+// where space is scarce; DecodeHashBinary reverses it exactly. The first byte
+// is the scheme's identifier (see SchemeIDFor), followed by the number of
+// '$'-separated fields in the hash. Salts and checksums are then packed at 6
+// bits per base64 character or 4 per hex digit, and numeric parameters stored
+// as varints; other fields are stored as they are. This saves around a sixth
+// of the space of the string form, or half for hex hashes such as nthash.
+//
+// The encoding is lossless for any hash, rather than only canonical ones,
+// because it packs the characters of the string, not the bytes they encode.
+//
+// Returns ErrNoSchemeID if no built-in scheme supports hash, as for peppered
+// hashes.
+func EncodeHashBinary(hash string) ([]byte, error) {
+	id, ok := builtinSchemeID(hash)
+	if !ok {
+		return nil, ErrNoSchemeID
+	}
+
+	fields := strings.Split(hash, "$")
+	b := appendUvarint([]byte{id}, uint64(len(fields)))
+	for _, field := range fields {
+		b = appendField(b, field)
+	}
+
+	return b, nil
+}
+
+// Decodes a hash encoded by EncodeHashBinary, returning exactly the string
+// which was encoded. Returns ErrInvalidBinaryHash if b is malformed, or does
+// not decode to a hash supported by the scheme it is tagged with.
+func DecodeHashBinary(b []byte) (string, error) {
+	if len(b) == 0 || schemesByID[b[0]] == nil {
+		return "", ErrInvalidBinaryHash
+	}
+	scheme := schemesByID[b[0]]
+	d := binaryDecoder{b: b[1:]}
+
+	// Every field takes at least one byte.
+	n, ok := d.uvarint()
+	if !ok || n > uint64(len(d.b)) {
+		return "", ErrInvalidBinaryHash
+	}
+
+	fields := make([]string, n)
+	for i := range fields {
+		if fields[i], ok = d.field(); !ok {
+			return "", ErrInvalidBinaryHash
+		}
+	}
+
+	hash := strings.Join(fields, "$")
+	if len(d.b) != 0 || !scheme.SupportsStub(hash) {
+		return "", ErrInvalidBinaryHash
+	}
+
+	return hash, nil
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// Appends a field header of the given kind holding x.
+func appendHeader(b []byte, kind byte, x uint64) []byte {
+	if x < fieldSmallMax {
+		return append(b, kind<<fieldKindShift|byte(x))
+	}
+
+	return appendUvarint(append(b, kind<<fieldKindShift|fieldSmallMax), x-fieldSmallMax)
+}
+
+// Appends field in the most compact encoding which reproduces it exactly.
+func appendField(b []byte, field string) []byte {
+	if n, err := strconv.ParseUint(field, 10, 64); err == nil && strconv.FormatUint(n, 10) == field {
+		return appendHeader(b, fieldDecimal, n)
+	}
+
+	if packed, ok := pack(field, hexLowerAlphabet, 4); ok {
+		return append(appendHeader(b, fieldHexLower, uint64(len(field))), packed...)
+	}
+
+	if packed, ok := pack(field, hexUpperAlphabet, 4); ok {
+		return append(appendHeader(b, fieldHexUpper, uint64(len(field))), packed...)
+	}
+
+	if packed, ok := pack(field, hash64Alphabet, 6); ok {
+		return append(appendHeader(b, fieldHash64, uint64(len(field))), packed...)
+	}
+
+	unpadded := strings.TrimRight(field, "=")
+	if padding := len(field) - len(unpadded); padding <= 2 {
+		if packed, ok := pack(unpadded, base64Alphabet, 6); ok {
+			kind := byte(fieldBase64 + padding)
+			return append(appendHeader(b, kind, uint64(len(unpadded))), packed...)
+		}
+	}
+
+	return append(appendHeader(b, fieldLiteral, uint64(len(field))), field...)
+}
+
+// Packs the indices in alphabet of the characters of s into bits bits each,
+// most significant first, padding the last byte with zeros. Returns false if
+// s is empty or not drawn from alphabet.
+func pack(s, alphabet string, bits uint) ([]byte, bool) {
+	if s == "" {
+		return nil, false
+	}
+
+	packed := make([]byte, 0, (len(s)*int(bits)+7)/8)
+	var acc uint
+	var n uint
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(alphabet, s[i])
+		if v < 0 {
+			return nil, false
+		}
+
+		acc = acc<<bits | uint(v)
+		n += bits
+		if n >= 8 {
+			n -= 8
+			packed = append(packed, byte(acc>>n))
+		}
+	}
+
+	if n > 0 {
+		packed = append(packed, byte(acc<<(8-n)))
+	}
+
+	return packed, true
+}
+
+type binaryDecoder struct {
+	b []byte
+}
+
+func (d *binaryDecoder) uvarint() (uint64, bool) {
+	x, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, false
+	}
+
+	d.b = d.b[n:]
+	return x, true
+}
+
+func (d *binaryDecoder) field() (string, bool) {
+	if len(d.b) == 0 {
+		return "", false
+	}
+	kind, x := d.b[0]>>fieldKindShift, uint64(d.b[0]&fieldSmallMax)
+	d.b = d.b[1:]
+
+	if x == fieldSmallMax {
+		excess, ok := d.uvarint()
+		if !ok || excess > ^uint64(0)-fieldSmallMax {
+			return "", false
+		}
+		x += excess
+	}
+
+	switch kind {
+	case fieldLiteral:
+		if x > uint64(len(d.b)) {
+			return "", false
+		}
+		s := string(d.b[:x])
+		d.b = d.b[x:]
+		return s, true
+	case fieldDecimal:
+		return strconv.FormatUint(x, 10), true
+	case fieldHash64:
+		return d.unpack(x, hash64Alphabet, 6)
+	case fieldBase64, fieldBase64Pad1, fieldBase64Pad2:
+		s, ok := d.unpack(x, base64Alphabet, 6)
+		return s + strings.Repeat("=", int(kind-fieldBase64)), ok
+	case fieldHexLower:
+		return d.unpack(x, hexLowerAlphabet, 4)
+	default:
+		return d.unpack(x, hexUpperAlphabet, 4)
+	}
+}
+
+// Reverses pack, reading the packed bytes of n characters.
+func (d *binaryDecoder) unpack(n uint64, alphabet string, bits uint) (string, bool) {
+	if n == 0 || n > uint64(len(d.b))*8/uint64(bits) {
+		return "", false
+	}
+
+	size := (int(n)*int(bits) + 7) / 8
+	packed := d.b[:size]
+	d.b = d.b[size:]
+
+	s := make([]byte, n)
+	mask := uint(1)<<bits - 1
+	var acc uint
+	var have uint
+	j := 0
+	for i := range s {
+		for have < bits {
+			acc = acc<<8 | uint(packed[j])
+			j++
+			have += 8
+		}
+		have -= bits
+		s[i] = alphabet[acc>>have&mask]
+	}
+
+	return string(s), true
+}
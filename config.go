@@ -0,0 +1,320 @@
+package passlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// The JSON representation of a Context.
+type contextJSON struct {
+	Schemes              []schemeJSON `json:"schemes,omitempty"`
+	DeprecatedSchemes    []schemeJSON `json:"deprecated_schemes,omitempty"`
+	MinVerifyDuration    string       `json:"min_verify_duration,omitempty"`
+	NormalizePassword    bool         `json:"normalize_password,omitempty"`
+	MaxPasswordLength    int          `json:"max_password_length,omitempty"`
+	MaxSecretSize        int64        `json:"max_secret_size,omitempty"`
+	NULPolicy            string       `json:"nul_policy,omitempty"`
+	FIPSOnly             bool         `json:"fips_only,omitempty"`
+	ConstantTimeIdentify bool         `json:"constant_time_identify,omitempty"`
+	MinimumStrength      float64      `json:"minimum_strength,omitempty"`
+	CurrentPepperID      string       `json:"current_pepper_id,omitempty"`
+	StrictUniformParams  bool         `json:"strict_uniform_params,omitempty"`
+	KeepHashWhitespace   bool         `json:"keep_hash_whitespace,omitempty"`
+	EmbedTimestamp       bool         `json:"embed_timestamp,omitempty"`
+	NormalizeEncoding    bool         `json:"normalize_encoding,omitempty"`
+}
+
+// The JSON representation of a scheme: its registered name, and its
+// parameters if it implements abstract.ParamScheme.
+type schemeJSON struct {
+	Name   string                 `json:"name"`
+	Params map[string]json.Number `json:"params,omitempty"`
+}
+
+var nulPolicyNames = map[NULPolicy]string{
+	AllowNUL:  "allow",
+	RejectNUL: "reject",
+}
+
+// Encodes the context's configuration as JSON, for example:
+//
+//   {
+//     "schemes": [
+//       {"name": "argon2id", "params": {"key_length": 32, "memory": 65536, "salt_length": 16, "threads": 4, "time": 3, "version": 19}},
+//       {"name": "bcrypt", "params": {"cost": 12}}
+//     ],
+//     "min_verify_duration": "250ms"
+//   }
+//
+// Schemes are recorded by their registered names (see RegisterScheme), with
+// their parameters where they implement abstract.ParamScheme. A scheme
+// which is not registered, such as one created with a custom cost, is
+// recorded under the registered name at the start of its String method's
+// result, e.g. "bcrypt" for "bcrypt(14)"; an error is returned if there is
+// none.
+//
+// Each scheme must be recreated exactly by UnmarshalJSON, so an error is
+// also returned for a scheme configured in ways its parameters do not
+// record, such as a bcrypt scheme with a TruncationPolicy, an scrypt scheme
+// with a custom encoding or legacy formats, an argon2 scheme with a secret,
+// or a scheme wrapped by WithVerifyTimeout.
+//
+// Secrets are never encoded: Pepper and Peppers are omitted, as are
+// SaltReader and DummyScheme. CurrentPepperID is included.
+func (ctx Context) MarshalJSON() ([]byte, error) {
+	cj := contextJSON{
+		NormalizePassword:    ctx.NormalizePassword,
+		MaxPasswordLength:    ctx.MaxPasswordLength,
+		MaxSecretSize:        ctx.MaxSecretSize,
+		FIPSOnly:             ctx.FIPSOnly,
+		ConstantTimeIdentify: ctx.ConstantTimeIdentify,
+		MinimumStrength:      ctx.MinimumStrength,
+		CurrentPepperID:      ctx.CurrentPepperID,
+		StrictUniformParams:  ctx.StrictUniformParams,
+		KeepHashWhitespace:   ctx.KeepHashWhitespace,
+		EmbedTimestamp:       ctx.EmbedTimestamp,
+		NormalizeEncoding:    ctx.NormalizeEncoding,
+	}
+
+	if ctx.MinVerifyDuration != 0 {
+		cj.MinVerifyDuration = ctx.MinVerifyDuration.String()
+	}
+
+	if ctx.NULPolicy != AllowNUL {
+		name, ok := nulPolicyNames[ctx.NULPolicy]
+		if !ok {
+			return nil, fmt.Errorf("unknown NUL policy %d", ctx.NULPolicy)
+		}
+		cj.NULPolicy = name
+	}
+
+	var err error
+	if cj.Schemes, err = marshalSchemes(ctx.Schemes); err != nil {
+		return nil, err
+	}
+	if cj.DeprecatedSchemes, err = marshalSchemes(ctx.DeprecatedSchemes); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(cj)
+}
+
+func marshalSchemes(schemes []abstract.Scheme) ([]schemeJSON, error) {
+	var result []schemeJSON
+	for _, scheme := range schemes {
+		sj, err := marshalScheme(scheme)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sj)
+	}
+	return result, nil
+}
+
+func marshalScheme(scheme abstract.Scheme) (schemeJSON, error) {
+	name := nameOfScheme(scheme)
+	if name == "" {
+		if s, ok := scheme.(fmt.Stringer); ok {
+			family := strings.SplitN(s.String(), "(", 2)[0]
+			if _, err := SchemeFromNameE(family); err == nil {
+				name = family
+			}
+		}
+	}
+
+	if name == "" {
+		return schemeJSON{}, fmt.Errorf("cannot encode unregistered scheme %s", schemeDisplayName(scheme))
+	}
+
+	sj := schemeJSON{Name: name}
+	if ps, ok := scheme.(abstract.ParamScheme); ok {
+		sj.Params = map[string]json.Number{}
+		for k, v := range ps.Params() {
+			sj.Params[k] = json.Number(v)
+		}
+	}
+
+	if decoded, err := unmarshalScheme(sj); err != nil || !sameScheme(scheme, decoded) {
+		return schemeJSON{}, fmt.Errorf("cannot encode scheme %s: its name and parameters do not record its whole configuration", schemeDisplayName(scheme))
+	}
+
+	return sj, nil
+}
+
+// Reports whether a and b are configured identically: of the same type, with
+// equal fields. Functions are equal if they are the same function, and
+// fields of sync and sync/atomic types, which hold only locks and caches, are
+// ignored.
+func sameScheme(a, b abstract.Scheme) bool {
+	return sameValue(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func sameValue(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return sameValue(a.Elem(), b.Elem())
+	case reflect.Array, reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			v := b.MapIndex(k)
+			if !v.IsValid() || !sameValue(a.MapIndex(k), v) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if pkg := a.Type().PkgPath(); pkg == "sync" || pkg == "sync/atomic" {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// Decodes a configuration encoded by MarshalJSON into the context. Schemes
+// are looked up by name in the registry, and given the recorded parameters;
+// parameters which are omitted keep the registered scheme's values.
+// Returns an *ErrUnknownScheme naming any scheme which is not registered.
+//
+// Fields which are not encoded, such as Pepper and Peppers, are left
+// unchanged, so that secrets can be loaded separately. All other fields are
+// replaced, and reset to their zero values if absent.
+func (ctx *Context) UnmarshalJSON(data []byte) error {
+	var cj contextJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+
+	schemes, err := unmarshalSchemes(cj.Schemes)
+	if err != nil {
+		return err
+	}
+
+	deprecatedSchemes, err := unmarshalSchemes(cj.DeprecatedSchemes)
+	if err != nil {
+		return err
+	}
+
+	var minVerifyDuration time.Duration
+	if cj.MinVerifyDuration != "" {
+		d, err := time.ParseDuration(cj.MinVerifyDuration)
+		if err != nil {
+			return fmt.Errorf("invalid min_verify_duration: %v", err)
+		}
+		minVerifyDuration = d
+	}
+
+	nulPolicy := AllowNUL
+	if cj.NULPolicy != "" {
+		found := false
+		for policy, name := range nulPolicyNames {
+			if name == cj.NULPolicy {
+				nulPolicy, found = policy, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown nul_policy %q", cj.NULPolicy)
+		}
+	}
+
+	ctx.Schemes = schemes
+	ctx.DeprecatedSchemes = deprecatedSchemes
+	ctx.MinVerifyDuration = minVerifyDuration
+	ctx.NormalizePassword = cj.NormalizePassword
+	ctx.MaxPasswordLength = cj.MaxPasswordLength
+	ctx.MaxSecretSize = cj.MaxSecretSize
+	ctx.NULPolicy = nulPolicy
+	ctx.FIPSOnly = cj.FIPSOnly
+	ctx.ConstantTimeIdentify = cj.ConstantTimeIdentify
+	ctx.MinimumStrength = cj.MinimumStrength
+	ctx.CurrentPepperID = cj.CurrentPepperID
+	ctx.StrictUniformParams = cj.StrictUniformParams
+	ctx.KeepHashWhitespace = cj.KeepHashWhitespace
+	ctx.EmbedTimestamp = cj.EmbedTimestamp
+	ctx.NormalizeEncoding = cj.NormalizeEncoding
+	return nil
+}
+
+func unmarshalSchemes(sjs []schemeJSON) ([]abstract.Scheme, error) {
+	var result []abstract.Scheme
+	for _, sj := range sjs {
+		scheme, err := unmarshalScheme(sj)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, scheme)
+	}
+	return result, nil
+}
+
+func unmarshalScheme(sj schemeJSON) (abstract.Scheme, error) {
+	scheme, err := SchemeFromNameE(sj.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sj.Params) == 0 {
+		return scheme, nil
+	}
+
+	ps, ok := scheme.(abstract.ParamScheme)
+	if !ok {
+		return nil, fmt.Errorf("scheme %q does not take parameters", sj.Name)
+	}
+
+	params := map[string]string{}
+	for k, v := range sj.Params {
+		params[k] = v.String()
+	}
+
+	scheme, err = ps.WithParams(params)
+	if err != nil {
+		return nil, fmt.Errorf("scheme %q: %v", sj.Name, err)
+	}
+
+	return scheme, nil
+}
@@ -0,0 +1,52 @@
+package passlib
+
+import (
+	"fmt"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// The cost of hashing one password with a context's preferred scheme, as
+// reported by PreferredCost.
+type Cost struct {
+	// The scheme's name, as Identify would report it.
+	Scheme string
+
+	abstract.Cost
+}
+
+// Indicates that the preferred scheme cannot report its cost, because it
+// does not implement abstract.Coster.
+var ErrCostUnknown = fmt.Errorf("scheme cannot estimate its cost")
+
+// Reports the cost of hashing a password with the preferred scheme, from its
+// configured parameters: the approximate peak memory, the number of threads,
+// the parameters governing the time taken, and the resulting strength (see
+// Strength), which serves as a rough class of CPU cost. This is computed
+// analytically, without hashing, so unlike the Calibrate functions of the
+// scheme packages it says nothing about how long a hash takes on this
+// machine; it is meant for sizing, e.g. a pool of n login workers needs
+// about n times Memory.
+//
+// Returns ErrNoHashingScheme if the context has no scheme for hashing, and
+// ErrCostUnknown if the preferred scheme does not implement abstract.Coster,
+// as for legacy schemes.
+func (ctx *Context) PreferredCost() (Cost, error) {
+	scheme, err := ctx.PreferredScheme()
+	if err != nil {
+		return Cost{}, err
+	}
+
+	c, ok := scheme.(abstract.Coster)
+	if !ok {
+		return Cost{}, ErrCostUnknown
+	}
+
+	return Cost{Scheme: schemeDisplayName(scheme), Cost: c.EstimateCost()}, nil
+}
+
+// Uses the default context to report the cost of hashing a password. See
+// Context.PreferredCost.
+func PreferredCost() (Cost, error) {
+	return DefaultContext.PreferredCost()
+}
@@ -3,12 +3,26 @@ package passlib
 import (
 	"fmt"
 	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/apr1"
 	"github.com/al45tair/passlib/hash/argon2"
+	argon2raw "github.com/al45tair/passlib/hash/argon2/raw"
+	"github.com/al45tair/passlib/hash/balloon"
 	"github.com/al45tair/passlib/hash/bcrypt"
 	"github.com/al45tair/passlib/hash/bcryptsha256"
+	"github.com/al45tair/passlib/hash/bcryptsha512"
+	"github.com/al45tair/passlib/hash/descrypt"
+	"github.com/al45tair/passlib/hash/ldap"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/mysql"
+	"github.com/al45tair/passlib/hash/nthash"
 	"github.com/al45tair/passlib/hash/pbkdf2"
+	"github.com/al45tair/passlib/hash/phpass"
 	"github.com/al45tair/passlib/hash/scrypt"
+	"github.com/al45tair/passlib/hash/sha1crypt"
 	"github.com/al45tair/passlib/hash/sha2crypt"
+	"github.com/al45tair/passlib/hash/yescrypt"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -16,10 +30,19 @@ import (
 // scrypt-sha256. It is now obsolete.
 const Defaults20160922 = "20160922"
 
-// This is the most up-to-date set of defaults preferred by passlib. It prefers
-// Argon2i. You must opt into it by calling UseDefaults at startup.
+// This set of defaults prefers Argon2i. It is now obsolete.
 const Defaults20180601 = "20180601"
 
+// This set of defaults prefers Argon2id with the parameters of the Argon2i
+// defaults. It is now obsolete.
+const Defaults20201015 = "20201015"
+
+// This is the most up-to-date set of defaults preferred by passlib. It prefers
+// Argon2id with 19 MiB of memory, 2 iterations and 1 lane, as currently
+// recommended by OWASP; hashes using other schemes are upgraded on successful
+// verification. You must opt into it by calling UseDefaults at startup.
+const Defaults20240101 = "20240101"
+
 // This value, when passed to UseDefaults, causes passlib to always use the
 // very latest set of defaults. DO NOT use this unless you are sure that
 // opportunistic hash upgrades will not cause breakage for your application
@@ -28,33 +51,194 @@ const DefaultsLatest = "latest"
 
 // Scheme names
 var schemes = map[string]abstract.Scheme{
-	"argon2":        argon2.Crypter,
-	"scrypt-sha256": scrypt.SHA256Crypter,
-	"sha256-crypt":  sha2crypt.Crypter256,
-	"sha512-crypt":  sha2crypt.Crypter512,
-	"bcrypt":        bcrypt.Crypter,
-	"bcrypt-sha256": bcryptsha256.Crypter,
-	"pbkdf2-sha256": pbkdf2.SHA256Crypter,
-	"pbkdf2-sha512": pbkdf2.SHA512Crypter,
-	"pbkdr2-sha1":   pbkdf2.SHA1Crypter,
-}
-
-// Convert a scheme name into a scheme
+	"argon2":               argon2.Crypter,
+	"argon2id":             argon2.IDCrypter,
+	"argon2id-20240101":    argon2ID20240101,
+	"scrypt-sha256":        scrypt.SHA256Crypter,
+	"sha256-crypt":         sha2crypt.Crypter256,
+	"sha512-crypt":         sha2crypt.Crypter512,
+	"bcrypt":               bcrypt.Crypter,
+	"bcrypt-sha256":        bcryptsha256.Crypter,
+	"bcrypt-sha512":        bcryptsha512.Crypter,
+	"pbkdf2-sha224":        pbkdf2.SHA224Crypter,
+	"pbkdf2-sha256":        pbkdf2.SHA256Crypter,
+	"pbkdf2-sha384":        pbkdf2.SHA384Crypter,
+	"pbkdf2-sha512":        pbkdf2.SHA512Crypter,
+	"pbkdf2-sha3-256":      pbkdf2.SHA3_256Crypter,
+	"pbkdf2-sha3-512":      pbkdf2.SHA3_512Crypter,
+	"pbkdf2-sha1":          pbkdf2.SHA1Crypter,
+	"pbkdr2-sha1":          pbkdf2.SHA1Crypter, // misspelt; kept for compatibility
+	"django-pbkdf2-sha256": pbkdf2.DjangoSHA256Crypter,
+	"md5-crypt":            md5crypt.Crypter,
+	"sha1-crypt":           sha1crypt.Crypter,
+	"des-crypt":            descrypt.Crypter,
+	"bsdi-crypt":           descrypt.BSDiCrypter,
+	"phpass":               phpass.Crypter,
+	"apr1":                 apr1.Crypter,
+	"nthash":               nthash.Crypter,
+	"ldap-ssha":            ldap.SSHACrypter,
+	"ldap-sha":             ldap.SHACrypter,
+	"mysql41":              mysql.Crypter,
+	"yescrypt":             yescrypt.Crypter,
+	"balloon":              balloon.Crypter,
+}
+
+// Guards schemes.
+var schemesMutex sync.RWMutex
+
+// Registers a scheme under the given name, so that it can be found by
+// SchemeFromName, SchemesFromNames and UseDefaultSchemes. Returns an error if
+// the name is empty or already registered; to replace a scheme, including a
+// built-in one, use ReplaceScheme.
+//
+// RegisterScheme is safe to call concurrently, and from init functions.
+func RegisterScheme(name string, scheme abstract.Scheme) error {
+	if name == "" {
+		return fmt.Errorf("scheme name must not be empty")
+	}
+
+	if scheme == nil {
+		return fmt.Errorf("cannot register nil scheme %q", name)
+	}
+
+	schemesMutex.Lock()
+	defer schemesMutex.Unlock()
+
+	if _, ok := schemes[name]; ok {
+		return fmt.Errorf("scheme %q is already registered", name)
+	}
+
+	schemes[name] = scheme
+	return nil
+}
+
+// Removes the scheme registered under the given name, so that SchemeFromName,
+// SchemesFromNames and configuration referring to it fail with an
+// *ErrUnknownScheme rather than silently using it. Returns an
+// *ErrUnknownScheme if no scheme is registered under the name. Only the
+// name is removed: a scheme registered under several names, such as
+// pbkdf2-sha1, remains available under the others.
+//
+// This mutates global state, and is meant for enforcing policy at init
+// time, e.g. to disable bcrypt throughout a hardened build. It does not
+// affect DefaultSchemes, LegacySchemes or contexts which already hold the
+// scheme; remove it from those explicitly.
+func UnregisterScheme(name string) error {
+	schemesMutex.Lock()
+	defer schemesMutex.Unlock()
+
+	if _, ok := schemes[name]; !ok {
+		return &ErrUnknownScheme{Name: name}
+	}
+
+	delete(schemes, name)
+	return nil
+}
+
+// Replaces the scheme registered under the given name, which may be a
+// built-in one, so that lookups by name return scheme instead. Returns an
+// *ErrUnknownScheme if no scheme is registered under the name; use
+// RegisterScheme to add a new one.
+//
+// As with UnregisterScheme, this mutates global state and is meant for use
+// at init time, and it does not affect DefaultSchemes or existing contexts.
+func ReplaceScheme(name string, scheme abstract.Scheme) error {
+	if scheme == nil {
+		return fmt.Errorf("cannot register nil scheme %q", name)
+	}
+
+	schemesMutex.Lock()
+	defer schemesMutex.Unlock()
+
+	if _, ok := schemes[name]; !ok {
+		return &ErrUnknownScheme{Name: name}
+	}
+
+	schemes[name] = scheme
+	return nil
+}
+
+// Returns the names of all registered schemes, sorted.
+func SchemeNames() []string {
+	schemesMutex.RLock()
+	defer schemesMutex.RUnlock()
+
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Returns the registered scheme which supports hash, trying schemes in order
+// of name, or nil if there is none.
+func registeredScheme(hash string) abstract.Scheme {
+	for _, name := range SchemeNames() {
+		if scheme := SchemeFromName(name); scheme != nil && scheme.SupportsStub(hash) {
+			return scheme
+		}
+	}
+
+	return nil
+}
+
+// Indicates that no scheme is registered under the given name.
+type ErrUnknownScheme struct {
+	Name string
+}
+
+func (e *ErrUnknownScheme) Error() string {
+	return fmt.Sprintf("unknown scheme %q", e.Name)
+}
+
+// Convert a scheme name into a scheme, returning nil if the name is unknown.
+// See SchemeFromNameE.
 func SchemeFromName(schemeName string) abstract.Scheme {
+	scheme, _ := SchemeFromNameE(schemeName)
+	return scheme
+}
+
+// Convert a scheme name into a scheme, returning an *ErrUnknownScheme if the
+// name is unknown.
+func SchemeFromNameE(schemeName string) (abstract.Scheme, error) {
+	schemesMutex.RLock()
+	defer schemesMutex.RUnlock()
+
 	scheme, ok := schemes[schemeName]
 	if !ok {
-		return nil
+		return nil, &ErrUnknownScheme{Name: schemeName}
 	}
-	return scheme
+	return scheme, nil
+}
+
+// Returns the registered name of a scheme, or "" if it is not registered.
+// If a scheme is registered under several names, the first in lexical
+// order is returned.
+func nameOfScheme(scheme abstract.Scheme) string {
+	schemesMutex.RLock()
+	defer schemesMutex.RUnlock()
+
+	name := ""
+	for n, s := range schemes {
+		if s == scheme && (name == "" || n < name) {
+			name = n
+		}
+	}
+	return name
 }
 
 // Convert a list of scheme names into a list of schemes
 func SchemesFromNames(schemeNames []string) ([]abstract.Scheme, error) {
+	schemesMutex.RLock()
+	defer schemesMutex.RUnlock()
+
 	result := make([]abstract.Scheme, len(schemeNames))
 	for n, schemeName := range schemeNames {
 		scheme, ok := schemes[schemeName]
 		if !ok {
-			return nil, fmt.Errorf("unknown scheme %q", schemeName)
+			return nil, &ErrUnknownScheme{Name: schemeName}
 		}
 		result[n] = scheme
 	}
@@ -87,6 +271,61 @@ var defaultSchemes20180601 = []abstract.Scheme{
 	pbkdf2.SHA1Crypter,
 }
 
+// Default schemes as of 2020-10-15.
+var defaultSchemes20201015 = []abstract.Scheme{
+	argon2.IDCrypter,
+	argon2.Crypter,
+	scrypt.SHA256Crypter,
+	sha2crypt.Crypter512,
+	sha2crypt.Crypter256,
+	bcryptsha256.Crypter,
+	pbkdf2.SHA512Crypter,
+	pbkdf2.SHA256Crypter,
+	bcrypt.Crypter,
+	pbkdf2.SHA1Crypter,
+}
+
+// Argon2id with m=19456 (19 MiB), t=2 and p=1, as preferred by
+// Defaults20240101. It handles all argon2id hashes, whatever their
+// parameters.
+var argon2ID20240101 = argon2.NewID(2, 19*1024, 1, argon2raw.RecommendedKeyLength)
+
+// Default schemes as of 2024-01-01. Argon2id uses argon2ID20240101; the
+// remaining schemes are those of 2020-10-15, kept so that existing hashes can
+// still be verified (and upgraded). argon2.IDCrypter is omitted, as
+// argon2ID20240101 claims its hashes.
+var defaultSchemes20240101 = []abstract.Scheme{
+	argon2ID20240101,
+	argon2.Crypter,
+	scrypt.SHA256Crypter,
+	sha2crypt.Crypter512,
+	sha2crypt.Crypter256,
+	bcryptsha256.Crypter,
+	pbkdf2.SHA512Crypter,
+	pbkdf2.SHA256Crypter,
+	bcrypt.Crypter,
+	pbkdf2.SHA1Crypter,
+}
+
+// Weak schemes which are never part of the defaults, but which can be
+// appended to a context's schemes to verify (and upgrade) legacy hashes, or
+// placed first where interoperability requires them, e.g. for writing
+// htpasswd files with apr1.
+//
+// As with DefaultSchemes, do not mutate the array this slice points to.
+var LegacySchemes = []abstract.Scheme{
+	apr1.Crypter,
+	md5crypt.Crypter,
+	sha1crypt.Crypter,
+	phpass.Crypter,
+	descrypt.BSDiCrypter,
+	descrypt.Crypter,
+	nthash.Crypter,
+	ldap.SSHACrypter,
+	ldap.SHACrypter,
+	mysql.Crypter,
+}
+
 // The default schemes, most preferred first. The first scheme will be used to
 // hash passwords, and any of the schemes may be used to verify existing
 // passwords. The contents of this value may change with subsequent releases.
@@ -123,8 +362,8 @@ func UseDefaults(date string) error {
 
 // Return the schemes corresponding to the specified date string
 func DefaultSchemesFromDate(date string) ([]abstract.Scheme, error) {
-	if date == "latest" {
-		return defaultSchemes20180601, nil
+	if date == DefaultsLatest {
+		return defaultSchemes20240101, nil
 	}
 
 	t, err := time.ParseInLocation("20060102", date, time.UTC)
@@ -132,6 +371,14 @@ func DefaultSchemesFromDate(date string) ([]abstract.Scheme, error) {
 		return nil, fmt.Errorf("invalid time string passed to passlib.UseDefaults: %q", date)
 	}
 
+	if !t.Before(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		return defaultSchemes20240101, nil
+	}
+
+	if !t.Before(time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC)) {
+		return defaultSchemes20201015, nil
+	}
+
 	if !t.Before(time.Date(2016, 9, 22, 0, 0, 0, 0, time.UTC)) {
 		return defaultSchemes20180601, nil
 	}
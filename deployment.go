@@ -0,0 +1,64 @@
+package passlib
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Reported by ValidateDeployment when a scheme is configured to hash with
+// more threads than there are CPUs, as when argon2 with p=8 is deployed on a
+// single-core container. The extra lanes are still recorded in new hashes,
+// and so must still be computed, but they run one after another and add no
+// security over a smaller degree of parallelism with more memory or passes.
+type ErrExcessParallelism struct {
+	// The scheme's name, as Identify would report it.
+	Scheme string
+
+	// The number of threads the scheme hashes with.
+	Threads int
+
+	// The number of CPUs available, from runtime.NumCPU.
+	CPUs int
+}
+
+func (e *ErrExcessParallelism) Error() string {
+	return fmt.Sprintf("%s hashes with %d threads, but only %d CPUs are available", e.Scheme, e.Threads, e.CPUs)
+}
+
+// Checks the context's schemes for configuration which is valid but unsuited
+// to the machine it is running on, and returns a diagnostic for each problem
+// found, for the caller to log; currently, these are *ErrExcessParallelism.
+// None of them stop the context from working, and hashes are computed exactly
+// as they would be otherwise.
+//
+// Only schemes implementing abstract.Coster are checked. Call this once at
+// startup, after configuring the context.
+func (ctx *Context) ValidateDeployment() []error {
+	var diagnostics []error
+
+	cpus := runtime.NumCPU()
+	for _, scheme := range ctx.schemes() {
+		c, ok := scheme.(abstract.Coster)
+		if !ok {
+			continue
+		}
+
+		if threads := c.EstimateCost().Threads; threads > cpus {
+			diagnostics = append(diagnostics, &ErrExcessParallelism{
+				Scheme:  schemeDisplayName(scheme),
+				Threads: threads,
+				CPUs:    cpus,
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// Uses the default context to check for configuration unsuited to this
+// machine. See Context.ValidateDeployment.
+func ValidateDeployment() []error {
+	return DefaultContext.ValidateDeployment()
+}
@@ -0,0 +1,125 @@
+package passlib
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// A decoy hash, and the scheme which made it.
+type dummyCache struct {
+	scheme abstract.Scheme
+	hash   string
+}
+
+// Returns the context's decoy hash, made with scheme. It is generated on
+// first use, and again whenever scheme changes; a scheme configured the same
+// way (see sameScheme) reuses the decoy, so the cache never holds more than
+// one hash.
+func (ctx *Context) dummyHash(scheme abstract.Scheme) (string, error) {
+	if c, ok := ctx.dummy.Load().(*dummyCache); ok && sameScheme(c.scheme, scheme) {
+		return c.hash, nil
+	}
+
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := scheme.Hash(base64.RawStdEncoding.EncodeToString(buf))
+	if err != nil {
+		return "", err
+	}
+
+	ctx.dummy.Store(&dummyCache{scheme: scheme, hash: hash})
+	return hash, nil
+}
+
+// Performs a verification of password against a decoy hash, taking about as
+// long as a real verification using the context's DummyScheme (or preferred
+// scheme). Call this when there is no hash to verify against, for example
+// because a user does not exist, so that attackers cannot use timing to tell
+// that apart from a wrong password.
+//
+// The decoy hash is generated the first time it is needed and cached in the
+// context (see DummyHash), so the first call takes about twice as long. The result of the
+// verification is discarded; it is padded to MinVerifyDuration if that is
+// set.
+func (ctx *Context) VerifyDummy(password string) {
+	start := time.Now()
+
+	scheme := ctx.dummyScheme()
+	if scheme != nil {
+		if hash, err := ctx.dummyHash(scheme); err == nil {
+			scheme.Verify(password, hash)
+		}
+	}
+
+	ctx.pad(start)
+}
+
+// Returns a decoy hash of a random password, made with the context's
+// DummyScheme (or preferred scheme), for login handlers which prefer to call
+// Verify on every code path:
+//
+//   hash, ok := lookupUser(username)
+//   if !ok {
+//     hash, _ = ctx.DummyHash()
+//   }
+//   newHash, err := ctx.Verify(password, hash)
+//
+// Verifying against the decoy runs the same scheme, with the same
+// parameters, as verifying a real hash, so it takes about as long, and
+// attackers cannot use timing to tell a missing user from a wrong password.
+// It always fails, and so is padded to MinVerifyDuration if that is set,
+// which also hides any remaining difference such as pepper handling. No
+// password can verify against it, since the password is random and
+// discarded.
+//
+// The decoy is generated on the first call and cached in the context, so
+// later calls are cheap; call it at startup to keep the first login fast.
+// Changing DummyScheme, or the preferred scheme, generates a new one. Two
+// first calls at once may each generate a decoy; either is as good.
+// See also VerifyDummy.
+func (ctx *Context) DummyHash() (string, error) {
+	scheme := ctx.dummyScheme()
+	if scheme == nil {
+		return "", ErrNoHashingScheme
+	}
+
+	return ctx.dummyHash(scheme)
+}
+
+// Returns the scheme used for decoy hashes, or nil if there is none.
+func (ctx *Context) dummyScheme() abstract.Scheme {
+	if ctx.DummyScheme != nil {
+		return ctx.DummyScheme
+	}
+
+	if schemes := ctx.schemes(); len(schemes) != 0 {
+		return schemes[0]
+	}
+
+	return nil
+}
+
+// Sleeps until at least MinVerifyDuration has passed since start.
+func (ctx *Context) pad(start time.Time) {
+	if d := ctx.MinVerifyDuration - time.Since(start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Uses the default context to perform a dummy verification. See
+// Context.VerifyDummy.
+func VerifyDummy(password string) {
+	DefaultContext.VerifyDummy(password)
+}
+
+// Returns a decoy hash using the default context. See Context.DummyHash.
+func DummyHash() (string, error) {
+	return DefaultContext.DummyHash()
+}
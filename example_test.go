@@ -1,5 +1,13 @@
 package passlib
 
+import (
+	"fmt"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/sha2crypt"
+)
+
 // User signup example.
 func ExampleHash_signup() {
 	// User signup example.
@@ -49,6 +57,79 @@ func ExampleVerify_login() {
 	// ... log the user in ...
 }
 
+// Lazy migration example, moving a table of md5-crypt hashes to
+// sha512-crypt as each user logs in.
+func ExampleContext_UpgradeOnVerify() {
+	sha512crypt, err := sha2crypt.NewCrypter512(5000)
+	if err != nil {
+		// rounds outside the range sha512-crypt allows
+		return
+	}
+
+	ctx := &Context{
+		Schemes:           []abstract.Scheme{sha512crypt},
+		DeprecatedSchemes: []abstract.Scheme{md5crypt.Crypter},
+	}
+
+	// The user table, keyed by user ID.
+	users := map[int]string{
+		1: "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1", // U*U*U*U*
+		2: "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1",
+	}
+
+	// Replaces a user's hash only if it is still oldHash, as
+	// "UPDATE users SET hash = ? WHERE id = ? AND hash = ?" would.
+	storeIfUnchanged := func(id int, oldHash, newHash string) bool {
+		if users[id] != oldHash {
+			return false
+		}
+		users[id] = newHash
+		return true
+	}
+
+	login := func(id int, password string) bool {
+		oldHash := users[id]
+
+		newHash, changed, err := ctx.UpgradeOnVerify(password, oldHash)
+		if err != nil {
+			// Wrong password or unusable hash: store nothing.
+			return false
+		}
+
+		// Only now is it safe to store the new hash. If this fails, the
+		// user can still log in with the old one, and is upgraded next time.
+		if changed {
+			storeIfUnchanged(id, oldHash, newHash)
+		}
+
+		return true
+	}
+
+	// Counts the hashes still to be migrated.
+	remaining := func() int {
+		n := 0
+		for _, hash := range users {
+			if needsUpdate, _ := ctx.NeedsUpdate(hash); needsUpdate {
+				n++
+			}
+		}
+		return n
+	}
+
+	fmt.Println("remaining:", remaining())
+	fmt.Println("user 1, wrong password:", login(1, "wrong"), "remaining:", remaining())
+	fmt.Println("user 1:", login(1, "U*U*U*U*"), "remaining:", remaining())
+	fmt.Println("user 1 again:", login(1, "U*U*U*U*"), "remaining:", remaining())
+	fmt.Println("user 2:", login(2, "U*U*U*U*"), "remaining:", remaining())
+
+	// Output:
+	// remaining: 2
+	// user 1, wrong password: false remaining: 2
+	// user 1: true remaining: 1
+	// user 1 again: true remaining: 1
+	// user 2: true remaining: 0
+}
+
 // These are dummy functions for the benefit of the examples.
 
 func getSignupUsername() string {
@@ -0,0 +1,60 @@
+package passlib
+
+import (
+	"fmt"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/pbkdf2"
+)
+
+// Schemes using only FIPS-approved primitives (PBKDF2 with SHA-2), most
+// preferred first. These are used by contexts with FIPSOnly set and no
+// Schemes of their own.
+//
+// NIST SP 800-132 requires a salt of at least 128 bits, which these schemes
+// use, and at least 1,000 iterations, recommending as many as is practical.
+// The built-in crypters use RecommendedRoundsSHA512 and so on; for new
+// deployments, consider schemes created with pbkdf2.NewSHA512 using at least
+// pbkdf2.OWASPMinRoundsSHA512 iterations instead.
+//
+// As with DefaultSchemes, do not mutate the array this slice points to.
+var DefaultSchemesFIPS = []abstract.Scheme{
+	pbkdf2.SHA512Crypter,
+	pbkdf2.SHA384Crypter,
+	pbkdf2.SHA256Crypter,
+}
+
+// Indicates that a context with FIPSOnly set was asked to hash with, or to
+// verify a hash made by, a scheme which is not FIPS-approved.
+type ErrNotFIPSApproved struct {
+	Name string
+}
+
+func (e *ErrNotFIPSApproved) Error() string {
+	return fmt.Sprintf("scheme %q is not FIPS-approved", e.Name)
+}
+
+// Returns a context which uses DefaultSchemesFIPS and only FIPS-approved
+// schemes.
+func NewFIPSContext() *Context {
+	return &Context{
+		Schemes:  DefaultSchemesFIPS,
+		FIPSOnly: true,
+	}
+}
+
+// Returns true iff scheme reports that it is FIPS-approved.
+func fipsApproved(scheme abstract.Scheme) bool {
+	fs, ok := scheme.(abstract.FIPSScheme)
+	return ok && fs.FIPSApproved()
+}
+
+// Returns an *ErrNotFIPSApproved if the context is restricted to
+// FIPS-approved schemes and scheme is not one.
+func (ctx *Context) checkFIPS(scheme abstract.Scheme) error {
+	if !ctx.FIPSOnly || fipsApproved(scheme) {
+		return nil
+	}
+
+	return &ErrNotFIPSApproved{Name: schemeDisplayName(scheme)}
+}
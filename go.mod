@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
+	golang.org/x/text v0.3.0
 	gopkg.in/hlandau/easymetric.v1 v1.0.0
 	gopkg.in/hlandau/measurable.v1 v1.0.1 // indirect
 )
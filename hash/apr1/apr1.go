@@ -0,0 +1,121 @@
+// Package apr1 implements Apache's apr1 variant of md5-crypt, as used in
+// .htpasswd files.
+//
+// apr1 is weak and should be used only where compatibility with Apache
+// requires it. It is not included in passlib's default schemes; see
+// passlib.LegacySchemes.
+package apr1
+
+import "expvar"
+import "fmt"
+import "math"
+import "strings"
+import "crypto/rand"
+import "io"
+import "github.com/al45tair/passlib/hash/md5crypt/raw"
+import "github.com/al45tair/passlib/abstract"
+
+var cAPR1HashCalls = expvar.NewInt("passlib.apr1.hashCalls")
+var cAPR1VerifyCalls = expvar.NewInt("passlib.apr1.verifyCalls")
+
+// An implementation of Scheme performing apr1-md5.
+//
+// WARNING: apr1 should not be used for new applications other than for
+// interoperability with Apache.
+var Crypter abstract.Scheme
+
+// Indicates that a user name cannot be represented in an htpasswd file.
+var ErrInvalidUser = fmt.Errorf("invalid htpasswd user name")
+
+func init() {
+	Crypter = &apr1Crypter{}
+}
+
+// Formats a user name and a hash as a line of an htpasswd file, without a
+// trailing newline. The user name must not be empty or contain a colon or
+// line break.
+func HtpasswdLine(user, hash string) (string, error) {
+	if user == "" || strings.ContainsAny(user, ":\r\n") {
+		return "", ErrInvalidUser
+	}
+
+	return user + ":" + hash, nil
+}
+
+type apr1Crypter struct{}
+
+func (c *apr1Crypter) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, "$apr1$")
+}
+
+func (c *apr1Crypter) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *apr1Crypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	cAPR1HashCalls.Add(1)
+
+	buf := make([]byte, 6)
+	_, err := io.ReadFull(saltReader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	salt := raw.EncodeBase64(buf)
+
+	return raw.CryptAPR1(string(password), salt), nil
+}
+
+func (c *apr1Crypter) Verify(password, hash string) error {
+	cAPR1VerifyCalls.Add(1)
+
+	salt, oldHash, err := raw.ParseAPR1(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, raw.CryptAPR1(password, salt)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// apr1 has no parameters, so a hash never needs updating to match the
+// scheme. Contexts still upgrade apr1 hashes, as the scheme is deprecated.
+func (c *apr1Crypter) NeedsUpdate(stub string) bool {
+	return false
+}
+
+// apr1 is an MD5 construction, and is deprecated like md5-crypt; it is
+// supported for htpasswd files, which verify without upgrading.
+func (c *apr1Crypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *apr1Crypter) ReadParams(hash string) (map[string]string, error) {
+	if _, _, err := raw.ParseAPR1(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// Like md5-crypt, every apr1 hash takes 1,000 rounds of MD5, so has a
+// strength of about 10 bits.
+func (c *apr1Crypter) Strength(hash string) (float64, error) {
+	if _, _, err := raw.ParseAPR1(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(1000), nil
+}
+
+func (c *apr1Crypter) String() string {
+	return "apr1"
+}
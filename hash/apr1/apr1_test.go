@@ -0,0 +1,33 @@
+package apr1
+
+import "testing"
+
+func TestApr1(t *testing.T) {
+	if err := Crypter.Verify("myPassword", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"); err != nil {
+		t.Fatalf("err verifying htpasswd hash: %v", err)
+	}
+
+	h, err := Crypter.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if err := Crypter.Verify("password", h); err != nil {
+		t.Fatalf("err verifying %q: %v", h, err)
+	}
+	if err := Crypter.Verify("password2", h); err == nil {
+		t.Fatalf("got nil error with wrong password")
+	}
+}
+
+func TestHtpasswdLine(t *testing.T) {
+	l, err := HtpasswdLine("alice", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/")
+	if err != nil || l != "alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/" {
+		t.Fatalf("unexpected result: %q, %v", l, err)
+	}
+
+	for _, user := range []string{"", "a:b", "a\nb"} {
+		if _, err := HtpasswdLine(user, "x"); err != ErrInvalidUser {
+			t.Errorf("expected ErrInvalidUser for %q, got %v", user, err)
+		}
+	}
+}
@@ -1,62 +1,267 @@
-// Package argon2 implements the argon2 password hashing mechanism, wrapped in
-// the argon2 encoded format.
+// Package argon2 implements the argon2i and argon2id password hashing
+// mechanisms, wrapped in the argon2 encoded format.
 package argon2
 
 import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"math"
 	"strings"
 
-	"golang.org/x/crypto/argon2"
 	"github.com/al45tair/passlib/abstract"
 	"github.com/al45tair/passlib/hash/argon2/raw"
 )
 
-// An implementation of Scheme performing argon2 hashing.
+// An implementation of Scheme performing argon2i hashing.
 //
-// Uses the recommended values for time, memory and threads defined in raw.
+// Uses the recommended values for time, memory, threads and key length
+// defined in raw.
+//
+// Its NeedsUpdate judges argon2i hashes by their parameters alone. To migrate
+// argon2i hashes to argon2id, list IDCrypter before it, e.g. by putting it in
+// a context's DeprecatedSchemes.
 var Crypter abstract.Scheme
 
-const saltLength = 16
+// An implementation of Scheme performing argon2id hashing.
+//
+// Uses the recommended values for time, memory, threads and key length
+// defined in raw.
+var IDCrypter abstract.Scheme
 
 func init() {
 	Crypter = New(
 		raw.RecommendedTime,
 		raw.RecommendedMemory,
 		raw.RecommendedThreads,
+		raw.RecommendedKeyLength,
+	)
+	IDCrypter = NewID(
+		raw.RecommendedTime,
+		raw.RecommendedMemory,
+		raw.RecommendedThreads,
+		raw.RecommendedKeyLength,
 	)
 }
 
-// Returns an implementation of Scheme implementing argon2
+// Returns an implementation of Scheme implementing argon2i
 // with the specified parameters.
-func New(time, memory uint32, threads uint8) abstract.Scheme {
+//
+// The parameters are used only when hashing new passwords; existing hashes
+// are verified using the parameters encoded in them. If the parameters are
+// invalid (see raw.CheckParams), Hash returns a descriptive error.
+func New(time, memory uint32, threads uint8, keyLen uint32) abstract.Scheme {
 	return &scheme{
+		version: raw.Version13,
 		time:    time,
 		memory:  memory,
 		threads: threads,
+		keyLen:  keyLen,
+		saltLen: raw.RecommendedSaltLength,
+	}
+}
+
+// Returns an implementation of Scheme implementing argon2id
+// with the specified parameters. See New.
+func NewID(time, memory uint32, threads uint8, keyLen uint32) abstract.Scheme {
+	return &scheme{
+		id:      true,
+		version: raw.Version13,
+		time:    time,
+		memory:  memory,
+		threads: threads,
+		keyLen:  keyLen,
+		saltLen: raw.RecommendedSaltLength,
+	}
+}
+
+// Like New, but new hashes are computed with, and tagged as, the given
+// argon2 version, for interoperating with implementations pinned to
+// raw.Version10. Returns an error unless version is raw.Version10 or
+// raw.Version13.
+//
+// Verify always uses the version recorded in the stored hash.
+func NewWithVersion(version int, time, memory uint32, threads uint8, keyLen uint32) (abstract.Scheme, error) {
+	if err := raw.CheckVersion(version); err != nil {
+		return nil, err
+	}
+
+	s := New(time, memory, threads, keyLen).(*scheme)
+	s.version = version
+	return s, nil
+}
+
+// Like NewID, but with the given argon2 version. See NewWithVersion.
+func NewIDWithVersion(version int, time, memory uint32, threads uint8, keyLen uint32) (abstract.Scheme, error) {
+	if err := raw.CheckVersion(version); err != nil {
+		return nil, err
+	}
+
+	s := NewID(time, memory, threads, keyLen).(*scheme)
+	s.version = version
+	return s, nil
+}
+
+// Returns a copy of s, which must be an argon2i or argon2id scheme from this
+// package, which generates salts of saltLen bytes for new hashes rather than
+// raw.RecommendedSaltLength. saltLen must be between raw.MinimumSaltLength and
+// raw.MaxSaltLength. Verify uses whatever salt the stored hash records, and
+// NeedsUpdate reports hashes with shorter salts.
+//
+// The salt length is also available as the "salt_length" parameter (see
+// abstract.ParamScheme).
+func WithSaltLength(s abstract.Scheme, saltLen int) (abstract.Scheme, error) {
+	c, ok := s.(*scheme)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an argon2 scheme", s)
+	}
+
+	if err := checkSaltLength(saltLen); err != nil {
+		return nil, err
+	}
+
+	n := *c
+	n.saltLen = saltLen
+	return &n, nil
+}
+
+// Returns a copy of s, which must be an argon2i or argon2id scheme from this
+// package, which mixes secret into every hash it makes or verifies as
+// argon2's secret value K.
+//
+// Like Context.Pepper, this means that a stolen password database cannot be
+// attacked without also stealing the secret, but it is applied by argon2
+// itself, as the argon2 specification intends. The secret is not recorded in
+// the hash, and hashes made with it will not verify without it (and vice
+// versa): they are reported as not matching the password. The secret is
+// copied, and is never included in Params.
+func WithSecret(s abstract.Scheme, secret []byte) (abstract.Scheme, error) {
+	c, ok := s.(*scheme)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an argon2 scheme", s)
 	}
+
+	n := *c
+	n.secret = append([]byte(nil), secret...)
+	return &n, nil
+}
+
+func checkSaltLength(saltLen int) error {
+	if saltLen < raw.MinimumSaltLength || saltLen > raw.MaxSaltLength {
+		return fmt.Errorf("argon2 salt length must be between %d and %d bytes, got %d", raw.MinimumSaltLength, raw.MaxSaltLength, saltLen)
+	}
+
+	return nil
 }
 
 type scheme struct {
+	id           bool
+	version      int
 	time, memory uint32
 	threads      uint8
+	keyLen       uint32
+	saltLen      int
+	secret       []byte
 }
 
 func (c *scheme) SetParams(time, memory uint32, threads uint8) error {
+	err := raw.CheckParams(time, memory, threads, c.keyLen)
+	if err != nil {
+		return err
+	}
+
 	c.time = time
 	c.memory = memory
 	c.threads = threads
 	return nil
 }
 
+func (c *scheme) Params() map[string]string {
+	return map[string]string{
+		"time":        fmt.Sprint(c.time),
+		"memory":      fmt.Sprint(c.memory),
+		"threads":     fmt.Sprint(c.threads),
+		"key_length":  fmt.Sprint(c.keyLen),
+		"salt_length": fmt.Sprint(c.saltLen),
+		"version":     fmt.Sprint(c.version),
+	}
+}
+
+func (c *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	time, memory, threads, keyLen, version := int(c.time), int(c.memory), int(c.threads), int(c.keyLen), c.version
+	saltLen := c.saltLen
+	err := abstract.ParseIntParams(params, map[string]*int{
+		"time":        &time,
+		"memory":      &memory,
+		"threads":     &threads,
+		"key_length":  &keyLen,
+		"salt_length": &saltLen,
+		"version":     &version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if threads > 255 {
+		return nil, fmt.Errorf("argon2 threads parameter must be at most 255, got %d", threads)
+	}
+
+	err = raw.CheckParams(uint32(time), uint32(memory), uint8(threads), uint32(keyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := raw.CheckVersion(version); err != nil {
+		return nil, err
+	}
+
+	if err := checkSaltLength(saltLen); err != nil {
+		return nil, err
+	}
+
+	return &scheme{
+		id:      c.id,
+		version: version,
+		time:    uint32(time),
+		memory:  uint32(memory),
+		threads: uint8(threads),
+		keyLen:  uint32(keyLen),
+		saltLen: saltLen,
+		secret:  c.secret,
+	}, nil
+}
+
 func (c *scheme) SupportsStub(stub string) bool {
-	return strings.HasPrefix(stub, "$argon2i$")
+	return strings.HasPrefix(stub, c.prefix())
+}
+
+func (c *scheme) prefix() string {
+	if c.id {
+		return "$argon2id$"
+	}
+
+	return "$argon2i$"
+}
+
+func (c *scheme) parse(stub string) (salt, hash []byte, version int, time, memory uint32, threads uint8, err error) {
+	if c.id {
+		return raw.ParseID(stub)
+	}
+
+	return raw.Parse(stub)
 }
 
 func (c *scheme) Hash(password string) (string, error) {
+	return c.HashBytes([]byte(password))
+}
 
-	stub, err := c.makeStub()
+func (c *scheme) HashBytes(password []byte) (string, error) {
+	return c.HashWithSaltReader(password, rand.Reader)
+}
+
+func (c *scheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	stub, err := c.makeStub(saltReader)
 	if err != nil {
 		return "", err
 	}
@@ -66,9 +271,21 @@ func (c *scheme) Hash(password string) (string, error) {
 }
 
 func (c *scheme) Verify(password, hash string) (err error) {
+	return c.VerifyBytes([]byte(password), hash)
+}
 
-	_, newHash, _, _, _, _, _, err := c.hash(password, hash)
-	if err == nil && !abstract.SecureCompare(hash, newHash) {
+func (c *scheme) VerifyBytes(password []byte, hash string) (err error) {
+	oldHashRaw, newHash, _, _, _, _, _, err := c.hash(password, hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if len(oldHashRaw) == 0 {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, newHash) {
 		err = abstract.ErrInvalidPassword
 	}
 
@@ -76,40 +293,182 @@ func (c *scheme) Verify(password, hash string) (err error) {
 }
 
 func (c *scheme) NeedsUpdate(stub string) bool {
-	salt, _, version, time, memory, threads, err := raw.Parse(stub)
+	salt, hash, version, time, memory, threads, err := c.parse(stub)
 	if err != nil {
 		return false // ...
 	}
 
-	return c.needsUpdate(salt, version, time, memory, threads)
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"version":     uint64(version),
+		"time":        uint64(time),
+		"memory":      uint64(memory),
+		"threads":     uint64(threads),
+	}
+	if len(hash) != 0 {
+		stored["key_length"] = uint64(len(hash))
+	}
+
+	return abstract.CompareParams(stored, c.target()) < 0
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	_, _, version, time, memory, threads, err := c.parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{
+		"version": fmt.Sprint(version),
+		"memory":  fmt.Sprint(memory),
+		"time":    fmt.Sprint(time),
+		"threads": fmt.Sprint(threads),
+	}, nil
 }
 
-func (c *scheme) needsUpdate(salt []byte, version int, time, memory uint32, threads uint8) bool {
-	return len(salt) < saltLength || version < argon2.Version || time < c.time || memory < c.memory || threads < c.threads
+func (c *scheme) SplitHash(hash string) (salt, digest []byte, params map[string]string, err error) {
+	salt, digest, version, time, memory, threads, err := c.parse(hash)
+	if err == nil && len(digest) == 0 {
+		err = raw.ErrInvalidStub
+	}
+	if err != nil {
+		return nil, nil, nil, abstract.InvalidHash(err)
+	}
+
+	return salt, digest, map[string]string{
+		"version": fmt.Sprint(version),
+		"memory":  fmt.Sprint(memory),
+		"time":    fmt.Sprint(time),
+		"threads": fmt.Sprint(threads),
+	}, nil
 }
 
-func (c *scheme) hash(password, stub string) (oldHashRaw []byte, newHash string, salt []byte, version int, memory, time uint32, threads uint8, err error) {
+func (c *scheme) JoinHash(salt, digest []byte, params map[string]string) (string, error) {
+	var version, memory, time, threads int
+	err := abstract.ParseAllIntParams(params, map[string]*int{
+		"version": &version,
+		"memory":  &memory,
+		"time":    &time,
+		"threads": &threads,
+	})
+	if err != nil {
+		return "", err
+	}
 
-	salt, oldHashRaw, version, time, memory, threads, err = raw.Parse(stub)
+	if threads > 255 || len(salt) == 0 || len(digest) == 0 {
+		return "", raw.ErrInvalidStub
+	}
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", c.prefix(), version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(digest)), nil
+}
+
+// argon2 fills memory KiB in each of time passes, and compressing a 1 KiB
+// block costs about 16 SHA-256 compressions, so the strength is
+// log2(time*memory) + 4. Memory hardness is ignored.
+func (c *scheme) Strength(hash string) (float64, error) {
+	_, _, _, time, memory, _, err := c.parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return strength(time, memory), nil
+}
+
+func strength(time, memory uint32) float64 {
+	return math.Log2(float64(time)*float64(memory)) + 4
+}
+
+func (c *scheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Memory:   uint64(c.memory) * 1024,
+		Threads:  int(c.threads),
+		Time:     map[string]uint64{"time": uint64(c.time), "memory": uint64(c.memory)},
+		Strength: strength(c.time, c.memory),
+	}
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (c *scheme) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": uint64(c.saltLen),
+		"key_length":  uint64(c.keyLen),
+		"version":     uint64(c.version),
+		"time":        uint64(c.time),
+		"memory":      uint64(c.memory),
+		"threads":     uint64(c.threads),
+	}
+}
+
+func (c *scheme) hash(password []byte, stub string) (oldHashRaw []byte, newHash string, salt []byte, version int, memory, time uint32, threads uint8, err error) {
+
+	salt, oldHashRaw, version, time, memory, threads, err = c.parse(stub)
 	if err != nil {
 		return
 	}
 
-	return oldHashRaw, raw.Argon2(password, salt, time, memory, threads), salt, version, memory, time, threads, nil
+	// Verify using the key length of the stored hash; new hashes use the
+	// configured key length.
+	keyLen := c.keyLen
+	if len(oldHashRaw) != 0 {
+		keyLen = uint32(len(oldHashRaw))
+	}
+
+	err = raw.CheckParams(time, memory, threads, keyLen)
+	if err != nil {
+		return
+	}
+
+	// Hash with the version the stub records, which for new hashes is the
+	// configured version.
+	err = raw.CheckVersion(version)
+	if err != nil {
+		return
+	}
+
+	if c.id {
+		newHash = raw.Argon2IDBytesSecret(password, salt, c.secret, version, time, memory, threads, keyLen)
+	} else {
+		newHash = raw.Argon2BytesSecret(password, salt, c.secret, version, time, memory, threads, keyLen)
+	}
+
+	return oldHashRaw, newHash, salt, version, memory, time, threads, nil
 }
 
-func (c *scheme) makeStub() (string, error) {
-	buf := make([]byte, saltLength)
-	_, err := rand.Read(buf)
+func (c *scheme) makeStub(saltReader io.Reader) (string, error) {
+	err := raw.CheckParams(c.time, c.memory, c.threads, c.keyLen)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, c.saltLen)
+	_, err = io.ReadFull(saltReader, buf)
 	if err != nil {
 		return "", err
 	}
 
 	salt := base64.RawStdEncoding.EncodeToString(buf)
 
-	return fmt.Sprintf("$argon2i$v=%d$m=%d,t=%d,p=%d$%s$", argon2.Version, c.memory, c.time, c.threads, salt), nil
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$", c.prefix(), c.version, c.memory, c.time, c.threads, salt), nil
+}
+
+func (c *scheme) Describe() string {
+	name := "argon2i"
+	if c.id {
+		name = "argon2id"
+	}
+
+	if c.version != raw.Version13 {
+		return fmt.Sprintf("%s(v=%d,t=%d,m=%d,p=%d)", name, c.version, c.time, c.memory, c.threads)
+	}
+
+	return fmt.Sprintf("%s(t=%d,m=%d,p=%d)", name, c.time, c.memory, c.threads)
 }
 
 func (c *scheme) String() string {
-	return fmt.Sprintf("argon2(%d,%d,%d,%d)", argon2.Version, c.memory, c.time, c.threads)
+	if c.id {
+		return fmt.Sprintf("argon2id(%d,%d,%d,%d)", c.version, c.memory, c.time, c.threads)
+	}
+
+	return fmt.Sprintf("argon2(%d,%d,%d,%d)", c.version, c.memory, c.time, c.threads)
 }
@@ -0,0 +1,111 @@
+package argon2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/argon2/raw"
+)
+
+// An argon2 variant.
+type Type int
+
+const (
+	TypeI  Type = iota // argon2i
+	TypeID             // argon2id
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeI:
+		return "argon2i"
+	case TypeID:
+		return "argon2id"
+	}
+
+	return fmt.Sprintf("argon2.Type(%d)", int(t))
+}
+
+// Indicates that the scheme only verifies existing hashes.
+var ErrHashNotSupported = fmt.Errorf("argon2 hashes without a type cannot be used for new hashes")
+
+// The prefix written by some encoders in place of $argon2i$ or $argon2id$.
+const barePrefix = "$argon2$"
+
+// Returns a verify-only scheme for hashes written by encoders which omit the
+// argon2 type, as in $argon2$v=19$m=...,t=...,p=...$salt$hash, which neither
+// Crypter nor IDCrypter will claim. Such hashes are verified as if they had
+// the given type; there is no way to tell which type was actually used, so
+// this is only for cleaning up legacy data whose origin is known.
+//
+// The scheme supports only hashes with the bare $argon2$ prefix, so that it
+// can be listed alongside the other argon2 schemes without claiming their
+// hashes. Hash always fails with ErrHashNotSupported, and NeedsUpdate always
+// returns true, so that hashes are replaced as soon as they are verified.
+func NewWithAssumedType(t Type) (abstract.Scheme, error) {
+	var s *scheme
+	switch t {
+	case TypeI:
+		s = Crypter.(*scheme)
+	case TypeID:
+		s = IDCrypter.(*scheme)
+	default:
+		return nil, fmt.Errorf("unknown argon2 type %v", t)
+	}
+
+	return &assumedType{scheme: s, t: t}, nil
+}
+
+type assumedType struct {
+	scheme *scheme
+	t      Type
+}
+
+// Returns hash with the bare prefix replaced by the assumed type's.
+func (a *assumedType) typed(hash string) (string, error) {
+	if !strings.HasPrefix(hash, barePrefix) {
+		return "", raw.ErrInvalidStub
+	}
+
+	return a.scheme.prefix() + hash[len(barePrefix):], nil
+}
+
+func (a *assumedType) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, barePrefix)
+}
+
+func (a *assumedType) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (a *assumedType) Verify(password, hash string) error {
+	return a.VerifyBytes([]byte(password), hash)
+}
+
+func (a *assumedType) VerifyBytes(password []byte, hash string) error {
+	typed, err := a.typed(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	return a.scheme.VerifyBytes(password, typed)
+}
+
+// Hashes without a type are always deprecated.
+func (a *assumedType) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (a *assumedType) ReadParams(hash string) (map[string]string, error) {
+	typed, err := a.typed(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return a.scheme.ReadParams(typed)
+}
+
+func (a *assumedType) String() string {
+	return fmt.Sprintf("argon2(assumed %v)", a.t)
+}
@@ -0,0 +1,112 @@
+package argon2
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/al45tair/passlib/hash/argon2/raw"
+)
+
+// The number of trials averaged for each measurement made by Calibrate.
+const calibrationTrials = 3
+
+// The fraction by which a measured duration may exceed the target and still
+// be considered a match by Calibrate.
+const calibrationTolerance = 0.1
+
+// Determines argon2 parameters which make hashing a password take roughly
+// target on the current machine, using no more than maxMemory KiB of memory.
+//
+// Memory is increased first, up to maxMemory, followed by the number of
+// passes. Each measurement hashes a password through the same code path as
+// Hash, averaged over several trials to smooth out scheduler noise. Calibrate
+// does not modify any global state and is safe to call at startup, but it
+// takes a multiple of target to run.
+//
+// The results are specific to the machine (and its load) at the time of the
+// call. Calibrate once, store the results in your configuration and pass them
+// to New or NewID, rather than recalibrating in every process; otherwise
+// every restart may change the parameters and cause needless rehashing.
+func Calibrate(target time.Duration, maxMemory uint32) (passes, memory uint32, threads uint8, err error) {
+	if target <= 0 {
+		err = fmt.Errorf("argon2 calibration target must be positive, got %v", target)
+		return
+	}
+
+	threads = raw.RecommendedThreads
+	minMemory := 8 * uint32(threads)
+	if maxMemory < minMemory {
+		err = fmt.Errorf("argon2 calibration needs at least %d KiB of memory, got %d KiB", minMemory, maxMemory)
+		return
+	}
+
+	passes, memory = 1, raw.RecommendedMemory
+	if memory > maxMemory {
+		memory = maxMemory
+	}
+
+	d, err := measure(passes, memory, threads)
+	if err != nil {
+		return
+	}
+
+	// Too slow even with a single pass; give up memory until we fit.
+	for d > target && memory/2 >= minMemory {
+		memory /= 2
+		if d, err = measure(passes, memory, threads); err != nil {
+			return
+		}
+	}
+
+	// Spend the memory budget first.
+	for d < target && memory <= maxMemory/2 {
+		memory *= 2
+		if d, err = measure(passes, memory, threads); err != nil {
+			return
+		}
+	}
+
+	if d > target {
+		return
+	}
+
+	// Cost is linear in the number of passes, so estimate and then refine.
+	passes = uint32(float64(target) / float64(d))
+	if passes < 1 {
+		passes = 1
+	}
+
+	for {
+		if d, err = measure(passes, memory, threads); err != nil {
+			return
+		}
+
+		if d > time.Duration(float64(target)*(1+calibrationTolerance)) {
+			if passes > 1 {
+				passes--
+			}
+			return
+		}
+
+		if d >= target {
+			return
+		}
+
+		passes++
+	}
+}
+
+func measure(passes, memory uint32, threads uint8) (time.Duration, error) {
+	s := New(passes, memory, threads, raw.RecommendedKeyLength)
+
+	var total time.Duration
+	for i := 0; i < calibrationTrials; i++ {
+		start := time.Now()
+		if _, err := s.Hash("passlib calibration"); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+
+	return total / calibrationTrials, nil
+}
@@ -1,4 +1,5 @@
-// Package raw provides a raw implementation of the modular-crypt-wrapped Argon2i primitive.
+// Package raw provides a raw implementation of the modular-crypt-wrapped Argon2i
+// and Argon2id primitives.
 package raw
 
 import (
@@ -18,24 +19,150 @@ const RecommendedMemory uint32 = 32 * 1024
 // The current recommended number of threads for interactive logins.
 const RecommendedThreads uint8 = 4
 
+// The current recommended key (hash output) length, in bytes.
+const RecommendedKeyLength uint32 = 32
+
+// The minimum key length permitted by argon2, in bytes.
+const MinimumKeyLength uint32 = 4
+
+// The current recommended salt length, in bytes.
+const RecommendedSaltLength = 16
+
+// The minimum salt length permitted by argon2, in bytes.
+const MinimumSaltLength = 8
+
+// The largest memory parameter which argon2 will use, in KiB (1 GiB). Hashes
+// needing more are rejected, so that a malicious hash cannot exhaust memory.
+const MaxMemory uint32 = 1 << 20
+
+// Indicates that the memory parameter exceeds MaxMemory, or that the memory
+// it needs cannot be addressed on this platform.
+var ErrParametersTooLarge = fmt.Errorf("argon2 parameters too large")
+
+const maxInt = int(^uint(0) >> 1)
+
+// The longest salt and key accepted in a hash, in bytes. Argon2 permits far
+// longer ones, but nothing legitimate uses them.
+const (
+	MaxSaltLength = 1024
+	MaxKeyLength  = 1024
+)
+
+// Version 1.0 of argon2 (v=16), which some older implementations still
+// produce. It differs from Version13 only in that later passes overwrite
+// memory rather than XOR into it.
+const Version10 = 0x10
+
+// Version 1.3 of argon2 (v=19), the current version and the default.
+const Version13 = argon2.Version
+
+// Returns an error if version is not Version10 or Version13.
+func CheckVersion(version int) error {
+	if version != Version10 && version != Version13 {
+		return fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	return nil
+}
+
 // Wrapper for golang.org/x/crypto/argon2 implementing a sensible
 // hashing interface.
 //
 // password should be a UTF-8 plaintext password.
 // salt should be a random salt value in binary form.
 //
-// Time, memory, and threads are parameters to argon2.
+// Time, memory, and threads are parameters to argon2. keyLen is the length
+// of the resulting hash in bytes.
 //
-// Returns an argon2 encoded hash.
-func Argon2(password string, salt []byte, time, memory uint32, threads uint8) string {
-	passwordb := []byte(password)
+// Returns an argon2i encoded hash.
+func Argon2(password string, salt []byte, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2Bytes([]byte(password), salt, time, memory, threads, keyLen)
+}
 
-	hash := argon2.Key(passwordb, salt, time, memory, threads, 32)
+// Like Argon2, but takes the password as a byte slice.
+func Argon2Bytes(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2BytesVersion(password, salt, Version13, time, memory, threads, keyLen)
+}
 
+// Like Argon2Bytes, but computes and encodes the hash using the given
+// version, which must be Version10 or Version13 (see CheckVersion).
+func Argon2BytesVersion(password, salt []byte, version int, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2BytesSecret(password, salt, nil, version, time, memory, threads, keyLen)
+}
+
+// Like Argon2BytesVersion, but mixes secret into the hash as argon2's secret
+// value K. The secret is not recorded in the encoded hash, so the same secret
+// must be supplied to verify it. A nil or empty secret is the same as none.
+func Argon2BytesSecret(password, salt, secret []byte, version int, time, memory uint32, threads uint8, keyLen uint32) string {
+	hash := key(argon2i, version, password, salt, secret, time, memory, threads, keyLen)
+
+	return encode("argon2i", salt, hash, version, time, memory, threads)
+}
+
+// Like Argon2, but uses the Argon2id variant, which combines Argon2i's
+// resistance to side-channel attacks with Argon2d's resistance to GPU
+// cracking.
+//
+// Returns an argon2id encoded hash.
+func Argon2ID(password string, salt []byte, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2IDBytes([]byte(password), salt, time, memory, threads, keyLen)
+}
+
+// Like Argon2ID, but takes the password as a byte slice.
+func Argon2IDBytes(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2IDBytesVersion(password, salt, Version13, time, memory, threads, keyLen)
+}
+
+// Like Argon2IDBytes, but computes and encodes the hash using the given
+// version, which must be Version10 or Version13 (see CheckVersion).
+func Argon2IDBytesVersion(password, salt []byte, version int, time, memory uint32, threads uint8, keyLen uint32) string {
+	return Argon2IDBytesSecret(password, salt, nil, version, time, memory, threads, keyLen)
+}
+
+// Like Argon2BytesSecret, but uses the Argon2id variant.
+func Argon2IDBytesSecret(password, salt, secret []byte, version int, time, memory uint32, threads uint8, keyLen uint32) string {
+	hash := key(argon2id, version, password, salt, secret, time, memory, threads, keyLen)
+
+	return encode("argon2id", salt, hash, version, time, memory, threads)
+}
+
+func encode(variant string, salt, hash []byte, version int, time, memory uint32, threads uint8) string {
 	hstr := base64.RawStdEncoding.EncodeToString(hash)
 	sstr := base64.RawStdEncoding.EncodeToString(salt)
 
-	return fmt.Sprintf("$argon2i$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, threads, sstr, hstr)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", variant, version, memory, time, threads, sstr, hstr)
+}
+
+// Checks that time, memory, threads and keyLen are acceptable parameters for
+// argon2, returning a descriptive error if they are not.
+//
+// Argon2 requires at least one pass, at least one thread, at least
+// 8 KiB of memory per thread and a key length of at least MinimumKeyLength
+// bytes. Memory is also limited to MaxMemory, and to what an int can address
+// on this platform, or the error wraps ErrParametersTooLarge. The key length
+// is limited to MaxKeyLength.
+func CheckParams(time, memory uint32, threads uint8, keyLen uint32) error {
+	if time < 1 {
+		return fmt.Errorf("argon2 time parameter must be at least 1, got %d", time)
+	}
+
+	if threads < 1 {
+		return fmt.Errorf("argon2 threads parameter must be at least 1, got %d", threads)
+	}
+
+	if uint64(memory) < 8*uint64(threads) {
+		return fmt.Errorf("argon2 memory parameter must be at least 8*threads KiB (%d KiB for %d threads), got %d KiB", 8*uint32(threads), threads, memory)
+	}
+
+	if memory > MaxMemory || uint64(memory) > uint64(maxInt/1024) {
+		return fmt.Errorf("%w: memory parameter must be at most %d KiB, got %d KiB", ErrParametersTooLarge, MaxMemory, memory)
+	}
+
+	if keyLen < MinimumKeyLength || keyLen > MaxKeyLength {
+		return fmt.Errorf("argon2 key length must be between %d and %d bytes, got %d", MinimumKeyLength, MaxKeyLength, keyLen)
+	}
+
+	return nil
 }
 
 // Indicates that a password hash or stub is invalid.
@@ -66,7 +193,7 @@ var ErrMissingTime = fmt.Errorf("time parameter (t) is missing")
 // part, even though it is required.
 var ErrMissingParallelism = fmt.Errorf("parallelism parameter (p) is missing")
 
-// Parses an argon2 encoded hash.
+// Parses an argon2i encoded hash.
 //
 // The format is as follows:
 //
@@ -74,13 +201,25 @@ var ErrMissingParallelism = fmt.Errorf("parallelism parameter (p) is missing")
 //   $argon2i$v=version$m=memory,t=time,p=threads$salt        // stub
 //
 func Parse(stub string) (salt, hash []byte, version int, time, memory uint32, parallelism uint8, err error) {
-	if len(stub) < 26 || !strings.HasPrefix(stub, "$argon2i$") {
+	return parse("$argon2i$", stub)
+}
+
+// Parses an argon2id encoded hash.
+//
+// The format is the same as for argon2i, except that the prefix is
+// "$argon2id$". argon2i hashes are rejected.
+func ParseID(stub string) (salt, hash []byte, version int, time, memory uint32, parallelism uint8, err error) {
+	return parse("$argon2id$", stub)
+}
+
+func parse(prefix, stub string) (salt, hash []byte, version int, time, memory uint32, parallelism uint8, err error) {
+	if len(stub) < len(prefix)+17 || !strings.HasPrefix(stub, prefix) {
 		err = ErrInvalidStub
 		return
 	}
 
 	// $argon2i$  v=version$m=memory,t=time,p=threads$salt-base64$hash-base64
-	parts := strings.Split(stub[9:], "$")
+	parts := strings.Split(stub[len(prefix):], "$")
 
 	// version-params$hash-config-params$salt[$hash]
 	if len(parts) < 3 || len(parts) > 4 {
@@ -128,6 +267,13 @@ func Parse(stub string) (salt, hash []byte, version int, time, memory uint32, pa
 		return
 	}
 
+	// Reject absurd values before anything is allocated in proportion to
+	// them.
+	if val > uint64(MaxMemory) {
+		err = ErrInvalidStub
+		return
+	}
+
 	memory = uint32(val)
 
 	// Time parameter.
@@ -146,9 +292,19 @@ func Parse(stub string) (salt, hash []byte, version int, time, memory uint32, pa
 		return
 	}
 
+	if val > 255 {
+		err = ErrInvalidStub
+		return
+	}
+
 	parallelism = uint8(val)
 
 	// Decode salt.
+	if base64.RawStdEncoding.DecodedLen(len(parts[2])) > MaxSaltLength {
+		err = ErrInvalidStub
+		return
+	}
+
 	salt, err = base64.RawStdEncoding.DecodeString(parts[2])
 	if err != nil {
 		return
@@ -156,6 +312,11 @@ func Parse(stub string) (salt, hash []byte, version int, time, memory uint32, pa
 
 	// Decode hash if present.
 	if len(parts) >= 4 {
+		if base64.RawStdEncoding.DecodedLen(len(parts[3])) > int(MaxKeyLength) {
+			err = ErrInvalidStub
+			return
+		}
+
 		hash, err = base64.RawStdEncoding.DecodeString(parts[3])
 	}
 
@@ -0,0 +1,21 @@
+//go:build 386 || arm || mips || mipsle
+// +build 386 arm mips mipsle
+
+package raw
+
+import (
+	"errors"
+	"testing"
+)
+
+// memory*1024 overflows a 32-bit int for these, though not a 64-bit one.
+func TestMemoryOverflow32Bit(t *testing.T) {
+	for _, memory := range []uint32{1 << 21, 1 << 22, ^uint32(0)} {
+		if uint64(memory) <= uint64(maxInt/1024) {
+			t.Fatalf("%d KiB fits in an int", memory)
+		}
+		if err := CheckParams(1, memory, 1, 32); !errors.Is(err, ErrParametersTooLarge) {
+			t.Errorf("%d KiB: expected ErrParametersTooLarge, got %v", memory, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package raw
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/argon2"
+	"strings"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	password := []byte("password")
+	salt := []byte("somesaltsomesalt")
+
+	for _, p := range []struct {
+		time, memory uint32
+		threads      uint8
+	}{
+		{1, 8, 1}, {3, 64, 1}, {2, 100, 3}, {4, 1024, 4},
+	} {
+		if !bytes.Equal(deriveKey(argon2i, Version13, password, salt, nil, nil, p.time, p.memory, p.threads, 32),
+			argon2.Key(password, salt, p.time, p.memory, p.threads, 32)) {
+			t.Errorf("argon2i mismatch for %+v", p)
+		}
+		if !bytes.Equal(deriveKey(argon2id, Version13, password, salt, nil, nil, p.time, p.memory, p.threads, 32),
+			argon2.IDKey(password, salt, p.time, p.memory, p.threads, 32)) {
+			t.Errorf("argon2id mismatch for %+v", p)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	// From the reference implementation's test suite.
+	for _, v := range []struct {
+		version int
+		hash    string
+	}{
+		{Version10, "$argon2i$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ"},
+		{Version13, "$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$wWKIMhR9lyDFvRz9YTZweHKfbftvj+qf+YFY4NeBbtA"},
+	} {
+		h := Argon2BytesVersion([]byte("password"), []byte("somesalt"), v.version, 2, 65536, 1, 32)
+		if h != v.hash {
+			t.Errorf("version %d: got %q, expected %q", v.version, h, v.hash)
+		}
+	}
+
+	for _, version := range []int{0, 15, 17, 20} {
+		if CheckVersion(version) == nil {
+			t.Errorf("version %d accepted", version)
+		}
+	}
+}
+
+func TestSecret(t *testing.T) {
+	// From RFC 9106, section 5, which uses a secret and associated data.
+	password := bytes.Repeat([]byte{1}, 32)
+	salt := bytes.Repeat([]byte{2}, 16)
+	secret := bytes.Repeat([]byte{3}, 8)
+	data := bytes.Repeat([]byte{4}, 12)
+
+	for _, v := range []struct {
+		mode int
+		tag  string
+	}{
+		{argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8"},
+		{argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	} {
+		tag := deriveKey(v.mode, Version13, password, salt, secret, data, 3, 32, 4, 32)
+		if hex.EncodeToString(tag) != v.tag {
+			t.Errorf("mode %d: got %x, expected %s", v.mode, tag, v.tag)
+		}
+	}
+
+	// The secret changes the hash, but is not recorded in it.
+	with := Argon2IDBytesSecret([]byte("password"), []byte("somesalt"), secret, Version13, 2, 64, 1, 32)
+	without := Argon2IDBytesVersion([]byte("password"), []byte("somesalt"), Version13, 2, 64, 1, 32)
+	if with == without || with[:strings.LastIndexByte(with, '$')] != without[:strings.LastIndexByte(without, '$')] {
+		t.Errorf("unexpected hashes with and without secret: %q, %q", with, without)
+	}
+}
+
+func TestParametersTooLarge(t *testing.T) {
+	for _, memory := range []uint32{MaxMemory + 1, 1 << 22, ^uint32(0)} {
+		if err := CheckParams(1, memory, 1, 32); !errors.Is(err, ErrParametersTooLarge) {
+			t.Errorf("%d KiB: expected ErrParametersTooLarge, got %v", memory, err)
+		}
+	}
+
+	if err := CheckParams(1, MaxMemory, 1, 32); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
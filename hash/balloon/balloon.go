@@ -0,0 +1,251 @@
+// Package balloon implements Balloon hashing over SHA-256, a memory-hard
+// password hashing function with a proof of memory hardness which uses
+// only a standard hash function.
+//
+// Hashes are PHC strings of the form:
+//
+//   $balloon$s=space,t=time$salt$hash
+//
+// where space is the number of 32-byte blocks of memory and time the number
+// of mixing rounds.
+package balloon
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/balloon/raw"
+)
+
+// An implementation of Scheme performing Balloon hashing.
+//
+// Uses raw.RecommendedSpace and raw.RecommendedTime.
+var Crypter abstract.Scheme
+
+// Indicates that a Balloon hash or stub is malformed.
+var ErrInvalidStub = fmt.Errorf("invalid balloon stub")
+
+const saltLength = 16
+
+const prefix = "$balloon$"
+
+func init() {
+	Crypter = New(raw.RecommendedSpace, raw.RecommendedTime)
+}
+
+// Returns an implementation of Scheme performing Balloon hashing with the
+// given space cost, in 32-byte blocks, and time cost, in rounds.
+//
+// The parameters are used only when hashing new passwords; existing hashes
+// are verified using the parameters encoded in them. If the parameters are
+// invalid (see raw.CheckParams), Hash returns a descriptive error.
+func New(space, time uint64) abstract.Scheme {
+	return &scheme{
+		space: space,
+		time:  time,
+	}
+}
+
+type scheme struct {
+	space, time uint64
+}
+
+// Parses a Balloon hash or stub. hash is nil for a stub.
+func parse(stub string) (salt, hash []byte, space, time uint64, err error) {
+	if !strings.HasPrefix(stub, prefix) {
+		err = ErrInvalidStub
+		return
+	}
+
+	p, err := abstract.ParsePHC(stub)
+	if err != nil || p.Version != "" || len(p.Params) != 2 || p.Salt == nil {
+		err = ErrInvalidStub
+		return
+	}
+
+	s, _ := p.Param("s")
+	t, _ := p.Param("t")
+	if space, err = strconv.ParseUint(s, 10, 64); err != nil {
+		err = ErrInvalidStub
+		return
+	}
+	if time, err = strconv.ParseUint(t, 10, 64); err != nil {
+		err = ErrInvalidStub
+		return
+	}
+
+	if raw.CheckParams(space, time) != nil {
+		err = ErrInvalidStub
+		return
+	}
+
+	if p.Hash != nil && len(p.Hash) != raw.BlockSize {
+		err = ErrInvalidStub
+		return
+	}
+
+	return p.Salt, p.Hash, space, time, nil
+}
+
+func format(salt, hash []byte, space, time uint64) string {
+	return abstract.FormatPHC(&abstract.PHCParams{
+		ID: "balloon",
+		Params: []abstract.PHCParam{
+			{Name: "s", Value: strconv.FormatUint(space, 10)},
+			{Name: "t", Value: strconv.FormatUint(time, 10)},
+		},
+		Salt: salt,
+		Hash: hash,
+	})
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, prefix)
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return c.HashBytes([]byte(password))
+}
+
+func (c *scheme) HashBytes(password []byte) (string, error) {
+	return c.HashWithSaltReader(password, rand.Reader)
+}
+
+func (c *scheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	if err := raw.CheckParams(c.space, c.time); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(saltReader, salt); err != nil {
+		return "", err
+	}
+
+	hash := raw.Balloon(password, salt, c.space, c.time)
+	return format(salt, hash, c.space, c.time), nil
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	return c.VerifyBytes([]byte(password), hash)
+}
+
+func (c *scheme) VerifyBytes(password []byte, hash string) error {
+	salt, oldHash, space, time, err := parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == nil {
+		return abstract.InvalidHash(ErrInvalidStub)
+	}
+
+	if err := raw.CheckParams(space, time); err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	newHash := format(salt, raw.Balloon(password, salt, space, time), space, time)
+	if !abstract.SecureCompare(hash, newHash) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+func (c *scheme) NeedsUpdate(stub string) bool {
+	salt, _, space, time, err := parse(stub)
+	if err != nil {
+		return false // ...
+	}
+
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"space":       space,
+		"time":        time,
+	}
+
+	return abstract.CompareParams(stored, c.target()) < 0
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (c *scheme) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": saltLength,
+		"space":       c.space,
+		"time":        c.time,
+	}
+}
+
+func (c *scheme) Params() map[string]string {
+	return map[string]string{
+		"space": fmt.Sprint(c.space),
+		"time":  fmt.Sprint(c.time),
+	}
+}
+
+func (c *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	space, time := int(c.space), int(c.time)
+	err := abstract.ParseIntParams(params, map[string]*int{
+		"space": &space,
+		"time":  &time,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := raw.CheckParams(uint64(space), uint64(time)); err != nil {
+		return nil, err
+	}
+
+	return New(uint64(space), uint64(time)), nil
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	_, _, space, time, err := parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{
+		"space": fmt.Sprint(space),
+		"time":  fmt.Sprint(time),
+	}, nil
+}
+
+// Each round takes 1 + 3*raw.Delta hashes per block, most of two SHA-256
+// compressions, so the strength is about log2(20*space*time). Memory
+// hardness is ignored.
+func (c *scheme) Strength(hash string) (float64, error) {
+	_, _, space, time, err := parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return strength(space, time), nil
+}
+
+func strength(space, time uint64) float64 {
+	return math.Log2(2 * (1 + 3*raw.Delta) * float64(space) * float64(time))
+}
+
+func (c *scheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Memory:   c.space * raw.BlockSize,
+		Threads:  1,
+		Time:     map[string]uint64{"space": c.space, "time": c.time},
+		Strength: strength(c.space, c.time),
+	}
+}
+
+func (c *scheme) Describe() string {
+	return fmt.Sprintf("balloon(s=%d,t=%d)", c.space, c.time)
+}
+
+func (c *scheme) String() string {
+	return fmt.Sprintf("balloon(%d,%d)", c.space, c.time)
+}
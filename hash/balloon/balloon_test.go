@@ -0,0 +1,57 @@
+package balloon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// The first of raw's test vectors, as a hash.
+const vectorHash = "$balloon$s=1024,t=3$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs+snSicW1GVlnqmNEDfs"
+
+func TestBalloon(t *testing.T) {
+	if !Crypter.SupportsStub(vectorHash) {
+		t.Fatalf("hash not supported")
+	}
+	if err := Crypter.Verify("hunter42", vectorHash); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if err := Crypter.Verify("hunter43", vectorHash); err != abstract.ErrInvalidPassword {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+	if !Crypter.NeedsUpdate(vectorHash) {
+		t.Fatalf("hash with weak parameters does not need update")
+	}
+
+	c := New(256, 2)
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$balloon$s=256,t=2$") {
+		t.Fatalf("unexpected hash: %q", h)
+	}
+	if err := c.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if c.NeedsUpdate(h) || !New(512, 2).NeedsUpdate(h) || !New(256, 3).NeedsUpdate(h) {
+		t.Fatalf("NeedsUpdate does not reflect parameters")
+	}
+
+	for _, bad := range []string{
+		"$balloon$s=1024,t=3$ZXhhbXBsZXNhbHQ",
+		"$balloon$s=1024$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs+snSicW1GVlnqmNEDfs",
+		"$balloon$s=0,t=3$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs+snSicW1GVlnqmNEDfs",
+		"$balloon$s=1099511627776,t=3$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs+snSicW1GVlnqmNEDfs",
+		"$balloon$s=1024,t=3$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs",
+	} {
+		if err := Crypter.Verify("hunter42", bad); err == nil {
+			t.Fatalf("malformed hash verified: %q", bad)
+		}
+	}
+
+	if _, err := New(0, 1).Hash("password"); err == nil {
+		t.Fatalf("expected error for zero space cost")
+	}
+}
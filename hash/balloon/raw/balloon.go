@@ -0,0 +1,112 @@
+// Package raw provides a raw implementation of Balloon hashing (Boneh,
+// Corrigan-Gibbs and Schechter, 2016) over SHA-256.
+package raw
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// The number of dependencies from each block to pseudorandomly chosen
+// blocks per round, as recommended by the paper.
+const Delta = 3
+
+// The size of a block, and of the output, in bytes.
+const BlockSize = sha256.Size
+
+// The recommended space cost, in blocks (1 MiB).
+const RecommendedSpace = 1 << 15
+
+// The recommended time cost, in rounds.
+const RecommendedTime = 3
+
+// The largest space cost which Balloon will use, in blocks (1 GiB). Hashes
+// needing more are rejected, so that a malicious hash cannot exhaust memory.
+const MaxSpace = 1 << 25
+
+// Checks that space and time are acceptable costs.
+func CheckParams(space, time uint64) error {
+	if space < 1 || space > MaxSpace {
+		return fmt.Errorf("balloon space cost must be between 1 and %d blocks, got %d", MaxSpace, space)
+	}
+
+	if time < 1 {
+		return fmt.Errorf("balloon time cost must be at least 1, got %d", time)
+	}
+
+	return nil
+}
+
+// A hasher for the H(cnt, ...) calls of the construction, which prefix the
+// counter to their arguments.
+type hasher struct {
+	h   hash.Hash
+	cnt uint64
+	buf [8]byte
+}
+
+func (h *hasher) sum(dst []byte, args ...[]byte) {
+	h.h.Reset()
+	binary.LittleEndian.PutUint64(h.buf[:], h.cnt)
+	h.h.Write(h.buf[:])
+	for _, arg := range args {
+		h.h.Write(arg)
+	}
+	h.h.Sum(dst[:0])
+	h.cnt++
+}
+
+// Computes the Balloon hash of password with salt, using space blocks of
+// memory and time rounds, with Delta dependencies per block. Integers are
+// encoded as 8-byte little-endian values. Panics unless CheckParams accepts
+// the parameters.
+func Balloon(password, salt []byte, space, time uint64) []byte {
+	if err := CheckParams(space, time); err != nil {
+		panic(err)
+	}
+
+	h := &hasher{h: sha256.New()}
+	buf := make([][BlockSize]byte, space)
+
+	// Expand.
+	h.sum(buf[0][:], password, salt)
+	for m := uint64(1); m < space; m++ {
+		h.sum(buf[m][:], buf[m-1][:])
+	}
+
+	// Mix.
+	var ints [24]byte
+	var idx, other [BlockSize]byte
+	for t := uint64(0); t < time; t++ {
+		for m := uint64(0); m < space; m++ {
+			prev := (m + space - 1) % space
+			h.sum(buf[m][:], buf[prev][:], buf[m][:])
+
+			for i := uint64(0); i < Delta; i++ {
+				binary.LittleEndian.PutUint64(ints[0:], t)
+				binary.LittleEndian.PutUint64(ints[8:], m)
+				binary.LittleEndian.PutUint64(ints[16:], i)
+				idx = sha256.Sum256(ints[:])
+
+				h.sum(other[:], salt, idx[:])
+				j := mod(other[:], space)
+				h.sum(buf[m][:], buf[m][:], buf[j][:])
+			}
+		}
+	}
+
+	out := buf[space-1]
+	return out[:]
+}
+
+// Returns the little-endian integer in b modulo n, which must be at most
+// MaxSpace so that the intermediate values cannot overflow.
+func mod(b []byte, n uint64) uint64 {
+	r := uint64(0)
+	for i := len(b) - 1; i >= 0; i-- {
+		r = (r<<8 | uint64(b[i])) % n
+	}
+	return r
+}
@@ -0,0 +1,36 @@
+package raw
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestBalloon(t *testing.T) {
+	// The published test vectors for Balloon over SHA-256 with delta = 3.
+	vectors := []struct {
+		password, salt string
+		space, time    uint64
+		output         string
+	}{
+		{"hunter42", "examplesalt", 1024, 3, "716043dff777b44aa7b88dcbab12c078abecfac9d289c5b5195967aa63440dfb"},
+		{"", "salt", 3, 3, "5f02f8206f9cd212485c6bdf85527b698956701ad0852106f94b94ee94577378"},
+		{"password", "", 3, 3, "20aa99d7fe3f4df4bd98c655c5480ec98b143107a331fd491deda885c4d6a6cc"},
+		{"\x00", "\x00", 3, 3, "4fc7e302ffa29ae0eac31166cee7a552d1d71135f4e0da66486fb68a749b73a4"},
+		{"password", "salt", 1, 1, "eefda4a8a75b461fa389c1dcfaf3e9dfacbc26f81f22e6f280d15cc18c417545"},
+	}
+
+	for i, v := range vectors {
+		out := hex.EncodeToString(Balloon([]byte(v.password), []byte(v.salt), v.space, v.time))
+		if out != v.output {
+			t.Errorf("test %d: got %s, expected %s", i, out, v.output)
+		}
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	for _, p := range []struct{ space, time uint64 }{{0, 1}, {1, 0}, {MaxSpace + 1, 1}} {
+		if CheckParams(p.space, p.time) == nil {
+			t.Errorf("invalid parameters accepted: %+v", p)
+		}
+	}
+}
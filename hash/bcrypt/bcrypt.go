@@ -2,12 +2,15 @@
 //
 // Please note that bcrypt truncates passwords to 72 characters in length. Consider using
 // a more modern hashing scheme such as scrypt or sha-crypt. If you must use bcrypt,
-// consider using bcrypt-sha256 instead.
+// consider using bcrypt-sha256 instead, or a TruncationPolicy other than Allow.
 package bcrypt
 
 import "golang.org/x/crypto/bcrypt"
 import "github.com/al45tair/passlib/abstract"
+import "encoding/base64"
 import "fmt"
+import "strconv"
+import "strings"
 
 // An implementation of Scheme implementing bcrypt.
 //
@@ -17,6 +20,46 @@ var Crypter abstract.Scheme
 // The recommended cost for bcrypt. This may change with subsequent releases.
 const RecommendedCost = 12
 
+// The prefix of hashes generated by this package. $2b$ and $2y$ hashes are
+// wire-compatible and verify normally, but are reported as needing an update.
+const canonicalPrefix = "$2a$"
+
+// The minimum cost permitted by bcrypt.
+const MinimumCost = bcrypt.MinCost
+
+// The maximum cost permitted by bcrypt.
+const MaximumCost = bcrypt.MaxCost
+
+// Indicates that the cost specified is not in the valid range.
+var ErrInvalidCost = fmt.Errorf("invalid bcrypt cost")
+
+// The maximum number of password bytes bcrypt takes into account.
+const MaxPasswordLength = 72
+
+// Indicates that a password is longer than MaxPasswordLength and the scheme's
+// TruncationPolicy is Reject.
+var ErrPasswordTooLong = fmt.Errorf("password exceeds bcrypt's %d byte limit", MaxPasswordLength)
+
+// Determines how a scheme handles passwords longer than MaxPasswordLength.
+type TruncationPolicy int
+
+const (
+	// Ignore any bytes past MaxPasswordLength, as bcrypt always has. This is
+	// the default, for compatibility.
+	Allow TruncationPolicy = iota
+
+	// Refuse to hash passwords longer than MaxPasswordLength, returning
+	// ErrPasswordTooLong. Existing hashes of such passwords still verify.
+	Reject
+
+	// Prehash passwords longer than MaxPasswordLength with SHA-256 before
+	// passing them to bcrypt. Such hashes are stored in Python passlib's
+	// $bcrypt-sha256$ format, so that Verify knows to prehash, and can also
+	// be verified by the bcryptsha256 package. Shorter passwords are hashed
+	// with plain bcrypt.
+	PreHashSHA256
+)
+
 // bcrypt.DefaultCost is a bit low (10), so use 12 instead.
 
 func init() {
@@ -30,41 +73,245 @@ func New(cost int) abstract.Scheme {
 	}
 }
 
+// Create a new scheme implementing bcrypt with RecommendedCost, handling
+// passwords longer than MaxPasswordLength according to policy.
+func NewWithTruncationPolicy(policy TruncationPolicy) abstract.Scheme {
+	return &scheme{
+		Cost:   RecommendedCost,
+		Policy: policy,
+	}
+}
+
+// Like New, but returns ErrInvalidCost if cost is outside the range
+// MinimumCost <= cost <= MaximumCost.
+//
+// The cost is used only when hashing new passwords; existing hashes are
+// verified using the cost encoded in them, and NeedsUpdate reports hashes
+// with a lower cost.
+func NewWithCost(cost int) (abstract.Scheme, error) {
+	if cost < MinimumCost || cost > MaximumCost {
+		return nil, ErrInvalidCost
+	}
+
+	return New(cost), nil
+}
+
+func (s *scheme) Params() map[string]string {
+	return map[string]string{"cost": fmt.Sprint(s.Cost)}
+}
+
+func (s *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	cost := s.Cost
+	err := abstract.ParseIntParams(params, map[string]*int{"cost": &cost})
+	if err != nil {
+		return nil, err
+	}
+
+	if cost < MinimumCost || cost > MaximumCost {
+		return nil, ErrInvalidCost
+	}
+
+	return &scheme{
+		Cost:   cost,
+		Policy: s.Policy,
+	}, nil
+}
+
 type scheme struct {
-	Cost int
+	Cost   int
+	Policy TruncationPolicy
 }
 
 func (s *scheme) SupportsStub(stub string) bool {
+	if s.Policy == PreHashSHA256 && isPrehashed(stub) {
+		stub = demangle(stub)
+	}
+
 	return len(stub) >= 3 && stub[0] == '$' && stub[1] == '2' &&
 		(stub[2] == '$' || (len(stub) >= 4 && stub[3] == '$' &&
 			(stub[2] == 'a' || stub[2] == 'b' || stub[2] == 'y')))
 }
 
 func (s *scheme) Hash(password string) (string, error) {
-	h, err := bcrypt.GenerateFromPassword([]byte(password), s.Cost)
+	return s.HashBytes([]byte(password))
+}
+
+func (s *scheme) HashBytes(password []byte) (string, error) {
+	prehashed := false
+	if len(password) > MaxPasswordLength {
+		switch s.Policy {
+		case Reject:
+			return "", ErrPasswordTooLong
+		case PreHashSHA256:
+			password = prehash(password)
+			prehashed = true
+		}
+	}
+
+	h, err := bcrypt.GenerateFromPassword(password, s.Cost)
 	if err != nil {
 		return "", err
 	}
 
+	if prehashed {
+		return mangle(string(h)), nil
+	}
+
 	return string(h), nil
 }
 
 func (s *scheme) Verify(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return s.VerifyBytes([]byte(password), hash)
+}
+
+func (s *scheme) VerifyBytes(password []byte, hash string) error {
+	if s.Policy == PreHashSHA256 && isPrehashed(hash) {
+		password = prehash(password)
+		hash = demangle(hash)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), password)
 	if err == bcrypt.ErrMismatchedHashAndPassword {
-		err = abstract.ErrInvalidPassword
+		return abstract.ErrInvalidPassword
 	}
 
-	return err
+	// Any other error is due to a malformed hash.
+	return abstract.InvalidHash(err)
 }
 
 func (s *scheme) NeedsUpdate(stub string) bool {
-	cost, err := bcrypt.Cost([]byte(stub))
-	if err != nil {
+	if s.Policy == PreHashSHA256 && isPrehashed(stub) {
+		stub = demangle(stub)
+	}
+
+	cost, ok := parseCost(stub)
+	if !ok {
 		return false
 	}
 
-	return cost < s.Cost
+	stored := map[string]uint64{"cost": uint64(cost)}
+	return abstract.CompareParams(stored, s.target()) < 0 || !strings.HasPrefix(stub, canonicalPrefix)
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (s *scheme) target() map[string]uint64 {
+	return map[string]uint64{"cost": uint64(s.Cost)}
+}
+
+// Reads the cost from a bcrypt hash or stub. Unlike bcrypt.Cost, this does
+// not need the salt and checksum to be present, so works on stubs too.
+func parseCost(stub string) (int, bool) {
+	if len(stub) < 4 || stub[0] != '$' || stub[1] != '2' {
+		return 0, false
+	}
+
+	rest := stub[3:]
+	if stub[2] != '$' {
+		rest = stub[4:]
+	}
+
+	if len(rest) < 3 || rest[2] != '$' {
+		return 0, false
+	}
+
+	cost, err := strconv.Atoi(rest[:2])
+	if err != nil || cost < MinimumCost || cost > MaximumCost {
+		return 0, false
+	}
+
+	return cost, true
+}
+
+func (s *scheme) ReadParams(hash string) (map[string]string, error) {
+	if s.Policy == PreHashSHA256 && isPrehashed(hash) {
+		hash = demangle(hash)
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"cost": fmt.Sprint(cost)}, nil
+}
+
+// bcrypt's base64 alphabet, in which salts and digests are written.
+var encoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// Indicates that a bcrypt hash cannot be split or joined, because it is
+// malformed or prehashed.
+var errInvalidHash = fmt.Errorf("invalid bcrypt hash")
+
+// Splits a plain bcrypt hash into its 16-byte salt and 23-byte digest. The
+// variant, e.g. 2b, is not kept; JoinHash writes the canonical one.
+//
+// The last character of the salt carries four unused bits, which some
+// encoders leave set. Such salts still verify, so they are accepted, and
+// JoinHash clears the bits. A digest with such bits set never verifies, so
+// is rejected.
+func (s *scheme) SplitHash(hash string) (salt, digest []byte, params map[string]string, err error) {
+	cost, ok := parseCost(hash)
+	if !ok || len(hash) != 60 || hash[3] != '$' || isPrehashed(hash) {
+		return nil, nil, nil, abstract.InvalidHash(errInvalidHash)
+	}
+
+	salt, err = encoding.DecodeString(hash[7:29])
+	if err == nil {
+		digest, err = encoding.DecodeString(hash[29:])
+	}
+	if err != nil || encoding.EncodeToString(digest) != hash[29:] {
+		return nil, nil, nil, abstract.InvalidHash(errInvalidHash)
+	}
+
+	return salt, digest, map[string]string{"cost": fmt.Sprint(cost)}, nil
+}
+
+func (s *scheme) JoinHash(salt, digest []byte, params map[string]string) (string, error) {
+	var cost int
+	err := abstract.ParseAllIntParams(params, map[string]*int{"cost": &cost})
+	if err != nil {
+		return "", err
+	}
+
+	if cost < MinimumCost || cost > MaximumCost {
+		return "", ErrInvalidCost
+	}
+
+	if len(salt) != 16 || len(digest) != 23 {
+		return "", errInvalidHash
+	}
+
+	return fmt.Sprintf("%s%02d$%s%s", canonicalPrefix, cost, encoding.EncodeToString(salt), encoding.EncodeToString(digest)), nil
+}
+
+// A bcrypt hash of cost c runs the Blowfish key schedule 2^(c+1) times, at
+// about 520 Blowfish encryptions each; an encryption costs about a quarter
+// of a SHA-256 compression, so the strength is about c + 8.
+func (s *scheme) Strength(hash string) (float64, error) {
+	if s.Policy == PreHashSHA256 && isPrehashed(hash) {
+		hash = demangle(hash)
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return float64(cost + 8), nil
+}
+
+// bcrypt's memory is its 4168-byte Blowfish state.
+func (s *scheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Memory:   4168,
+		Threads:  1,
+		Time:     map[string]uint64{"cost": uint64(s.Cost)},
+		Strength: float64(s.Cost + 8),
+	}
+}
+
+func (s *scheme) Describe() string {
+	return fmt.Sprintf("bcrypt(cost=%d)", s.Cost)
 }
 
 func (s *scheme) String() string {
@@ -0,0 +1,151 @@
+package bcrypt
+
+import "testing"
+import "strings"
+import "time"
+
+func TestNewWithCost(t *testing.T) {
+	for _, cost := range []int{0, 3, 32} {
+		if _, err := NewWithCost(cost); err != ErrInvalidCost {
+			t.Fatalf("cost %d: expected ErrInvalidCost, got %v", cost, err)
+		}
+	}
+
+	s10, err := NewWithCost(10)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	s12, err := NewWithCost(12)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	h, err := s10.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := s12.Verify("password", h); err != nil {
+		t.Fatalf("err verifying cost 10 hash with cost 12 scheme: %v", err)
+	}
+	if !s12.NeedsUpdate(h) {
+		t.Fatalf("cost 10 hash does not need update under cost 12")
+	}
+	if s10.NeedsUpdate(h) {
+		t.Fatalf("cost 10 hash needs update under cost 10")
+	}
+}
+
+func TestTruncationPolicy(t *testing.T) {
+	long := strings.Repeat("0123456789", 8)
+	truncated := long[:MaxPasswordLength]
+
+	// Allow (the default) ignores bytes past the limit.
+	h, err := NewWithTruncationPolicy(Allow).Hash(long)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := Crypter.Verify(truncated, h); err != nil {
+		t.Fatalf("truncated password did not verify under Allow: %v", err)
+	}
+
+	// Reject refuses to hash long passwords, but not short ones.
+	reject := NewWithTruncationPolicy(Reject)
+	if _, err := reject.Hash(long); err != ErrPasswordTooLong {
+		t.Fatalf("expected ErrPasswordTooLong, got %v", err)
+	}
+	if _, err := reject.Hash(truncated); err != nil {
+		t.Fatalf("err hashing %d byte password: %v", MaxPasswordLength, err)
+	}
+
+	// PreHashSHA256 prehashes long passwords and marks them in the stub.
+	prehashing := NewWithTruncationPolicy(PreHashSHA256)
+	h, err = prehashing.Hash(long)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$bcrypt-sha256$") || !prehashing.SupportsStub(h) {
+		t.Fatalf("prehashed hash not marked as such: %q", h)
+	}
+	if Crypter.SupportsStub(h) {
+		t.Fatalf("plain bcrypt claims to support prehashed hash")
+	}
+	if err := prehashing.Verify(long, h); err != nil {
+		t.Fatalf("err verifying prehashed hash: %v", err)
+	}
+	if err := prehashing.Verify(truncated, h); err == nil {
+		t.Fatalf("truncated password verified against prehashed hash")
+	}
+
+	h, err = prehashing.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$2a$") {
+		t.Fatalf("short password was prehashed: %q", h)
+	}
+	if err := prehashing.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	for _, v := range []struct{ p, h string }{
+		// From the PHP manual's password_verify example.
+		{"rasmuslerdorf", "$2y$10$.vGA1O9wmRjrwAVXD98HNOgsNpDczlqm3Jq7KnEd1rVAGv3Fykk1a"},
+		{"password", "$2b$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu"},
+		{"password", "$2a$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu"},
+	} {
+		if !Crypter.SupportsStub(v.h) {
+			t.Fatalf("stub not supported: %q", v.h)
+		}
+		if err := Crypter.Verify(v.p, v.h); err != nil {
+			t.Fatalf("err verifying %q: %v", v.h, err)
+		}
+	}
+
+	s, _ := NewWithCost(5)
+	if !s.NeedsUpdate("$2y$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu") {
+		t.Fatalf("$2y$ hash does not need update")
+	}
+	if !s.NeedsUpdate("$2b$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu") {
+		t.Fatalf("$2b$ hash does not need update")
+	}
+	if s.NeedsUpdate("$2a$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu") {
+		t.Fatalf("$2a$ hash needs update")
+	}
+
+	h, err := s.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$2a$") {
+		t.Fatalf("non-canonical prefix generated: %q", h)
+	}
+}
+
+// bcrypt stubs carry no checksum, but their cost must still be checked.
+func TestStubNeedsUpdate(t *testing.T) {
+	s := New(12)
+	if !s.NeedsUpdate("$2a$10$abcdefghijklmnopqrstuu") {
+		t.Errorf("stub with lower cost does not need update")
+	}
+	if s.NeedsUpdate("$2a$12$abcdefghijklmnopqrstuu") || s.NeedsUpdate("$2a$13$abcdefghijklmnopqrstuu") {
+		t.Errorf("stub with sufficient cost needs update")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	cost, d, err := Calibrate(5 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cost < MinimumCost || cost > MaximumCost || d <= 0 {
+		t.Fatalf("unexpected calibration: cost %d, %v", cost, d)
+	}
+
+	if _, _, err := Calibrate(0); err == nil {
+		t.Fatalf("expected error for zero target")
+	}
+}
@@ -0,0 +1,61 @@
+package bcrypt
+
+import (
+	"fmt"
+	"time"
+)
+
+// The number of trials averaged for each measurement made by Calibrate.
+const calibrationTrials = 3
+
+// The fraction by which a measured duration may exceed the target and still
+// be considered a match by Calibrate.
+const calibrationTolerance = 0.1
+
+// Determines the bcrypt cost which makes hashing a password take roughly
+// target on the current machine, returning it with its measured duration.
+//
+// Each increment of the cost doubles the time taken, so the result is the
+// highest cost whose duration does not exceed target by more than 10%, or
+// MinimumCost if even that is too slow. Each candidate is hashed several
+// times and the durations averaged.
+//
+// The results are specific to the machine (and its load) at the time of the
+// call. Calibrate once and store the result in your configuration, rather
+// than recalibrating in every process.
+func Calibrate(target time.Duration) (cost int, measured time.Duration, err error) {
+	if target <= 0 {
+		err = fmt.Errorf("bcrypt calibration target must be positive, got %v", target)
+		return
+	}
+
+	cost = MinimumCost
+	if measured, err = measure(cost); err != nil {
+		return
+	}
+
+	limit := time.Duration(float64(target) * (1 + calibrationTolerance))
+	for measured < target && 2*measured <= limit && cost < MaximumCost {
+		cost++
+		if measured, err = measure(cost); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func measure(cost int) (time.Duration, error) {
+	s := New(cost)
+
+	var total time.Duration
+	for i := 0; i < calibrationTrials; i++ {
+		start := time.Now()
+		if _, err := s.Hash("passlib calibration"); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+
+	return total / calibrationTrials, nil
+}
@@ -0,0 +1,54 @@
+package bcrypt
+
+import "crypto/sha256"
+import "encoding/base64"
+import "strings"
+
+// Prehashed passwords are stored in Python passlib's bcrypt-sha256 format:
+//
+//   $bcrypt-sha256$2a,12$salt$hash
+//
+// which is equivalent to the bcrypt hash $2a$12$salthash of the base64
+// encoded SHA-256 digest of the password.
+const prehashPrefix = "$bcrypt-sha256$"
+
+func isPrehashed(stub string) bool {
+	return strings.HasPrefix(stub, prehashPrefix)
+}
+
+func prehash(password []byte) []byte {
+	h := sha256.Sum256(password)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(h)))
+	base64.StdEncoding.Encode(out, h[:])
+	return out
+}
+
+// Converts a bcrypt-sha256 stub into the equivalent bcrypt stub, or returns
+// "" if the stub is malformed.
+func demangle(stub string) string {
+	parts := strings.Split(stub[len(prehashPrefix):], "$")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	// 0: 2a,12
+	// 1: salt
+	// 2: hash
+	parts0 := strings.Split(parts[0], ",")
+	if len(parts0) != 2 || len(parts0[1]) > 2 {
+		return ""
+	}
+
+	return "$" + parts0[0] + "$" + strings.Repeat("0", 2-len(parts0[1])) + parts0[1] + "$" + parts[1] + parts[2]
+}
+
+// Converts a bcrypt hash into the equivalent bcrypt-sha256 hash.
+func mangle(hash string) string {
+	parts := strings.Split(hash[1:], "$")
+	// 0: 2a
+	// 1: rounds
+	// 2: salt + hash
+	salt := parts[2][0:22]
+	h := parts[2][22:]
+	return prehashPrefix + parts[0] + "," + parts[1] + "$" + salt + "$" + h
+}
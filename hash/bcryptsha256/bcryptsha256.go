@@ -2,11 +2,27 @@
 //
 // This is preferred over bcrypt because the prehash essentially renders bcrypt's password length
 // limitation irrelevant; although of course it is less compatible.
+//
+// Python passlib has used two formats for these hashes. Both pass bcrypt the
+// 44-character standard base64 encoding, with padding, of a SHA-256 digest of
+// the UTF-8 password; the raw digest is never used, as it may contain NUL
+// bytes, which bcrypt treats as the end of the password. They differ in the
+// digest and in how the bcrypt parameters are written:
+//
+//   $bcrypt-sha256$2b,12$<salt>$<checksum>          passlib 1.6.2 to 1.7.2
+//   $bcrypt-sha256$v=2,t=2b,r=12$<salt>$<checksum>  passlib 1.7.3 and later
+//
+// The first, "version 1", uses the plain SHA-256 digest of the password, and
+// bcrypt's variant may be 2a (as passlib 1.6 writes) or 2b. The second,
+// "version 2", uses HMAC-SHA256 of the password keyed with the 22-character
+// bcrypt salt, as written in the hash. Both are verified; new hashes are in
+// version 1 format, which every release of passlib since 1.6.2 can verify.
 package bcryptsha256
 
 import "github.com/al45tair/passlib/abstract"
 import "github.com/al45tair/passlib/hash/bcrypt"
 import "encoding/base64"
+import "crypto/hmac"
 import "crypto/sha256"
 import "strings"
 import "fmt"
@@ -38,6 +54,20 @@ func New(cost int) abstract.Scheme {
 	}
 }
 
+// Like New, but returns bcrypt.ErrInvalidCost if cost is outside the range
+// bcrypt.MinimumCost <= cost <= bcrypt.MaximumCost.
+//
+// Only the cost of the inner bcrypt changes; the prehash is the same, so
+// existing hashes still verify. Verify uses the cost encoded in the stored
+// hash, and NeedsUpdate reports hashes with a lower cost than this.
+func NewWithCost(cost int) (abstract.Scheme, error) {
+	if cost < bcrypt.MinimumCost || cost > bcrypt.MaximumCost {
+		return nil, bcrypt.ErrInvalidCost
+	}
+
+	return New(cost), nil
+}
+
 func (s *scheme) Hash(password string) (string, error) {
 	p := s.prehash(password)
 	h, err := s.underlying.Hash(p)
@@ -49,6 +79,16 @@ func (s *scheme) Hash(password string) (string, error) {
 }
 
 func (s *scheme) Verify(password, hash string) error {
+	if strings.HasPrefix(hash, "$bcrypt-sha256$v=2,") {
+		// The salt follows "$2b$12$"; a stub too short to hold it is
+		// rejected by bcrypt as malformed.
+		stub := demangle(hash)
+		if len(stub) < 29 {
+			return s.underlying.Verify(password, stub)
+		}
+		return s.underlying.Verify(s.prehashV2(password, stub[7:29]), stub)
+	}
+
 	p := s.prehash(password)
 	return s.underlying.Verify(p, demangle(hash))
 }
@@ -60,6 +100,13 @@ func (s *scheme) prehash(password string) string {
 	return v
 }
 
+// The prehash of passlib's version 2 format, keyed with the hash's salt.
+func (s *scheme) prehashV2(password, salt string) string {
+	h := hmac.New(sha256.New, []byte(salt))
+	h.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
 func (s *scheme) SupportsStub(stub string) bool {
 	return strings.HasPrefix(stub, "$bcrypt-sha256$") && s.underlying.SupportsStub(demangle(stub))
 }
@@ -68,17 +115,77 @@ func (s *scheme) NeedsUpdate(stub string) bool {
 	return s.underlying.NeedsUpdate(demangle(stub))
 }
 
+func (s *scheme) Params() map[string]string {
+	return map[string]string{"cost": fmt.Sprint(s.cost)}
+}
+
+func (s *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	cost := s.cost
+	err := abstract.ParseIntParams(params, map[string]*int{"cost": &cost})
+	if err != nil {
+		return nil, err
+	}
+
+	if cost < bcrypt.MinimumCost || cost > bcrypt.MaximumCost {
+		return nil, bcrypt.ErrInvalidCost
+	}
+
+	return New(cost), nil
+}
+
+func (s *scheme) ReadParams(hash string) (map[string]string, error) {
+	return s.underlying.(abstract.ParamReader).ReadParams(demangle(hash))
+}
+
+// The prehash is negligible, so the strength is that of the bcrypt hash.
+func (s *scheme) Strength(hash string) (float64, error) {
+	return s.underlying.(abstract.StrengthScheme).Strength(demangle(hash))
+}
+
+func (s *scheme) EstimateCost() abstract.Cost {
+	return s.underlying.(abstract.Coster).EstimateCost()
+}
+
+func (s *scheme) Describe() string {
+	return fmt.Sprintf("bcrypt-sha256(cost=%d)", s.cost)
+}
+
 func (s *scheme) String() string {
 	return fmt.Sprintf("bcrypt-sha256(%d)", s.cost)
 }
 
+// Converts a bcrypt-sha256 stub in either format into the equivalent bcrypt
+// stub, or returns "" if the stub is malformed.
 func demangle(stub string) string {
-	if strings.HasPrefix(stub, "$bcrypt-sha256$2") {
+	if strings.HasPrefix(stub, "$bcrypt-sha256$v=2,") {
 		parts := strings.Split(stub[15:], "$")
+		if len(parts) != 3 {
+			return ""
+		}
+
+		// 0: v=2,t=2b,r=12
+		// 1: salt
+		// 2: hash
+		params := strings.Split(parts[0], ",")
+		if len(params) != 3 || !strings.HasPrefix(params[1], "t=") || !strings.HasPrefix(params[2], "r=") {
+			return ""
+		}
+
+		return "$" + params[1][2:] + "$" + fmt.Sprintf("%02s", params[2][2:]) + "$" + parts[1] + parts[2]
+	} else if strings.HasPrefix(stub, "$bcrypt-sha256$2") {
+		parts := strings.Split(stub[15:], "$")
+		if len(parts) != 3 {
+			return ""
+		}
+
 		// 0: 2a,12
 		// 1: salt
 		// 2: hash
 		parts0 := strings.Split(parts[0], ",")
+		if len(parts0) != 2 {
+			return ""
+		}
+
 		return "$" + parts0[0] + "$" + fmt.Sprintf("%02s", parts0[1]) + "$" + parts[1] + parts[2]
 	} else {
 		return stub
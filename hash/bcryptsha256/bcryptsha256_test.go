@@ -0,0 +1,114 @@
+package bcryptsha256
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/bcrypt"
+)
+
+const upass = "táБℓə"
+
+// Test vectors from Python passlib's own tests.
+var pythonHashes = []struct {
+	password string
+	hash     string
+}{
+	// passlib 1.6, version 1 with bcrypt variant 2a.
+	{"", "$bcrypt-sha256$2a,5$E/e/2AOhqM5W/KJTFQzLce$F6dYSxOdAEoJZO2eoHUZWZljW/e0TXO"},
+	{"password", "$bcrypt-sha256$2a,5$5Hg1DKFqPE8C2aflZ5vVoe$12BjNE0p7axMg55.Y/mHsYiVuFBDQyu"},
+	{upass, "$bcrypt-sha256$2a,5$.US1fQ4TQS.ZTz/uJ5Kyn.$QNdPDOTKKT5/sovNz1iWg26quOU4Pje"},
+
+	// passlib 1.7, version 1 with bcrypt variant 2b.
+	{"password", "$bcrypt-sha256$2b,5$5Hg1DKFqPE8C2aflZ5vVoe$12BjNE0p7axMg55.Y/mHsYiVuFBDQyu"},
+	{upass, "$bcrypt-sha256$2b,5$.US1fQ4TQS.ZTz/uJ5Kyn.$QNdPDOTKKT5/sovNz1iWg26quOU4Pje"},
+
+	// passlib 1.7.3 and later, version 2.
+	{"", "$bcrypt-sha256$v=2,t=2b,r=5$E/e/2AOhqM5W/KJTFQzLce$WFPIZKtDDTriqWwlmRFfHiOTeheAZWe"},
+	{"password", "$bcrypt-sha256$v=2,t=2b,r=5$5Hg1DKFqPE8C2aflZ5vVoe$wOK1VFFtS8IGTrGa7.h5fs0u84qyPbS"},
+	{upass, "$bcrypt-sha256$v=2,t=2b,r=5$.US1fQ4TQS.ZTz/uJ5Kyn.$pzzgp40k8reM1CuQb03PvE0IDPQSdV6"},
+}
+
+func TestPythonCompatibility(t *testing.T) {
+	for _, v := range pythonHashes {
+		if !Crypter.SupportsStub(v.hash) {
+			t.Errorf("%s: not supported", v.hash)
+		}
+		if err := Crypter.Verify(v.password, v.hash); err != nil {
+			t.Errorf("%s: %v", v.hash, err)
+		}
+		if err := Crypter.Verify(v.password+"x", v.hash); err != abstract.ErrPasswordMismatch {
+			t.Errorf("%s: expected ErrPasswordMismatch, got %v", v.hash, err)
+		}
+		if p, err := Crypter.(abstract.ParamReader).ReadParams(v.hash); err != nil || p["cost"] != "5" {
+			t.Errorf("%s: unexpected params %v, %v", v.hash, p, err)
+		}
+	}
+}
+
+func TestMalformedV2(t *testing.T) {
+	for _, h := range []string{
+		"$bcrypt-sha256$v=2,t=2b,r=5$",
+		"$bcrypt-sha256$v=2,t=2b,r=5$5Hg1DKFqPE8C2aflZ5vVoe",
+		"$bcrypt-sha256$v=2,t=2b$5Hg1DKFqPE8C2aflZ5vVoe$wOK1VFFtS8IGTrGa7.h5fs0u84qyPbS",
+		"$bcrypt-sha256$v=2,r=5,t=2b$5Hg1DKFqPE8C2aflZ5vVoe$wOK1VFFtS8IGTrGa7.h5fs0u84qyPbS",
+	} {
+		if Crypter.SupportsStub(h) {
+			t.Errorf("%s: supported", h)
+		}
+		if err := Crypter.Verify("password", h); !errors.Is(err, abstract.ErrInvalidHash) {
+			t.Errorf("%s: expected ErrInvalidHash, got %v", h, err)
+		}
+	}
+}
+
+func TestNewWithCost(t *testing.T) {
+	for _, cost := range []int{3, 32} {
+		if _, err := NewWithCost(cost); err != bcrypt.ErrInvalidCost {
+			t.Errorf("cost %d: expected ErrInvalidCost, got %v", cost, err)
+		}
+	}
+
+	same, err := NewWithCost(5)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	higher, err := NewWithCost(6)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Existing hashes verify at their own cost, and those below the
+	// configured cost need rehashing.
+	for _, v := range pythonHashes {
+		if err := higher.Verify(v.password, v.hash); err != nil {
+			t.Errorf("%s: %v", v.hash, err)
+		}
+		if !higher.NeedsUpdate(v.hash) {
+			t.Errorf("%s: cost 5 hash does not need updating to cost 6", v.hash)
+		}
+	}
+
+	old, err := same.Hash(upass)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if same.NeedsUpdate(old) || !higher.NeedsUpdate(old) {
+		t.Errorf("%s: unexpected NeedsUpdate results", old)
+	}
+
+	h, err := higher.Hash(upass)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if p, err := higher.(abstract.ParamReader).ReadParams(h); err != nil || p["cost"] != "6" {
+		t.Errorf("%s: unexpected params %v, %v", h, p, err)
+	}
+	if err := Crypter.Verify(upass, h); err != nil {
+		t.Errorf("%s: not verified by Crypter: %v", h, err)
+	}
+	if higher.NeedsUpdate(h) {
+		t.Errorf("%s: new hash needs updating", h)
+	}
+}
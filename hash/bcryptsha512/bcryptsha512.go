@@ -0,0 +1,148 @@
+// Package bcryptsha512 implements bcrypt with a SHA512 prehash, in the same
+// format as the bcryptsha256 package but with a `$bcrypt-sha512$` identifier.
+//
+// As with bcrypt-sha256, the prehash removes bcrypt's password length
+// limitation. The base64-encoded SHA512 digest is 88 bytes long, so it is
+// truncated to bcrypt's 72 byte limit, leaving 432 bits of the digest; this
+// is what bcrypt would do anyway, but is done explicitly so that the result
+// does not depend on the bcrypt implementation.
+package bcryptsha512
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/bcrypt"
+)
+
+type scheme struct {
+	underlying abstract.Scheme
+	cost       int
+}
+
+// An implementation of Scheme implementing bcrypt with a SHA512 prehash,
+// which removes bcrypt's password length limitation.
+var Crypter abstract.Scheme
+
+// The recommended cost for bcrypt-sha512. This may change with subsequent releases.
+const RecommendedCost = bcrypt.RecommendedCost
+
+const prefix = "$bcrypt-sha512$"
+
+func init() {
+	Crypter = New(bcrypt.RecommendedCost)
+}
+
+// Instantiates a new Scheme implementing bcrypt-sha512 with the given cost.
+//
+// The recommended cost is RecommendedCost.
+func New(cost int) abstract.Scheme {
+	return &scheme{
+		underlying: bcrypt.New(cost),
+		cost:       cost,
+	}
+}
+
+func (s *scheme) Hash(password string) (string, error) {
+	p := s.prehash(password)
+	h, err := s.underlying.Hash(p)
+	if err != nil {
+		return "", err
+	}
+
+	return mangle(h), nil
+}
+
+func (s *scheme) Verify(password, hash string) error {
+	p := s.prehash(password)
+	return s.underlying.Verify(p, demangle(hash))
+}
+
+func (s *scheme) prehash(password string) string {
+	h := sha512.Sum512([]byte(password))
+	v := base64.StdEncoding.EncodeToString(h[:])
+	return v[:bcrypt.MaxPasswordLength]
+}
+
+func (s *scheme) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, prefix) && s.underlying.SupportsStub(demangle(stub))
+}
+
+func (s *scheme) NeedsUpdate(stub string) bool {
+	return s.underlying.NeedsUpdate(demangle(stub))
+}
+
+func (s *scheme) Params() map[string]string {
+	return map[string]string{"cost": fmt.Sprint(s.cost)}
+}
+
+func (s *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	cost := s.cost
+	err := abstract.ParseIntParams(params, map[string]*int{"cost": &cost})
+	if err != nil {
+		return nil, err
+	}
+
+	if cost < bcrypt.MinimumCost || cost > bcrypt.MaximumCost {
+		return nil, bcrypt.ErrInvalidCost
+	}
+
+	return New(cost), nil
+}
+
+func (s *scheme) ReadParams(hash string) (map[string]string, error) {
+	return s.underlying.(abstract.ParamReader).ReadParams(demangle(hash))
+}
+
+// The prehash is negligible, so the strength is that of the bcrypt hash.
+func (s *scheme) Strength(hash string) (float64, error) {
+	return s.underlying.(abstract.StrengthScheme).Strength(demangle(hash))
+}
+
+func (s *scheme) EstimateCost() abstract.Cost {
+	return s.underlying.(abstract.Coster).EstimateCost()
+}
+
+func (s *scheme) Describe() string {
+	return fmt.Sprintf("bcrypt-sha512(cost=%d)", s.cost)
+}
+
+func (s *scheme) String() string {
+	return fmt.Sprintf("bcrypt-sha512(%d)", s.cost)
+}
+
+// Converts a bcrypt-sha512 stub into the equivalent bcrypt stub, or returns
+// "" if the stub is malformed.
+func demangle(stub string) string {
+	if !strings.HasPrefix(stub, prefix+"2") {
+		return ""
+	}
+
+	// 0: 2b,12
+	// 1: salt
+	// 2: hash
+	parts := strings.Split(stub[len(prefix):], "$")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	parts0 := strings.Split(parts[0], ",")
+	if len(parts0) != 2 {
+		return ""
+	}
+
+	return "$" + parts0[0] + "$" + fmt.Sprintf("%02s", parts0[1]) + "$" + parts[1] + parts[2]
+}
+
+func mangle(hash string) string {
+	// 0: 2b
+	// 1: rounds
+	// 2: salt + hash
+	parts := strings.Split(hash[1:], "$")
+	salt := parts[2][0:22]
+	h := parts[2][22:]
+	return prefix + parts[0] + "," + parts[1] + "$" + salt + "$" + h
+}
@@ -0,0 +1,67 @@
+package bcryptsha512
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib/hash/bcryptsha256"
+)
+
+type test struct {
+	password string
+	hash     string
+}
+
+// Checked against the system crypt(3), prehashing with Python's hashlib.
+var tests = []test{
+	{"password", "$bcrypt-sha512$2a,05$R4VYL20Lcoz6acvvwQ1kX.$HGjaU.5GIDYVhZ9L1OTKJsQsjp51J4W"},
+	{strings.Repeat("x", 100), "$bcrypt-sha512$2a,05$FgG2JEyqLWwqsRrEvVFPq.$jLVUOvpBwiO8ajI300BDY8EgLbIFaWm"},
+	{"", "$bcrypt-sha512$2a,05$abcdefghijklmnopqrstuu$jhP9v678QQ14fDlEs97D9ySTXler1ca"},
+}
+
+const sha256Hash = "$bcrypt-sha256$2a,05$R4VYL20Lcoz6acvvwQ1kX.$C/cKqtZJaowFuNLDLMob7GR.gk2lfOi"
+
+func TestBcryptSHA512(t *testing.T) {
+	for i, tst := range tests {
+		if !Crypter.SupportsStub(tst.hash) {
+			t.Fatalf("test %d: hash not supported", i)
+		}
+		if err := Crypter.Verify(tst.password, tst.hash); err != nil {
+			t.Fatalf("test %d: err verifying: %v", i, err)
+		}
+		if err := Crypter.Verify(tst.password+"x", tst.hash); err == nil {
+			t.Fatalf("test %d: wrong password verified", i)
+		}
+		if !Crypter.NeedsUpdate(tst.hash) {
+			t.Fatalf("test %d: cost 5 hash does not need update", i)
+		}
+	}
+
+	h, err := New(5).Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$bcrypt-sha512$2a,05$") || New(5).NeedsUpdate(h) {
+		t.Fatalf("unexpected hash: %q", h)
+	}
+	if err := Crypter.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+
+	// Long passwords differing only after bcrypt's limit are distinct.
+	if err := Crypter.Verify(strings.Repeat("x", 99)+"y", tests[1].hash); err == nil {
+		t.Fatalf("prehash did not remove the length limit")
+	}
+}
+
+func TestPrehashVariants(t *testing.T) {
+	if Crypter.SupportsStub(sha256Hash) {
+		t.Fatalf("bcrypt-sha512 supports a bcrypt-sha256 hash")
+	}
+	if bcryptsha256.Crypter.SupportsStub(tests[0].hash) {
+		t.Fatalf("bcrypt-sha256 supports a bcrypt-sha512 hash")
+	}
+	if err := bcryptsha256.Crypter.Verify("password", sha256Hash); err != nil {
+		t.Fatalf("err verifying bcrypt-sha256 hash: %v", err)
+	}
+}
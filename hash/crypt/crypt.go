@@ -0,0 +1,170 @@
+// Package crypt implements a scheme which verifies any of the crypt(3) hash
+// formats supported by passlib, dispatching on the hash's $id$ prefix as
+// libc's crypt() does. It suits contexts which only need to verify whatever
+// /etc/shadow contains, without listing every scheme:
+//
+//   $1$                   md5-crypt
+//   $2$, $2a$, $2b$, $2y$ bcrypt
+//   $5$                   sha256-crypt
+//   $6$                   sha512-crypt
+//   $y$                   yescrypt
+//   _                     BSDi extended DES
+//   (none)                traditional DES
+//
+// New passwords are hashed with sha512-crypt by Crypter, or the scheme given
+// to New.
+package crypt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/bcrypt"
+	"github.com/al45tair/passlib/hash/descrypt"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/sha2crypt"
+	"github.com/al45tair/passlib/hash/yescrypt"
+)
+
+// An implementation of Scheme verifying any supported crypt(3) hash and
+// hashing new passwords with sha2crypt.Crypter512.
+var Crypter abstract.Scheme
+
+// Indicates that a hash is not in a supported crypt(3) format.
+var ErrInvalidHash = fmt.Errorf("unsupported crypt(3) hash")
+
+// The schemes handling each $id$.
+var schemesByID map[string]abstract.Scheme
+
+func init() {
+	schemesByID = map[string]abstract.Scheme{
+		"1":  md5crypt.Crypter,
+		"2":  bcrypt.Crypter,
+		"2a": bcrypt.Crypter,
+		"2b": bcrypt.Crypter,
+		"2y": bcrypt.Crypter,
+		"5":  sha2crypt.Crypter256,
+		"6":  sha2crypt.Crypter512,
+		"y":  yescrypt.Crypter,
+	}
+
+	Crypter = New(sha2crypt.Crypter512)
+}
+
+// Returns a scheme verifying any supported crypt(3) hash and hashing new
+// passwords with hasher, which should be one of the crypt(3) family, e.g. an
+// sha512-crypt scheme with more rounds. Hashes hasher supports are verified
+// by it; NeedsUpdate reports all other hashes.
+func New(hasher abstract.Scheme) abstract.Scheme {
+	return &scheme{hasher: hasher}
+}
+
+type scheme struct {
+	hasher abstract.Scheme
+}
+
+// Returns the scheme handling a hash, or nil if there is none.
+func (c *scheme) lookup(hash string) abstract.Scheme {
+	if c.hasher.SupportsStub(hash) {
+		return c.hasher
+	}
+
+	var s abstract.Scheme
+	switch {
+	case strings.HasPrefix(hash, "$"):
+		i := strings.IndexByte(hash[1:], '$')
+		if i < 0 {
+			return nil
+		}
+		s = schemesByID[hash[1:i+1]]
+	case strings.HasPrefix(hash, "_"):
+		s = descrypt.BSDiCrypter
+	default:
+		s = descrypt.Crypter
+	}
+
+	if s == nil || !s.SupportsStub(hash) {
+		return nil
+	}
+
+	return s
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	return c.lookup(stub) != nil
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return c.hasher.Hash(password)
+}
+
+func (c *scheme) HashBytes(password []byte) (string, error) {
+	if bs, ok := c.hasher.(abstract.ByteScheme); ok {
+		return bs.HashBytes(password)
+	}
+
+	return c.hasher.Hash(string(password))
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	s := c.lookup(hash)
+	if s == nil {
+		return abstract.InvalidHash(ErrInvalidHash)
+	}
+
+	return s.Verify(password, hash)
+}
+
+func (c *scheme) VerifyBytes(password []byte, hash string) error {
+	s := c.lookup(hash)
+	if s == nil {
+		return abstract.InvalidHash(ErrInvalidHash)
+	}
+
+	if bs, ok := s.(abstract.ByteScheme); ok {
+		return bs.VerifyBytes(password, hash)
+	}
+
+	return s.Verify(string(password), hash)
+}
+
+// Hashes not made by the hashing scheme always need updating.
+func (c *scheme) NeedsUpdate(stub string) bool {
+	if c.hasher.SupportsStub(stub) {
+		return c.hasher.NeedsUpdate(stub)
+	}
+
+	return c.lookup(stub) != nil
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	s := c.lookup(hash)
+	if s == nil {
+		return nil, abstract.InvalidHash(ErrInvalidHash)
+	}
+
+	if pr, ok := s.(abstract.ParamReader); ok {
+		return pr.ReadParams(hash)
+	}
+
+	return map[string]string{}, nil
+}
+
+func (c *scheme) Strength(hash string) (float64, error) {
+	s := c.lookup(hash)
+	if s == nil {
+		return 0, abstract.InvalidHash(ErrInvalidHash)
+	}
+
+	ss, ok := s.(abstract.StrengthScheme)
+	if !ok {
+		return 0, fmt.Errorf("cannot estimate the strength of %v hashes", s)
+	}
+
+	return ss.Strength(hash)
+}
+
+func (c *scheme) String() string {
+	return "crypt"
+}
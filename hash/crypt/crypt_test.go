@@ -0,0 +1,115 @@
+package crypt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/bcrypt"
+	"github.com/al45tair/passlib/hash/descrypt"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/sha2crypt"
+	"github.com/al45tair/passlib/hash/yescrypt"
+)
+
+// Hashes of "password" made by libxcrypt's crypt(3).
+var tests = []struct {
+	hash   string
+	scheme abstract.Scheme
+}{
+	{"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", md5crypt.Crypter},
+	{"$2a$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", bcrypt.Crypter},
+	{"$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", bcrypt.Crypter},
+	{"$2y$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", bcrypt.Crypter},
+	{"$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC.", sha2crypt.Crypter256},
+	{"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/", sha2crypt.Crypter512},
+	{"$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC", yescrypt.Crypter},
+	{"_J9..CCCC.MOp/ZbelpA", descrypt.BSDiCrypter},
+	{"abJnggxhB/yWI", descrypt.Crypter},
+}
+
+func TestDispatch(t *testing.T) {
+	for _, test := range tests {
+		if !Crypter.SupportsStub(test.hash) {
+			t.Fatalf("%q not supported", test.hash)
+		}
+		if s := Crypter.(*scheme).lookup(test.hash); s != test.scheme {
+			t.Fatalf("%q dispatched to %v, expected %v", test.hash, s, test.scheme)
+		}
+		if err := Crypter.Verify("password", test.hash); err != nil {
+			t.Fatalf("err verifying %q: %v", test.hash, err)
+		}
+		if err := Crypter.(abstract.ByteScheme).VerifyBytes([]byte("password"), test.hash); err != nil {
+			t.Fatalf("err verifying %q as bytes: %v", test.hash, err)
+		}
+		if err := Crypter.Verify("wrong", test.hash); err != abstract.ErrInvalidPassword {
+			t.Fatalf("expected ErrInvalidPassword for %q, got %v", test.hash, err)
+		}
+		if _, err := Crypter.(abstract.StrengthScheme).Strength(test.hash); err != nil {
+			t.Fatalf("err estimating strength of %q: %v", test.hash, err)
+		}
+
+		// Hashes other than sha512-crypt always need updating.
+		want := true
+		if test.scheme == sha2crypt.Crypter512 {
+			want = sha2crypt.Crypter512.NeedsUpdate(test.hash)
+		}
+		if Crypter.NeedsUpdate(test.hash) != want {
+			t.Fatalf("unexpected NeedsUpdate result for %q", test.hash)
+		}
+	}
+
+	for _, hash := range []string{
+		"",
+		"$",
+		"$1",
+		"$3$$8846f7eaee8fb117ad06bdd830b7586c",
+		"$apr1$FkJhrohe$bqA2mteQgQco/wa2eJWnU1",
+		"$argon2id$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA",
+		"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"*",
+		"!abJnggxhB/yWI",
+	} {
+		if Crypter.SupportsStub(hash) {
+			t.Fatalf("%q supported", hash)
+		}
+		if err := Crypter.Verify("password", hash); err == nil || !strings.Contains(err.Error(), ErrInvalidHash.Error()) {
+			t.Fatalf("unexpected error for %q: %v", hash, err)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	h, err := Crypter.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$6$") {
+		t.Fatalf("unexpected hash %q", h)
+	}
+	if err := Crypter.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+
+	if Crypter.NeedsUpdate(h) {
+		t.Fatalf("new hash needs update")
+	}
+
+	strong, err := sha2crypt.NewCrypter512(20000)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+
+	s := New(strong)
+	if !s.NeedsUpdate(h) {
+		t.Fatalf("hash with fewer rounds does not need update")
+	}
+
+	h, err = s.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$6$rounds=20000$") || s.NeedsUpdate(h) || Crypter.NeedsUpdate(h) {
+		t.Fatalf("unexpected hash %q", h)
+	}
+}
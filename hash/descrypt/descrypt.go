@@ -0,0 +1,154 @@
+// Package descrypt implements verification of the traditional DES-based
+// crypt(3) (des-crypt) and of the BSDi extended DES-based crypt(3)
+// (bsdi-crypt).
+//
+// Both schemes are hopelessly weak and are supported only so that legacy
+// hashes can be verified and upgraded to a modern scheme. Hash always fails
+// with ErrHashNotSupported and NeedsUpdate always returns true.
+package descrypt
+
+import "fmt"
+import "math"
+import "github.com/al45tair/passlib/hash/descrypt/raw"
+import "github.com/al45tair/passlib/abstract"
+
+// Indicates that the scheme only verifies existing hashes.
+var ErrHashNotSupported = fmt.Errorf("DES-based crypt is insecure and cannot be used for new hashes")
+
+// An implementation of Scheme verifying traditional DES-based crypt hashes.
+//
+// WARNING: des-crypt considers only the first eight characters of the
+// password and can be brute forced trivially. It is for legacy
+// compatibility only.
+var Crypter abstract.Scheme
+
+// An implementation of Scheme verifying BSDi extended DES-based crypt
+// hashes.
+//
+// WARNING: bsdi-crypt is for legacy compatibility only.
+var BSDiCrypter abstract.Scheme
+
+func init() {
+	Crypter = &desCrypter{}
+	BSDiCrypter = &bsdiCrypter{}
+}
+
+type desCrypter struct{}
+
+func (c *desCrypter) SupportsStub(stub string) bool {
+	_, _, err := raw.Parse(stub)
+	return err == nil
+}
+
+func (c *desCrypter) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (c *desCrypter) Verify(password, hash string) error {
+	salt, oldHash, err := raw.Parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, raw.Crypt(password, salt)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// des-crypt is always deprecated.
+func (c *desCrypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *desCrypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *desCrypter) ReadParams(hash string) (map[string]string, error) {
+	if _, _, err := raw.Parse(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// A traditional DES crypt hash takes 25 DES encryptions, for a strength of
+// under 5 bits.
+func (c *desCrypter) Strength(hash string) (float64, error) {
+	if _, _, err := raw.Parse(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(25), nil
+}
+
+func (c *desCrypter) String() string {
+	return "des-crypt"
+}
+
+type bsdiCrypter struct{}
+
+func (c *bsdiCrypter) SupportsStub(stub string) bool {
+	return len(stub) >= 1 && stub[0] == '_'
+}
+
+func (c *bsdiCrypter) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (c *bsdiCrypter) Verify(password, hash string) error {
+	rounds, salt, oldHash, err := raw.ParseExtended(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, raw.CryptExtended(password, rounds, salt)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// bsdi-crypt is always deprecated.
+func (c *bsdiCrypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *bsdiCrypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *bsdiCrypter) ReadParams(hash string) (map[string]string, error) {
+	rounds, _, _, err := raw.ParseExtended(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"rounds": fmt.Sprint(rounds)}, nil
+}
+
+// A BSDi extended DES crypt hash takes one DES encryption per round.
+func (c *bsdiCrypter) Strength(hash string) (float64, error) {
+	rounds, _, _, err := raw.ParseExtended(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(float64(rounds)), nil
+}
+
+func (c *bsdiCrypter) String() string {
+	return "bsdi-crypt"
+}
@@ -0,0 +1,32 @@
+package raw
+
+import "testing"
+import "crypto/des"
+import "encoding/binary"
+
+// With no salt, the implementation must agree with the standard library.
+func TestDES(t *testing.T) {
+	key := uint64(0x133457799BBCDFF1)
+	block := uint64(0x0123456789ABCDEF)
+
+	for i := 0; i < 64; i++ {
+		var k, b, out [8]byte
+		binary.BigEndian.PutUint64(k[:], key)
+		binary.BigEndian.PutUint64(b[:], block)
+
+		c, err := des.NewCipher(k[:])
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		c.Encrypt(out[:], b[:])
+
+		subkeys := keySchedule(key)
+		got := encrypt(block, &subkeys, 0, 1)
+		if got != binary.BigEndian.Uint64(out[:]) {
+			t.Fatalf("mismatch: key %016x block %016x: got %016x, expected %x", key, block, got, out)
+		}
+
+		key = key*6364136223846793005 + 1442695040888963407
+		block = block*2862933555777941757 + 3037000493
+	}
+}
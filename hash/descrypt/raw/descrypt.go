@@ -0,0 +1,123 @@
+// Package raw provides a raw implementation of the traditional DES-based
+// crypt(3) and of the BSDi extended DES-based crypt(3).
+package raw
+
+// The length of a traditional DES crypt salt.
+const SaltLength = 2
+
+// The length of a BSDi extended DES crypt salt.
+const ExtendedSaltLength = 4
+
+// The maximum number of rounds representable in a BSDi extended DES crypt
+// hash.
+const MaximumRounds = 1<<24 - 1
+
+// The number of rounds used by traditional DES crypt.
+const traditionalRounds = 25
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Calculates the traditional DES-based crypt(3), as found in Seventh Edition
+// Unix. Only the first eight characters of the password are significant.
+//
+// The salt must consist of SaltLength characters from the crypt base64
+// alphabet.
+//
+// The output is a 13 character string, the first two characters of which are
+// the salt.
+func Crypt(password, salt string) string {
+	var key uint64
+	for i := 0; i < 8; i++ {
+		key <<= 8
+		if i < len(password) {
+			key |= uint64(password[i]) << 1
+		}
+	}
+
+	s := decode64(salt)
+	subkeys := keySchedule(key)
+	block := encrypt(0, &subkeys, saltMask(s), traditionalRounds)
+
+	return salt + encodeBlock(block)
+}
+
+// Calculates the BSDi extended DES-based crypt(3). All characters of the
+// password are significant.
+//
+// rounds must be between 1 and MaximumRounds, and the salt must consist of
+// ExtendedSaltLength characters from the crypt base64 alphabet.
+//
+// The output is a 20 character string in the form
+//
+//   _RRRRSSSShhhhhhhhhhh
+//
+// where R is the rounds, S the salt and h the hash.
+func CryptExtended(password string, rounds uint32, salt string) string {
+	var key uint64
+	for i := 0; i < 8; i++ {
+		key <<= 8
+		if i < len(password) {
+			key |= uint64(password[i]) << 1
+		}
+	}
+
+	// Fold in the remainder of the password, eight characters at a time.
+	subkeys := keySchedule(key)
+	for p := 8; p < len(password); p += 8 {
+		key = encrypt(key, &subkeys, 0, 1)
+		for i := 0; i < 8 && p+i < len(password); i++ {
+			key ^= uint64(password[p+i]) << 1 << (56 - 8*uint(i))
+		}
+		subkeys = keySchedule(key)
+	}
+
+	s := decode64(salt)
+	block := encrypt(0, &subkeys, saltMask(s), int(rounds))
+
+	return "_" + encode64(rounds, 4) + salt + encodeBlock(block)
+}
+
+// Encodes a 64-bit block as 11 characters, most significant bits first.
+func encodeBlock(block uint64) string {
+	out := make([]byte, 11)
+	for i := range out {
+		out[i] = itoa64[(block>>(58-6*uint(i)))&0x3f]
+	}
+	// The final character holds the last four bits, padded with zeroes.
+	out[10] = itoa64[(block<<2)&0x3f]
+	return string(out)
+}
+
+// Encodes n characters of v, least significant bits first.
+func encode64(v uint32, n int) string {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = itoa64[v&0x3f]
+		v >>= 6
+	}
+	return string(out)
+}
+
+// Decodes a crypt base64 string, least significant bits first. Characters
+// outside the alphabet are treated as '.'.
+func decode64(s string) (v uint32) {
+	for i := len(s) - 1; i >= 0; i-- {
+		v <<= 6
+		if d := index64(s[i]); d > 0 {
+			v |= uint32(d)
+		}
+	}
+	return
+}
+
+func index64(c byte) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 38
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 12
+	case c >= '.' && c <= '9':
+		return int(c - '.')
+	}
+	return -1
+}
@@ -0,0 +1,67 @@
+package raw
+
+import "testing"
+
+func TestCrypt(t *testing.T) {
+	vectors := []struct {
+		password, hash string
+	}{
+		{"", "..X8NBuQ4l6uQ"},
+		{"password", "abJnggxhB/yWI"},
+		{"test", "aaqPiZY5xR5l."},
+		{"foob", "arlEKn0OzVJn."},
+		{"U*U*U*U*", "CCNf8Sbh3HDfQ"},
+		// Only the first eight characters are significant.
+		{"longpassword123", "zzSu2QW7SNyD2"},
+		{"longpass", "zzSu2QW7SNyD2"},
+	}
+
+	for _, v := range vectors {
+		salt, _, err := Parse(v.hash)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", v.hash, err)
+		}
+
+		if h := Crypt(v.password, salt); h != v.hash {
+			t.Errorf("Crypt(%q, %q): got %q, expected %q", v.password, salt, h, v.hash)
+		}
+	}
+}
+
+func TestCryptExtended(t *testing.T) {
+	vectors := []struct {
+		password, hash string
+	}{
+		{"password", "_J9..saltJW8FtKdEkNM"},
+		{"test", "_...0abcd0WzOMeOx1fM"},
+		{"U*U*U*U*", "_J9..CCCCXBrJUJV154M"},
+		{"U*U*U*U*_", "_J9..XXXX80wszn2Znj6"},
+		{"U*U*U*U*U*U*U*U*U*U*U*U*U*U*", "_J9..SOMEsVDHP.jGpPs"},
+		{"a long password over eight", "_Z/..SALTE0ufo9M8yBs"},
+	}
+
+	for _, v := range vectors {
+		rounds, salt, _, err := ParseExtended(v.hash)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", v.hash, err)
+		}
+
+		if h := CryptExtended(v.password, rounds, salt); h != v.hash {
+			t.Errorf("CryptExtended(%q, %d, %q): got %q, expected %q", v.password, rounds, salt, h, v.hash)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "a", "abc", "ab!nggxhB/yWI", "abJnggxhB/yWIx", "$1$abc"} {
+		if _, _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+
+	for _, s := range []string{"", "_J9..sal", "_J9..salt!W8FtKdEkNM", "_....salt", "J9..saltJW8FtKdEkNM"} {
+		if _, _, _, err := ParseExtended(s); err == nil {
+			t.Errorf("ParseExtended(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package raw
+
+import "fmt"
+
+// Indicates that a password hash or stub is invalid.
+var ErrInvalidStub = fmt.Errorf("invalid des-crypt stub")
+
+// Indicates that a BSDi extended DES crypt hash specifies zero rounds.
+var ErrInvalidRounds = fmt.Errorf("invalid bsdi-crypt rounds")
+
+// Scans a traditional DES crypt stub or hash to determine the salt and hash.
+//
+// The format is as follows:
+//
+//   sshhhhhhhhhhh   // hash
+//   ss              // stub
+//
+func Parse(stub string) (salt, hash string, err error) {
+	if (len(stub) != SaltLength && len(stub) != SaltLength+11) || !isBase64(stub) {
+		err = ErrInvalidStub
+		return
+	}
+
+	return stub[:SaltLength], stub[SaltLength:], nil
+}
+
+// Scans a BSDi extended DES crypt stub or hash to determine the rounds, salt
+// and hash.
+//
+// The format is as follows:
+//
+//   _RRRRSSSShhhhhhhhhhh   // hash
+//   _RRRRSSSS              // stub
+//
+func ParseExtended(stub string) (rounds uint32, salt, hash string, err error) {
+	if (len(stub) != 9 && len(stub) != 20) || stub[0] != '_' || !isBase64(stub[1:]) {
+		err = ErrInvalidStub
+		return
+	}
+
+	rounds = decode64(stub[1:5])
+	if rounds == 0 {
+		err = ErrInvalidRounds
+		return
+	}
+
+	return rounds, stub[5:9], stub[9:], nil
+}
+
+func isBase64(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if index64(s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+// Package ldap implements verification of the RFC 2307 `{SHA}` and `{SSHA}`
+// password hashes found in LDAP `userPassword` attributes, such as those
+// exported from OpenLDAP.
+//
+// `{SHA}` is followed by the base64 encoding of the SHA-1 digest of the
+// password; `{SSHA}` by that of the SHA-1 digest of the password and salt,
+// followed by the salt. The prefixes are matched case-insensitively.
+//
+// SHA-1 is fast and, for `{SHA}`, unsalted, so these schemes are supported
+// only so that migrated users can log in once and have their hashes upgraded
+// to a modern scheme. Hash always fails with ErrHashNotSupported and
+// NeedsUpdate always returns true.
+//
+// `{CRYPT}` values wrap a crypt(3) hash, which passlib can verify directly
+// once unwrapped; see UnwrapCrypt and FormatCrypt.
+package ldap
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that the scheme only verifies existing hashes.
+var ErrHashNotSupported = fmt.Errorf("LDAP SHA-1 hashes are insecure and cannot be used for new hashes")
+
+// Indicates that a hash is not a well-formed {SHA} or {SSHA} hash.
+var ErrInvalidHash = fmt.Errorf("invalid LDAP hash")
+
+// An implementation of Scheme verifying salted SHA-1 ({SSHA}) hashes.
+//
+// WARNING: SHA-1 is far too fast for password hashing. This is for
+// migration only.
+var SSHACrypter abstract.Scheme
+
+// An implementation of Scheme verifying unsalted SHA-1 ({SHA}) hashes.
+//
+// WARNING: unsalted SHA-1 can be brute forced trivially. This is for
+// migration only.
+var SHACrypter abstract.Scheme
+
+const (
+	prefixSHA   = "{SHA}"
+	prefixSSHA  = "{SSHA}"
+	prefixCrypt = "{CRYPT}"
+)
+
+func init() {
+	SSHACrypter = &scheme{prefix: prefixSSHA, salted: true}
+	SHACrypter = &scheme{prefix: prefixSHA}
+}
+
+type scheme struct {
+	prefix string
+	salted bool
+}
+
+// Returns the digest and salt from a hash with the scheme's prefix.
+func (c *scheme) parse(hash string) (digest, salt []byte, err error) {
+	if len(hash) < len(c.prefix) || !strings.EqualFold(hash[:len(c.prefix)], c.prefix) {
+		return nil, nil, ErrInvalidHash
+	}
+
+	data, err := base64.StdEncoding.DecodeString(hash[len(c.prefix):])
+	if err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+
+	if c.salted {
+		if len(data) <= sha1.Size {
+			return nil, nil, ErrInvalidHash
+		}
+	} else if len(data) != sha1.Size {
+		return nil, nil, ErrInvalidHash
+	}
+
+	return data[:sha1.Size], data[sha1.Size:], nil
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	_, _, err := c.parse(stub)
+	return err == nil
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	digest, salt, err := c.parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	h := sha1.New()
+	h.Write([]byte(password))
+	h.Write(salt)
+
+	if subtle.ConstantTimeCompare(digest, h.Sum(nil)) != 1 {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// LDAP SHA-1 hashes are always deprecated.
+func (c *scheme) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *scheme) IsDeprecated() bool {
+	return true
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	if _, _, err := c.parse(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// A {SHA} or {SSHA} hash is a single SHA-1 compression, so has a strength of
+// 0.
+func (c *scheme) Strength(hash string) (float64, error) {
+	if _, _, err := c.parse(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return 0, nil
+}
+
+func (c *scheme) String() string {
+	if c.salted {
+		return "ldap-ssha"
+	}
+
+	return "ldap-sha"
+}
+
+// Returns the crypt(3) hash wrapped by a {CRYPT} userPassword value, and
+// true, or "" and false if value is not a {CRYPT} value. The prefix is
+// matched case-insensitively.
+func UnwrapCrypt(value string) (string, bool) {
+	if len(value) < len(prefixCrypt) || !strings.EqualFold(value[:len(prefixCrypt)], prefixCrypt) {
+		return "", false
+	}
+
+	return value[len(prefixCrypt):], true
+}
+
+// Wraps a crypt(3) hash, such as one made by passlib's sha512-crypt or
+// bcrypt schemes, as a {CRYPT} userPassword value, so that an LDAP server
+// using crypt(3) can verify it.
+func FormatCrypt(hash string) string {
+	return prefixCrypt + hash
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	vectors := []struct {
+		scheme   interface{ Verify(string, string) error }
+		password string
+		hash     string
+	}{
+		{SHACrypter, "password", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		{SHACrypter, "password", "{sha}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		{SSHACrypter, "password", "{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME"},
+		{SSHACrypter, "password", "{SSHA}yrht1iYXEIkejLVu42JWkadd80RzYWx0c2FsdA=="},
+		{SSHACrypter, "táБℓə", "{SSHA}4zkoUfPDS8ikA/tulj3UBzGs4NRhYmNk"},
+	}
+
+	for i, v := range vectors {
+		if err := v.scheme.Verify(v.password, v.hash); err != nil {
+			t.Fatalf("test %d: err verifying %q: %v", i, v.hash, err)
+		}
+		if err := v.scheme.Verify(v.password+"x", v.hash); err == nil {
+			t.Fatalf("test %d: wrong password verified against %q", i, v.hash)
+		}
+	}
+
+	if !SSHACrypter.NeedsUpdate("{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME") || !SHACrypter.NeedsUpdate("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=") {
+		t.Fatalf("LDAP hash does not need update")
+	}
+
+	if _, err := SSHACrypter.Hash("password"); err != ErrHashNotSupported {
+		t.Fatalf("expected ErrHashNotSupported, got %v", err)
+	}
+}
+
+func TestSupportsStub(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"{SSHA}",
+		"{SSHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", // no salt
+		"{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME!",
+		"{SHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME", // salted
+		"{CRYPT}$1$saltsalt$",
+		"W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+	} {
+		if SSHACrypter.SupportsStub(hash) || SHACrypter.SupportsStub(hash) {
+			t.Fatalf("malformed hash supported: %q", hash)
+		}
+	}
+
+	if SHACrypter.SupportsStub("{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME") || SSHACrypter.SupportsStub("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=") {
+		t.Fatalf("scheme supports the other's prefix")
+	}
+}
+
+func TestCrypt(t *testing.T) {
+	hash := "$6$saltsalt$hash"
+	value := FormatCrypt(hash)
+	if value != "{CRYPT}"+hash {
+		t.Fatalf("unexpected {CRYPT} value: %q", value)
+	}
+
+	for _, v := range []string{value, "{crypt}" + hash} {
+		if h, ok := UnwrapCrypt(v); !ok || h != hash {
+			t.Fatalf("failed to unwrap %q: %q", v, h)
+		}
+	}
+
+	if _, ok := UnwrapCrypt("{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME"); ok {
+		t.Fatalf("unwrapped a non-{CRYPT} value")
+	}
+}
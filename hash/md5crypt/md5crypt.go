@@ -0,0 +1,100 @@
+// Package md5crypt implements md5-crypt.
+//
+// md5-crypt is weak and is supported only so that legacy hashes can be
+// verified and upgraded to a modern scheme. NeedsUpdate always returns true.
+package md5crypt
+
+import "math"
+import "expvar"
+import "crypto/rand"
+import "io"
+import "github.com/al45tair/passlib/hash/md5crypt/raw"
+import "github.com/al45tair/passlib/abstract"
+
+var cMD5CryptHashCalls = expvar.NewInt("passlib.md5crypt.hashCalls")
+var cMD5CryptVerifyCalls = expvar.NewInt("passlib.md5crypt.verifyCalls")
+
+// An implementation of Scheme performing md5-crypt.
+//
+// WARNING: md5-crypt should not be used for new applications under any
+// circumstances. It should be used for legacy compatibility only.
+var Crypter abstract.Scheme
+
+func init() {
+	Crypter = &md5Crypter{}
+}
+
+type md5Crypter struct{}
+
+func (c *md5Crypter) SupportsStub(stub string) bool {
+	return len(stub) >= 3 && stub[0] == '$' && stub[1] == '1' && stub[2] == '$'
+}
+
+func (c *md5Crypter) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *md5Crypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	cMD5CryptHashCalls.Add(1)
+
+	buf := make([]byte, 6)
+	_, err := io.ReadFull(saltReader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	salt := raw.EncodeBase64(buf)
+
+	return raw.Crypt(string(password), salt), nil
+}
+
+func (c *md5Crypter) Verify(password, hash string) error {
+	cMD5CryptVerifyCalls.Add(1)
+
+	salt, oldHash, err := raw.Parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, raw.Crypt(password, salt)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// md5-crypt is always deprecated.
+func (c *md5Crypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *md5Crypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *md5Crypter) ReadParams(hash string) (map[string]string, error) {
+	if _, _, err := raw.Parse(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// Every md5-crypt hash takes 1,000 rounds of MD5, so has a strength of about
+// 10 bits whatever its salt.
+func (c *md5Crypter) Strength(hash string) (float64, error) {
+	if _, _, err := raw.Parse(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(1000), nil
+}
+
+func (c *md5Crypter) String() string {
+	return "md5-crypt"
+}
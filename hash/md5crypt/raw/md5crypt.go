@@ -0,0 +1,118 @@
+// Package raw provides a raw implementation of the md5-crypt primitive and
+// of its Apache variant, apr1.
+package raw
+
+import "crypto/md5"
+
+// The maximum length of an md5-crypt salt. Longer salts are truncated.
+const MaximumSaltLength = 8
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Calculates md5-crypt, as originally implemented by Poul-Henning Kamp for
+// FreeBSD. The password must be in plaintext and be a UTF-8 string.
+//
+// The salt should consist of characters from the crypt base64 alphabet; it
+// is truncated to MaximumSaltLength characters.
+//
+// The output is in modular crypt format.
+func Crypt(password, salt string) string {
+	return md5Crypt(password, salt, "$1$")
+}
+
+// Calculates Apache's apr1 variant of md5-crypt, as used in .htpasswd files.
+// It differs from md5-crypt only in its magic string.
+//
+// The output is in modular crypt format.
+func CryptAPR1(password, salt string) string {
+	return md5Crypt(password, salt, "$apr1$")
+}
+
+func md5Crypt(password, salt, magic string) string {
+	if len(salt) > MaximumSaltLength {
+		salt = salt[0:MaximumSaltLength]
+	}
+
+	passwordb := []byte(password)
+	saltb := []byte(salt)
+
+	alt := md5.New()
+	alt.Write(passwordb)
+	alt.Write(saltb)
+	alt.Write(passwordb)
+	final := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(passwordb)
+	ctx.Write([]byte(magic))
+	ctx.Write(saltb)
+
+	for pl := len(passwordb); pl > 0; pl -= 16 {
+		if pl > 16 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(final[0:pl])
+		}
+	}
+
+	// This odd construction is faithful to the original implementation.
+	for i := len(passwordb); i != 0; i >>= 1 {
+		if (i & 1) != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(passwordb[0:1])
+		}
+	}
+
+	final = ctx.Sum(nil)
+
+	// Slow things down.
+	for i := 0; i < 1000; i++ {
+		c := md5.New()
+		if (i & 1) != 0 {
+			c.Write(passwordb)
+		} else {
+			c.Write(final)
+		}
+		if (i % 3) != 0 {
+			c.Write(saltb)
+		}
+		if (i % 7) != 0 {
+			c.Write(passwordb)
+		}
+		if (i & 1) != 0 {
+			c.Write(final)
+		} else {
+			c.Write(passwordb)
+		}
+		final = c.Sum(nil)
+	}
+
+	out := make([]byte, 0, 22)
+	out = to64(out, uint(final[0])<<16|uint(final[6])<<8|uint(final[12]), 4)
+	out = to64(out, uint(final[1])<<16|uint(final[7])<<8|uint(final[13]), 4)
+	out = to64(out, uint(final[2])<<16|uint(final[8])<<8|uint(final[14]), 4)
+	out = to64(out, uint(final[3])<<16|uint(final[9])<<8|uint(final[15]), 4)
+	out = to64(out, uint(final[4])<<16|uint(final[10])<<8|uint(final[5]), 4)
+	out = to64(out, uint(final[11]), 2)
+
+	return magic + salt + "$" + string(out)
+}
+
+// Encodes a byte string using the crypt base64 variant, in the byte order used
+// by md5-crypt. len(b) must be a multiple of 3.
+func EncodeBase64(b []byte) string {
+	out := make([]byte, 0, len(b)/3*4)
+	for i := 0; i+2 < len(b); i += 3 {
+		out = to64(out, uint(b[i])<<16|uint(b[i+1])<<8|uint(b[i+2]), 4)
+	}
+	return string(out)
+}
+
+func to64(out []byte, v uint, n int) []byte {
+	for ; n > 0; n-- {
+		out = append(out, itoa64[v&0x3f])
+		v >>= 6
+	}
+	return out
+}
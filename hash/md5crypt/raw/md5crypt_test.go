@@ -0,0 +1,81 @@
+package raw
+
+import "testing"
+
+type test struct {
+	password string
+	salt     string
+	output   string
+}
+
+var tests = []test{
+	// From John the Ripper, as used by Python passlib; checked against the
+	// system crypt(3).
+	{"U*U*U*U*", "dXc3I7Rw", "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"},
+	{"U*U***U", "dXc3I7Rw", "$1$dXc3I7Rw$94JPyQc/eAgQ3MFMCoMF.0"},
+	{"U*U***U*", "dXc3I7Rw", "$1$dXc3I7Rw$is1mVIAEtAhIzSdfn5JOO0"},
+	{"*U*U*U*U", "eQT9Hwbt", "$1$eQT9Hwbt$XtuElNJD.eW5MN5UCWyTQ0"},
+	{"", "Eu.GHtia", "$1$Eu.GHtia$CFkL/nE1BYTlEPiVx1VWX0"},
+	// From Python passlib.
+	{"", "dOHYPKoP", "$1$dOHYPKoP$tnxS1T8Q6VVn3kpV8cN6o."},
+	{" ", "m/5ee7ol", "$1$m/5ee7ol$bZn0kIBFipq39e.KDXX8I0"},
+	{"test", "ec6XvcoW", "$1$ec6XvcoW$ghEtNK2U1MC5l.Dwgi3020"},
+	// Edge cases.
+	{"", "", "$1$$qRPK7m23GJusamGpoGLby/"},
+	{"a", "a", "$1$a$44cUw6Nm5bX0muHWNIwub0"},
+	{"abcdefghijklmnopqrstuvwxyz0123456789", "abcdefgh", "$1$abcdefgh$lRarj3bp7AX0dooeT2MCd1"},
+	{"password", "abcdefghij", "$1$abcdefgh$G//4keteveJp0qb8z2DxG/"},
+	{"táБℓə", "s", "$1$s$3vyc3YLjtyAF6awlePwkN1"},
+}
+
+func TestMD5Crypt(t *testing.T) {
+	for i, tst := range tests {
+		out := Crypt(tst.password, tst.salt)
+		if out != tst.output {
+			t.Errorf("test %d: md5-crypt mismatch: %#v (expected %#v)", i, out, tst.output)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for i, tst := range tests {
+		salt, hash, err := Parse(tst.output)
+		if err != nil {
+			t.Fatalf("test %d: err parsing: %v", i, err)
+		}
+		if Crypt(tst.password, salt) != tst.output || hash != tst.output[len(tst.output)-22:] {
+			t.Errorf("test %d: parse mismatch: %#v %#v", i, salt, hash)
+		}
+	}
+
+	for _, stub := range []string{"", "$1", "$5$salt$hash", "$1$salt$hash$extra", "$1$saltsalts$hash"} {
+		if _, _, err := Parse(stub); err != ErrInvalidStub {
+			t.Errorf("expected ErrInvalidStub for %#v, got %v", stub, err)
+		}
+	}
+}
+
+func TestAPR1(t *testing.T) {
+	// Generated by htpasswd and openssl passwd -apr1.
+	vectors := []test{
+		{"myPassword", "r31.....", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"},
+		{"password", "saltsalt", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"},
+		{"", "abc", "$apr1$abc$BfqKdn9xFDWJPa3kcp/PH0"},
+	}
+
+	for i, tst := range vectors {
+		out := CryptAPR1(tst.password, tst.salt)
+		if out != tst.output {
+			t.Errorf("test %d: apr1 mismatch: %#v (expected %#v)", i, out, tst.output)
+		}
+
+		salt, _, err := ParseAPR1(tst.output)
+		if err != nil || salt != tst.salt {
+			t.Errorf("test %d: parse mismatch: %#v %v", i, salt, err)
+		}
+	}
+
+	if _, _, err := ParseAPR1("$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"); err != ErrInvalidStub {
+		t.Errorf("expected ErrInvalidStub for md5-crypt hash, got %v", err)
+	}
+}
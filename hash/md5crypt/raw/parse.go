@@ -0,0 +1,54 @@
+package raw
+
+import "fmt"
+import "strings"
+
+// Indicates that a password hash or stub is invalid.
+var ErrInvalidStub = fmt.Errorf("invalid md5-crypt stub")
+
+// Scans an md5-crypt modular crypt stub or modular crypt hash to determine
+// the salt and hash.
+//
+// The format is as follows:
+//
+//   $1$salt$hash    // hash
+//   $1$salt         // stub
+//
+func Parse(stub string) (salt, hash string, err error) {
+	return parse("$1$", stub)
+}
+
+// Scans an apr1 modular crypt stub or hash, as for Parse.
+//
+//   $apr1$salt$hash // hash
+//   $apr1$salt      // stub
+//
+func ParseAPR1(stub string) (salt, hash string, err error) {
+	return parse("$apr1$", stub)
+}
+
+func parse(magic, stub string) (salt, hash string, err error) {
+	if !strings.HasPrefix(stub, magic) {
+		err = ErrInvalidStub
+		return
+	}
+
+	parts := strings.Split(stub[len(magic):], "$")
+
+	switch len(parts) {
+	case 1:
+		salt = parts[0]
+	case 2:
+		salt = parts[0]
+		hash = parts[1]
+	default:
+		err = ErrInvalidStub
+		return
+	}
+
+	if len(salt) > MaximumSaltLength {
+		err = ErrInvalidStub
+	}
+
+	return
+}
@@ -0,0 +1,114 @@
+// Package mysql implements verification of MySQL 4.1+ and MariaDB
+// `PASSWORD()` hashes, as found in the `authentication_string` (or older
+// `Password`) column of the mysql.user table.
+//
+// Hashes are written as `*` followed by the 40 uppercase hexadecimal digits
+// of SHA1(SHA1(password)); lowercase digits are also accepted.
+//
+// These hashes are unsalted and extremely fast to compute, so they are
+// supported only so that migrated users can log in once and have their
+// hashes upgraded to a modern scheme. Hash always fails with
+// ErrHashNotSupported and NeedsUpdate always returns true.
+package mysql
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that the scheme only verifies existing hashes.
+var ErrHashNotSupported = fmt.Errorf("MySQL hashes are insecure and cannot be used for new hashes")
+
+// Indicates that a hash is not a well-formed MySQL 4.1 hash.
+var ErrInvalidHash = fmt.Errorf("invalid MySQL 4.1 hash")
+
+// An implementation of Scheme verifying MySQL 4.1 hashes.
+//
+// WARNING: MySQL 4.1 hashes can be brute forced trivially. They are for
+// migration only.
+var Crypter abstract.Scheme
+
+func init() {
+	Crypter = &scheme{}
+}
+
+type scheme struct{}
+
+// Returns the MySQL 4.1 hash of password, as MySQL's PASSWORD() function
+// would.
+func Password(password string) string {
+	inner := sha1.Sum([]byte(password))
+	outer := sha1.Sum(inner[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(outer[:]))
+}
+
+// Returns the uppercase hexadecimal digest from a MySQL 4.1 hash.
+func parse(hash string) (string, error) {
+	if len(hash) != 41 || hash[0] != '*' {
+		return "", ErrInvalidHash
+	}
+
+	digest := hash[1:]
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", ErrInvalidHash
+	}
+
+	return strings.ToUpper(digest), nil
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	_, err := parse(stub)
+	return err == nil
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	digest, err := parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	if !abstract.SecureCompare("*"+digest, Password(password)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// MySQL 4.1 hashes are always deprecated.
+func (c *scheme) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *scheme) IsDeprecated() bool {
+	return true
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	if _, err := parse(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// A MySQL 4.1 hash is two unsalted SHA-1 compressions, so has a strength of
+// 1.
+func (c *scheme) Strength(hash string) (float64, error) {
+	if _, err := parse(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return 1, nil
+}
+
+func (c *scheme) String() string {
+	return "mysql41"
+}
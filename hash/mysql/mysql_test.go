@@ -0,0 +1,50 @@
+package mysql
+
+import "testing"
+
+func TestPassword(t *testing.T) {
+	vectors := []struct {
+		password string
+		hash     string
+	}{
+		{"mypass", "*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF4"},
+		{"password", "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+		{"táБℓə", "*E7AFE21A9CFA2FC9D15D942AE8FB5C240FE5837B"},
+	}
+
+	for i, v := range vectors {
+		if h := Password(v.password); h != v.hash {
+			t.Errorf("test %d: MySQL hash mismatch: %q (expected %q)", i, h, v.hash)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, hash := range []string{
+		"*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF4",
+		"*6c8989366eaf75bb670ad8ea7a7fc1176a95cef4",
+	} {
+		if !Crypter.SupportsStub(hash) {
+			t.Fatalf("hash not supported: %q", hash)
+		}
+		if err := Crypter.Verify("mypass", hash); err != nil {
+			t.Fatalf("err verifying %q: %v", hash, err)
+		}
+		if err := Crypter.Verify("Mypass", hash); err == nil {
+			t.Fatalf("wrong password verified against %q", hash)
+		}
+		if !Crypter.NeedsUpdate(hash) {
+			t.Fatalf("MySQL hash does not need update")
+		}
+	}
+
+	for _, hash := range []string{"", "*", "*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF", "*6C8989366EAF75BB670AD8EA7A7FC1176A95CEFG", "6C8989366EAF75BB670AD8EA7A7FC1176A95CEF4", "*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF44"} {
+		if Crypter.SupportsStub(hash) {
+			t.Fatalf("malformed hash supported: %q", hash)
+		}
+	}
+
+	if _, err := Crypter.Hash("mypass"); err != ErrHashNotSupported {
+		t.Fatalf("expected ErrHashNotSupported, got %v", err)
+	}
+}
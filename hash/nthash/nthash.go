@@ -0,0 +1,127 @@
+// Package nthash implements verification of Windows NT hashes, the MD4
+// digest of the UTF-16LE encoded password, as found in dumps of Active
+// Directory or SAM databases.
+//
+// Hashes are written as `$nt$` followed by the 32 hexadecimal digits of the
+// digest; Python passlib's `$3$$` form is also accepted.
+//
+// NT hashes are unsalted and extremely fast to compute, so they are
+// supported only so that migrated users can log in once and have their
+// hashes upgraded to a modern scheme. Hash always fails with
+// ErrHashNotSupported and NeedsUpdate always returns true.
+package nthash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/al45tair/passlib/abstract"
+	"golang.org/x/crypto/md4"
+)
+
+// Indicates that the scheme only verifies existing hashes.
+var ErrHashNotSupported = fmt.Errorf("NT hashes are insecure and cannot be used for new hashes")
+
+// Indicates that a hash is not a well-formed NT hash.
+var ErrInvalidHash = fmt.Errorf("invalid NT hash")
+
+// An implementation of Scheme verifying NT hashes.
+//
+// WARNING: NT hashes can be brute forced trivially. They are for migration
+// only.
+var Crypter abstract.Scheme
+
+func init() {
+	Crypter = &scheme{}
+}
+
+type scheme struct{}
+
+// Returns the NT hash of password as lowercase hexadecimal.
+func NTHash(password string) string {
+	units := utf16.Encode([]rune(password))
+	buf := make([]byte, 2*len(units))
+	for i, u := range units {
+		buf[2*i] = byte(u)
+		buf[2*i+1] = byte(u >> 8)
+	}
+
+	h := md4.New()
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the lowercase hexadecimal digest from an NT hash.
+func parse(hash string) (string, error) {
+	var digest string
+	switch {
+	case strings.HasPrefix(hash, "$nt$"):
+		digest = hash[4:]
+	case strings.HasPrefix(hash, "$3$$"):
+		digest = hash[4:]
+	default:
+		return "", ErrInvalidHash
+	}
+
+	if len(digest) != 32 {
+		return "", ErrInvalidHash
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", ErrInvalidHash
+	}
+
+	return strings.ToLower(digest), nil
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, "$nt$") || strings.HasPrefix(stub, "$3$$")
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	digest, err := parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	if !abstract.SecureCompare(digest, NTHash(password)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// NT hashes are always deprecated.
+func (c *scheme) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *scheme) IsDeprecated() bool {
+	return true
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	if _, err := parse(hash); err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{}, nil
+}
+
+// An NT hash is a single unsalted MD4 compression, so has a strength of 0.
+func (c *scheme) Strength(hash string) (float64, error) {
+	if _, err := parse(hash); err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return 0, nil
+}
+
+func (c *scheme) String() string {
+	return "nthash"
+}
@@ -0,0 +1,68 @@
+package nthash
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+func TestNTHash(t *testing.T) {
+	vectors := []struct {
+		password string
+		digest   string
+	}{
+		{"password", "8846f7eaee8fb117ad06bdd830b7586c"},
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+		{"U*U*U*U*", "cc2c846fbf2013694591d0ec141c4928"},
+		{"táБℓə", "272b4516906989c16ca2f242b17b02f5"},
+		{"\U0001F600", "4b58a10cc20a4e7d808d218e1f80aabc"}, // surrogate pair
+	}
+
+	for i, v := range vectors {
+		if d := NTHash(v.password); d != v.digest {
+			t.Errorf("test %d: NT hash mismatch: %q (expected %q)", i, d, v.digest)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, hash := range []string{
+		"$nt$8846f7eaee8fb117ad06bdd830b7586c",
+		"$nt$8846F7EAEE8FB117AD06BDD830B7586C",
+		"$3$$8846f7eaee8fb117ad06bdd830b7586c",
+	} {
+		if !Crypter.SupportsStub(hash) {
+			t.Fatalf("hash not supported: %q", hash)
+		}
+		if err := Crypter.Verify("password", hash); err != nil {
+			t.Fatalf("err verifying %q: %v", hash, err)
+		}
+		if err := Crypter.Verify("Password", hash); err == nil {
+			t.Fatalf("wrong password verified against %q", hash)
+		}
+		if !Crypter.NeedsUpdate(hash) {
+			t.Fatalf("NT hash does not need update")
+		}
+	}
+
+	for _, hash := range []string{"", "8846f7eaee8fb117ad06bdd830b7586c", "$3$8846f7eaee8fb117ad06bdd830b7586c"} {
+		if Crypter.SupportsStub(hash) {
+			t.Fatalf("hash without prefix supported: %q", hash)
+		}
+	}
+
+	// Malformed hashes are left to Verify to reject.
+	for _, hash := range []string{"$nt$", "$nt$8846f7eaee8fb117ad06bdd830b7586", "$nt$8846f7eaee8fb117ad06bdd830b7586g", "$3$$8846f7eaee8fb117ad06bdd830b7586c0"} {
+		if !Crypter.SupportsStub(hash) {
+			t.Fatalf("malformed hash not supported: %q", hash)
+		}
+		if err := Crypter.Verify("password", hash); !errors.Is(err, abstract.ErrInvalidHash) {
+			t.Fatalf("expected ErrInvalidHash verifying %q, got %v", hash, err)
+		}
+	}
+
+	if _, err := Crypter.Hash("password"); err != ErrHashNotSupported {
+		t.Fatalf("expected ErrHashNotSupported, got %v", err)
+	}
+}
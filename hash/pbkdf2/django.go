@@ -0,0 +1,223 @@
+package pbkdf2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/pbkdf2/raw"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// An implementation of Scheme implementing Django's PBKDF2-SHA256 password
+// format (pbkdf2_sha256$iterations$salt$hash), so that hashes can be shared
+// with Django applications.
+//
+// Uses RecommendedRoundsDjangoSHA256.
+var DjangoSHA256Crypter abstract.Scheme
+
+// The iteration count used by Django 5.2.
+const RecommendedRoundsDjangoSHA256 = 1000000
+
+// The length of salts generated for Django hashes, as used by Django.
+const DjangoSaltLength = 22
+
+const djangoIdentSHA256 = "pbkdf2_sha256$"
+
+const djangoSaltChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func init() {
+	DjangoSHA256Crypter = NewDjangoSHA256(RecommendedRoundsDjangoSHA256)
+}
+
+// Returns a scheme implementing Django's PBKDF2-SHA256 format, hashing new
+// passwords with the specified number of iterations. NeedsUpdate reports
+// hashes using fewer iterations.
+func NewDjangoSHA256(iterations int) abstract.Scheme {
+	return &djangoScheme{
+		Rounds: iterations,
+	}
+}
+
+func (s *djangoScheme) Params() map[string]string {
+	return map[string]string{"rounds": strconv.Itoa(s.Rounds)}
+}
+
+func (s *djangoScheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	rounds := s.Rounds
+	err := abstract.ParseIntParams(params, map[string]*int{"rounds": &rounds})
+	if err != nil {
+		return nil, err
+	}
+
+	if rounds < raw.MinRounds || rounds > raw.MaxRounds {
+		return nil, raw.ErrInvalidRounds
+	}
+
+	return NewDjangoSHA256(rounds), nil
+}
+
+type djangoScheme struct {
+	Rounds int
+}
+
+func (s *djangoScheme) Hash(password string) (string, error) {
+	return s.HashBytes([]byte(password))
+}
+
+func (s *djangoScheme) HashBytes(password []byte) (string, error) {
+	return s.HashWithSaltReader(password, rand.Reader)
+}
+
+func (s *djangoScheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	salt, err := djangoSalt(saltReader)
+	if err != nil {
+		return "", err
+	}
+
+	return djangoSHA256(password, salt, s.Rounds), nil
+}
+
+func (s *djangoScheme) Verify(password, stub string) error {
+	return s.VerifyBytes([]byte(password), stub)
+}
+
+func (s *djangoScheme) VerifyBytes(password []byte, stub string) error {
+	rounds, salt, oldHash, err := parseDjango(stub)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(stub, djangoSHA256(password, salt, rounds)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+func (s *djangoScheme) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, djangoIdentSHA256)
+}
+
+func (s *djangoScheme) FIPSApproved() bool {
+	return true
+}
+
+func (s *djangoScheme) NeedsUpdate(stub string) bool {
+	rounds, _, _, err := parseDjango(stub)
+	if err != nil {
+		return err == raw.ErrInvalidRounds
+	}
+
+	stored := map[string]uint64{"rounds": uint64(rounds)}
+	return abstract.CompareParams(stored, s.target()) < 0
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (s *djangoScheme) target() map[string]uint64 {
+	return map[string]uint64{"rounds": uint64(s.Rounds)}
+}
+
+func (s *djangoScheme) ReadParams(hash string) (map[string]string, error) {
+	rounds, _, _, err := parseDjango(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"rounds": strconv.Itoa(rounds)}, nil
+}
+
+// As for pbkdf2-sha256, the strength is log2(2*rounds).
+func (s *djangoScheme) Strength(hash string) (float64, error) {
+	rounds, _, _, err := parseDjango(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(2 * float64(rounds)), nil
+}
+
+func (s *djangoScheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Threads:  1,
+		Time:     map[string]uint64{"rounds": uint64(s.Rounds)},
+		Strength: math.Log2(2 * float64(s.Rounds)),
+	}
+}
+
+func (s *djangoScheme) Describe() string {
+	return fmt.Sprintf("django-pbkdf2-sha256(rounds=%d)", s.Rounds)
+}
+
+func (s *djangoScheme) String() string {
+	return fmt.Sprintf("django-pbkdf2-sha256(%d)", s.Rounds)
+}
+
+func djangoSHA256(password []byte, salt string, rounds int) string {
+	key := pbkdf2.Key(password, []byte(salt), rounds, sha256.Size, sha256.New)
+	return fmt.Sprintf("%s%d$%s$%s", djangoIdentSHA256, rounds, salt, base64.StdEncoding.EncodeToString(key))
+}
+
+// Django salts are random alphanumeric strings, used as-is.
+func djangoSalt(saltReader io.Reader) (string, error) {
+	salt := make([]byte, 0, DjangoSaltLength)
+	buf := make([]byte, DjangoSaltLength)
+
+	for len(salt) < DjangoSaltLength {
+		_, err := io.ReadFull(saltReader, buf)
+		if err != nil {
+			return "", err
+		}
+
+		// Reject bytes which would bias the result.
+		for _, b := range buf {
+			if int(b) < 256/len(djangoSaltChars)*len(djangoSaltChars) && len(salt) < DjangoSaltLength {
+				salt = append(salt, djangoSaltChars[int(b)%len(djangoSaltChars)])
+			}
+		}
+	}
+
+	return string(salt), nil
+}
+
+// Parses a Django PBKDF2-SHA256 hash:
+//
+//   pbkdf2_sha256$iterations$salt$hash
+//
+func parseDjango(stub string) (rounds int, salt, hash string, err error) {
+	if !strings.HasPrefix(stub, djangoIdentSHA256) {
+		err = raw.ErrInvalidStub
+		return
+	}
+
+	parts := strings.Split(stub[len(djangoIdentSHA256):], "$")
+	if len(parts) != 3 || parts[1] == "" {
+		err = raw.ErrInvalidStub
+		return
+	}
+
+	n, err := strconv.ParseUint(parts[0], 10, 31)
+	if err != nil {
+		err = raw.ErrInvalidStub
+		return
+	}
+
+	rounds = int(n)
+	if rounds < raw.MinRounds || rounds > raw.MaxRounds {
+		err = raw.ErrInvalidRounds
+		return
+	}
+
+	return rounds, parts[1], parts[2], nil
+}
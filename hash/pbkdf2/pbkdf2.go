@@ -1,7 +1,10 @@
 // Package pbkdf2 implements a modular crypt format for PBKDF2-SHA1,
-// PBKDF2-SHA256 and PBKDF-SHA512.
+// PBKDF2-SHA224, PBKDF2-SHA256, PBKDF2-SHA384 and PBKDF-SHA512, plus
+// PBKDF2-SHA3-256 and PBKDF2-SHA3-512.
 //
 // The format is the same as that used by Python's passlib and is compatible.
+// Python's passlib has no SHA-3 variants; those use the same format with the
+// identifiers $pbkdf2-sha3-256$ and $pbkdf2-sha3-512$.
 package pbkdf2
 
 import (
@@ -9,75 +12,202 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"fmt"
 	"github.com/al45tair/passlib/abstract"
 	"github.com/al45tair/passlib/hash/pbkdf2/raw"
+	"golang.org/x/crypto/sha3"
 	"hash"
+	"io"
+	"math"
 	"strings"
 )
 
 // An implementation of Scheme implementing a number of PBKDF2 modular crypt
 // formats used by Python's passlib ($pbkdf2$, $pbkdf2-sha256$,
-// $pbkdf2-sha512$).
+// $pbkdf2-sha512$), plus $pbkdf2-sha224$ and $pbkdf2-sha384$ in the same
+// format.
 //
 // Uses RecommendedRounds.
 //
 // WARNING: SHA1 should not be used for new applications under any
 // circumstances. It should be used for legacy compatibility only.
 var SHA1Crypter abstract.Scheme
+var SHA224Crypter abstract.Scheme
 var SHA256Crypter abstract.Scheme
+var SHA384Crypter abstract.Scheme
 var SHA512Crypter abstract.Scheme
 
+// Implementations of Scheme using HMAC-SHA3-256 and HMAC-SHA3-512 as the
+// PRF, with the identifiers $pbkdf2-sha3-256$ and $pbkdf2-sha3-512$.
+var SHA3_256Crypter abstract.Scheme
+var SHA3_512Crypter abstract.Scheme
+
 const (
 	RecommendedRoundsSHA1   = 131000
+	RecommendedRoundsSHA224 = 29000
 	RecommendedRoundsSHA256 = 29000
+	RecommendedRoundsSHA384 = 25000
 	RecommendedRoundsSHA512 = 25000
+
+	RecommendedRoundsSHA3_256 = 29000
+	RecommendedRoundsSHA3_512 = 25000
+)
+
+// Minimum iteration counts recommended for new hashes by the OWASP Password
+// Storage Cheat Sheet (2023). The Recommended* values above predate this
+// guidance and are kept for compatibility; use NewSHA256 or NewSHA512 to
+// hash with more iterations.
+const (
+	OWASPMinRoundsSHA1   = 1300000
+	OWASPMinRoundsSHA256 = 600000
+	OWASPMinRoundsSHA512 = 210000
 )
 
 const SaltLength = 16
 
 func init() {
 	SHA1Crypter = New("$pbkdf2$", sha1.New, RecommendedRoundsSHA1)
+	SHA224Crypter = New("$pbkdf2-sha224$", sha256.New224, RecommendedRoundsSHA224)
 	SHA256Crypter = New("$pbkdf2-sha256$", sha256.New, RecommendedRoundsSHA256)
+	SHA384Crypter = New("$pbkdf2-sha384$", sha512.New384, RecommendedRoundsSHA384)
 	SHA512Crypter = New("$pbkdf2-sha512$", sha512.New, RecommendedRoundsSHA512)
+	SHA3_256Crypter = New("$pbkdf2-sha3-256$", sha3.New256, RecommendedRoundsSHA3_256)
+	SHA3_512Crypter = New("$pbkdf2-sha3-512$", sha3.New512, RecommendedRoundsSHA3_512)
+}
+
+// Returns a PBKDF2-SHA256 scheme which hashes new passwords with the
+// specified number of iterations. Verify uses the count in the stored hash,
+// and NeedsUpdate reports hashes using fewer iterations than this.
+//
+// Returns an error if iterations is not positive; see OWASPMinRoundsSHA256
+// for the currently recommended minimum.
+func NewSHA256(iterations int) (abstract.Scheme, error) {
+	return newChecked("$pbkdf2-sha256$", sha256.New, iterations, OWASPMinRoundsSHA256)
+}
+
+// Like NewSHA256, but for PBKDF2-SHA512; see OWASPMinRoundsSHA512.
+func NewSHA512(iterations int) (abstract.Scheme, error) {
+	return newChecked("$pbkdf2-sha512$", sha512.New, iterations, OWASPMinRoundsSHA512)
+}
+
+func newChecked(ident string, hf func() hash.Hash, rounds, recommended int) (abstract.Scheme, error) {
+	if rounds < raw.MinRounds || rounds > raw.MaxRounds {
+		return nil, fmt.Errorf("pbkdf2 iterations must be between %d and %d, got %d (OWASP recommends at least %d)",
+			raw.MinRounds, raw.MaxRounds, rounds, recommended)
+	}
+
+	return New(ident, hf, rounds), nil
+}
+
+func (s *scheme) Params() map[string]string {
+	return map[string]string{"rounds": fmt.Sprint(s.Rounds)}
+}
+
+func (s *scheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	rounds := s.Rounds
+	err := abstract.ParseIntParams(params, map[string]*int{"rounds": &rounds})
+	if err != nil {
+		return nil, err
+	}
+
+	if rounds < raw.MinRounds || rounds > raw.MaxRounds {
+		return nil, raw.ErrInvalidRounds
+	}
+
+	return NewWithEncoding(s.Ident, s.HashFunc, rounds, s.Encoding), nil
+}
+
+func (s *scheme) name() string {
+	name := strings.Trim(s.Ident, "$")
+	if name == "pbkdf2" {
+		name = "pbkdf2-sha1"
+	}
+
+	return name
+}
+
+func (s *scheme) Describe() string {
+	return fmt.Sprintf("%s(rounds=%d)", s.name(), s.Rounds)
+}
+
+func (s *scheme) String() string {
+	return fmt.Sprintf("%s(%d)", s.name(), s.Rounds)
 }
 
 type scheme struct {
 	Ident    string
 	HashFunc func() hash.Hash
 	Rounds   int
+	Encoding abstract.Base64Encoding
 }
 
 func New(ident string, hf func() hash.Hash, rounds int) abstract.Scheme {
+	return NewWithEncoding(ident, hf, rounds, abstract.Base64Default)
+}
+
+// Like New, but new hashes encode their salt and digest using the given
+// variant of base64 rather than passlib's adapted alphabet, to match other
+// implementations which use the standard one. Verify accepts hashes in any
+// variant.
+func NewWithEncoding(ident string, hf func() hash.Hash, rounds int, encoding abstract.Base64Encoding) abstract.Scheme {
+	if encoding == abstract.Base64Default {
+		encoding = abstract.Base64Adapted
+	}
+
 	return &scheme{
 		Ident:    ident,
 		HashFunc: hf,
 		Rounds:   rounds,
+		Encoding: encoding,
 	}
 }
 
 func (s *scheme) Hash(password string) (string, error) {
+	return s.HashBytes([]byte(password))
+}
+
+func (s *scheme) HashBytes(password []byte) (string, error) {
+	return s.HashWithSaltReader(password, rand.Reader)
+}
+
+func (s *scheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
 	salt := make([]byte, SaltLength)
-	_, err := rand.Read(salt)
+	_, err := io.ReadFull(saltReader, salt)
 	if err != nil {
 		return "", err
 	}
 
-	hash := raw.Hash([]byte(password), salt, s.Rounds, s.HashFunc)
+	hash := raw.Key(password, salt, s.Rounds, s.HashFunc)
 
-	newHash := fmt.Sprintf("%s%d$%s$%s", s.Ident, s.Rounds, raw.Base64Encode(salt), hash)
+	newHash := fmt.Sprintf("%s%d$%s$%s", s.Ident, s.Rounds, s.Encoding.Encode(salt), s.Encoding.Encode(hash))
 	return newHash, nil
 }
 
 func (s *scheme) Verify(password, stub string) (err error) {
+	return s.VerifyBytes([]byte(password), stub)
+}
+
+func (s *scheme) VerifyBytes(password []byte, stub string) (err error) {
 	_, rounds, salt, oldHash, err := raw.Parse(stub)
 	if err != nil {
-		return
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	// As in Python passlib, the checksum is always a whole digest.
+	oldKey, err := raw.Base64Decode(oldHash)
+	if err != nil || len(oldKey) != s.HashFunc().Size() {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
 	}
 
-	newHash := raw.Hash([]byte(password), salt, rounds, s.HashFunc)
+	newKey := raw.Key(password, salt, rounds, s.HashFunc)
 
-	if len(newHash) == 0 || !abstract.SecureCompare(oldHash, newHash) {
+	if len(newKey) == 0 || subtle.ConstantTimeCompare(oldKey, newKey) != 1 {
 		err = abstract.ErrInvalidPassword
 	}
 
@@ -88,7 +218,109 @@ func (s *scheme) SupportsStub(stub string) bool {
 	return strings.HasPrefix(stub, s.Ident)
 }
 
+// PBKDF2 is approved by NIST SP 800-132 when used with an approved hash
+// function, which SHA-1 is no longer for new hashes. SHA-3 is approved by
+// FIPS 202.
+func (s *scheme) FIPSApproved() bool {
+	switch s.Ident {
+	case "$pbkdf2-sha224$", "$pbkdf2-sha256$", "$pbkdf2-sha384$", "$pbkdf2-sha512$",
+		"$pbkdf2-sha3-256$", "$pbkdf2-sha3-512$":
+		return true
+	}
+	return false
+}
+
 func (s *scheme) NeedsUpdate(stub string) bool {
 	_, rounds, salt, _, err := raw.Parse(stub)
-	return err == raw.ErrInvalidRounds || rounds < s.Rounds || len(salt) < SaltLength
+	if err != nil {
+		return err == raw.ErrInvalidRounds
+	}
+
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"rounds":      uint64(rounds),
+	}
+
+	return abstract.CompareParams(stored, s.target()) < 0
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (s *scheme) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": SaltLength,
+		"rounds":      uint64(s.Rounds),
+	}
+}
+
+func (s *scheme) ReadParams(hash string) (map[string]string, error) {
+	_, rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"rounds": fmt.Sprint(rounds)}, nil
+}
+
+func (s *scheme) SplitHash(hash string) (salt, digest []byte, params map[string]string, err error) {
+	if !strings.HasPrefix(hash, s.Ident) {
+		return nil, nil, nil, abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	_, rounds, salt, checksum, err := raw.Parse(hash)
+	if err == nil {
+		digest, err = raw.Base64Decode(checksum)
+	}
+	if err == nil && len(digest) != s.HashFunc().Size() {
+		err = raw.ErrInvalidStub
+	}
+	if err != nil {
+		return nil, nil, nil, abstract.InvalidHash(err)
+	}
+
+	return salt, digest, map[string]string{"rounds": fmt.Sprint(rounds)}, nil
+}
+
+func (s *scheme) JoinHash(salt, digest []byte, params map[string]string) (string, error) {
+	var rounds int
+	err := abstract.ParseAllIntParams(params, map[string]*int{"rounds": &rounds})
+	if err != nil {
+		return "", err
+	}
+
+	if len(salt) == 0 || len(digest) != s.HashFunc().Size() {
+		return "", raw.ErrInvalidStub
+	}
+
+	return fmt.Sprintf("%s%d$%s$%s", s.Ident, rounds, s.Encoding.Encode(salt), s.Encoding.Encode(digest)), nil
+}
+
+// Each PBKDF2 iteration takes two compressions of the underlying hash (one
+// for each half of the HMAC), so the strength is log2(2*rounds), plus one
+// bit for SHA-384, SHA-512 and SHA-3, whose compressions (or Keccak
+// permutations) cost about two of SHA-256's.
+func (s *scheme) Strength(hash string) (float64, error) {
+	_, rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return s.strength(rounds), nil
+}
+
+func (s *scheme) strength(rounds int) float64 {
+	strength := math.Log2(2 * float64(rounds))
+	switch s.Ident {
+	case "$pbkdf2-sha384$", "$pbkdf2-sha512$", "$pbkdf2-sha3-256$", "$pbkdf2-sha3-512$":
+		strength++
+	}
+
+	return strength
+}
+
+func (s *scheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Threads:  1,
+		Time:     map[string]uint64{"rounds": uint64(s.Rounds)},
+		Strength: s.strength(s.Rounds),
+	}
 }
@@ -1,6 +1,13 @@
 package pbkdf2
 
 import "testing"
+import "bytes"
+import "strings"
+import "crypto/sha1"
+import "crypto/sha256"
+import "crypto/sha512"
+import "github.com/al45tair/passlib/abstract"
+import "github.com/al45tair/passlib/hash/pbkdf2/raw"
 
 type test struct {
 	password string
@@ -126,6 +133,48 @@ func TestPBKDF2_SHA1(t *testing.T) {
 	}
 }
 
+// Hashes in Python passlib's pbkdf2_sha1 layout, computed with hashlib using
+// passlib's adapted base64 for the salt and checksum. The salt exercises the
+// '.' and '/' characters.
+var test_sha1_fixed_salt = []struct {
+	password string
+	rounds   int
+	hash     string
+}{
+	{"password", 1000, "$pbkdf2$1000$..../wAQgxBRhyCSizDTjw$nVosxWN9F2.muy2J9ZyPYUZEUhE"},
+	{"correct horse battery staple", 131000, "$pbkdf2$131000$..../wAQgxBRhyCSizDTjw$V7BbUlIJpPeZJda5be7F774Aiuc"},
+}
+
+func TestPBKDF2_SHA1_RoundTrip(t *testing.T) {
+	salt := []byte{0xfb, 0xef, 0xbe, 0xff, 0x00, 0x10, 0x83, 0x10, 0x51, 0x87, 0x20, 0x92, 0x8b, 0x30, 0xd3, 0x8f}
+
+	for _, tst := range test_sha1_fixed_salt {
+		s := New("$pbkdf2$", sha1.New, tst.rounds).(abstract.SaltReaderScheme)
+		h, err := s.HashWithSaltReader([]byte(tst.password), bytes.NewReader(salt))
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+		if h != tst.hash {
+			t.Errorf("got %q, expected %q", h, tst.hash)
+		}
+
+		if err := SHA1Crypter.Verify(tst.password, tst.hash); err != nil {
+			t.Errorf("unable to verify %q: %v", tst.hash, err)
+		}
+	}
+
+	// passlib rejects zero-padded rounds and truncated checksums.
+	for _, h := range []string{
+		"$pbkdf2$01000$..../wAQgxBRhyCSizDTjw$nVosxWN9F2.muy2J9ZyPYUZEUhE",
+		"$pbkdf2$1000$..../wAQgxBRhyCSizDTjw$nVosxWN9F2.muy2J9Zy",
+	} {
+		err := SHA1Crypter.Verify("password", h)
+		if err == nil || err == abstract.ErrInvalidPassword {
+			t.Errorf("unexpected result for %q: %v", h, err)
+		}
+	}
+}
+
 func TestPBKDF2_SHA256(t *testing.T) {
 	var crypter = SHA256Crypter
 	var test_hashes = test_sha256
@@ -220,6 +269,135 @@ func TestPBKDF2_SHA512(t *testing.T) {
 	}
 }
 
+var test_sha224 = []test{
+	{"", "$pbkdf2-sha224$29000$8keGH11EdbfL/OVC4TRPgA$WyFGoR6yzIiii6aSUhLcTbJ97bQo/ATxEulK6w"},
+	{"a", "$pbkdf2-sha224$29000$CY90o20xhKKIOrYbFhC0qg$dkc6pYta2Q6yA6Xe9HUZKrJ35F8OTqiWnKIGBQ"},
+	{"abc", "$pbkdf2-sha224$29000$4dTfqRNw0CN7fu2lTuoldg$z30Q2nFzVK6JSALzyzhBxVx5paeAP58TYCPQsw"},
+	{"abcdefghijklmnop", "$pbkdf2-sha224$29000$5WWy.yoV0k7.SVuIrc6V0g$uSR9wXibz9VOYLIfiglFLIIo6gIat1hcMVugXw"},
+	{"67890./", "$pbkdf2-sha224$29000$6uxwhQr2Mn.dAMnhrScaVw$psenqF5krl0CnQpQb49gkMV9IZA8BNrjbOUroA"},
+	{"QRSTUVWXYZ012345", "$pbkdf2-sha224$29000$jL4jwTu4Enwvfiuj8sfPKA$a6/F4D.QAp1qZmOpU/XfI2S6uwmHcwwL/K1iIg"},
+	{"password", "$pbkdf2-sha224$29000$9vXlhKbA3iQh1FUYtIvwXQ$PEhgT0lAEPlQs5y6yehHAaSZNeX8.t/juTQQsg"},
+}
+
+var test_sha384 = []test{
+	{"", "$pbkdf2-sha384$25000$tN0Oxh6H4jkxI4KxNtIvkA$McNrtzI9Vbto4.RD89Vzf0tXsK.Kn6F.8HFL5AtAOXtBhifgApC84Vva/64qGNAI"},
+	{"a", "$pbkdf2-sha384$25000$5AN6VKuGE7I8hPtI8e5J2Q$pVuj9aV2FrBsPDDsDGhfxphYrC5tP5M6qV1PoLGHyMEUJDoeTqsX1An0D41Tnddq"},
+	{"abc", "$pbkdf2-sha384$25000$sSYE5o9B.vlBrTCkTkoKwQ$/fXqMi14X1TAd8FgAlhSh1SlbYKpss9w4PLTlX77tSbOaPMHRSgNMLYnOQKjureO"},
+	{"abcdefghijklmnop", "$pbkdf2-sha384$25000$S4w4.pHjHvlaFDhf8C/eRg$eSFz9mBMueRPgCLa321i/s40RlkYtToXgIdzESbMZle9shbvstaGvsqc8RX5tbq2"},
+	{"67890./", "$pbkdf2-sha384$25000$iIvRUxODGl41Igq23IhuYA$IqWgEb9jcCQaFydh/u3W4iqQZvvgese/.a0Zj2BlTABE5TbawDdYnpDLlI909vxq"},
+	{"QRSTUVWXYZ012345", "$pbkdf2-sha384$25000$IhR1kaja1iWWDTL2clEnBA$yc8tmjmSUb/c1eWd9BskqEXCJBjHgTY44o4L2cJ358e3HiHxcTfFfX/KxsNoSP9w"},
+	{"password", "$pbkdf2-sha384$25000$XMogIMbtyhMDdHrxCyu5aA$YVX4B/l2vn1sk8TzTzj.YyqtXwV4j5ePq5nxsFLpVNkcn78hQR6oF8cie/PY6coA"},
+}
+
+var test_sha3_256 = []test{
+	{"", "$pbkdf2-sha3-256$29000$KLoxGVTusJaAxZeTuCNC6A$/Jg5L/9p3.WLfNkt0IfS5pSEt1mpUaD9rWob8xqLtXo"},
+	{"a", "$pbkdf2-sha3-256$29000$dLE5mk9BgTtb0RnZ0OUtOg$haLTfwDSNVUOGKvIDLYzopYjRVHsM68Oxr7XFwTRAB0"},
+	{"abc", "$pbkdf2-sha3-256$29000$6qx1I3KvMmxgrqvR9iiTBQ$IyDbXJIb5xw2yKiwD0175VbAIkVCJS7xWiIduHTlI7M"},
+	{"abcdefghijklmnop", "$pbkdf2-sha3-256$29000$.cvKLy229vO55wNQMBy2yA$7dU5ag4lzxcMKn0m9bGdOj/SXIV9ixuARi82UpmVTmM"},
+	{"67890./", "$pbkdf2-sha3-256$29000$bsa4pYxTjVebNZMyT3LvNw$qM7zsLJ.8YGg2BYApHxYlN/IH3og/K.J00OpcNi0mLw"},
+	{"QRSTUVWXYZ012345", "$pbkdf2-sha3-256$29000$NtW9lcAwxCAuNEd3EZ7rig$0ajzZO1JcHEQ833e.Idh4Yv6R4qE1E/X7tbDdlWaHEI"},
+	{"password", "$pbkdf2-sha3-256$29000$Q68BWW49uRsfR51cb5NrTw$fYBToi2CH7iGsYn2dvLsSRFFCCUMxveGuAaH6sFxyYs"},
+}
+
+var test_sha3_512 = []test{
+	{"", "$pbkdf2-sha3-512$25000$ua.jMcmaPQNE6h08zjTVag$Yq/91HY4SDezJPo4dvjSLmCGrNa998dJ5Yu4FYTxWPUlkl0JhV/Jc4tBndXlsAcEsWZAbt7.bKNkBqqEEEP5Bg"},
+	{"a", "$pbkdf2-sha3-512$25000$Cc5ZzU8kl6p1F9eS7RqQNA$5m5RC0lKYw5J.BGL4.iVdN0LHtaXPkxD6jV4YblLf1Mh5T6PpoUQB3GRhiNB/FP.HgY/6BPchxhLchuw/Gv0/Q"},
+	{"abc", "$pbkdf2-sha3-512$25000$d.ANR2FVPLSw.HyW4PxO.Q$EDdGjrwQCj7gb2aAbFLHeOfzDj9/ehhsXzLIVFykzT3IZtSSNJd3u3.c5nK4lo/ksax3tMui4SLsx4WLPumY8w"},
+	{"abcdefghijklmnop", "$pbkdf2-sha3-512$25000$KHg9wIfrM0zn68ReBkq7.Q$ZX7OUfdRUN19PJVbVPfdC1YHN.KZsshWEfRhgyRxfGihYZX/TIjMrRm0vHlKRgJX0gpdzDeSOQp5tGf40RO1lw"},
+	{"67890./", "$pbkdf2-sha3-512$25000$TTj/7x0Kl9LimMjSd/t27A$jdCTzQz/7.iTykif4i4yeuUFIAWAn6AnFvHAZZy5MoJ11DggK.C6P/rI9xM2rHQy3o3MaVhBQTyRI96l/THUVg"},
+	{"QRSTUVWXYZ012345", "$pbkdf2-sha3-512$25000$pLOWNlOh/Jc5lkKv6gRwaA$5AI3LamNNAOjhAogWAXxHR5QTAj.nuP26h/qFrF7wedZEsPsFitMACHnz5KuvxOWXMGGYQooPPkrfFTzhcptAw"},
+	{"password", "$pbkdf2-sha3-512$25000$LoVIYOKOt2E5VceOZqwceg$x/t4/AXI4edv3ppJnIdwrh.i7c6g4LTTTfw98W5i2YO8c8/C1SD6piy2NK51AtvXGnBkjtr4mKEDFaTJrjd/MA"},
+}
+
+func TestPBKDF2_SHA224_SHA384(t *testing.T) {
+	// Generated with Python's hashlib.pbkdf2_hmac, encoded as passlib does.
+	for _, c := range []struct {
+		crypter     abstract.Scheme
+		test_hashes []test
+	}{
+		{SHA224Crypter, test_sha224},
+		{SHA384Crypter, test_sha384},
+		{SHA3_256Crypter, test_sha3_256},
+		{SHA3_512Crypter, test_sha3_512},
+	} {
+		for _, test := range c.test_hashes {
+			if !c.crypter.SupportsStub(test.hash) {
+				t.Errorf("crypter reports not support valid stub %s", test.hash)
+			}
+			if err := c.crypter.Verify(test.password, test.hash); err != nil {
+				t.Errorf("unable to verify password %s: %v", test.password, err)
+			}
+			if err := c.crypter.Verify(test.password+"x", test.hash); err == nil {
+				t.Errorf("invalid password accepted for %s", test.hash)
+			}
+		}
+
+		hash, err := c.crypter.Hash("helloworld")
+		if err != nil {
+			t.Fatalf("recieved error whilst hashing password: %v", err)
+		}
+		if err := c.crypter.Verify("helloworld", hash); err != nil {
+			t.Errorf("valid password not accepted: %v", err)
+		}
+	}
+
+	// Neighbouring identifiers must not claim each other's hashes.
+	all := []abstract.Scheme{SHA1Crypter, SHA224Crypter, SHA256Crypter, SHA384Crypter, SHA512Crypter, SHA3_256Crypter, SHA3_512Crypter}
+	hashes := []string{test_sha1[0].hash, test_sha224[0].hash, test_sha256[0].hash, test_sha384[0].hash, test_sha512[0].hash, test_sha3_256[0].hash, test_sha3_512[0].hash}
+	for i, crypter := range all {
+		for j, hash := range hashes {
+			if crypter.SupportsStub(hash) != (i == j) {
+				t.Errorf("crypter %d: unexpected SupportsStub result for %s", i, hash)
+			}
+		}
+	}
+}
+
+func TestNewSHA256(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := NewSHA256(n); err == nil {
+			t.Errorf("expected error for %d iterations", n)
+		}
+		if _, err := NewSHA512(n); err == nil {
+			t.Errorf("expected error for %d iterations", n)
+		}
+	}
+
+	s, err := NewSHA256(30000)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+
+	hash, err := s.Hash("helloworld")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$pbkdf2-sha256$30000$") {
+		t.Errorf("unexpected hash: %s", hash)
+	}
+	if s.NeedsUpdate(hash) {
+		t.Errorf("hash with configured iterations needs update")
+	}
+
+	// Verification uses the stored iteration count.
+	for _, test := range test_sha256 {
+		if err := s.Verify(test.password, test.hash); err != nil {
+			t.Errorf("unable to verify password %s: %v", test.password, err)
+		}
+		if !s.NeedsUpdate(test.hash) {
+			t.Errorf("hash with fewer iterations does not need update: %s", test.hash)
+		}
+	}
+
+	s, err = NewSHA512(30000)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+	if !s.SupportsStub(test_sha512[0].hash) || !s.NeedsUpdate(test_sha512[0].hash) {
+		t.Errorf("unexpected result for %s", test_sha512[0].hash)
+	}
+}
+
 func BenchmarkPBDF2_SHA1_Hash(b *testing.B) {
 	var crypter = SHA1Crypter
 	const passwd = "benchmarkMeThis!!"
@@ -276,3 +454,101 @@ func BenchmarkPBDF2_SHA512_Verify(b *testing.B) {
 		crypter.Verify(passwd, hash)
 	}
 }
+
+var test_django_sha256 = []test{
+	// From Django's test suite: make_password("lètmein", "seasalt").
+	{"lètmein", "pbkdf2_sha256$1000000$seasalt$r1uLUxoxpP2Ued/qxvmje7UH9PUJBkRrvf9gGPL7Cps="},
+	{"password", "pbkdf2_sha256$600000$AFgYhNcg8gCJbSYZiNJ7Fc$YE4CcHfqflVvbWoV1czX03D1yFMZj/c78NKr6KBJQkc="},
+	{"", "pbkdf2_sha256$260000$qaZLPZDhUAXT8Fub7V7dtM$xqkmfY+XxtR4h/y77qUcnGkdH3ipmeQvfqr59KlvrTk="},
+}
+
+func TestDjangoSHA256(t *testing.T) {
+	for i, tst := range test_django_sha256 {
+		if !DjangoSHA256Crypter.SupportsStub(tst.hash) {
+			t.Fatalf("test %d: stub not supported", i)
+		}
+		if err := DjangoSHA256Crypter.Verify(tst.password, tst.hash); err != nil {
+			t.Fatalf("test %d: err verifying: %v", i, err)
+		}
+		if err := DjangoSHA256Crypter.Verify(tst.password+"x", tst.hash); err == nil {
+			t.Fatalf("test %d: got nil error with wrong password", i)
+		}
+		if DjangoSHA256Crypter.NeedsUpdate(tst.hash) != (i > 0) {
+			t.Fatalf("test %d: unexpected NeedsUpdate result", i)
+		}
+	}
+
+	s := NewDjangoSHA256(1000)
+	h, err := s.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "pbkdf2_sha256$1000$") || len(strings.Split(h, "$")[2]) != DjangoSaltLength {
+		t.Fatalf("unexpected hash format: %q", h)
+	}
+	if err := s.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if SHA256Crypter.SupportsStub(h) {
+		t.Fatalf("passlib-format scheme claims Django hash")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	// Generated with Python's hashlib.pbkdf2_hmac for the password
+	// "password", encoded as standard base64, as other implementations do.
+	for _, c := range []struct {
+		crypter  abstract.Scheme
+		encoding abstract.Base64Encoding
+		hash     string
+	}{
+		{NewWithEncoding("$pbkdf2-sha256$", sha256.New, 29000, abstract.Base64Std),
+			abstract.Base64Std,
+			"$pbkdf2-sha256$29000$X+zrZv/IbzjZUnhsbWlseQ==$gUe67vFNW/AvaD6+MWXLwLP3En0F5RmZqitrfaF3nsM="},
+		{NewWithEncoding("$pbkdf2-sha512$", sha512.New, 25000, abstract.Base64RawStd),
+			abstract.Base64RawStd,
+			"$pbkdf2-sha512$25000$X+zrZv/IbzjZUnhsbWlseQ$hPEh9XnMofXNhKaH/AyDLxBI+IwMXMWLsZcJx4gnvfrtblieYs3MNZEy0x7RWpv5vMZj+ZjDvTUsCW5beXUffw"},
+	} {
+		_, _, salt, _, err := raw.Parse(c.hash)
+		if err != nil {
+			t.Fatalf("err parsing %q: %v", c.hash, err)
+		}
+
+		h, err := c.crypter.(abstract.SaltReaderScheme).HashWithSaltReader([]byte("password"), bytes.NewReader(salt))
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+		if h != c.hash {
+			t.Fatalf("hash with encoding %d: got %q, expected %q", c.encoding, h, c.hash)
+		}
+
+		// Passlib's usual schemes verify hashes in any encoding, and vice
+		// versa.
+		for _, s := range []abstract.Scheme{c.crypter, SHA256Crypter, SHA512Crypter} {
+			if !s.SupportsStub(c.hash) {
+				continue
+			}
+			if err := s.Verify("password", c.hash); err != nil {
+				t.Fatalf("err verifying %q: %v", c.hash, err)
+			}
+			if err := s.Verify("passwore", c.hash); err != abstract.ErrInvalidPassword {
+				t.Fatalf("expected ErrInvalidPassword for %q, got %v", c.hash, err)
+			}
+		}
+	}
+
+	s := NewWithEncoding("$pbkdf2-sha256$", sha256.New, 29000, abstract.Base64Std)
+	for _, test := range test_sha256 {
+		if err := s.Verify(test.password, test.hash); err != nil {
+			t.Fatalf("err verifying passlib hash %q: %v", test.hash, err)
+		}
+	}
+
+	p, err := s.(abstract.ParamScheme).WithParams(map[string]string{"rounds": "1000"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.(*scheme).Encoding != abstract.Base64Std {
+		t.Fatalf("WithParams did not keep the encoding")
+	}
+}
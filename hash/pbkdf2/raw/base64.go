@@ -13,7 +13,13 @@ func Base64Encode(src []byte) (dst string) {
 	return
 }
 
+// Decodes src, which may use passlib's adapted alphabet, as produced by
+// Base64Encode, or the standard alphabet with or without padding.
 func Base64Decode(src string) (dst []byte, err error) {
+	if strings.HasSuffix(src, "=") {
+		return base64.StdEncoding.DecodeString(src)
+	}
+
 	src = strings.Replace(src, ".", "+", -1)
 	dst, err = b64.DecodeString(src)
 	return
@@ -4,7 +4,9 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/base64"
 	"fmt"
+	"golang.org/x/crypto/sha3"
 	"hash"
 	"strconv"
 	"strings"
@@ -18,8 +20,13 @@ var ErrInvalidRounds = fmt.Errorf("invalid number of rounds")
 
 var hashMap = map[string]func() hash.Hash{
 	"pbkdf2":        sha1.New,
+	"pbkdf2-sha224": sha256.New224,
 	"pbkdf2-sha256": sha256.New,
+	"pbkdf2-sha384": sha512.New384,
 	"pbkdf2-sha512": sha512.New,
+
+	"pbkdf2-sha3-256": sha3.New256,
+	"pbkdf2-sha3-512": sha3.New512,
 }
 
 func Parse(stub string) (hashFunc func() hash.Hash, rounds int, salt []byte, hash string, err error) {
@@ -30,6 +37,11 @@ func Parse(stub string) (hashFunc func() hash.Hash, rounds int, salt []byte, has
 	}
 
 	parts := strings.Split(stub, "$")
+	if len(parts) != 5 {
+		err = ErrInvalidStub
+		return
+	}
+
 	if f, ok := hashMap[parts[1]]; ok {
 		hashFunc = f
 	} else {
@@ -37,7 +49,14 @@ func Parse(stub string) (hashFunc func() hash.Hash, rounds int, salt []byte, has
 		return
 	}
 
+	// Python passlib rejects zero-padded rounds, so a hash using them would
+	// not round-trip.
 	roundsStr := parts[2]
+	if len(roundsStr) > 1 && roundsStr[0] == '0' {
+		err = ErrInvalidStub
+		return
+	}
+
 	var n uint64
 	n, err = strconv.ParseUint(roundsStr, 10, 31)
 	if err != nil {
@@ -51,6 +70,11 @@ func Parse(stub string) (hashFunc func() hash.Hash, rounds int, salt []byte, has
 		return
 	}
 
+	if len(parts[3]) > base64.StdEncoding.EncodedLen(MaxSaltLength) {
+		err = ErrInvalidStub
+		return
+	}
+
 	salt, err = Base64Decode(parts[3])
 	if err != nil {
 		err = fmt.Errorf("could not decode base64 salt")
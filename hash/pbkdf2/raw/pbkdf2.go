@@ -10,6 +10,14 @@ const (
 	MaxRounds = 0x7fffffff // setting at 32-bit limit for now
 )
 
+// The longest salt accepted in a hash, in bytes, as for Python passlib.
+const MaxSaltLength = 1024
+
 func Hash(password, salt []byte, rounds int, hf func() hash.Hash) (hash string) {
-	return Base64Encode(pbkdf2.Key(password, salt, rounds, hf().Size(), hf))
+	return Base64Encode(Key(password, salt, rounds, hf))
+}
+
+// Like Hash, but returns the derived key without encoding it.
+func Key(password, salt []byte, rounds int, hf func() hash.Hash) []byte {
+	return pbkdf2.Key(password, salt, rounds, hf().Size(), hf)
 }
@@ -0,0 +1,105 @@
+// Package phpass implements the phpass portable hash used by WordPress and
+// phpBB.
+//
+// phpass is weak and is supported only so that legacy hashes can be verified
+// and upgraded to a modern scheme. NeedsUpdate always returns true.
+package phpass
+
+import "expvar"
+import "crypto/rand"
+import "io"
+import "strconv"
+import "github.com/al45tair/passlib/hash/phpass/raw"
+import "github.com/al45tair/passlib/abstract"
+
+var cPhpassHashCalls = expvar.NewInt("passlib.phpass.hashCalls")
+var cPhpassVerifyCalls = expvar.NewInt("passlib.phpass.verifyCalls")
+
+// An implementation of Scheme performing the phpass portable hash. It
+// verifies both $P$ and $H$ hashes, and generates $P$ hashes with
+// raw.RecommendedLog2Rounds.
+//
+// WARNING: phpass should not be used for new applications under any
+// circumstances. It should be used for legacy compatibility only.
+var Crypter abstract.Scheme
+
+func init() {
+	Crypter = &phpassCrypter{}
+}
+
+type phpassCrypter struct{}
+
+func (c *phpassCrypter) SupportsStub(stub string) bool {
+	return len(stub) >= 3 && stub[0] == '$' && (stub[1] == 'P' || stub[1] == 'H') && stub[2] == '$'
+}
+
+func (c *phpassCrypter) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *phpassCrypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	cPhpassHashCalls.Add(1)
+
+	buf := make([]byte, 6)
+	_, err := io.ReadFull(saltReader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	salt := raw.EncodeBase64(buf)
+
+	return raw.Crypt(string(password), salt, raw.RecommendedLog2Rounds), nil
+}
+
+func (c *phpassCrypter) Verify(password, hash string) error {
+	cPhpassVerifyCalls.Add(1)
+
+	log2Rounds, salt, oldHash, err := raw.Parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(oldHash, raw.Hash(password, salt, log2Rounds)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// phpass is always deprecated.
+func (c *phpassCrypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *phpassCrypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *phpassCrypter) ReadParams(hash string) (map[string]string, error) {
+	log2Rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"log2_rounds": strconv.Itoa(log2Rounds)}, nil
+}
+
+// A phpass hash takes 2^log2_rounds rounds of MD5, so its strength is
+// log2_rounds.
+func (c *phpassCrypter) Strength(hash string) (float64, error) {
+	log2Rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return float64(log2Rounds), nil
+}
+
+func (c *phpassCrypter) String() string {
+	return "phpass"
+}
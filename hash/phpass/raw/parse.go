@@ -0,0 +1,40 @@
+package raw
+
+import "fmt"
+import "strings"
+
+// Indicates that a password hash or stub is invalid.
+var ErrInvalidStub = fmt.Errorf("invalid phpass stub")
+
+// Indicates that the iteration count is outside the range permitted by
+// phpass.
+var ErrInvalidRounds = fmt.Errorf("invalid phpass rounds")
+
+// Scans a phpass stub or hash to determine the iteration count, salt and
+// hash. Both the $P$ (WordPress) and $H$ (phpBB) prefixes are accepted.
+//
+// The format is as follows:
+//
+//   $P$Rsssssssshhhhhhhhhhhhhhhhhhhhhh   // hash
+//   $P$Rssssssss                         // stub
+//
+// where R encodes the base-2 logarithm of the iteration count.
+func Parse(stub string) (log2Rounds int, salt, hash string, err error) {
+	if !strings.HasPrefix(stub, "$P$") && !strings.HasPrefix(stub, "$H$") {
+		err = ErrInvalidStub
+		return
+	}
+
+	if len(stub) != 4+SaltLength && len(stub) != 4+SaltLength+22 {
+		err = ErrInvalidStub
+		return
+	}
+
+	log2Rounds = strings.IndexByte(itoa64, stub[3])
+	if log2Rounds < MinimumLog2Rounds || log2Rounds > MaximumLog2Rounds {
+		err = ErrInvalidRounds
+		return
+	}
+
+	return log2Rounds, stub[4 : 4+SaltLength], stub[4+SaltLength:], nil
+}
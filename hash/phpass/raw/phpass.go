@@ -0,0 +1,64 @@
+// Package raw provides a raw implementation of the phpass portable hash.
+package raw
+
+import "crypto/md5"
+import "strings"
+
+// The length of a phpass salt.
+const SaltLength = 8
+
+// The minimum base-2 logarithm of the iteration count permitted by phpass.
+const MinimumLog2Rounds = 7
+
+// The maximum base-2 logarithm of the iteration count permitted by phpass.
+const MaximumLog2Rounds = 30
+
+// The base-2 logarithm of the iteration count used by WordPress.
+const RecommendedLog2Rounds = 8
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Calculates the phpass portable hash, as used by WordPress and phpBB, in
+// its $P$ form. The password must be in plaintext and be a UTF-8 string.
+//
+// The salt must consist of SaltLength characters from the crypt base64
+// alphabet, and log2Rounds must be between MinimumLog2Rounds and
+// MaximumLog2Rounds.
+func Crypt(password, salt string, log2Rounds int) string {
+	return "$P$" + string(itoa64[log2Rounds]) + salt + Hash(password, salt, log2Rounds)
+}
+
+// Calculates the checksum part of a phpass portable hash, as for Crypt.
+func Hash(password, salt string, log2Rounds int) string {
+	passwordb := []byte(password)
+
+	h := md5.Sum([]byte(salt + password))
+	for i := 1 << uint(log2Rounds); i > 0; i-- {
+		h = md5.Sum(append(h[:], passwordb...))
+	}
+
+	return EncodeBase64(h[:])
+}
+
+// Encodes a byte string using the crypt base64 variant, in the byte order used
+// by phpass.
+func EncodeBase64(b []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(b); i += 3 {
+		v := uint(b[i])
+		n := 2
+		if i+1 < len(b) {
+			v |= uint(b[i+1]) << 8
+			n++
+		}
+		if i+2 < len(b) {
+			v |= uint(b[i+2]) << 16
+			n++
+		}
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,38 @@
+package raw
+
+import "testing"
+
+func TestPhpass(t *testing.T) {
+	vectors := []struct {
+		password, hash string
+	}{
+		// From the test suite distributed with phpass.
+		{"test12345", "$P$9IQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0"},
+		{"", "$P$BabcdefghrBY/znFl0cIh22fo6F2px."},
+		{"password", "$P$BabcdefghEP1Dc925xipBv72nvZxoc1"},
+		{"password", "$H$9abcdefghreUCnbbQX76dJT2aHvsT6."},
+	}
+
+	for _, v := range vectors {
+		log2Rounds, salt, hash, err := Parse(v.hash)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", v.hash, err)
+		}
+
+		if h := Hash(v.password, salt, log2Rounds); h != hash {
+			t.Errorf("Hash(%q, %q, %d): got %q, expected %q", v.password, salt, log2Rounds, h, hash)
+		}
+	}
+
+	if h := Crypt("test12345", "IQRaTwmf", 11); h != "$P$9IQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0" {
+		t.Errorf("Crypt: got %q", h)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "$P$", "$1$BabcdefghrBY/znFl0cIh22fo6F2px.", "$P$BabcdefghrBY/znFl0cIh22fo6F2px", "$P$4abcdefghrBY/znFl0cIh22fo6F2px.", "$P$zabcdefgh"} {
+		if _, _, _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
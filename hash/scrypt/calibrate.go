@@ -0,0 +1,118 @@
+package scrypt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/al45tair/passlib/hash/scrypt/raw"
+)
+
+// The number of trials averaged for each measurement made by Calibrate.
+const calibrationTrials = 3
+
+// The fraction by which a measured duration may exceed the target and still
+// be considered a match by Calibrate.
+const calibrationTolerance = 0.1
+
+// The smallest N tried by Calibrate.
+const calibrationMinimumN = 1024
+
+// Determines scrypt-sha256 parameters which make hashing a password take
+// roughly target on the current machine, using no more than maxMemory bytes
+// of memory.
+//
+// r is fixed at raw.Recommendedr. N is doubled until the target or the memory
+// ceiling is reached, after which p is increased (which costs time but
+// little memory). Each candidate is hashed through the same code path as Hash
+// several times and the durations averaged. No candidate whose memory usage
+// would exceed maxMemory is ever tried. The parameters are returned together
+// with their measured duration.
+//
+// The results are specific to the machine (and its load) at the time of the
+// call. Calibrate once and store the results in your configuration, rather
+// than recalibrating in every process.
+func Calibrate(target time.Duration, maxMemory int) (N, r, p int, measured time.Duration, err error) {
+	if target <= 0 {
+		err = fmt.Errorf("scrypt calibration target must be positive, got %v", target)
+		return
+	}
+
+	N, r, p = calibrationMinimumN, raw.Recommendedr, 1
+	if memoryUsage(N, r, p) > maxMemory {
+		err = fmt.Errorf("scrypt calibration needs at least %d bytes of memory, got %d", memoryUsage(N, r, p), maxMemory)
+		return
+	}
+
+	if measured, err = measure(N, r, p); err != nil {
+		return
+	}
+
+	// Spend the memory budget first.
+	for measured < target && memoryUsage(N*2, r, p) <= maxMemory {
+		N *= 2
+		if measured, err = measure(N, r, p); err != nil {
+			return
+		}
+	}
+
+	if measured >= target {
+		return
+	}
+
+	// Out of memory; cost is linear in p, so estimate and then refine.
+	p = int(float64(target) / float64(measured))
+	if p < 1 {
+		p = 1
+	}
+
+	for memoryUsage(N, r, p) > maxMemory {
+		p--
+	}
+
+	for {
+		if measured, err = measure(N, r, p); err != nil {
+			return
+		}
+
+		if measured > time.Duration(float64(target)*(1+calibrationTolerance)) {
+			// Overshot; back off.
+			for p > 1 && measured > time.Duration(float64(target)*(1+calibrationTolerance)) {
+				p--
+				if measured, err = measure(N, r, p); err != nil {
+					return
+				}
+			}
+			return
+		}
+
+		if measured >= target || memoryUsage(N, r, p+1) > maxMemory {
+			return
+		}
+
+		p++
+	}
+}
+
+// Returns the number of bytes of memory used by scrypt with the given
+// parameters.
+func memoryUsage(N, r, p int) int {
+	return 128 * r * (N + p + 2)
+}
+
+func measure(N, r, p int) (time.Duration, error) {
+	s, err := NewSHA256(N, r, p)
+	if err != nil {
+		return 0, err
+	}
+
+	var total time.Duration
+	for i := 0; i < calibrationTrials; i++ {
+		start := time.Now()
+		if _, err := s.Hash("passlib calibration"); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+
+	return total / calibrationTrials, nil
+}
@@ -0,0 +1,134 @@
+package raw
+
+import "crypto/hmac"
+import "crypto/sha256"
+import "crypto/subtle"
+import "encoding/base64"
+import "encoding/binary"
+import "encoding/hex"
+import "fmt"
+import "strconv"
+import "strings"
+
+// The length of the header written by Colin Percival's scrypt utility (as
+// used by Tarsnap), in bytes.
+const HeaderLength = 96
+
+// The base64 encoding of the magic string "scrypt" and version 0 with which
+// every header starts.
+const HeaderPrefix = "c2NyeXB0A"
+
+// Indicates that a base64-encoded scrypt header is malformed or corrupt.
+var ErrInvalidHeader = fmt.Errorf("invalid scrypt header")
+
+// Parses a base64-encoded scrypt header, as produced by Colin Percival's
+// scrypt utility and by libraries such as node-scrypt which use its format
+// for password hashes.
+//
+// The header is laid out as follows; integers are big-endian:
+//
+//   "scrypt" 0x00 log2(N)    // magic, version and cost
+//   r p                      // 32 bits each
+//   salt                     // 32 bytes
+//   checksum                 // the first 16 bytes of SHA-256 of the above
+//   mac                      // HMAC-SHA256 of the above; see HeaderMAC
+//
+// The checksum is checked, but the MAC can only be checked with the password.
+func ParseHeader(s string) (header, salt []byte, N, r, p int, err error) {
+	if !strings.HasPrefix(s, HeaderPrefix) || len(s) > base64.StdEncoding.EncodedLen(HeaderLength) {
+		err = ErrInvalidHeader
+		return
+	}
+
+	header, err = decodeBase64(s)
+	if err != nil {
+		return
+	}
+
+	if len(header) != HeaderLength || string(header[:7]) != "scrypt\x00" {
+		err = ErrInvalidHeader
+		return
+	}
+
+	checksum := sha256.Sum256(header[:48])
+	if subtle.ConstantTimeCompare(checksum[:16], header[48:64]) != 1 {
+		err = ErrInvalidHeader
+		return
+	}
+
+	// Each parameter must fit in 31 bits, as it must for Parse.
+	logN := header[7]
+	r32 := binary.BigEndian.Uint32(header[8:12])
+	p32 := binary.BigEndian.Uint32(header[12:16])
+	if logN >= 31 || r32 >= 1<<31 || p32 >= 1<<31 {
+		err = ErrParametersTooLarge
+		return
+	}
+
+	N, r, p = 1<<logN, int(r32), int(p32)
+	if err = CheckParams(N, r, p); err != nil {
+		return
+	}
+
+	salt = header[16:48]
+	return
+}
+
+// Computes the MAC with which a header parsed by ParseHeader ends: the
+// HMAC-SHA256 of its first 64 bytes, keyed with the second half of the
+// 64-byte scrypt key derived from the password. N, r and p must satisfy
+// CheckParams.
+func HeaderMAC(password, header []byte, N, r, p int) []byte {
+	key := Key(password, header[16:48], N, r, p, 64)
+	mac := hmac.New(sha256.New, key[32:])
+	mac.Write(header[:64])
+	return mac.Sum(nil)
+}
+
+// Parses a hash in the format written by github.com/elithrar/simple-scrypt,
+// in which the salt and key are hex-encoded and there is no identifier:
+//
+//   N$r$p$salt$key
+//
+func ParseSimple(s string) (salt, key []byte, N, r, p int, err error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 5 {
+		err = ErrInvalidStub
+		return
+	}
+
+	var Ni, ri, pi uint64
+
+	Ni, err = strconv.ParseUint(parts[0], 10, 31)
+	if err != nil {
+		return
+	}
+
+	ri, err = strconv.ParseUint(parts[1], 10, 31)
+	if err != nil {
+		return
+	}
+
+	pi, err = strconv.ParseUint(parts[2], 10, 31)
+	if err != nil {
+		return
+	}
+
+	N, r, p = int(Ni), int(ri), int(pi)
+
+	if err = CheckParams(N, r, p); err != nil {
+		return
+	}
+
+	if len(parts[3]) > hex.EncodedLen(MaxSaltLength) || len(parts[4]) > hex.EncodedLen(MaxKeyLength) {
+		err = ErrInvalidStub
+		return
+	}
+
+	salt, err = hex.DecodeString(parts[3])
+	if err == nil {
+		key, err = hex.DecodeString(parts[4])
+	}
+
+	return
+}
@@ -16,29 +16,122 @@ const Recommendedr = 8
 // The current recommended p value for interactive logins.
 const Recommendedp = 1
 
+// The length of the derived key in hashes made by ScryptSHA256, in bytes.
+const DefaultKeyLength = 32
+
+// The shortest and longest derived keys supported, in bytes.
+const (
+	MinKeyLength = 16
+	MaxKeyLength = 1024
+)
+
+// The most memory scrypt will use, in bytes (1 GiB). Hashes needing more are
+// rejected, so that a malicious hash cannot exhaust memory.
+const MaxMemory = 1 << 30
+
+// The longest salt accepted in a hash, in bytes.
+const MaxSaltLength = 1024
+
+// Indicates that parameters need more memory than MaxMemory, or more than can
+// be addressed on this platform.
+var ErrParametersTooLarge = fmt.Errorf("scrypt parameters too large")
+
+const maxInt = int(^uint(0) >> 1)
+
+// Returns the memory needed to hash with N, r and p, in bytes, or false if
+// that overflows an int.
+func memoryRequired(N, r, p int) (int, bool) {
+	if r > maxInt/128 || N > maxInt-p {
+		return 0, false
+	}
+
+	if N+p > maxInt/(128*r) {
+		return 0, false
+	}
+
+	return 128 * r * (N + p), true
+}
+
+// Checks that keyLen is between MinKeyLength and MaxKeyLength.
+func CheckKeyLength(keyLen int) error {
+	if keyLen < MinKeyLength || keyLen > MaxKeyLength {
+		return fmt.Errorf("scrypt key length must be between %d and %d bytes, got %d", MinKeyLength, MaxKeyLength, keyLen)
+	}
+
+	return nil
+}
+
+// Checks that N, r and p are acceptable parameters for scrypt, returning a
+// descriptive error if they are not.
+//
+// N must be a power of two greater than 1, r and p must be positive and r*p
+// must be less than 2^30. Hashing requires roughly 128*r*(N+p) bytes of
+// memory; if that exceeds MaxMemory, or overflows an int, as it can on 32-bit
+// platforms, the error wraps ErrParametersTooLarge.
+func CheckParams(N, r, p int) error {
+	if N <= 1 || N&(N-1) != 0 {
+		return fmt.Errorf("scrypt N parameter must be a power of two greater than 1, got %d", N)
+	}
+
+	if r < 1 {
+		return fmt.Errorf("scrypt r parameter must be positive, got %d", r)
+	}
+
+	if p < 1 {
+		return fmt.Errorf("scrypt p parameter must be positive, got %d", p)
+	}
+
+	if uint64(r)*uint64(p) >= 1<<30 {
+		return fmt.Errorf("scrypt r*p must be less than 2^30, got %d*%d", r, p)
+	}
+
+	if mem, ok := memoryRequired(N, r, p); !ok || mem > MaxMemory {
+		return fmt.Errorf("%w: N = %d, r = %d and p = %d need more than %d bytes", ErrParametersTooLarge, N, r, p, MaxMemory)
+	}
+
+	return nil
+}
+
 // Wrapper for golang.org/x/crypto/scrypt implementing a sensible
 // modular crypt interface.
 //
 // password should be a UTF-8 plaintext password.
 // salt should be a random salt value in binary form.
 //
-// N, r and p are parameters to scrypt.
+// N, r and p are parameters to scrypt, and must satisfy CheckParams; the
+// function panics if they do not.
 //
 // Returns a modular crypt hash.
 func ScryptSHA256(password string, salt []byte, N, r, p int) string {
-	passwordb := []byte(password)
+	return ScryptSHA256Bytes([]byte(password), salt, N, r, p)
+}
 
-	hash, err := scrypt.Key(passwordb, salt, N, r, p, 32)
-	if err != nil {
+// Like ScryptSHA256, but takes the password as a byte slice.
+func ScryptSHA256Bytes(password, salt []byte, N, r, p int) string {
+	if err := CheckParams(N, r, p); err != nil {
 		panic(err)
 	}
 
+	hash := Key(password, salt, N, r, p, DefaultKeyLength)
+
 	hstr := base64.StdEncoding.EncodeToString(hash)
 	sstr := base64.StdEncoding.EncodeToString(salt)
 
 	return fmt.Sprintf("$s2$%d$%d$%d$%s$%s", N, r, p, sstr, hstr)
 }
 
+// Computes a keyLen-byte scrypt key, as used by ScryptSHA256, without
+// encoding it. N, r and p must satisfy CheckParams; the function panics if
+// scrypt rejects them.
+func Key(password, salt []byte, N, r, p, keyLen int) []byte {
+	key, err := scrypt.Key(password, salt, N, r, p, keyLen)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
 // Indicates that a password hash or stub is invalid.
 var ErrInvalidStub = fmt.Errorf("invalid scrypt password stub")
 
@@ -82,14 +175,41 @@ func Parse(stub string) (salt, hash []byte, N, r, p int, err error) {
 
 	N, r, p = int(Ni), int(ri), int(pi)
 
-	salt, err = base64.StdEncoding.DecodeString(parts[3])
+	// Reject absurd values before anything is allocated in proportion to
+	// them.
+	if err = CheckParams(N, r, p); err != nil {
+		return
+	}
+
+	if len(parts[3]) > base64.StdEncoding.EncodedLen(MaxSaltLength) {
+		err = ErrInvalidStub
+		return
+	}
+
+	salt, err = decodeBase64(parts[3])
 	if err != nil {
 		return
 	}
 
 	if len(parts) >= 5 {
-		hash, err = base64.StdEncoding.DecodeString(parts[4])
+		if len(parts[4]) > base64.StdEncoding.EncodedLen(MaxKeyLength) {
+			err = ErrInvalidStub
+			return
+		}
+
+		hash, err = decodeBase64(parts[4])
 	}
 
 	return
 }
+
+// Decodes the salt or hash of an scrypt hash. These are normally padded
+// standard base64, but unpadded standard base64, and the same with '.' in
+// place of '+', are also accepted.
+func decodeBase64(src string) ([]byte, error) {
+	if strings.HasSuffix(src, "=") {
+		return base64.StdEncoding.DecodeString(src)
+	}
+
+	return base64.RawStdEncoding.DecodeString(strings.Replace(src, ".", "+", -1))
+}
@@ -0,0 +1,21 @@
+//go:build 386 || arm || mips || mipsle
+// +build 386 arm mips mipsle
+
+package raw
+
+import (
+	"errors"
+	"testing"
+)
+
+// 128*r*(N+p) overflows a 32-bit int for these, though not a 64-bit one.
+func TestMemoryRequired32Bit(t *testing.T) {
+	for _, p := range [][3]int{{1 << 20, 32, 1}, {1 << 24, 1 << 4, 1}, {2, 1 << 24, 1}} {
+		if _, ok := memoryRequired(p[0], p[1], p[2]); ok {
+			t.Errorf("%v: expected overflow", p)
+		}
+		if err := CheckParams(p[0], p[1], p[2]); !errors.Is(err, ErrParametersTooLarge) {
+			t.Errorf("%v: expected ErrParametersTooLarge, got %v", p, err)
+		}
+	}
+}
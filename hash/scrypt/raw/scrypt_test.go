@@ -0,0 +1,134 @@
+package raw
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func BenchmarkScryptSHA256(b *testing.B) {
+	b.ReportAllocs()
+	salt := []byte("somesalt")
+	for i := 0; i < b.N; i++ {
+		ScryptSHA256Bytes([]byte("password"), salt, RecommendedN, Recommendedr, Recommendedp)
+	}
+}
+
+func BenchmarkKeyWithPool(b *testing.B) {
+	b.ReportAllocs()
+	pool := NewPool(RecommendedN, Recommendedr, Recommendedp)
+	salt := []byte("somesalt")
+	for i := 0; i < b.N; i++ {
+		KeyWithPool(pool, []byte("password"), salt, RecommendedN, Recommendedr, Recommendedp, DefaultKeyLength)
+	}
+}
+
+func TestKeyWithPool(t *testing.T) {
+	password := []byte("password")
+	salt := []byte("somesalt")
+
+	for _, p := range [][3]int{{2, 1, 1}, {16, 1, 1}, {1024, 8, 1}, {256, 2, 3}} {
+		expected := Key(password, salt, p[0], p[1], p[2], 32)
+		pool := NewPool(p[0], p[1], p[2])
+
+		// Run twice, so that the second call can reuse pooled memory.
+		for i := 0; i < 2; i++ {
+			if !bytes.Equal(KeyWithPool(pool, password, salt, p[0], p[1], p[2], 32), expected) {
+				t.Errorf("scrypt mismatch for %v", p)
+			}
+		}
+
+		// Pooled memory holds nothing derived from the password.
+		bufs := pool.pool.Get().(*buffers)
+		for _, w := range append(bufs.xy, bufs.v...) {
+			if w != 0 {
+				t.Fatalf("pooled memory not zeroed for %v", p)
+			}
+		}
+	}
+
+	// A pool for other parameters, or none, is not used.
+	pool := NewPool(16, 1, 1)
+	for _, pool := range []*Pool{pool, nil} {
+		if !bytes.Equal(KeyWithPool(pool, password, salt, 32, 1, 1, 32), Key(password, salt, 32, 1, 1, 32)) {
+			t.Errorf("scrypt mismatch with unsuitable pool %v", pool)
+		}
+	}
+}
+
+func TestParametersTooLarge(t *testing.T) {
+	for _, p := range [][3]int{{1 << 20, 8, 1}, {1 << 10, 1 << 20, 1}, {maxInt/2 + 1, 1, 1}} {
+		if err := CheckParams(p[0], p[1], p[2]); !errors.Is(err, ErrParametersTooLarge) {
+			t.Errorf("%v: expected ErrParametersTooLarge, got %v", p, err)
+		}
+	}
+
+	if err := CheckParams(1<<16, 8, 1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	const valid = "c2NyeXB0AAoAAAAIAAAAATAxMjM0NTY3ODlhYmNkZWYwMTIzNDU2Nzg5YWJjZGVmmxScRJjg+W1N9/jV1ZweuB671uNZze4s/jKEgp0FeUN9czpdEFkvwcmVZwmDcRpF"
+
+	header, salt, N, r, p, err := ParseHeader(valid)
+	if err != nil || len(header) != HeaderLength || string(salt) != "0123456789abcdef0123456789abcdef" || N != 1024 || r != 8 || p != 1 {
+		t.Fatalf("unexpected result %x, %q, %d, %d, %d, %v", header, salt, N, r, p, err)
+	}
+	if !bytes.Equal(HeaderMAC([]byte("password"), header, N, r, p), header[64:]) {
+		t.Fatalf("MAC mismatch")
+	}
+
+	// Returns a copy of header with its checksum updated.
+	resum := func(header []byte) string {
+		h := append([]byte(nil), header...)
+		sum := sha256.Sum256(h[:48])
+		copy(h[48:64], sum[:16])
+		return base64.StdEncoding.EncodeToString(h)
+	}
+
+	corrupt := append([]byte(nil), header...)
+	corrupt[20] ^= 1
+	huge := append([]byte(nil), header...)
+	huge[7] = 40
+	hugeR := append([]byte(nil), header...)
+	hugeR[8] = 0x80
+
+	for _, v := range []struct {
+		s   string
+		err error
+	}{
+		{"", ErrInvalidHeader},
+		{"$s2$1024$8$1$AAAA$AAAA", ErrInvalidHeader},
+		{valid[:len(valid)-4], ErrInvalidHeader},
+		{valid + "AAAA", ErrInvalidHeader},
+		{base64.StdEncoding.EncodeToString(corrupt), ErrInvalidHeader},
+		{resum(huge), ErrParametersTooLarge},
+		{resum(hugeR), ErrParametersTooLarge},
+	} {
+		if _, _, _, _, _, err := ParseHeader(v.s); !errors.Is(err, v.err) {
+			t.Errorf("%q: expected %v, got %v", v.s, v.err, err)
+		}
+	}
+}
+
+func TestParseSimple(t *testing.T) {
+	salt, key, N, r, p, err := ParseSimple("16$1$2$00112233445566778899aabbccddeeff$941e5f9958c8ea701425eb93d279552683e45038787c0e8a068db1b9785aa1d2")
+	if err != nil || len(salt) != 16 || len(key) != 32 || N != 16 || r != 1 || p != 2 {
+		t.Fatalf("unexpected result %x, %x, %d, %d, %d, %v", salt, key, N, r, p, err)
+	}
+
+	for _, s := range []string{
+		"",
+		"16$1$2$0011",
+		"16$1$2$0011$zz",
+		"15$1$2$0011$2233",
+		"16$1$2$0011$2233$4455",
+	} {
+		if _, _, _, _, _, err := ParseSimple(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
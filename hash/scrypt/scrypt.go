@@ -3,10 +3,13 @@
 package scrypt
 
 import "fmt"
+import "math"
 import "expvar"
 import "strings"
 import "crypto/rand"
-import "encoding/base64"
+import "io"
+import "crypto/subtle"
+import "sync/atomic"
 import "github.com/al45tair/passlib/hash/scrypt/raw"
 import "github.com/al45tair/passlib/abstract"
 
@@ -19,93 +22,388 @@ var cScryptSHA256VerifyCalls = expvar.NewInt("passlib.scryptsha256.verifyCalls")
 var SHA256Crypter abstract.Scheme
 
 func init() {
-	SHA256Crypter = NewSHA256(
+	SHA256Crypter = newSHA256(
 		raw.RecommendedN,
 		raw.Recommendedr,
 		raw.Recommendedp,
+		raw.DefaultKeyLength,
+		abstract.Base64Default,
 	)
 }
 
 // Returns an implementation of Scheme implementing scrypt-sha256
 // with the specified parameters.
-func NewSHA256(N, r, p int) abstract.Scheme {
+//
+// N must be a power of two greater than 1, and r and p must be positive; an
+// error is returned otherwise (see raw.CheckParams). Hashing uses roughly
+// 128*N*r bytes of memory, so the recommended parameters use 16 MiB.
+//
+// The parameters are used only when hashing new passwords; existing hashes
+// are verified using the parameters encoded in them, and NeedsUpdate reports
+// hashes whose parameters are lower than those configured.
+func NewSHA256(N, r, p int) (abstract.Scheme, error) {
+	err := raw.CheckParams(N, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSHA256(N, r, p, raw.DefaultKeyLength, abstract.Base64Default), nil
+}
+
+// Like NewSHA256, but new hashes use a keyLen-byte derived key rather than
+// raw.DefaultKeyLength, to match other systems' stored hashes. keyLen must
+// satisfy raw.CheckKeyLength. Verify derives a key of the same length as the
+// stored hash, so hashes of either length verify; NeedsUpdate reports hashes
+// with shorter keys.
+func NewSHA256WithKeyLen(N, r, p, keyLen int) (abstract.Scheme, error) {
+	err := raw.CheckParams(N, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = raw.CheckKeyLength(keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSHA256(N, r, p, keyLen, abstract.Base64Default), nil
+}
+
+// Like NewSHA256, but new hashes encode their salt and digest using the given
+// variant of base64 rather than padded standard base64, to match other
+// implementations. Verify accepts hashes in any variant.
+func NewSHA256WithEncoding(N, r, p int, encoding abstract.Base64Encoding) (abstract.Scheme, error) {
+	err := raw.CheckParams(N, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSHA256(N, r, p, raw.DefaultKeyLength, encoding), nil
+}
+
+// Formats of scrypt hashes written by other implementations, which
+// NewSHA256WithLegacyFormats can be asked to verify. They may be combined.
+type LegacyFormat uint
+
+const (
+	// Colin Percival's scrypt header, as written by his scrypt utility and
+	// Tarsnap and used for password hashes by libraries such as node-scrypt,
+	// base64-encoded. See raw.ParseHeader.
+	LegacyScryptHeader LegacyFormat = 1 << iota
+
+	// N$r$p$salt$key with a hex-encoded salt and key and no identifier, as
+	// written by github.com/elithrar/simple-scrypt. See raw.ParseSimple.
+	LegacySimpleScrypt
+)
+
+// Like NewSHA256, but the scheme also supports and verifies hashes in the
+// given legacy formats, so that they can be upgraded after migrating from
+// another scrypt implementation. New hashes are always in the usual $s2$
+// format, and NeedsUpdate always returns true for hashes in a legacy format.
+//
+// The legacy formats have no identifier as distinctive as $s2$, so only
+// enable those which are actually stored, and list this scheme after any
+// others whose hashes might be mistaken for them.
+func NewSHA256WithLegacyFormats(N, r, p int, formats LegacyFormat) (abstract.Scheme, error) {
+	s, err := NewSHA256(N, r, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.(*scryptSHA256Crypter).legacy = formats
+	return s, nil
+}
+
+func newSHA256(N, r, p, keyLen int, encoding abstract.Base64Encoding) abstract.Scheme {
+	if encoding == abstract.Base64Default {
+		encoding = abstract.Base64Std
+	}
+
 	return &scryptSHA256Crypter{
-		nN: N,
-		r:  r,
-		p:  p,
+		nN:       N,
+		r:        r,
+		p:        p,
+		keyLen:   keyLen,
+		encoding: encoding,
 	}
 }
 
 type scryptSHA256Crypter struct {
 	nN, r, p int
+	keyLen   int
+	encoding abstract.Base64Encoding
+	legacy   LegacyFormat
+	pool     atomic.Value // *raw.Pool
+}
+
+// Returns the pool of working memory for the configured parameters. It is
+// made on first use, so that schemes which never hash, such as most of those
+// Calibrate tries, hold none; it is freed along with the scheme.
+func (c *scryptSHA256Crypter) workPool() *raw.Pool {
+	pool, _ := c.pool.Load().(*raw.Pool)
+	if !pool.Fits(c.nN, c.r, c.p) {
+		pool = raw.NewPool(c.nN, c.r, c.p)
+		c.pool.Store(pool)
+	}
+
+	return pool
 }
 
 func (c *scryptSHA256Crypter) SetParams(N, r, p int) error {
+	err := raw.CheckParams(N, r, p)
+	if err != nil {
+		return err
+	}
+
 	c.nN = N
 	c.r = r
 	c.p = p
 	return nil
 }
 
+func (c *scryptSHA256Crypter) Params() map[string]string {
+	return map[string]string{
+		"N":          fmt.Sprint(c.nN),
+		"r":          fmt.Sprint(c.r),
+		"p":          fmt.Sprint(c.p),
+		"key_length": fmt.Sprint(c.keyLen),
+	}
+}
+
+func (c *scryptSHA256Crypter) WithParams(params map[string]string) (abstract.Scheme, error) {
+	N, r, p, keyLen := c.nN, c.r, c.p, c.keyLen
+	err := abstract.ParseIntParams(params, map[string]*int{"N": &N, "r": &r, "p": &p, "key_length": &keyLen})
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSHA256WithKeyLen(N, r, p, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	s.(*scryptSHA256Crypter).encoding = c.encoding
+	s.(*scryptSHA256Crypter).legacy = c.legacy
+	return s, nil
+}
+
 func (c *scryptSHA256Crypter) SupportsStub(stub string) bool {
-	return strings.HasPrefix(stub, "$s2$")
+	return strings.HasPrefix(stub, "$s2$") || c.legacyFormat(stub) != 0
+}
+
+// Returns which of the scheme's legacy formats hash appears to be in, or 0
+// if none.
+func (c *scryptSHA256Crypter) legacyFormat(hash string) LegacyFormat {
+	switch {
+	case c.legacy&LegacyScryptHeader != 0 && strings.HasPrefix(hash, raw.HeaderPrefix):
+		return LegacyScryptHeader
+	case c.legacy&LegacySimpleScrypt != 0 && len(hash) > 0 && hash[0] >= '0' && hash[0] <= '9' && strings.Count(hash, "$") == 4:
+		return LegacySimpleScrypt
+	}
+
+	return 0
+}
+
+// Parses a hash in the $s2$ format or one of the scheme's legacy formats.
+// For a header, key is its MAC.
+func (c *scryptSHA256Crypter) parse(hash string) (salt, key []byte, N, r, p int, err error) {
+	switch c.legacyFormat(hash) {
+	case LegacyScryptHeader:
+		var header []byte
+		header, salt, N, r, p, err = raw.ParseHeader(hash)
+		if err == nil {
+			key = header[64:]
+		}
+		return
+	case LegacySimpleScrypt:
+		return raw.ParseSimple(hash)
+	}
+
+	return raw.Parse(hash)
 }
 
 func (c *scryptSHA256Crypter) Hash(password string) (string, error) {
+	return c.HashBytes([]byte(password))
+}
+
+func (c *scryptSHA256Crypter) HashBytes(password []byte) (string, error) {
+	return c.HashWithSaltReader(password, rand.Reader)
+}
+
+func (c *scryptSHA256Crypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
 	cScryptSHA256HashCalls.Add(1)
 
-	stub, err := c.makeStub()
+	salt := make([]byte, 18)
+	_, err := io.ReadFull(saltReader, salt)
 	if err != nil {
 		return "", err
 	}
 
-	_, newHash, _, _, _, _, err := c.hash(password, stub)
-	return newHash, err
+	hash := raw.KeyWithPool(c.workPool(), password, salt, c.nN, c.r, c.p, c.keyLen)
+	return c.format(salt, hash, c.nN, c.r, c.p), nil
 }
 
 func (c *scryptSHA256Crypter) Verify(password, hash string) (err error) {
+	return c.VerifyBytes([]byte(password), hash)
+}
+
+func (c *scryptSHA256Crypter) VerifyBytes(password []byte, hash string) (err error) {
 	cScryptSHA256VerifyCalls.Add(1)
 
-	_, newHash, _, _, _, _, err := c.hash(password, hash)
-	if err == nil && !abstract.SecureCompare(hash, newHash) {
+	if c.legacyFormat(hash) == LegacyScryptHeader {
+		return c.verifyHeader(password, hash)
+	}
+
+	salt, oldHash, N, r, p, err := c.parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if len(oldHash) == 0 {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	err = raw.CheckParams(N, r, p)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	err = raw.CheckKeyLength(len(oldHash))
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	if subtle.ConstantTimeCompare(oldHash, raw.KeyWithPool(c.workPool(), password, salt, N, r, p, len(oldHash))) != 1 {
 		err = abstract.ErrInvalidPassword
 	}
 
 	return
 }
 
+func (c *scryptSHA256Crypter) verifyHeader(password []byte, hash string) error {
+	header, _, N, r, p, err := raw.ParseHeader(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	if subtle.ConstantTimeCompare(header[64:], raw.HeaderMAC(password, header, N, r, p)) != 1 {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
 func (c *scryptSHA256Crypter) NeedsUpdate(stub string) bool {
-	salt, _, N, r, p, err := raw.Parse(stub)
+	if c.legacyFormat(stub) != 0 {
+		return true
+	}
+
+	salt, hash, N, r, p, err := raw.Parse(stub)
 	if err != nil {
 		return false // ...
 	}
 
-	return c.needsUpdate(salt, N, r, p)
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"N":           uint64(N),
+		"r":           uint64(r),
+		"p":           uint64(p),
+	}
+	if len(hash) != 0 {
+		stored["key_length"] = uint64(len(hash))
+	}
+
+	return abstract.CompareParams(stored, c.target()) < 0
 }
 
-func (c *scryptSHA256Crypter) needsUpdate(salt []byte, N, r, p int) bool {
-	return len(salt) < 18 || N < c.nN || r < c.r || p < c.p
+func (c *scryptSHA256Crypter) ReadParams(hash string) (map[string]string, error) {
+	_, _, N, r, p, err := c.parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{
+		"N": fmt.Sprint(N),
+		"r": fmt.Sprint(r),
+		"p": fmt.Sprint(p),
+	}, nil
 }
 
-func (c *scryptSHA256Crypter) hash(password, stub string) (oldHashRaw []byte, newHash string, salt []byte, N, r, p int, err error) {
-	salt, oldHashRaw, N, r, p, err = raw.Parse(stub)
+func (c *scryptSHA256Crypter) SplitHash(hash string) (salt, digest []byte, params map[string]string, err error) {
+	salt, digest, N, r, p, err := raw.Parse(hash)
+	if err == nil && len(digest) == 0 {
+		err = raw.ErrInvalidStub
+	}
 	if err != nil {
-		return
+		return nil, nil, nil, abstract.InvalidHash(err)
 	}
 
-	return oldHashRaw, raw.ScryptSHA256(password, salt, N, r, p), salt, N, r, p, nil
+	return salt, digest, map[string]string{
+		"N": fmt.Sprint(N),
+		"r": fmt.Sprint(r),
+		"p": fmt.Sprint(p),
+	}, nil
 }
 
-func (c *scryptSHA256Crypter) makeStub() (string, error) {
-	buf := make([]byte, 18)
-	_, err := rand.Read(buf)
+func (c *scryptSHA256Crypter) JoinHash(salt, digest []byte, params map[string]string) (string, error) {
+	var N, r, p int
+	err := abstract.ParseAllIntParams(params, map[string]*int{"N": &N, "r": &r, "p": &p})
 	if err != nil {
 		return "", err
 	}
 
-	salt := base64.StdEncoding.EncodeToString(buf)
+	if len(salt) == 0 || len(digest) == 0 {
+		return "", raw.ErrInvalidStub
+	}
+
+	return c.format(salt, digest, N, r, p), nil
+}
+
+// scrypt runs 4*N*r*p Salsa20/8 cores, each costing about half a SHA-256
+// compression, so the strength is log2(2*N*r*p). This ignores the N*r*128
+// bytes of memory an attacker must also provide per guess.
+func (c *scryptSHA256Crypter) Strength(hash string) (float64, error) {
+	_, _, N, r, p, err := c.parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return strength(N, r, p), nil
+}
+
+func strength(N, r, p int) float64 {
+	return math.Log2(2 * float64(N) * float64(r) * float64(p))
+}
+
+// scrypt needs N blocks of 128*r bytes, plus p more for its output and two
+// as scratch space. The p lanes are computed one after another.
+func (c *scryptSHA256Crypter) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Memory:   128 * uint64(c.r) * uint64(c.nN+c.p+2),
+		Threads:  1,
+		Time:     map[string]uint64{"N": uint64(c.nN), "r": uint64(c.r), "p": uint64(c.p)},
+		Strength: strength(c.nN, c.r, c.p),
+	}
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (c *scryptSHA256Crypter) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": 18,
+		"key_length":  uint64(c.keyLen),
+		"N":           uint64(c.nN),
+		"r":           uint64(c.r),
+		"p":           uint64(c.p),
+	}
+}
+
+func (c *scryptSHA256Crypter) format(salt, hash []byte, N, r, p int) string {
+	return fmt.Sprintf("$s2$%d$%d$%d$%s$%s", N, r, p, c.encoding.Encode(salt), c.encoding.Encode(hash))
+}
 
-	return fmt.Sprintf("$s2$%d$%d$%d$%s", c.nN, c.r, c.p, salt), nil
+func (c *scryptSHA256Crypter) Describe() string {
+	return fmt.Sprintf("scrypt-sha256(N=%d,r=%d,p=%d)", c.nN, c.r, c.p)
 }
 
 func (c *scryptSHA256Crypter) String() string {
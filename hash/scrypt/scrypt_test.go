@@ -0,0 +1,299 @@
+package scrypt
+
+import "testing"
+import "errors"
+import "strings"
+import "bytes"
+import "time"
+import "github.com/al45tair/passlib/abstract"
+import "github.com/al45tair/passlib/hash/scrypt/raw"
+
+func TestNewSHA256(t *testing.T) {
+	for _, v := range []struct{ N, r, p int }{
+		{0, 8, 1},
+		{1, 8, 1},
+		{1000, 8, 1},
+		{16384, 0, 1},
+		{16384, 8, 0},
+		{16384, 1 << 15, 1 << 15},
+	} {
+		if _, err := NewSHA256(v.N, v.r, v.p); err == nil {
+			t.Fatalf("expected error for N=%d r=%d p=%d", v.N, v.r, v.p)
+		}
+	}
+
+	weak, err := NewSHA256(1024, 8, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	strong, err := NewSHA256(2048, 8, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	h, err := weak.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := strong.Verify("password", h); err != nil {
+		t.Fatalf("err verifying with different configured parameters: %v", err)
+	}
+	if !strong.NeedsUpdate(h) {
+		t.Fatalf("hash with weaker parameters does not need update")
+	}
+	if weak.NeedsUpdate(h) {
+		t.Fatalf("hash with configured parameters needs update")
+	}
+
+	// Invalid parameters embedded in a hash are an error, not a panic.
+	if err := strong.Verify("password", "$s2$1000$8$1$qa9lVfhmTE8F2Jpwya9m7uoE$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI="); err == nil {
+		t.Fatalf("expected error for invalid embedded parameters")
+	}
+}
+
+func TestWorkPool(t *testing.T) {
+	s, err := NewSHA256(1024, 8, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c := s.(*scryptSHA256Crypter)
+
+	if c.pool.Load() != nil {
+		t.Fatalf("pool made before first use")
+	}
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pool := c.workPool()
+	if !pool.Fits(1024, 8, 1) {
+		t.Fatalf("pool does not fit the configured parameters")
+	}
+
+	// Changing the parameters replaces the pool; hashes made with the old
+	// ones still verify.
+	if err := c.SetParams(2048, 8, 1); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if pool = c.workPool(); !pool.Fits(2048, 8, 1) {
+		t.Fatalf("pool not replaced after SetParams")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	const maxMemory = 4 << 20
+
+	N, r, p, d, err := Calibrate(5*time.Millisecond, maxMemory)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := raw.CheckParams(N, r, p); err != nil {
+		t.Fatalf("invalid calibration result: %v", err)
+	}
+	if memoryUsage(N, r, p) > maxMemory {
+		t.Fatalf("calibration result exceeds memory ceiling: N=%d r=%d p=%d", N, r, p)
+	}
+	if d <= 0 {
+		t.Fatalf("no measured duration returned")
+	}
+
+	if _, _, _, _, err := Calibrate(time.Second, 1024); err == nil {
+		t.Fatalf("expected error with insufficient memory")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	// Generated with Python's hashlib.scrypt for the password "password",
+	// in each encoding.
+	for _, v := range []struct {
+		encoding abstract.Base64Encoding
+		hash     string
+	}{
+		{abstract.Base64Default, "$s2$1024$8$1$X+zrZv/IbzjZUnhsbWlsecLb$v6Qo5+1s9dsptEY6tgLDEXTtcJ2ZazvjwGHJwE8VFdk="},
+		{abstract.Base64Std, "$s2$1024$8$1$X+zrZv/IbzjZUnhsbWlsecLb$v6Qo5+1s9dsptEY6tgLDEXTtcJ2ZazvjwGHJwE8VFdk="},
+		{abstract.Base64RawStd, "$s2$1024$8$1$X+zrZv/IbzjZUnhsbWlsecLb$v6Qo5+1s9dsptEY6tgLDEXTtcJ2ZazvjwGHJwE8VFdk"},
+		{abstract.Base64Adapted, "$s2$1024$8$1$X.zrZv/IbzjZUnhsbWlsecLb$v6Qo5.1s9dsptEY6tgLDEXTtcJ2ZazvjwGHJwE8VFdk"},
+	} {
+		s, err := NewSHA256WithEncoding(1024, 8, 1, v.encoding)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		salt, _, _, _, _, err := raw.Parse(v.hash)
+		if err != nil {
+			t.Fatalf("err parsing %q: %v", v.hash, err)
+		}
+
+		// WithParams keeps the encoding.
+		p, err := s.(abstract.ParamScheme).WithParams(map[string]string{})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		for _, c := range []abstract.Scheme{s, p} {
+			h, err := c.(abstract.SaltReaderScheme).HashWithSaltReader([]byte("password"), bytes.NewReader(salt))
+			if err != nil {
+				t.Fatalf("err hashing: %v", err)
+			}
+			if h != v.hash {
+				t.Fatalf("hash with encoding %d: got %q, expected %q", v.encoding, h, v.hash)
+			}
+		}
+
+		for _, c := range []abstract.Scheme{s, p, SHA256Crypter} {
+			if err := c.Verify("password", v.hash); err != nil {
+				t.Fatalf("err verifying %q: %v", v.hash, err)
+			}
+			if err := c.Verify("passwore", v.hash); err != abstract.ErrInvalidPassword {
+				t.Fatalf("expected ErrInvalidPassword for %q, got %v", v.hash, err)
+			}
+		}
+	}
+}
+
+func TestKeyLength(t *testing.T) {
+	for _, n := range []int{0, raw.MinKeyLength - 1, raw.MaxKeyLength + 1} {
+		if _, err := NewSHA256WithKeyLen(1024, 8, 1, n); err == nil {
+			t.Fatalf("expected error for key length %d", n)
+		}
+	}
+
+	s, err := NewSHA256WithKeyLen(1024, 8, 1, 64)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Generated with Python's hashlib.scrypt with dklen=64.
+	const peer = "$s2$1024$8$1$AAECAwQFBgcICQoLDA0ODxAR$XsUOsDBRdp+mINqJcsn32Tmqq4gy6QwclYS//H9Nz/QeC9YI43mXhpPFyyvwrbqJV1gGKUKB6o5wMRDgeJvJGA=="
+
+	salt, _, _, _, _, _ := raw.Parse(peer)
+	h, err := s.(abstract.SaltReaderScheme).HashWithSaltReader([]byte("password"), bytes.NewReader(salt))
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if h != peer {
+		t.Fatalf("got %q, expected %q", h, peer)
+	}
+
+	legacy, err := NewSHA256(1024, 8, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	old, err := legacy.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+
+	for _, hash := range []string{peer, old} {
+		for _, c := range []abstract.Scheme{s, legacy} {
+			if !c.SupportsStub(hash) {
+				t.Fatalf("%v does not support %q", c, hash)
+			}
+			if err := c.Verify("password", hash); err != nil {
+				t.Fatalf("err verifying %q with %v: %v", hash, c, err)
+			}
+			if err := c.Verify("passwore", hash); err != abstract.ErrInvalidPassword {
+				t.Fatalf("expected ErrInvalidPassword for %q, got %v", hash, err)
+			}
+		}
+	}
+
+	if !s.NeedsUpdate(old) {
+		t.Fatalf("hash with shorter key does not need update")
+	}
+	if s.NeedsUpdate(peer) || legacy.NeedsUpdate(peer) {
+		t.Fatalf("hash with configured key length needs update")
+	}
+
+	p, err := legacy.(abstract.ParamScheme).WithParams(map[string]string{"key_length": "64"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if params := p.(abstract.ParamScheme).Params(); params["key_length"] != "64" {
+		t.Fatalf("unexpected params: %v", params)
+	}
+}
+
+func TestLegacyFormats(t *testing.T) {
+	// Headers made with node's crypto.scryptSync (OpenSSL), and simple-scrypt
+	// hashes with Python's hashlib.scrypt.
+	header := []struct{ password, hash string }{
+		{"password", "c2NyeXB0AAoAAAAIAAAAATAxMjM0NTY3ODlhYmNkZWYwMTIzNDU2Nzg5YWJjZGVmmxScRJjg+W1N9/jV1ZweuB671uNZze4s/jKEgp0FeUN9czpdEFkvwcmVZwmDcRpF"},
+		{"correct horse battery staple", "c2NyeXB0AAQAAAABAAAAAmNHmtaaCQslgnfsj7pvmUGaL/skiYFRBlfJRMzRFI6XcbGYjZTDAwkYnmJ+mplojV7wLxUSs6N4zrC2a8O+d/9nxvnlQbLkwtiphZbMWBkC"},
+	}
+	simple := []struct{ password, hash string }{
+		{"password", "1024$8$1$ba5c8ce2d7e95bfd1a39d0a6d1aa1458$eac8dfd565de1d5a7cb6cde4e7cbe71e8cb7944930748c87f035ea49e40e34b6"},
+		{"correct horse battery staple", "16$1$2$00112233445566778899aabbccddeeff$941e5f9958c8ea701425eb93d279552683e45038787c0e8a068db1b9785aa1d2"},
+	}
+
+	both, err := NewSHA256WithLegacyFormats(1024, 8, 1, LegacyScryptHeader|LegacySimpleScrypt)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	headerOnly, err := NewSHA256WithLegacyFormats(1024, 8, 1, LegacyScryptHeader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// WithParams keeps the formats.
+	p, err := both.(abstract.ParamScheme).WithParams(map[string]string{"N": "2048"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, v := range append(header, simple...) {
+		for _, c := range []abstract.Scheme{both, p} {
+			if !c.SupportsStub(v.hash) {
+				t.Fatalf("%v does not support %q", c, v.hash)
+			}
+			if err := c.Verify(v.password, v.hash); err != nil {
+				t.Fatalf("err verifying %q: %v", v.hash, err)
+			}
+			if err := c.Verify("wrong", v.hash); err != abstract.ErrInvalidPassword {
+				t.Fatalf("expected ErrInvalidPassword for %q, got %v", v.hash, err)
+			}
+			if !c.NeedsUpdate(v.hash) {
+				t.Fatalf("legacy hash %q does not need update", v.hash)
+			}
+			if _, err := c.(abstract.StrengthScheme).Strength(v.hash); err != nil {
+				t.Fatalf("err estimating strength of %q: %v", v.hash, err)
+			}
+		}
+
+		if SHA256Crypter.SupportsStub(v.hash) {
+			t.Fatalf("default scheme supports %q", v.hash)
+		}
+	}
+
+	for _, v := range simple {
+		if headerOnly.SupportsStub(v.hash) {
+			t.Fatalf("header-only scheme supports %q", v.hash)
+		}
+	}
+
+	params, err := both.(abstract.ParamReader).ReadParams(header[1].hash)
+	if err != nil || params["N"] != "16" || params["r"] != "1" || params["p"] != "2" {
+		t.Fatalf("unexpected params %v, %v", params, err)
+	}
+
+	// New hashes are still in the $s2$ format.
+	h, err := both.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$s2$") || both.NeedsUpdate(h) {
+		t.Fatalf("unexpected hash %q", h)
+	}
+
+	// A corrupt header is rejected without being hashed.
+	corrupt := "c2NyeXB0AAoAAAAIAAAAATAxMjM0NTY3ODlhYmNkZWYwMTIzNDU2Nzg5YWJjZGVmnxScRJjg+W1N9/jV1ZweuB671uNZze4s/jKEgp0FeUN9czpdEFkvwcmVZwmDcRpF"
+	if err := both.Verify("password", corrupt); !errors.Is(err, abstract.ErrInvalidHash) {
+		t.Fatalf("expected ErrInvalidHash, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package raw
+
+import "fmt"
+import "strconv"
+import "strings"
+
+// Indicates that a password hash or stub is invalid.
+var ErrInvalidStub = fmt.Errorf("invalid sha1-crypt stub")
+
+// Indicates that the number of rounds is outside the permitted range, or is
+// written with leading zeros.
+var ErrInvalidRounds = fmt.Errorf("invalid sha1-crypt rounds")
+
+// Scans a sha1-crypt stub or hash to determine the number of rounds, salt
+// and hash.
+//
+// The format is as follows:
+//
+//   $sha1$rounds$salt$hash   // hash
+//   $sha1$rounds$salt        // stub
+//
+// where the salt and hash are in the crypt base64 alphabet, and the hash is
+// 28 characters long.
+func Parse(stub string) (rounds int, salt, hash string, err error) {
+	if !strings.HasPrefix(stub, "$sha1$") {
+		err = ErrInvalidStub
+		return
+	}
+
+	parts := strings.Split(stub[6:], "$")
+	if len(parts) < 2 || len(parts) > 3 {
+		err = ErrInvalidStub
+		return
+	}
+
+	r, err := strconv.ParseUint(parts[0], 10, 31)
+	if err != nil || r < MinimumRounds || parts[0] != strconv.FormatUint(r, 10) {
+		err = ErrInvalidRounds
+		return
+	}
+
+	salt = parts[1]
+	if len(salt) > MaximumSaltLength || !isBase64(salt) {
+		err = ErrInvalidStub
+		return
+	}
+
+	if len(parts) == 3 {
+		hash = parts[2]
+		if len(hash) != 28 || !isBase64(hash) {
+			err = ErrInvalidStub
+			return
+		}
+	}
+
+	return int(r), salt, hash, nil
+}
+
+func isBase64(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(itoa64, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
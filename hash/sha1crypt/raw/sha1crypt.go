@@ -0,0 +1,81 @@
+// Package raw provides a raw implementation of sha1-crypt, NetBSD's
+// iterated HMAC-SHA1 crypt.
+package raw
+
+import "crypto/hmac"
+import "crypto/sha1"
+import "strconv"
+
+// The length of the salts generated by Python passlib.
+const SaltLength = 8
+
+// The maximum length of a sha1-crypt salt.
+const MaximumSaltLength = 64
+
+// The minimum number of rounds.
+const MinimumRounds = 1
+
+// The maximum number of rounds. The format allows up to 2^32-1, but no
+// practical hash uses anywhere near this many, and larger counts do not fit
+// an int on 32-bit platforms.
+const MaximumRounds = 1<<31 - 1
+
+// The number of rounds used by Python passlib.
+const RecommendedRounds = 480000
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Calculates sha1-crypt. The password must be in plaintext and be a UTF-8
+// string.
+//
+// The salt must consist of at most MaximumSaltLength characters from the
+// crypt base64 alphabet, and rounds must be between MinimumRounds and
+// MaximumRounds.
+//
+// The output is in modular crypt format.
+func Crypt(password, salt string, rounds int) string {
+	return "$sha1$" + strconv.Itoa(rounds) + "$" + salt + "$" + Hash(password, salt, rounds)
+}
+
+// Calculates the checksum part of a sha1-crypt hash, as for Crypt. The first
+// round is HMAC-SHA1, keyed with the password, of "<salt>$sha1$<rounds>";
+// each further round is HMAC-SHA1 of the result of the one before.
+func Hash(password, salt string, rounds int) string {
+	mac := hmac.New(sha1.New, []byte(password))
+	mac.Write([]byte(salt + "$sha1$" + strconv.Itoa(rounds)))
+	result := mac.Sum(nil)
+
+	for i := 1; i < rounds; i++ {
+		mac.Reset()
+		mac.Write(result)
+		result = mac.Sum(result[:0])
+	}
+
+	// The 20-byte digest is encoded in groups of three bytes, each in
+	// reverse order; the last group repeats the first byte.
+	out := make([]byte, 0, 28)
+	for i := 0; i < 18; i += 3 {
+		out = to64(out, uint(result[i])<<16|uint(result[i+1])<<8|uint(result[i+2]), 4)
+	}
+	out = to64(out, uint(result[18])<<16|uint(result[19])<<8|uint(result[0]), 4)
+
+	return string(out)
+}
+
+// Encodes a byte string using the crypt base64 variant. len(b) must be a
+// multiple of 3.
+func EncodeBase64(b []byte) string {
+	out := make([]byte, 0, len(b)/3*4)
+	for i := 0; i+2 < len(b); i += 3 {
+		out = to64(out, uint(b[i])<<16|uint(b[i+1])<<8|uint(b[i+2]), 4)
+	}
+	return string(out)
+}
+
+func to64(out []byte, v uint, n int) []byte {
+	for ; n > 0; n-- {
+		out = append(out, itoa64[v&0x3f])
+		v >>= 6
+	}
+	return out
+}
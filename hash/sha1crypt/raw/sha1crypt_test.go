@@ -0,0 +1,52 @@
+package raw
+
+import "testing"
+
+func TestSHA1Crypt(t *testing.T) {
+	vectors := []struct {
+		password, hash string
+	}{
+		// From Python passlib's test suite.
+		{"password", "$sha1$19703$iVdJqfSE$v4qYKl1zqYThwpjJAoKX6UvlHq/a"},
+		{"password", "$sha1$21773$uV7PTeux$I9oHnvwPZHMO0Nq6/WgyGV/tDJIH"},
+		{"táБℓə", "$sha1$40000$uJ3Sp7LE$.VEmLO5xntyRFYihC7ggd3297T/D"},
+	}
+
+	for _, v := range vectors {
+		rounds, salt, hash, err := Parse(v.hash)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", v.hash, err)
+		}
+
+		if h := Hash(v.password, salt, rounds); h != hash {
+			t.Errorf("Hash(%q, %q, %d): got %q, expected %q", v.password, salt, rounds, h, hash)
+		}
+		if h := Crypt(v.password, salt, rounds); h != v.hash {
+			t.Errorf("Crypt: got %q, expected %q", h, v.hash)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if rounds, salt, hash, err := Parse("$sha1$480000$abcdefgh"); err != nil || rounds != 480000 || salt != "abcdefgh" || hash != "" {
+		t.Errorf("unexpected stub parse: %d, %q, %q, %v", rounds, salt, hash, err)
+	}
+
+	for _, stub := range []string{
+		"$sha1$",
+		"$sha1$1000",
+		"$sha1$0$abcdefgh",
+		"$sha1$01000$abcdefgh",
+		"$sha1$+1000$abcdefgh",
+		"$sha1$4294967296$abcdefgh",
+		"$sha1$1000$abc!efgh",
+		"$sha1$1000$abcdefgh$short",
+		"$sha1$1000$abcdefgh$v4qYKl1zqYThwpjJAoKX6UvlHq/a$",
+		"$sha1$1000$" + string(make([]byte, 65)),
+		"$sha256$1000$abcdefgh",
+	} {
+		if _, _, _, err := Parse(stub); err == nil {
+			t.Errorf("%q: expected error", stub)
+		}
+	}
+}
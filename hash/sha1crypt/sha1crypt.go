@@ -0,0 +1,107 @@
+// Package sha1crypt implements sha1-crypt, the iterated HMAC-SHA1 crypt
+// introduced by NetBSD and also supported by Python passlib, in the format
+// $sha1$rounds$salt$checksum.
+//
+// sha1-crypt is weak and is supported only so that legacy hashes can be
+// verified and upgraded to a modern scheme. NeedsUpdate always returns true.
+package sha1crypt
+
+import "expvar"
+import "crypto/rand"
+import "io"
+import "math"
+import "strconv"
+import "strings"
+import "github.com/al45tair/passlib/hash/sha1crypt/raw"
+import "github.com/al45tair/passlib/abstract"
+
+var cSHA1CryptHashCalls = expvar.NewInt("passlib.sha1crypt.hashCalls")
+var cSHA1CryptVerifyCalls = expvar.NewInt("passlib.sha1crypt.verifyCalls")
+
+// An implementation of Scheme performing sha1-crypt. It generates hashes
+// with raw.RecommendedRounds, as Python passlib does.
+//
+// WARNING: sha1-crypt should not be used for new applications under any
+// circumstances. It should be used for legacy compatibility only.
+var Crypter abstract.Scheme
+
+func init() {
+	Crypter = &sha1Crypter{}
+}
+
+type sha1Crypter struct{}
+
+func (c *sha1Crypter) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, "$sha1$")
+}
+
+func (c *sha1Crypter) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *sha1Crypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	cSHA1CryptHashCalls.Add(1)
+
+	buf := make([]byte, raw.SaltLength/4*3)
+	_, err := io.ReadFull(saltReader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	salt := raw.EncodeBase64(buf)
+
+	return raw.Crypt(string(password), salt, raw.RecommendedRounds), nil
+}
+
+func (c *sha1Crypter) Verify(password, hash string) error {
+	cSHA1CryptVerifyCalls.Add(1)
+
+	rounds, salt, oldHash, err := raw.Parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	if !abstract.SecureCompare(oldHash, raw.Hash(password, salt, rounds)) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// sha1-crypt is always deprecated.
+func (c *sha1Crypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (c *sha1Crypter) IsDeprecated() bool {
+	return true
+}
+
+func (c *sha1Crypter) ReadParams(hash string) (map[string]string, error) {
+	rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"rounds": strconv.Itoa(rounds)}, nil
+}
+
+// Each round is an HMAC-SHA1, which takes two compressions, so the strength
+// is log2(2*rounds).
+func (c *sha1Crypter) Strength(hash string) (float64, error) {
+	rounds, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return math.Log2(2 * float64(rounds)), nil
+}
+
+func (c *sha1Crypter) String() string {
+	return "sha1-crypt"
+}
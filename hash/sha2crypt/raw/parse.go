@@ -52,6 +52,13 @@ func Parse(stub string) (isSHA512 bool, salt, hash string, rounds int, err error
 		hash = parts[2]
 	default:
 		err = ErrInvalidStub
+		return
+	}
+
+	// crypt(3) truncates longer salts, so no hash it made has one.
+	if len(salt) > MaxSaltLength {
+		err = ErrInvalidStub
+		return
 	}
 
 	if roundsStr != "" {
@@ -25,6 +25,9 @@ const DefaultRounds = 5000
 // proportional to it.
 const RecommendedRounds = 10000
 
+// The longest salt sha256-crypt and sha512-crypt use, in characters.
+const MaxSaltLength = 16
+
 // Calculates sha256-crypt. The password must be in plaintext and be a UTF-8
 // string.
 //
@@ -64,7 +67,7 @@ func shaCrypt(password, salt string, rounds int, newHash func() hash.Hash, trans
 
 	passwordb := []byte(password)
 	saltb := []byte(salt)
-	if len(saltb) > 16 {
+	if len(saltb) > MaxSaltLength {
 		panic("salt must not exceed 16 bytes")
 	}
 
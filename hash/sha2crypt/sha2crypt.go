@@ -2,8 +2,10 @@
 package sha2crypt
 
 import "fmt"
+import "math"
 import "expvar"
 import "crypto/rand"
+import "io"
 import "github.com/al45tair/passlib/hash/sha2crypt/raw"
 import "github.com/al45tair/passlib/abstract"
 
@@ -21,20 +23,33 @@ var Crypter256 abstract.Scheme
 var Crypter512 abstract.Scheme
 
 func init() {
-	Crypter256 = NewCrypter256(raw.RecommendedRounds)
-	Crypter512 = NewCrypter512(raw.RecommendedRounds)
+	Crypter256 = &sha2Crypter{false, raw.RecommendedRounds}
+	Crypter512 = &sha2Crypter{true, raw.RecommendedRounds}
 }
 
 // Returns a Scheme implementing sha256-crypt using the number of rounds
 // specified.
-func NewCrypter256(rounds int) abstract.Scheme {
-	return &sha2Crypter{false, rounds}
+//
+// Returns raw.ErrInvalidRounds unless raw.MinimumRounds <= rounds <=
+// raw.MaximumRounds. New hashes include the rounds in the stub unless rounds
+// is raw.DefaultRounds. Existing hashes are verified using the rounds encoded
+// in them, and NeedsUpdate reports hashes with fewer rounds than configured.
+func NewCrypter256(rounds int) (abstract.Scheme, error) {
+	return newCrypter(false, rounds)
 }
 
 // Returns a Scheme implementing sha512-crypt using the number of rounds
-// specified.
-func NewCrypter512(rounds int) abstract.Scheme {
-	return &sha2Crypter{true, rounds}
+// specified. See NewCrypter256.
+func NewCrypter512(rounds int) (abstract.Scheme, error) {
+	return newCrypter(true, rounds)
+}
+
+func newCrypter(sha512 bool, rounds int) (abstract.Scheme, error) {
+	if rounds < raw.MinimumRounds || rounds > raw.MaximumRounds {
+		return nil, raw.ErrInvalidRounds
+	}
+
+	return &sha2Crypter{sha512, rounds}, nil
 }
 
 type sha2Crypter struct {
@@ -53,6 +68,24 @@ func (c *sha2Crypter) SetRounds(rounds int) error {
 	return nil
 }
 
+func (c *sha2Crypter) Params() map[string]string {
+	return map[string]string{"rounds": fmt.Sprint(c.rounds)}
+}
+
+func (c *sha2Crypter) WithParams(params map[string]string) (abstract.Scheme, error) {
+	rounds := c.rounds
+	err := abstract.ParseIntParams(params, map[string]*int{"rounds": &rounds})
+	if err != nil {
+		return nil, err
+	}
+
+	if rounds < raw.MinimumRounds || rounds > raw.MaximumRounds {
+		return nil, raw.ErrInvalidRounds
+	}
+
+	return &sha2Crypter{c.sha512, rounds}, nil
+}
+
 func (c *sha2Crypter) SupportsStub(stub string) bool {
 	if len(stub) < 3 || stub[0] != '$' || stub[2] != '$' {
 		return false
@@ -61,22 +94,35 @@ func (c *sha2Crypter) SupportsStub(stub string) bool {
 }
 
 func (c *sha2Crypter) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *sha2Crypter) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
 	cSHA2CryptHashCalls.Add(1)
 
-	stub, err := c.makeStub()
+	stub, err := c.makeStub(saltReader)
 	if err != nil {
 		return "", err
 	}
 
-	_, newHash, _, _, err := c.hash(password, stub)
+	_, newHash, _, _, err := c.hash(string(password), stub)
 	return newHash, err
 }
 
 func (c *sha2Crypter) Verify(password, hash string) (err error) {
 	cSHA2CryptVerifyCalls.Add(1)
 
-	_, newHash, _, _, err := c.hash(password, hash)
-	if err == nil && !abstract.SecureCompare(hash, newHash) {
+	oldHash, newHash, _, _, err := c.hash(password, hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(errInvalidStub)
+	}
+
+	if !abstract.SecureCompare(hash, newHash) {
 		err = abstract.ErrInvalidPassword
 	}
 
@@ -89,11 +135,58 @@ func (c *sha2Crypter) NeedsUpdate(stub string) bool {
 		return false // ...
 	}
 
-	return c.needsUpdate(salt, rounds)
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"rounds":      uint64(rounds),
+	}
+
+	return abstract.CompareParams(stored, c.target()) < 0
+}
+
+func (c *sha2Crypter) ReadParams(hash string) (map[string]string, error) {
+	_, _, _, rounds, err := raw.Parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{"rounds": fmt.Sprint(rounds)}, nil
+}
+
+// Each round of sha256-crypt takes about one SHA-256 compression, so its
+// strength is log2(rounds); a SHA-512 compression costs about two, so
+// sha512-crypt's is one bit more.
+func (c *sha2Crypter) Strength(hash string) (float64, error) {
+	is512, _, _, rounds, err := raw.Parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return strength(is512, rounds), nil
+}
+
+func strength(is512 bool, rounds int) float64 {
+	strength := math.Log2(float64(rounds))
+	if is512 {
+		strength++
+	}
+
+	return strength
+}
+
+func (c *sha2Crypter) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Threads:  1,
+		Time:     map[string]uint64{"rounds": uint64(c.rounds)},
+		Strength: strength(c.sha512, c.rounds),
+	}
 }
 
-func (c *sha2Crypter) needsUpdate(salt string, rounds int) bool {
-	return rounds < c.rounds || len(salt) < 16
+// The parameters NeedsUpdate compares hashes against.
+func (c *sha2Crypter) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": 16,
+		"rounds":      uint64(c.rounds),
+	}
 }
 
 var errInvalidStub = fmt.Errorf("invalid sha2 password stub")
@@ -115,14 +208,14 @@ func (c *sha2Crypter) hash(password, stub string) (oldHash, newHash, salt string
 	return oldHash, raw.Crypt256(password, salt, rounds), salt, rounds, nil
 }
 
-func (c *sha2Crypter) makeStub() (string, error) {
+func (c *sha2Crypter) makeStub(saltReader io.Reader) (string, error) {
 	ch := "5"
 	if c.sha512 {
 		ch = "6"
 	}
 
 	buf := make([]byte, 12)
-	_, err := rand.Read(buf)
+	_, err := io.ReadFull(saltReader, buf)
 	if err != nil {
 		return "", err
 	}
@@ -136,6 +229,14 @@ func (c *sha2Crypter) makeStub() (string, error) {
 	return fmt.Sprintf("$%s$rounds=%d$%s", ch, c.rounds, salt), nil
 }
 
+func (c *sha2Crypter) Describe() string {
+	if c.sha512 {
+		return fmt.Sprintf("sha512-crypt(rounds=%d)", c.rounds)
+	}
+
+	return fmt.Sprintf("sha256-crypt(rounds=%d)", c.rounds)
+}
+
 func (c *sha2Crypter) String() string {
 	if c.sha512 {
 		return fmt.Sprintf("sha512-crypt(%d)", c.rounds)
@@ -0,0 +1,65 @@
+package sha2crypt
+
+import "testing"
+import "strings"
+import "github.com/al45tair/passlib/hash/sha2crypt/raw"
+import "github.com/al45tair/passlib/abstract"
+
+func TestRounds(t *testing.T) {
+	for _, v := range []struct {
+		newCrypter func(rounds int) (abstract.Scheme, error)
+		ident      string
+	}{
+		{NewCrypter256, "$5$"},
+		{NewCrypter512, "$6$"},
+	} {
+		for _, rounds := range []int{0, 999, 1000000000} {
+			if s, err := v.newCrypter(rounds); err != raw.ErrInvalidRounds || s != nil {
+				t.Fatalf("%s rounds %d: expected ErrInvalidRounds, got %v", v.ident, rounds, err)
+			}
+		}
+		for _, rounds := range []int{raw.MinimumRounds, raw.MaximumRounds} {
+			if _, err := v.newCrypter(rounds); err != nil {
+				t.Fatalf("%s rounds %d: err: %v", v.ident, rounds, err)
+			}
+		}
+
+		weak, err := v.newCrypter(raw.DefaultRounds)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		strong, err := v.newCrypter(100000)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		h, err := weak.Hash("password")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !strings.HasPrefix(h, v.ident) || strings.Contains(h, "rounds=") {
+			t.Fatalf("unexpected default rounds hash: %q", h)
+		}
+
+		if err := strong.Verify("password", h); err != nil {
+			t.Fatalf("err verifying with different configured rounds: %v", err)
+		}
+		if !strong.NeedsUpdate(h) {
+			t.Fatalf("5000 round hash does not need update under 100000 rounds")
+		}
+		if weak.NeedsUpdate(h) {
+			t.Fatalf("hash with configured rounds needs update")
+		}
+
+		h, err = strong.Hash("password")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !strings.HasPrefix(h, v.ident+"rounds=100000$") {
+			t.Fatalf("rounds not encoded in hash: %q", h)
+		}
+		if strong.NeedsUpdate(h) {
+			t.Fatalf("hash with configured rounds needs update")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package raw
+
+import "strings"
+
+// The alphabet used by crypt(3).
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func atoi64(c byte) uint32 {
+	i := strings.IndexByte(itoa64, c)
+	if i < 0 {
+		return 64
+	}
+	return uint32(i)
+}
+
+// Encodes src as yescrypt does: each group of three bytes is read as a
+// little-endian integer and emitted six bits at a time, least significant
+// first.
+func encode64(src []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(src); {
+		value, bits := uint32(0), uint32(0)
+		for bits < 24 && i < len(src) {
+			value |= uint32(src[i]) << bits
+			bits += 8
+			i++
+		}
+
+		for b := uint32(0); b < bits; b += 6 {
+			sb.WriteByte(itoa64[value&0x3f])
+			value >>= 6
+		}
+	}
+	return sb.String()
+}
+
+// The inverse of encode64. Fails if src contains invalid characters, or
+// does not encode a whole number of bytes.
+func decode64(src string) ([]byte, error) {
+	var dst []byte
+	for len(src) != 0 {
+		value, bits := uint32(0), uint32(0)
+		for len(src) != 0 && bits < 24 {
+			c := atoi64(src[0])
+			if c > 63 {
+				return nil, ErrInvalidStub
+			}
+			src = src[1:]
+			value |= c << bits
+			bits += 6
+		}
+
+		// Each group must contain at least one whole byte, and any bits left
+		// over must be zero.
+		if bits < 12 {
+			return nil, ErrInvalidStub
+		}
+		for ; bits >= 8; bits -= 8 {
+			dst = append(dst, byte(value))
+			value >>= 8
+		}
+		if value != 0 {
+			return nil, ErrInvalidStub
+		}
+	}
+	return dst, nil
+}
+
+// Encodes a parameter in yescrypt's variable-length format, in which small
+// values take one character and larger ones progressively more. src must be
+// at least min.
+func encode64Uint32(src, min uint32) string {
+	src -= min
+
+	start, end, chars, bits := uint32(0), uint32(47), 1, uint32(0)
+	for {
+		count := (end + 1 - start) << bits
+		if src < count {
+			break
+		}
+		start = end + 1
+		end = start + (62-end)/2
+		src -= count
+		chars++
+		bits += 6
+	}
+
+	out := []byte{itoa64[start+(src>>bits)]}
+	for chars--; chars > 0; chars-- {
+		bits -= 6
+		out = append(out, itoa64[(src>>bits)&0x3f])
+	}
+	return string(out)
+}
+
+// The inverse of encode64Uint32, returning the decoded value and the rest of
+// src.
+func decode64Uint32(src string, min uint32) (uint32, string, error) {
+	if len(src) == 0 {
+		return 0, "", ErrInvalidStub
+	}
+
+	c := atoi64(src[0])
+	if c > 63 {
+		return 0, "", ErrInvalidStub
+	}
+	src = src[1:]
+
+	start, end, chars, bits := uint32(0), uint32(47), 1, uint32(0)
+	dst := min
+	for c > end {
+		dst += (end + 1 - start) << bits
+		start = end + 1
+		end = start + (62-end)/2
+		chars++
+		bits += 6
+	}
+	dst += (c - start) << bits
+
+	for chars--; chars > 0; chars-- {
+		if len(src) == 0 {
+			return 0, "", ErrInvalidStub
+		}
+		c = atoi64(src[0])
+		if c > 63 {
+			return 0, "", ErrInvalidStub
+		}
+		src = src[1:]
+		bits -= 6
+		dst += c << bits
+	}
+
+	return dst, src, nil
+}
@@ -0,0 +1,519 @@
+// Adapted from yescrypt-ref.c, the reference implementation of yescrypt.
+//
+// Copyright 2009 Colin Percival
+// Copyright 2013-2018 Alexander Peslyak
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+//    this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS BE LIABLE FOR
+// ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+// LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+// OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+// SUCH DAMAGE.
+
+package raw
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Flags selecting the yescrypt flavor.
+const (
+	flagWORM    = 0x001
+	flagRW      = 0x002
+	flagRounds6 = 0x004
+	flagGather4 = 0x010
+	flagSimple2 = 0x020
+	flagSBox12K = 0x080
+	flagPrehash = 0x10000000
+
+	modeMask     = 0x003
+	rwFlavorMask = 0x3fc
+
+	// The flags used by crypt(3) implementations by default.
+	FlagsDefault = flagRW | flagRounds6 | flagGather4 | flagSimple2 | flagSBox12K
+)
+
+// pwxform settings; only those of FlagsDefault are supported.
+const (
+	pwxSimple = 2
+	pwxGather = 4
+	pwxRounds = 6
+	sWidth    = 8
+
+	pwxBytes = pwxGather * pwxSimple * 8
+	pwxWords = pwxBytes / 4
+	sBytes   = 3 * (1 << sWidth) * pwxSimple * 8
+	sWords   = sBytes / 4
+	sMask    = ((1 << sWidth) - 1) * pwxSimple * 8
+)
+
+// The state of pwxform for one lane. s0, s1 and s2 are offsets of the
+// S-boxes in s, in words; w is the write position in S2, in 64-bit units.
+type pwxformCtx struct {
+	s          []uint32
+	s0, s1, s2 int
+	w          int
+}
+
+// Computes yescrypt_kdf.
+func kdf(password, salt []byte, flags uint32, N uint64, r, p, t uint32, keyLen int) []byte {
+	if flags&flagRW != 0 && p >= 1 && N/uint64(p) >= 0x100 && N/uint64(p)*uint64(r) >= 0x20000 {
+		password = kdfBody(password, salt, flags|flagPrehash, N>>6, r, p, 0, 32)
+	}
+
+	return kdfBody(password, salt, flags, N, r, p, t, keyLen)
+}
+
+func kdfBody(password, salt []byte, flags uint32, N uint64, r, p, t uint32, keyLen int) []byte {
+	s := 32 * int(r)
+	V := make([]uint32, uint64(s)*N)
+	XY := make([]uint32, 2*s)
+
+	var ctxs []pwxformCtx
+	if flags&flagRW != 0 {
+		ctxs = make([]pwxformCtx, p)
+		for i := range ctxs {
+			ctxs[i].s = make([]uint32, sWords)
+		}
+	}
+
+	if flags != 0 {
+		key := "yescrypt"
+		if flags&flagPrehash != 0 {
+			key = "yescrypt-prehash"
+		}
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(password)
+		password = mac.Sum(nil)
+	}
+
+	// 1: (B_0 ... B_{p-1}) <-- PBKDF2(P, S, 1, p * MFLen)
+	B := pbkdf2.Key(password, salt, 1, 128*int(r)*int(p), sha256.New)
+
+	var passwd []byte
+	if flags != 0 {
+		passwd = append([]byte{}, B[:32]...)
+		password = passwd
+	}
+
+	if flags&flagRW != 0 {
+		smix(B, r, N, p, t, flags, V, XY, ctxs, passwd)
+	} else {
+		// 2: for i = 0 to p - 1 do
+		for i := 0; i < int(p); i++ {
+			// 3: B_i <-- MF(B_i, N)
+			smix(B[128*int(r)*i:], r, N, 1, t, flags, V, XY, nil, nil)
+		}
+	}
+
+	// 5: DK <-- PBKDF2(P, B, 1, dkLen)
+	dk := pbkdf2.Key(password, B, 1, keyLen, sha256.New)
+
+	// Except for classic scrypt, the final steps match those of SCRAM (RFC
+	// 5802): the result is the StoredKey for the ClientKey.
+	if flags != 0 && flags&flagPrehash == 0 {
+		dkp := dk
+		if keyLen < 32 {
+			dkp = pbkdf2.Key(password, B, 1, 32, sha256.New)
+		}
+
+		mac := hmac.New(sha256.New, dkp[:32])
+		mac.Write([]byte("Client Key"))
+		storedKey := sha256.Sum256(mac.Sum(nil))
+		copy(dk, storedKey[:])
+	}
+
+	return dk
+}
+
+func smix(B []byte, r uint32, N uint64, p, t, flags uint32, V, XY []uint32, ctxs []pwxformCtx, passwd []byte) {
+	s := 32 * uint64(r)
+
+	// 1: n <-- N / p
+	nChunk := N / uint64(p)
+
+	// 2: Nloop_all <-- fNloop(n, t, flags)
+	nLoopAll := nChunk
+	if flags&flagRW != 0 {
+		if t <= 1 {
+			if t != 0 {
+				nLoopAll *= 2 // 2/3
+			}
+			nLoopAll = (nLoopAll + 2) / 3 // 1/3, round up
+		} else {
+			nLoopAll *= uint64(t - 1)
+		}
+	} else if t != 0 {
+		if t == 1 {
+			nLoopAll += (nLoopAll + 1) / 2 // 1.5, round up
+		}
+		nLoopAll *= uint64(t)
+	}
+
+	// 3-6: Nloop_rw <-- Nloop_all / p if YESCRYPT_RW is set, else 0
+	nLoopRW := uint64(0)
+	if flags&flagRW != 0 {
+		nLoopRW = nLoopAll / uint64(p)
+	}
+
+	// 8-10: round n down, and Nloop_all and Nloop_rw up, to even
+	nChunk &^= 1
+	nLoopAll = (nLoopAll + 1) &^ 1
+	nLoopRW = (nLoopRW + 1) &^ 1
+
+	// 11: for i = 0 to p - 1 do
+	vChunk := uint64(0)
+	for i := uint32(0); i < p; i++ {
+		// 13-16: the last lane takes whatever is left
+		np := nChunk
+		if i == p-1 {
+			np = N - vChunk
+		}
+
+		Bp := B[128*uint64(r)*uint64(i):]
+		Vp := V[s*vChunk:]
+
+		var ctx *pwxformCtx
+		if flags&flagRW != 0 {
+			ctx = &ctxs[i]
+
+			// 18: SMix1_1(B_i, Sbytes / 128, S_i, no flags)
+			smix1(Bp, 1, sBytes/128, 0, ctx.s, XY, nil)
+
+			// 19-22: S2_i, S1_i and S0_i are successive thirds of S_i
+			ctx.s2 = 0
+			ctx.s1 = (1 << sWidth) * pwxSimple * 2
+			ctx.s0 = (1 << sWidth) * pwxSimple * 2 * 2
+			ctx.w = 0
+
+			// 23-24: passwd <-- HMAC-SHA256(B_{0,2r-1}, passwd)
+			if i == 0 && passwd != nil {
+				mac := hmac.New(sha256.New, Bp[(s-16)*4:s*4])
+				mac.Write(passwd)
+				copy(passwd, mac.Sum(nil))
+			}
+		}
+
+		// 27: SMix1_r(B_i, n, V_{u..v}, flags)
+		smix1(Bp, r, np, flags, Vp, XY, ctx)
+
+		// 28: SMix2_r(B_i, p2floor(n), Nloop_rw, V_{u..v}, flags)
+		smix2(Bp, r, p2floor(np), nLoopRW, flags, Vp, XY, ctx)
+
+		vChunk += nChunk
+	}
+
+	// 30: for i = 0 to p - 1 do
+	for i := uint32(0); i < p; i++ {
+		var ctx *pwxformCtx
+		if flags&flagRW != 0 {
+			ctx = &ctxs[i]
+		}
+
+		// 31: SMix2_r(B_i, N, Nloop_all - Nloop_rw, V, flags excluding YESCRYPT_RW)
+		smix2(B[128*uint64(r)*uint64(i):], r, N, nLoopAll-nLoopRW, flags&^flagRW, V, XY, ctx)
+	}
+}
+
+// Loads the 2r 64-byte blocks of B into X, with the words of each block
+// shuffled as in the SIMD implementations; pwxform depends on this layout.
+func load(X []uint32, B []byte, r uint32) {
+	for k := 0; k < 2*int(r); k++ {
+		for i := 0; i < 16; i++ {
+			X[k*16+i] = binary.LittleEndian.Uint32(B[4*(k*16+i*5%16):])
+		}
+	}
+}
+
+// The inverse of load.
+func store(B []byte, X []uint32, r uint32) {
+	for k := 0; k < 2*int(r); k++ {
+		for i := 0; i < 16; i++ {
+			binary.LittleEndian.PutUint32(B[4*(k*16+i*5%16):], X[k*16+i])
+		}
+	}
+}
+
+func smix1(B []byte, r uint32, N uint64, flags uint32, V, XY []uint32, ctx *pwxformCtx) {
+	s := 32 * uint64(r)
+	X := XY[:s]
+	Y := XY[s : 2*s]
+
+	// 1: X <-- B
+	load(X, B, r)
+
+	// 2: for i = 0 to N - 1 do
+	for i := uint64(0); i < N; i++ {
+		// 3: V_i <-- X
+		copy(V[i*s:(i+1)*s], X)
+
+		if flags&flagRW != 0 && i > 1 {
+			// j <-- Wrap(Integerify(X), i)
+			j := wrap(integerify(X, r), i)
+
+			// X <-- X xor V_j
+			blkxor(X, V[j*s:(j+1)*s])
+		}
+
+		// 4: X <-- H(X)
+		if ctx != nil {
+			blockmixPwxform(X, Y, r, ctx)
+		} else {
+			blockmixSalsa8(X, Y, r)
+		}
+	}
+
+	// B' <-- X
+	store(B, X, r)
+}
+
+func smix2(B []byte, r uint32, N, nLoop uint64, flags uint32, V, XY []uint32, ctx *pwxformCtx) {
+	if nLoop == 0 {
+		return
+	}
+
+	s := 32 * uint64(r)
+	X := XY[:s]
+	Y := XY[s : 2*s]
+
+	// X <-- B'
+	load(X, B, r)
+
+	// 6: for i = 0 to N - 1 do
+	for i := uint64(0); i < nLoop; i++ {
+		// 7: j <-- Integerify(X) mod N
+		j := integerify(X, r) & (N - 1)
+
+		// 8.1: X <-- X xor V_j
+		Vj := V[j*s : (j+1)*s]
+		blkxor(X, Vj)
+
+		// V_j <-- X
+		if flags&flagRW != 0 {
+			copy(Vj, X)
+		}
+
+		// 8.2: X <-- H(X)
+		if ctx != nil {
+			blockmixPwxform(X, Y, r, ctx)
+		} else {
+			blockmixSalsa8(X, Y, r)
+		}
+	}
+
+	// 10: B' <-- X
+	store(B, X, r)
+}
+
+func blockmixSalsa8(B, Y []uint32, r uint32) {
+	var X [16]uint32
+
+	// 1: X <-- B_{2r - 1}
+	copy(X[:], B[(2*r-1)*16:])
+
+	// 2: for i = 0 to 2r - 1 do
+	for i := uint32(0); i < 2*r; i++ {
+		// 3: X <-- H(X xor B_i)
+		blkxor(X[:], B[i*16:(i+1)*16])
+		salsa20(X[:], 8)
+
+		// 4: Y_i <-- X
+		copy(Y[i*16:], X[:])
+	}
+
+	// 6: B' <-- (Y_0, Y_2 ... Y_{2r-2}, Y_1, Y_3 ... Y_{2r-1})
+	for i := uint32(0); i < r; i++ {
+		copy(B[i*16:(i+1)*16], Y[i*2*16:])
+	}
+	for i := uint32(0); i < r; i++ {
+		copy(B[(i+r)*16:(i+r+1)*16], Y[(i*2+1)*16:])
+	}
+}
+
+func blockmixPwxform(B, Y []uint32, r uint32, ctx *pwxformCtx) {
+	// 1: r_1 <-- 128r / PWXbytes
+	r1 := 128 * r / pwxBytes
+
+	// 2: X <-- B'_{r_1 - 1}
+	X := Y[:pwxWords]
+	copy(X, B[(r1-1)*pwxWords:])
+
+	// 3: for i = 0 to r_1 - 1 do
+	for i := uint32(0); i < r1; i++ {
+		// 4-5: if r_1 > 1, X <-- X xor B'_i
+		if r1 > 1 {
+			blkxor(X, B[i*pwxWords:(i+1)*pwxWords])
+		}
+
+		// 7: X <-- pwxform(X)
+		pwxform(X, ctx)
+
+		// 8: B'_i <-- X
+		copy(B[i*pwxWords:], X)
+	}
+
+	// 10: i <-- floor((r_1 - 1) * PWXbytes / 64)
+	i := (r1 - 1) * pwxBytes / 64
+
+	// 11: B_i <-- H(B_i)
+	salsa20(B[i*16:(i+1)*16], 2)
+
+	// 12-13: for i = i + 1 to 2r - 1 do B_i <-- H(B_i xor B_{i-1})
+	for i++; i < 2*r; i++ {
+		blkxor(B[i*16:(i+1)*16], B[(i-1)*16:i*16])
+		salsa20(B[i*16:(i+1)*16], 2)
+	}
+}
+
+func pwxform(B []uint32, ctx *pwxformCtx) {
+	S := ctx.s
+	s0, s1, s2 := ctx.s0, ctx.s1, ctx.s2
+	w := ctx.w
+
+	// 1: for i = 0 to PWXrounds - 1 do
+	for i := 0; i < pwxRounds; i++ {
+		// 2: for j = 0 to PWXgather - 1 do
+		for j := 0; j < pwxGather; j++ {
+			xl := B[j*pwxSimple*2]
+			xh := B[j*pwxSimple*2+1]
+
+			// 3: p0 <-- (lo(B_{j,0}) & Smask) / (PWXsimple * 8)
+			p0 := s0 + int(xl&sMask)/4
+			// 4: p1 <-- (hi(B_{j,0}) & Smask) / (PWXsimple * 8)
+			p1 := s1 + int(xh&sMask)/4
+
+			// 5: for k = 0 to PWXsimple - 1 do
+			for k := 0; k < pwxSimple; k++ {
+				n := (j*pwxSimple + k) * 2
+
+				// 6: B_{j,k} <-- (hi(B_{j,k}) * lo(B_{j,k}) + S0_{p0,k}) xor S1_{p1,k}
+				x := uint64(B[n+1]) * uint64(B[n])
+				x += uint64(S[p0+2*k+1])<<32 | uint64(S[p0+2*k])
+				x ^= uint64(S[p1+2*k+1])<<32 | uint64(S[p1+2*k])
+
+				B[n] = uint32(x)
+				B[n+1] = uint32(x >> 32)
+
+				// 8-10: if (i != 0) and (i != PWXrounds - 1), S2_w <-- B_j; w <-- w + 1
+				if i != 0 && i != pwxRounds-1 {
+					S[s2+2*w] = uint32(x)
+					S[s2+2*w+1] = uint32(x >> 32)
+					w++
+				}
+			}
+		}
+	}
+
+	// 14: (S0, S1, S2) <-- (S2, S0, S1)
+	ctx.s0, ctx.s1, ctx.s2 = s2, s0, s1
+
+	// 15: w <-- w mod 2^Swidth
+	ctx.w = w & ((1<<sWidth)*pwxSimple - 1)
+}
+
+// Applies the Salsa20 core with the given number of rounds to B, whose words
+// are in the shuffled order used by load.
+func salsa20(B []uint32, rounds int) {
+	var x [16]uint32
+
+	// SIMD unshuffle
+	for i := 0; i < 16; i++ {
+		x[i*5%16] = B[i]
+	}
+
+	for i := 0; i < rounds; i += 2 {
+		// Operate on columns
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		// Operate on rows
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+
+	// SIMD shuffle
+	for i := 0; i < 16; i++ {
+		B[i] += x[i*5%16]
+	}
+}
+
+func blkxor(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// Returns the 64-bit little-endian value at the start of the last 64-byte
+// block of B; word 13 is the block's second word due to the shuffling.
+func integerify(B []uint32, r uint32) uint64 {
+	X := B[(2*r-1)*16:]
+	return uint64(X[13])<<32 | uint64(X[0])
+}
+
+// Returns the largest power of two not greater than x.
+func p2floor(x uint64) uint64 {
+	for y := x & (x - 1); y != 0; y = x & (x - 1) {
+		x = y
+	}
+	return x
+}
+
+func wrap(x, i uint64) uint64 {
+	n := p2floor(i)
+	return (x & (n - 1)) + (i - n)
+}
@@ -0,0 +1,215 @@
+// Package raw provides a raw implementation of yescrypt, as used by crypt(3)
+// for `$y$` hashes.
+package raw
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Indicates that a yescrypt hash or stub is malformed.
+var ErrInvalidStub = fmt.Errorf("invalid yescrypt stub")
+
+// The N used by Debian and Fedora for new hashes, as log2(N).
+const RecommendedNLog2 = 12
+
+// The r used by Debian and Fedora for new hashes.
+const RecommendedR = 32
+
+// The largest amount of memory, in bytes, which Crypt will use. Hashes
+// needing more are rejected, so that a malicious hash cannot exhaust memory.
+const MaxMemory = 1 << 30
+
+// The length of the derived key, in bytes.
+const keyLength = 32
+
+// The largest salt which crypt(3) accepts, in bytes.
+const maxSaltLength = 64
+
+// The parameters of a yescrypt hash.
+type Params struct {
+	Flags uint32 // the flavor; only 0 (classic scrypt) and FlagsDefault are supported
+	N     uint64 // the block count, a power of two
+	R     uint32 // the block size
+	P     uint32 // the parallelism
+	T     uint32 // additional time
+}
+
+// Checks that the parameters are supported and that hashing with them will
+// use no more than MaxMemory.
+func (p Params) Check() error {
+	if p.Flags != 0 && p.Flags != FlagsDefault {
+		return fmt.Errorf("unsupported yescrypt flavor %#x", p.Flags)
+	}
+
+	if p.N <= 1 || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("yescrypt N parameter must be a power of two greater than 1, got %d", p.N)
+	}
+
+	if p.R < 1 || p.P < 1 || uint64(p.R)*uint64(p.P) >= 1<<30 {
+		return fmt.Errorf("invalid yescrypt r and p parameters %d and %d", p.R, p.P)
+	}
+
+	if p.Flags&flagRW != 0 && p.N/uint64(p.P) <= 1 {
+		return fmt.Errorf("yescrypt N parameter %d is too small for p = %d", p.N, p.P)
+	}
+
+	if p.N > MaxMemory/128/uint64(p.R) {
+		return fmt.Errorf("yescrypt parameters N = %d and r = %d need more than %d bytes", p.N, p.R, MaxMemory)
+	}
+
+	return nil
+}
+
+// Returns the setting prefix for the parameters, e.g. "$y$j9T$".
+func (p Params) Setting() string {
+	flavor := p.Flags
+	if flavor >= flagRW {
+		flavor = flagRW + (flavor >> 2)
+	}
+
+	nLog2 := uint32(0)
+	for n := p.N; n > 1; n >>= 1 {
+		nLog2++
+	}
+
+	var sb strings.Builder
+	sb.WriteString("$y$")
+	sb.WriteString(encode64Uint32(flavor, 0))
+	sb.WriteString(encode64Uint32(nLog2, 1))
+	sb.WriteString(encode64Uint32(p.R, 1))
+
+	have := uint32(0)
+	if p.P != 1 {
+		have |= 1
+	}
+	if p.T != 0 {
+		have |= 2
+	}
+	if have != 0 {
+		sb.WriteString(encode64Uint32(have, 1))
+		if p.P != 1 {
+			sb.WriteString(encode64Uint32(p.P, 2))
+		}
+		if p.T != 0 {
+			sb.WriteString(encode64Uint32(p.T, 1))
+		}
+	}
+
+	sb.WriteByte('$')
+	return sb.String()
+}
+
+// Parses a yescrypt hash or stub of the form $y$params$salt[$hash],
+// returning its parameters, the prefix up to and including the salt, the
+// decoded salt, and the hash, which is "" for a stub.
+func Parse(stub string) (params Params, prefix string, salt []byte, hash string, err error) {
+	if !strings.HasPrefix(stub, "$y$") {
+		err = ErrInvalidStub
+		return
+	}
+	src := stub[3:]
+
+	flavor, src, err := decode64Uint32(src, 0)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case flavor < flagRW:
+		params.Flags = flavor
+	case flavor <= flagRW+(rwFlavorMask>>2):
+		params.Flags = flagRW + ((flavor - flagRW) << 2)
+	default:
+		err = ErrInvalidStub
+		return
+	}
+
+	nLog2, src, err := decode64Uint32(src, 1)
+	if err != nil {
+		return
+	}
+	if nLog2 > 63 {
+		err = ErrInvalidStub
+		return
+	}
+	params.N = 1 << nLog2
+
+	params.R, src, err = decode64Uint32(src, 1)
+	if err != nil {
+		return
+	}
+
+	params.P = 1
+	if src != "" && src[0] != '$' {
+		var have uint32
+		have, src, err = decode64Uint32(src, 1)
+		if err != nil {
+			return
+		}
+
+		if have&1 != 0 {
+			params.P, src, err = decode64Uint32(src, 2)
+			if err != nil {
+				return
+			}
+		}
+
+		if have&2 != 0 {
+			params.T, src, err = decode64Uint32(src, 1)
+			if err != nil {
+				return
+			}
+		}
+
+		// Hash upgrades (g) and ROMs (NROM) are not supported.
+		if have&^3 != 0 {
+			err = ErrInvalidStub
+			return
+		}
+	}
+
+	if src == "" || src[0] != '$' {
+		err = ErrInvalidStub
+		return
+	}
+	src = src[1:]
+
+	saltStr := src
+	if i := strings.LastIndexByte(src, '$'); i >= 0 {
+		saltStr, hash = src[:i], src[i+1:]
+	}
+
+	salt, err = decode64(saltStr)
+	if err != nil {
+		return
+	}
+	if len(salt) > maxSaltLength {
+		err = ErrInvalidStub
+		return
+	}
+
+	prefix = stub[:len(stub)-len(src)+len(saltStr)]
+	return
+}
+
+// Computes the yescrypt hash of password using the parameters and salt in
+// stub, which may be a complete hash. Returns the complete hash.
+func Crypt(password []byte, stub string) (string, error) {
+	params, prefix, salt, _, err := Parse(stub)
+	if err != nil {
+		return "", err
+	}
+
+	if err := params.Check(); err != nil {
+		return "", err
+	}
+
+	dk := kdf(password, salt, params.Flags, params.N, params.R, params.P, params.T, keyLength)
+	return prefix + "$" + encode64(dk), nil
+}
+
+// Returns a stub for the parameters and salt.
+func MakeStub(params Params, salt []byte) string {
+	return params.Setting() + encode64(salt)
+}
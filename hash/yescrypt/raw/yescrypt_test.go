@@ -0,0 +1,77 @@
+package raw
+
+import (
+	"strings"
+	"testing"
+)
+
+type test struct {
+	password string
+	hash     string
+}
+
+// Generated with libxcrypt's crypt(3), which is built from the yescrypt
+// reference code, covering the default flavor with and without prehashing,
+// p > 1, t > 0, classic scrypt and an empty and a maximum-length salt.
+var tests = []test{
+	{"password", "$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC"},
+	{"", "$y$jC5$$MQKkP7ZhB5cXVNybte0xFCfxq1gjNPdAy6vjSSLpf4."},
+	{"pleaseletmein", "$y$j75$LdJMENpBABJJ3hIHjB1Bi.$LOFz5qVpaHYHlkfy7RM1hH9gRBSqy5mk4KRmFVRFKM4"},
+	{"password", "$y$j75..$LdJMENpBABJJ3hIHjB1Bi.$CNNJTnOCni/dqsaM1xsSPkCaLWFXnSfkZXQuUDGLH70"},
+	{"password", "$y$j75/.$LdJMENpBABJJ3hIHjB1Bi.$tw6JXovBMSlBPl9h7ekV7rVPXLcdeWgkvyuFsVIaQXB"},
+	{"password", "$y$.75$LdJMENpBABJJ3hIHjB1Bi.$MmpV0n2X/95WrtX1WEQxFp.x5AhQ0KY9ReBR4Ac5ziD"},
+	{"password", "$y$.75..$LdJMENpBABJJ3hIHjB1Bi.$M7643Kb0XmnLYpF68NwJA7.cYWvyWzbLZPtVnLF1vN2"},
+	{"password", "$y$j9T.0$LdJMENpBABJJ3hIHjB1Bi.$MxoLYfGhimPoQ6xN8t4i5ms4vf2vMFDzz.gaBl87gi0"},
+	{"táБℓə", "$y$j8T$saltsalt$jHtvP0MNIR1W7j9ewwl7gSGgShUA/jIR3c.wtcm7WB7"},
+	{strings.Repeat("x", 100), "$y$jBT$abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ./$byiGjvOn5KqEPwry5GcDupAr1lj1xrPrZyXi5i/ack9"},
+}
+
+func TestCrypt(t *testing.T) {
+	for i, tst := range tests {
+		out, err := Crypt([]byte(tst.password), tst.hash)
+		if err != nil {
+			t.Fatalf("test %d: err: %v", i, err)
+		}
+		if out != tst.hash {
+			t.Errorf("test %d: yescrypt mismatch: %#v (expected %#v)", i, out, tst.hash)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	params, prefix, salt, hash, err := Parse(tests[0].hash)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if params != (Params{Flags: FlagsDefault, N: 4096, R: 32, P: 1}) || prefix != "$y$j9T$F5Jx5fExrKuPp53xLKQ..1" ||
+		len(salt) != 16 || hash != "tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC" {
+		t.Fatalf("unexpected parse: %+v %q %x %q", params, prefix, salt, hash)
+	}
+
+	if params.Setting() != "$y$j9T$" || MakeStub(params, salt) != prefix {
+		t.Fatalf("unexpected encoding: %q %q", params.Setting(), MakeStub(params, salt))
+	}
+
+	params, _, _, _, err = Parse(tests[7].hash)
+	if err != nil || params.P != 4 || params.Setting() != "$y$j9T.0$" {
+		t.Fatalf("unexpected parse: %+v %v", params, err)
+	}
+
+	for _, stub := range []string{"", "$y$", "$y$j9T", "$y$j9T$!", "$y$j9T$a", "$y$j9T#$salt", "$7$C6..../....SodiumChloride", "$y$j9T.$salt$hash"} {
+		if _, _, _, _, err := Parse(stub); err == nil {
+			t.Errorf("expected error for %#v", stub)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, stub := range []string{
+		"$y$jT5$salt",   // N = 2^32, needing too much memory
+		"$y$/9T$salt",   // WORM flavor
+		"$y$j/T.0$salt", // N = 4, p = 4
+	} {
+		if _, err := Crypt([]byte("password"), stub); err == nil {
+			t.Errorf("expected error for %#v", stub)
+		}
+	}
+}
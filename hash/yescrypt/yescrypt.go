@@ -0,0 +1,180 @@
+// Package yescrypt implements yescrypt, the default password hashing scheme
+// for /etc/shadow on current Debian, Fedora and other Linux distributions,
+// whose hashes start with `$y$`.
+//
+// Only the default flavor used by crypt(3) and classic scrypt are
+// supported; hashes using other flavors, ROMs or hash upgrades fail to
+// verify with an error wrapping abstract.ErrInvalidHash.
+package yescrypt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/yescrypt/raw"
+)
+
+// An implementation of Scheme performing yescrypt, with the parameters used
+// by Debian and Fedora (N = 4096, r = 32, "$y$j9T$").
+var Crypter abstract.Scheme
+
+const saltLength = 16
+
+func init() {
+	Crypter = New(raw.RecommendedNLog2, raw.RecommendedR)
+}
+
+// Returns an implementation of Scheme performing yescrypt with N = 2^nLog2
+// and the given r, using the default flavor. Hashing uses about 128 * N * r
+// bytes of memory.
+//
+// The parameters are used only when hashing new passwords; existing hashes
+// are verified using the parameters encoded in them. If the parameters are
+// invalid, Hash returns a descriptive error.
+func New(nLog2 uint, r uint32) abstract.Scheme {
+	return &scheme{
+		params: raw.Params{
+			Flags: raw.FlagsDefault,
+			N:     1 << nLog2,
+			R:     r,
+			P:     1,
+		},
+	}
+}
+
+type scheme struct {
+	params raw.Params
+}
+
+func (c *scheme) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, "$y$")
+}
+
+func (c *scheme) Hash(password string) (string, error) {
+	return c.HashWithSaltReader([]byte(password), rand.Reader)
+}
+
+func (c *scheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	if err := c.params.Check(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(saltReader, salt); err != nil {
+		return "", err
+	}
+
+	return raw.Crypt(password, raw.MakeStub(c.params, salt))
+}
+
+func (c *scheme) Verify(password, hash string) error {
+	return c.VerifyBytes([]byte(password), hash)
+}
+
+func (c *scheme) VerifyBytes(password []byte, hash string) error {
+	_, _, _, oldHash, err := raw.Parse(hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	// A stub cannot be verified against.
+	if oldHash == "" {
+		return abstract.InvalidHash(raw.ErrInvalidStub)
+	}
+
+	newHash, err := raw.Crypt(password, hash)
+	if err != nil {
+		return abstract.InvalidHash(err)
+	}
+
+	if !abstract.SecureCompare(hash, newHash) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+func (c *scheme) NeedsUpdate(stub string) bool {
+	params, _, salt, _, err := raw.Parse(stub)
+	if err != nil {
+		return false // ...
+	}
+
+	if params.Flags != c.params.Flags {
+		return true
+	}
+
+	stored := map[string]uint64{
+		"salt_length": uint64(len(salt)),
+		"N":           params.N,
+		"r":           uint64(params.R),
+	}
+
+	return abstract.CompareParams(stored, c.target()) < 0
+}
+
+// The parameters NeedsUpdate compares hashes against.
+func (c *scheme) target() map[string]uint64 {
+	return map[string]uint64{
+		"salt_length": saltLength,
+		"N":           c.params.N,
+		"r":           uint64(c.params.R),
+	}
+}
+
+func (c *scheme) ReadParams(hash string) (map[string]string, error) {
+	params, _, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return nil, abstract.InvalidHash(err)
+	}
+
+	return map[string]string{
+		"N": fmt.Sprint(params.N),
+		"r": fmt.Sprint(params.R),
+		"p": fmt.Sprint(params.P),
+		"t": fmt.Sprint(params.T),
+	}, nil
+}
+
+// Like scrypt, yescrypt's strength is about log2(2*N*r), times t+1 for the
+// additional passes. In the classic scrypt flavor, each of the p lanes
+// needs its own N blocks, so p is counted too. Memory hardness is ignored.
+func (c *scheme) Strength(hash string) (float64, error) {
+	params, _, _, _, err := raw.Parse(hash)
+	if err != nil {
+		return 0, abstract.InvalidHash(err)
+	}
+
+	return strength(params), nil
+}
+
+func strength(params raw.Params) float64 {
+	work := 2 * float64(params.N) * float64(params.R) * float64(params.T+1)
+	if params.Flags == 0 {
+		work *= float64(params.P)
+	}
+
+	return math.Log2(work)
+}
+
+// yescrypt needs N blocks of 128*r bytes.
+func (c *scheme) EstimateCost() abstract.Cost {
+	return abstract.Cost{
+		Memory:   128 * c.params.N * uint64(c.params.R),
+		Threads:  1,
+		Time:     map[string]uint64{"N": c.params.N, "r": uint64(c.params.R)},
+		Strength: strength(c.params),
+	}
+}
+
+func (c *scheme) Describe() string {
+	return fmt.Sprintf("yescrypt(N=%d,r=%d)", c.params.N, c.params.R)
+}
+
+func (c *scheme) String() string {
+	return fmt.Sprintf("yescrypt(%d,%d)", c.params.N, c.params.R)
+}
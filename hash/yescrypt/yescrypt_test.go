@@ -0,0 +1,49 @@
+package yescrypt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Generated by crypt(3) with the settings Debian and Fedora use for
+// /etc/shadow, for the password "password".
+const debianHash = "$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC"
+
+func TestYescrypt(t *testing.T) {
+	if !Crypter.SupportsStub(debianHash) {
+		t.Fatalf("hash not supported")
+	}
+	if err := Crypter.Verify("password", debianHash); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if err := Crypter.Verify("Password", debianHash); err != abstract.ErrInvalidPassword {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+	if Crypter.NeedsUpdate(debianHash) {
+		t.Fatalf("hash with default parameters needs update")
+	}
+
+	c := New(10, 8)
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$y$j75$") || len(h) != len("$y$j75$")+22+1+43 {
+		t.Fatalf("unexpected hash: %q", h)
+	}
+	if err := c.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if !Crypter.NeedsUpdate(h) || c.NeedsUpdate(h) {
+		t.Fatalf("NeedsUpdate does not reflect parameters")
+	}
+
+	if err := Crypter.Verify("password", "$y$j9T$F5Jx5fExrKuPp53xLKQ..1"); err == nil {
+		t.Fatalf("stub verified")
+	}
+	if err := Crypter.Verify("password", "$y$/9T$F5Jx5fExrKuPp53xLKQ..1$x"); err == nil {
+		t.Fatalf("unsupported flavor verified")
+	}
+}
@@ -0,0 +1,44 @@
+package passlib
+
+import "github.com/al45tair/passlib/abstract"
+
+// Reports whether password matches any of history, the user's previous
+// password hashes, so that a password change reusing one of them can be
+// rejected. This only verifies password against the old hashes, each with
+// whichever of the context's schemes supports it (see Verify), so the history
+// may mix schemes; how the history is stored, and how many entries are kept,
+// is up to the caller. Hashes in the history should therefore use schemes the
+// context still lists, if only in DeprecatedSchemes.
+//
+// An entry which cannot be verified, e.g. because it is malformed or no
+// scheme supports it, is skipped rather than aborting the check. If any were
+// skipped and none matched, err is an *ErrNoHashMatched recording each
+// entry's error, for the caller to log; matched is still false, as no
+// remaining entry matched. Otherwise err is nil.
+//
+// The context's MinimumStrength and StrictUniformParams are not applied to
+// the history: they reject exactly the oldest hashes, whose passwords must
+// still count as reused.
+//
+// Each entry costs a full verification.
+func (ctx *Context) MatchesAny(password string, history []string) (matched bool, err error) {
+	c := *ctx
+	c.MinimumStrength = 0
+	c.StrictUniformParams = false
+
+	_, err = c.VerifyMultiple(password, history)
+	switch err {
+	case nil:
+		return true, nil
+	case abstract.ErrPasswordMismatch:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Uses the default context to check a password against previous password
+// hashes. See Context.MatchesAny.
+func MatchesAny(password string, history []string) (matched bool, err error) {
+	return DefaultContext.MatchesAny(password, history)
+}
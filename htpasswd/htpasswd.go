@@ -0,0 +1,196 @@
+// Package htpasswd reads and writes Apache-style .htpasswd files, as also
+// used by nginx.
+//
+// New passwords are hashed with bcrypt. Existing entries hashed with bcrypt,
+// apr1, {SHA} or crypt(3) (des-crypt, md5-crypt and sha2-crypt) can be
+// verified.
+package htpasswd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/al45tair/passlib"
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/apr1"
+	"github.com/al45tair/passlib/hash/bcrypt"
+	"github.com/al45tair/passlib/hash/descrypt"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/sha2crypt"
+)
+
+// The schemes used by files which do not set Context, most preferred first.
+// The first is used by Set.
+//
+// As with passlib.DefaultSchemes, do not mutate the array this slice points
+// to.
+var DefaultSchemes = []abstract.Scheme{
+	bcrypt.Crypter,
+	apr1.Crypter,
+	SHA1Crypter,
+	sha2crypt.Crypter512,
+	sha2crypt.Crypter256,
+	md5crypt.Crypter,
+	descrypt.Crypter,
+}
+
+// Indicates that a user has no entry in the file.
+var ErrUnknownUser = fmt.Errorf("unknown htpasswd user")
+
+// Describes a line of an htpasswd file which could not be parsed.
+type ParseError struct {
+	Line int // 1-based
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("htpasswd line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// An htpasswd file. Comments, blank lines and the order of entries are
+// preserved when it is written back.
+type File struct {
+	// The context used to hash and verify passwords. If nil, a context using
+	// DefaultSchemes is used.
+	Context *passlib.Context
+
+	lines []line
+}
+
+// A line of the file; entries have a non-empty user, and other lines are
+// kept verbatim in text.
+type line struct {
+	user string
+	hash string
+	text string
+}
+
+// Reads an htpasswd file. Lines which are blank or start with '#' are kept
+// as they are; every other line must be of the form user:hash. If any line
+// is malformed, a *ParseError for the first such line is returned.
+func Load(r io.Reader) (*File, error) {
+	f := &File{}
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+
+		if trimmed == "" || trimmed[0] == '#' {
+			f.lines = append(f.lines, line{text: text})
+			continue
+		}
+
+		i := strings.IndexByte(text, ':')
+		if i <= 0 {
+			return nil, &ParseError{Line: n, Err: fmt.Errorf("expected user:hash")}
+		}
+
+		user := text[:i]
+		if f.find(user) >= 0 {
+			return nil, &ParseError{Line: n, Err: fmt.Errorf("duplicate user %q", user)}
+		}
+
+		f.lines = append(f.lines, line{user: user, hash: text[i+1:]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) context() *passlib.Context {
+	if f.Context == nil {
+		return &passlib.Context{Schemes: DefaultSchemes}
+	}
+
+	return f.Context
+}
+
+// Returns the index of the user's entry, or -1.
+func (f *File) find(user string) int {
+	for i, l := range f.lines {
+		if user != "" && l.user == user {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns the users with entries in the file, in file order.
+func (f *File) Users() []string {
+	var users []string
+	for _, l := range f.lines {
+		if l.user != "" {
+			users = append(users, l.user)
+		}
+	}
+
+	return users
+}
+
+// Verifies a user's password. Returns ErrUnknownUser if the user has no
+// entry, or the verification error if the password does not match.
+func (f *File) Verify(user, password string) error {
+	i := f.find(user)
+	if i < 0 {
+		return ErrUnknownUser
+	}
+
+	return f.context().VerifyNoUpgrade(password, f.lines[i].hash)
+}
+
+// Sets a user's password, replacing their existing entry in place or adding
+// a new entry at the end of the file. Returns apr1.ErrInvalidUser if the user
+// name cannot be stored in an htpasswd file.
+func (f *File) Set(user, password string) error {
+	if _, err := apr1.HtpasswdLine(user, ""); err != nil {
+		return err
+	}
+
+	hash, err := f.context().Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if i := f.find(user); i >= 0 {
+		f.lines[i].hash = hash
+	} else {
+		f.lines = append(f.lines, line{user: user, hash: hash})
+	}
+
+	return nil
+}
+
+// Writes the file in htpasswd format, implementing io.WriterTo.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+
+	for _, l := range f.lines {
+		text := l.text
+		if l.user != "" {
+			var err error
+			text, err = apr1.HtpasswdLine(l.user, l.hash)
+			if err != nil {
+				return total, err
+			}
+		}
+
+		n, err := io.WriteString(w, text+"\n")
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
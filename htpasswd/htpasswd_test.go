@@ -0,0 +1,104 @@
+package htpasswd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+const testFile = `# Managed by hand
+alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/
+bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+
+carol:abJnggxhB/yWI
+dave:$5$9jV2mPqA$e8hKF26rmbH5KLUyHBgJprdKcJ2RkVl55ei6ikXmihB
+`
+
+func TestLoad(t *testing.T) {
+	f, err := Load(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatalf("err loading: %v", err)
+	}
+
+	for user, password := range map[string]string{
+		"alice": "myPassword",
+		"bob":   "password",
+		"carol": "password",
+		"dave":  "correcthorse",
+	} {
+		if err := f.Verify(user, password); err != nil {
+			t.Errorf("err verifying %s: %v", user, err)
+		}
+		if err := f.Verify(user, "x"+password); !errors.Is(err, abstract.ErrPasswordMismatch) {
+			t.Errorf("unexpected error verifying %s: %v", user, err)
+		}
+	}
+
+	if err := f.Verify("eve", "password"); err != ErrUnknownUser {
+		t.Errorf("unexpected error for unknown user: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil || buf.String() != testFile {
+		t.Errorf("file not preserved: %q, %v", buf.String(), err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	f, err := Load(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatalf("err loading: %v", err)
+	}
+
+	if err := f.Set("bob", "newpassword"); err != nil {
+		t.Fatalf("err setting: %v", err)
+	}
+	if err := f.Set("eve", "evepassword"); err != nil {
+		t.Fatalf("err setting: %v", err)
+	}
+	if err := f.Set("bad:user", "password"); err == nil {
+		t.Fatalf("set password for invalid user")
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("err writing: %v", err)
+	}
+
+	f, err = Load(&buf)
+	if err != nil {
+		t.Fatalf("err reloading: %v", err)
+	}
+
+	if users := strings.Join(f.Users(), ","); users != "alice,bob,carol,dave,eve" {
+		t.Errorf("unexpected users: %s", users)
+	}
+	if f.lines[2].hash[:4] != "$2a$" {
+		t.Errorf("new hash is not bcrypt: %s", f.lines[2].hash)
+	}
+	if err := f.Verify("bob", "newpassword"); err != nil {
+		t.Errorf("err verifying bob: %v", err)
+	}
+	if err := f.Verify("eve", "evepassword"); err != nil {
+		t.Errorf("err verifying eve: %v", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, tst := range []struct {
+		text string
+		line int
+	}{
+		{"alice:x\nnocolon\n", 2},
+		{"# comment\n\n:nouser\n", 3},
+		{"alice:x\nalice:y\n", 2},
+	} {
+		_, err := Load(strings.NewReader(tst.text))
+		if e, ok := err.(*ParseError); !ok || e.Line != tst.line {
+			t.Errorf("unexpected error for %q: %v", tst.text, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package htpasswd
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// An implementation of Scheme for htpasswd's unsalted {SHA} hashes, which
+// can be verified but should never be generated.
+var SHA1Crypter abstract.Scheme = sha1Crypter{}
+
+// Indicates that an {SHA} hash is malformed.
+var ErrInvalidSHA1Hash = fmt.Errorf("invalid {SHA} hash")
+
+const sha1Prefix = "{SHA}"
+
+type sha1Crypter struct{}
+
+func (sha1Crypter) Hash(password string) (string, error) {
+	sum := sha1.Sum([]byte(password))
+	return sha1Prefix + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+func (c sha1Crypter) Verify(password, hash string) error {
+	if !c.SupportsStub(hash) {
+		return abstract.InvalidHash(ErrInvalidSHA1Hash)
+	}
+
+	// A stub cannot be verified against.
+	if hash == sha1Prefix {
+		return abstract.InvalidHash(ErrInvalidSHA1Hash)
+	}
+
+	newHash, _ := c.Hash(password)
+	if !abstract.SecureCompare(hash, newHash) {
+		return abstract.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+func (sha1Crypter) SupportsStub(stub string) bool {
+	return strings.HasPrefix(stub, sha1Prefix)
+}
+
+func (sha1Crypter) NeedsUpdate(stub string) bool {
+	return true
+}
+
+func (sha1Crypter) String() string {
+	return "htpasswd-sha1"
+}
@@ -0,0 +1,155 @@
+// Package migrate surveys an export of stored password hashes, to plan a
+// change of schemes without needing any of the passwords.
+//
+// The export is a CSV file with two columns: a key identifying the account,
+// such as an email address, and its hash. An optional header row whose second
+// column is "hash" is skipped.
+package migrate
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/al45tair/passlib"
+)
+
+// Describes a record of the export which could not be analysed.
+type ParseError struct {
+	Record int // 1-based, counting any header
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// A record of the export which needs attention.
+type Row struct {
+	Record int // 1-based, counting any header
+	Key    string
+
+	// The scheme which owns the hash, as passlib.Context.Identify reports
+	// it, or "" if no scheme supports it.
+	Scheme string
+}
+
+// The result of Analyze.
+type Report struct {
+	// The number of well-formed records, not counting any header.
+	Rows int
+
+	// The number of hashes owned by each scheme, and how many of those need
+	// updating (see passlib.Context.NeedsUpdate), keyed by scheme name.
+	Schemes     map[string]int
+	NeedsUpdate map[string]int
+
+	// The records whose hashes need updating, in the order they were read.
+	Upgrades []Row
+
+	// The records whose hashes no scheme supports, in the order they were
+	// read, for handling by hand.
+	Unsupported []Row
+
+	// The records which could not be analysed, in the order they were read.
+	Malformed []*ParseError
+}
+
+// Reads an export of key,hash records from r, and reports which of ctx's
+// schemes owns each hash and which need updating. If ctx is nil,
+// passlib.DefaultContext is used.
+//
+// Records are processed as they are read, so only those which need attention
+// are held in memory. Malformed records, and those whose hashes ctx cannot
+// examine (e.g. because they are peppered with an unknown pepper), are
+// collected in the report's Malformed list rather than aborting the
+// analysis; an error is returned only if r itself fails.
+func Analyze(r io.Reader, ctx *passlib.Context) (*Report, error) {
+	if ctx == nil {
+		ctx = &passlib.DefaultContext
+	}
+
+	report := &Report{
+		Schemes:     map[string]int{},
+		NeedsUpdate: map[string]int{},
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.Malformed = append(report.Malformed, &ParseError{Record: n, Err: err})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(record) != 2 {
+			report.Malformed = append(report.Malformed, &ParseError{Record: n, Err: fmt.Errorf("expected 2 fields, got %d", len(record))})
+			continue
+		}
+
+		key, hash := record[0], record[1]
+		if n == 1 && strings.EqualFold(strings.TrimSpace(hash), "hash") {
+			continue
+		}
+
+		scheme, err := ctx.Identify(hash)
+		if err != nil {
+			report.Rows++
+			report.Unsupported = append(report.Unsupported, Row{Record: n, Key: key})
+			continue
+		}
+
+		needsUpdate, err := ctx.NeedsUpdate(hash)
+		if err != nil {
+			report.Malformed = append(report.Malformed, &ParseError{Record: n, Err: err})
+			continue
+		}
+
+		report.Rows++
+		report.Schemes[scheme]++
+		if needsUpdate {
+			report.NeedsUpdate[scheme]++
+			report.Upgrades = append(report.Upgrades, Row{Record: n, Key: key, Scheme: scheme})
+		}
+	}
+
+	return report, nil
+}
+
+// Writes a summary of the report to w, one line per scheme in order of name,
+// followed by the number of unsupported and malformed records.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(r.Schemes))
+	for name := range r.Schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "rows: %d\n", r.Rows)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %d (%d need updating)\n", name, r.Schemes[name], r.NeedsUpdate[name])
+	}
+	fmt.Fprintf(&b, "unsupported: %d\n", len(r.Unsupported))
+	fmt.Fprintf(&b, "malformed: %d\n", len(r.Malformed))
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
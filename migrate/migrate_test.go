@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/al45tair/passlib"
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/sha2crypt"
+)
+
+func TestAnalyze(t *testing.T) {
+	f, err := os.Open("testdata/users.csv")
+	if err != nil {
+		t.Fatalf("err opening fixture: %v", err)
+	}
+	defer f.Close()
+
+	sha512crypt, err := sha2crypt.NewCrypter512(5000)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+
+	ctx := &passlib.Context{Schemes: []abstract.Scheme{sha512crypt, md5crypt.Crypter}}
+	report, err := Analyze(f, ctx)
+	if err != nil {
+		t.Fatalf("err analysing: %v", err)
+	}
+
+	if report.Rows != 5 {
+		t.Errorf("unexpected row count %d", report.Rows)
+	}
+	if expected := map[string]int{"sha512-crypt(5000)": 1, "md5-crypt": 2}; !reflect.DeepEqual(report.Schemes, expected) {
+		t.Errorf("unexpected scheme counts %v", report.Schemes)
+	}
+	if expected := map[string]int{"md5-crypt": 2}; !reflect.DeepEqual(report.NeedsUpdate, expected) {
+		t.Errorf("unexpected update counts %v", report.NeedsUpdate)
+	}
+
+	upgrades := []Row{
+		{Record: 3, Key: "bob@example.com", Scheme: "md5-crypt"},
+		{Record: 7, Key: "frank@example.com", Scheme: "md5-crypt"},
+	}
+	if !reflect.DeepEqual(report.Upgrades, upgrades) {
+		t.Errorf("unexpected upgrades %v", report.Upgrades)
+	}
+
+	unsupported := []Row{
+		{Record: 4, Key: "carol@example.com"},
+		{Record: 8, Key: "grace@example.com"},
+	}
+	if !reflect.DeepEqual(report.Unsupported, unsupported) {
+		t.Errorf("unexpected unsupported rows %v", report.Unsupported)
+	}
+
+	if len(report.Malformed) != 2 || report.Malformed[0].Record != 5 || report.Malformed[1].Record != 6 {
+		t.Errorf("unexpected malformed rows %v", report.Malformed)
+	}
+
+	var buf bytes.Buffer
+	if _, err := report.WriteTo(&buf); err != nil {
+		t.Fatalf("err writing summary: %v", err)
+	}
+	expected := `rows: 5
+md5-crypt: 2 (2 need updating)
+sha512-crypt(5000): 1 (0 need updating)
+unsupported: 2
+malformed: 2
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected summary:\n%s", buf.String())
+	}
+}
+
+func TestAnalyzeNoHeader(t *testing.T) {
+	report, err := Analyze(strings.NewReader("alice,$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/\n"), nil)
+	if err != nil {
+		t.Fatalf("err analysing: %v", err)
+	}
+
+	if report.Rows != 1 || len(report.Unsupported) != 1 || report.Unsupported[0].Record != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+type failingReader struct{}
+
+var errRead = errors.New("read failed")
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errRead
+}
+
+func TestAnalyzeReadError(t *testing.T) {
+	if _, err := Analyze(failingReader{}, nil); !errors.Is(err, errRead) {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package passlib
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// The encodings tried by DetectNesting on each part of a hash.
+var nestingEncodings = []func(string) ([]byte, error){
+	base64.StdEncoding.DecodeString,
+	base64.RawStdEncoding.DecodeString,
+	base64.URLEncoding.DecodeString,
+	base64.RawURLEncoding.DecodeString,
+	hex.DecodeString,
+}
+
+// Reports whether hash appears to contain another hash, e.g. because a
+// migration stored a bcrypt hash where an argon2 salt or digest belonged, and
+// if so returns the name of the registered scheme which owns the inner hash.
+// This is a heuristic for diagnosing hashes which unexpectedly fail to
+// verify, and is not used by Verify.
+//
+// A hash is reported as nested if it contains a hash of a registered scheme
+// starting with "$" straight after another '$', as when hashes are joined
+// with '$', or starting with "{" after its first character, or if it, or any
+// of its '$'-separated parts, is a hash of a registered scheme encoded in
+// base64 or hex. Only copies of a hash can be found this way: a hash computed from
+// another hash, e.g. argon2 applied to a bcrypt hash as if it were the
+// password, is indistinguishable from any other hash.
+func DetectNesting(hash string) (nested bool, inner string) {
+	_, hash, _ = splitTimestamped(strings.TrimSpace(hash))
+	_, hash, _ = splitPeppered(hash)
+
+	var candidates []string
+	for i := 1; i < len(hash); i++ {
+		if (hash[i] == '$' && hash[i-1] == '$') || hash[i] == '{' {
+			candidates = append(candidates, hash[i:])
+		}
+	}
+
+	for _, part := range append(strings.Split(hash, "$"), hash) {
+		for _, decode := range nestingEncodings {
+			if b, err := decode(part); err == nil && looksLikeHash(b) {
+				candidates = append(candidates, string(b))
+			}
+		}
+	}
+
+	names := SchemeNames()
+	for _, candidate := range candidates {
+		for _, name := range names {
+			if s := SchemeFromName(name); s != nil && s.SupportsStub(candidate) {
+				return true, name
+			}
+		}
+	}
+
+	return false, ""
+}
+
+// Returns true iff b is long enough to be a hash and is printable ASCII, as
+// all hashes are, so that random salts and digests which happen to decode
+// are not mistaken for hashes.
+func looksLikeHash(b []byte) bool {
+	if len(b) < 13 {
+		return false
+	}
+
+	for _, c := range b {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package passlib
+
+import (
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Observer receives notifications of a context's hashing activity, for
+// example to export metrics. Schemes are identified by their registered
+// names (see RegisterScheme), or their String methods where unregistered.
+//
+// Callbacks run synchronously on the calling goroutine, so they should be
+// quick, and must be safe for concurrent use if the context is shared. They
+// cannot affect the result of the call which triggered them.
+type Observer interface {
+	// Called after scheme successfully hashes a new password, with the time
+	// the scheme took.
+	OnHash(scheme string, dur time.Duration)
+
+	// Called after scheme verifies a password against a hash which it
+	// supports, with whether the password matched and the time the scheme
+	// took. Verifications which fail before a scheme is found, for example
+	// because no scheme supports the hash, are not reported.
+	OnVerify(scheme string, ok bool, dur time.Duration)
+
+	// Called when Verify produces an upgrade hash, with the names of the
+	// scheme which verified the old hash and the scheme used for the new one.
+	// The new hash is also reported to OnHash.
+	OnUpgrade(from, to string)
+}
+
+// Returns the current time if the context has an Observer, so that
+// unobserved contexts do not pay for reading the clock.
+func (ctx *Context) observeStart() time.Time {
+	if ctx.Observer == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+func (ctx *Context) observeHash(scheme abstract.Scheme, start time.Time) {
+	if ctx.Observer != nil {
+		ctx.Observer.OnHash(schemeDisplayName(scheme), time.Since(start))
+	}
+}
+
+func (ctx *Context) observeVerify(scheme abstract.Scheme, ok bool, start time.Time) {
+	if ctx.Observer != nil {
+		ctx.Observer.OnVerify(schemeDisplayName(scheme), ok, time.Since(start))
+	}
+}
+
+func (ctx *Context) observeUpgrade(from, to abstract.Scheme) {
+	if ctx.Observer != nil {
+		ctx.Observer.OnUpgrade(schemeDisplayName(from), schemeDisplayName(to))
+	}
+}
@@ -0,0 +1,119 @@
+package passlib
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that a scheme cannot split its hashes into parts, because it
+// does not implement abstract.Splittable.
+var ErrNotSplittable = fmt.Errorf("scheme cannot split its hashes")
+
+// Like Hash, but returns the new hash in parts, for storage layers which
+// keep the salt and digest in separate columns rather than storing the hash
+// as one string: the name of the preferred scheme (as Identify would report
+// it), the raw salt and digest, and the parameters needed to reassemble the
+// hash, as decimal strings. For peppered hashes, params also includes
+// "pepper", holding the pepper's identifier, and if the context has
+// EmbedTimestamp set, "created" holds the creation time in seconds since the
+// Unix epoch. Pass the parts to VerifyParts to verify a password against
+// them.
+//
+// The built-in schemes which can do this are argon2, argon2id, bcrypt,
+// pbkdf2 and scrypt-sha256. Returns ErrNotSplittable if the preferred scheme
+// is not one of them, or otherwise does not implement abstract.Splittable.
+func (ctx *Context) HashParts(password string) (scheme string, salt, digest []byte, params map[string]string, err error) {
+	preferred, err := ctx.PreferredScheme()
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	s, ok := preferred.(abstract.Splittable)
+	if !ok {
+		return "", nil, nil, nil, ErrNotSplittable
+	}
+
+	hash, err := ctx.hash([]byte(password))
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	created, hash, timestamped := splitTimestamped(hash)
+	keyID, inner, peppered := splitPeppered(hash)
+	salt, digest, params, err = s.SplitHash(inner)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	if peppered {
+		params["pepper"] = keyID
+	}
+	if timestamped {
+		params["created"] = strconv.FormatInt(created.Unix(), 10)
+	}
+
+	return schemeDisplayName(s), salt, digest, params, nil
+}
+
+// Verifies password against a hash stored in parts by HashParts, by
+// reassembling the hash with the named scheme and verifying it as
+// VerifyDeferringUpgrade would, including reporting whether it needs
+// updating; if so, call HashParts and store its results in place of the old
+// parts. The scheme may be any of the context's Schemes or
+// DeprecatedSchemes.
+//
+// Returns an *ErrSchemeNotInContext if the context has no scheme of that
+// name, and ErrNotSplittable if the scheme cannot reassemble hashes.
+func (ctx *Context) VerifyParts(password, scheme string, salt, digest []byte, params map[string]string) (needsUpdate bool, err error) {
+	var s abstract.Splittable
+	for _, candidate := range ctx.verifySchemes() {
+		if schemeDisplayName(candidate) == scheme {
+			var ok bool
+			if s, ok = candidate.(abstract.Splittable); !ok {
+				return false, ErrNotSplittable
+			}
+			break
+		}
+	}
+	if s == nil {
+		return false, &ErrSchemeNotInContext{Name: scheme}
+	}
+
+	// The creation time is not needed to verify.
+	keyID, peppered := params["pepper"]
+	_, timestamped := params["created"]
+	if peppered || timestamped {
+		p := make(map[string]string, len(params))
+		for name, value := range params {
+			if name != "pepper" && name != "created" {
+				p[name] = value
+			}
+		}
+		params = p
+	}
+
+	hash, err := s.JoinHash(salt, digest, params)
+	if err != nil {
+		return false, abstract.InvalidHash(err)
+	}
+
+	if peppered {
+		hash = joinPeppered(keyID, hash)
+	}
+
+	return ctx.VerifyDeferringUpgrade(password, hash)
+}
+
+// Uses the default context to hash a password, returning the hash in parts.
+// See Context.HashParts.
+func HashParts(password string) (scheme string, salt, digest []byte, params map[string]string, err error) {
+	return DefaultContext.HashParts(password)
+}
+
+// Uses the default context to verify a password against a hash stored in
+// parts. See Context.VerifyParts.
+func VerifyParts(password, scheme string, salt, digest []byte, params map[string]string) (needsUpdate bool, err error) {
+	return DefaultContext.VerifyParts(password, scheme, salt, digest, params)
+}
@@ -10,14 +10,24 @@
 // You should initialise the library before using it with the following line.
 //
 //   // Call this at application startup.
-//   passlib.UseDefaults(passlib.Defaults20180601)
+//   passlib.UseDefaults(passlib.Defaults20240101)
 //
 // See func UseDefaults for details.
 package passlib // import "github.com/al45tair/passlib"
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
 	"gopkg.in/hlandau/easymetric.v1/cexp"
 	"github.com/al45tair/passlib/abstract"
+	"golang.org/x/text/unicode/norm"
 )
 
 var cHashCalls = cexp.NewCounter("passlib.ctx.hashCalls")
@@ -38,16 +48,352 @@ type Context struct {
 	// abstract.Scheme interface) will be issued whenever a password is validated
 	// using a scheme which is not the first scheme in this slice.
 	Schemes []abstract.Scheme
+
+	// Schemes which may be used to verify existing hashes, but never to hash
+	// new passwords, whatever their position. They are tried after Schemes,
+	// and hashes they verify always need updating, so that passwords are
+	// rehashed with the preferred scheme on successful verification.
+	//
+	// Use this for weak or retired schemes, such as md5-crypt, whose hashes
+	// must still be accepted until they have been upgraded.
+	DeprecatedSchemes []abstract.Scheme
+
+	// If non-zero, failed verifications (including VerifyDummy) are padded
+	// by sleeping until at least this long has passed since they started, so
+	// that quick failures, such as those for malformed hashes, cannot be
+	// distinguished from slow ones by timing.
+	MinVerifyDuration time.Duration
+
+	// A secret key (pepper) applied to every password before hashing, so that
+	// a leak of the stored hashes alone does not allow them to be cracked
+	// offline. The pepper should be at least 32 random bytes, and be stored
+	// separately from the hashes, e.g. in an HSM or configuration file.
+	//
+	// The password is replaced by HMAC-SHA256(Pepper, password) and the
+	// resulting hash is marked as peppered. Peppered hashes cannot be verified
+	// without the pepper. Unpeppered hashes still verify, and are upgraded.
+	//
+	// Changing the pepper invalidates every existing peppered hash, as they
+	// cannot be verified or upgraded without the old pepper. To rotate
+	// peppers, use Peppers and CurrentPepperID instead.
+	Pepper []byte
+
+	// Named peppers, keyed by identifier, for pepper rotation. Peppered hashes
+	// record the identifier of the pepper used, which must not contain '$'.
+	//
+	// To rotate, add a new pepper and make it current, keeping the old ones
+	// (and Pepper, if it was used) so that existing hashes still verify.
+	// Hashes made with any other pepper need updating, and are rehashed with
+	// the current pepper on successful verification. Once no hashes use an old
+	// pepper, it can be removed.
+	Peppers map[string][]byte
+
+	// The identifier of the pepper in Peppers used for new hashes. If empty,
+	// Pepper is used.
+	CurrentPepperID string
+
+	// The scheme used by VerifyDummy. If nil, the preferred (first) scheme is
+	// used, so that VerifyDummy costs the same as verifying a current hash.
+	DummyScheme abstract.Scheme
+
+	// If true, only FIPS-approved schemes (see abstract.FIPSScheme) may be
+	// used. Hash fails if the preferred scheme is not approved, and Verify
+	// rejects hashes made by schemes which are not, in both cases with an
+	// *ErrNotFIPSApproved. If Schemes is nil, DefaultSchemesFIPS is used.
+	FIPSOnly bool
+
+	// If true, Verify, NeedsUpdate and Identify ask every scheme whether it
+	// supports a hash, rather than stopping at the first which does, so that
+	// the time taken to find the scheme does not depend on its position, and
+	// so cannot reveal which scheme a stored hash uses.
+	//
+	// The scheme's own computation dominates the time taken, so this gradient
+	// is small, as is the cost of removing it: a few string comparisons per
+	// scheme. Off by default.
+	ConstantTimeIdentify bool
+
+	// If positive, Verify rejects correct passwords whose stored hash has an
+	// estimated strength (see Strength) below this many bits, returning an
+	// *ErrHashTooWeak rather than nil, so that the caller can require a
+	// password reset. Wrong passwords still fail with the scheme's usual
+	// error, so the check reveals nothing to someone guessing.
+	//
+	// Strength is roughly log2 of the work per guess, in SHA-256
+	// compressions; see abstract.StrengthScheme. For example, md5-crypt
+	// scores about 10, sha512-crypt with 10,000 rounds about 14, bcrypt with
+	// cost 12 about 20, and argon2id with t=2 and m=19456 about 19. Hashes
+	// from schemes which cannot estimate their strength score 0. Zero, the
+	// default, disables the check.
+	MinimumStrength float64
+
+	// If true, Verify rejects hashes whose encoded parameters, such as
+	// argon2's memory or scrypt's N, differ from those their scheme is
+	// configured with, returning an error wrapping ErrParameterMismatch before
+	// doing any of the scheme's work. This suits closed systems in which every
+	// hash is known to use one parameter set: an attacker able to plant a
+	// hash cannot then make verification cheap, or expensive enough to
+	// exhaust memory, and every verification touches the same amount of
+	// memory. Only parameters reported by both abstract.ParamReader and
+	// abstract.ParamScheme are compared.
+	//
+	// This breaks opportunistic upgrade: hashes made with older parameters
+	// no longer verify, so are never rehashed, and changing a scheme's
+	// parameters locks out every user until their hashes are replaced. Off by
+	// default.
+	StrictUniformParams bool
+
+	// Unless this is set, Verify and the other methods taking a stored hash
+	// strip leading and trailing ASCII whitespace from it before use, as
+	// hashes read from files or pasted through UIs often carry a trailing
+	// newline or stray spaces, which no scheme accepts. Whitespace within a
+	// hash is never removed. Set this to use hashes exactly as given.
+	KeepHashWhitespace bool
+
+	// If true, new hashes record when they were created, for password-age
+	// policies; see HashAge. This changes the stored format: the scheme's
+	// hash is wrapped as $created$<unix time>$<hash>, which only passlib
+	// understands. Verify and the other methods taking a stored hash strip
+	// the wrapper whether or not this is set, so it can be turned off again
+	// later, but anything else reading the stored hashes must strip it too.
+	// Upgraded hashes keep the creation time of the hash they replace.
+	EmbedTimestamp bool
+
+	// If true, hashes which are not in their scheme's canonical encoding need
+	// updating, so that VerifyAndUpgrade rewrites them in it: for example,
+	// bcrypt salts whose unused trailing bits are set, or pbkdf2 hashes in a
+	// base64 alphabet other than the scheme's. Such hashes verify normally,
+	// but stores which compare or deduplicate hashes as strings can be
+	// confused by them. Only schemes implementing abstract.Splittable can
+	// re-encode their hashes, so those of other schemes are never affected.
+	NormalizeEncoding bool
+
+	// If true, passwords are converted to Unicode Normalization Form C before
+	// hashing and verification, so that visually identical passwords typed
+	// with precomposed or combining characters (as macOS and Linux may
+	// produce) are treated the same.
+	//
+	// Off by default for compatibility. Hashes of non-NFC passwords made
+	// before enabling it will no longer verify; if such hashes may exist,
+	// verify with normalization off and rehash on the next successful login
+	// before turning it on. Normalized passwords are copied, so the caller's
+	// byte slice (see HashBytes) is not the only copy.
+	NormalizePassword bool
+
+	// If positive, Hash and Verify reject passwords longer than this many
+	// bytes (after any normalization) with an *ErrPasswordTooLong, rather
+	// than passing them to schemes which may silently truncate them, such as
+	// bcrypt at 72 bytes. Zero means no limit.
+	MaxPasswordLength int
+
+	// How passwords containing NUL bytes are handled. The crypt(3) family of
+	// schemes stops at the first NUL, so that "a\x00b" and "a\x00c" hash the
+	// same. The default is AllowNUL.
+	NULPolicy NULPolicy
+
+	// If non-nil, Hash and the other methods hashing a new password call this
+	// with the password before doing anything else, including normalization,
+	// and return its error unchanged if it fails, so that a password which
+	// fails the policy, for example because it is too short or is known to
+	// have been breached, is never hashed. Verify does not call it, so
+	// existing users can still log in, and their hashes are still upgraded.
+	PasswordPolicy func(password string) error
+
+	// The source of randomness for new salts. If nil, crypto/rand.Reader is
+	// used. Schemes which do not implement abstract.SaltReaderScheme, such as
+	// bcrypt, always use crypto/rand.
+	//
+	// This exists so that tests can inject a fixed reader and get
+	// reproducible hashes. Production code must never set it to anything
+	// predictable, as that would make every salt guessable.
+	SaltReader io.Reader
+
+	// The largest secret, in bytes, which HashReader and VerifyReader will
+	// read, and so the most memory each call may use to buffer it. Zero means
+	// DefaultMaxSecretSize (1 MiB).
+	MaxSecretSize int64
+
+	// If non-nil, notified of each hash, verification and upgrade, for
+	// example to record metrics. See Observer. Nil, the default, costs
+	// nothing.
+	Observer Observer
+
+	// The decoy hash returned by DummyHash, as a *dummyCache.
+	dummy atomic.Value
+}
+
+// Determines how a context handles passwords containing NUL bytes.
+type NULPolicy int
+
+const (
+	// Pass passwords containing NUL bytes to schemes unchanged. This is the
+	// default, for compatibility.
+	AllowNUL NULPolicy = iota
+
+	// Refuse to hash or verify passwords containing NUL bytes, returning
+	// ErrPasswordContainsNUL.
+	RejectNUL
+)
+
+// Indicates that a password contains a NUL byte and the context's NULPolicy
+// is RejectNUL.
+var ErrPasswordContainsNUL = fmt.Errorf("password contains a NUL byte")
+
+// Indicates that a password is longer than the context's MaxPasswordLength.
+type ErrPasswordTooLong struct {
+	Length int
+	Max    int
+}
+
+func (e *ErrPasswordTooLong) Error() string {
+	return fmt.Sprintf("password is %d bytes long, exceeding the limit of %d", e.Length, e.Max)
+}
+
+// Checks a password against the context's MaxPasswordLength and NULPolicy.
+func (ctx *Context) checkPassword(password []byte) error {
+	if ctx.MaxPasswordLength > 0 && len(password) > ctx.MaxPasswordLength {
+		return &ErrPasswordTooLong{Length: len(password), Max: ctx.MaxPasswordLength}
+	}
+
+	if ctx.NULPolicy == RejectNUL && bytes.IndexByte(password, 0) >= 0 {
+		return ErrPasswordContainsNUL
+	}
+
+	return nil
+}
+
+// Indicates that the first scheme passed to NewContext, which would be used
+// to hash new passwords, is one of the LegacySchemes. Some of these, such as
+// nthash, cannot hash at all. This is a warning: NewContext returns a usable
+// context alongside it, so that callers needing a legacy scheme for
+// interoperability, e.g. apr1 for htpasswd files, can log it and carry on.
+type ErrLegacyScheme struct {
+	Name string
+}
+
+func (e *ErrLegacyScheme) Error() string {
+	return fmt.Sprintf("scheme %q is a legacy scheme and should not be used to hash new passwords", e.Name)
+}
+
+// Returns a context using the named schemes, most preferred first, looked up
+// with SchemesFromNames. This validates the list up front, rather than
+// leaving problems to be discovered by the first call to Hash.
+//
+// Returns ErrNoHashingScheme if schemeNames is empty, and an *ErrUnknownScheme
+// if a name is not registered; the context is nil in either case. If the
+// first scheme is a legacy scheme, the context is returned together with an
+// *ErrLegacyScheme.
+func NewContext(schemeNames []string) (*Context, error) {
+	if len(schemeNames) == 0 {
+		return nil, ErrNoHashingScheme
+	}
+
+	schemes, err := SchemesFromNames(schemeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &Context{Schemes: schemes}
+	for _, legacy := range LegacySchemes {
+		if schemes[0] == legacy {
+			return ctx, &ErrLegacyScheme{Name: schemeNames[0]}
+		}
+	}
+
+	return ctx, nil
+}
+
+// Returns a copy of the context which can be modified without affecting
+// it. The Schemes slice, Pepper and Peppers (including their keys) are
+// copied, so changing the clone's schemes or peppers never affects the
+// original, and vice versa.
+//
+// The copy is shallow with respect to the schemes themselves, which are
+// shared: to change a scheme's parameters in the clone, replace the scheme
+// rather than mutating it (e.g. with SetParams). SaltReader is shared too.
+func (ctx *Context) Clone() *Context {
+	c := *ctx
+
+	if ctx.Schemes != nil {
+		c.Schemes = append([]abstract.Scheme{}, ctx.Schemes...)
+	}
+
+	if ctx.DeprecatedSchemes != nil {
+		c.DeprecatedSchemes = append([]abstract.Scheme{}, ctx.DeprecatedSchemes...)
+	}
+
+	if ctx.Pepper != nil {
+		c.Pepper = append([]byte{}, ctx.Pepper...)
+	}
+
+	if ctx.Peppers != nil {
+		c.Peppers = make(map[string][]byte, len(ctx.Peppers))
+		for id, pepper := range ctx.Peppers {
+			c.Peppers[id] = append([]byte{}, pepper...)
+		}
+	}
+
+	return &c
 }
 
 func (ctx *Context) schemes() []abstract.Scheme {
 	if ctx.Schemes == nil {
+		if ctx.FIPSOnly {
+			return DefaultSchemesFIPS
+		}
 		return DefaultSchemes
 	}
 
 	return ctx.Schemes
 }
 
+// Returns true iff scheme reports that it is deprecated.
+func deprecated(scheme abstract.Scheme) bool {
+	d, ok := scheme.(abstract.Deprecatable)
+	return ok && d.IsDeprecated()
+}
+
+// Returns true iff the context has NormalizeEncoding set and hash, which
+// scheme owns, differs from its canonical encoding, found by splitting and
+// rejoining it. Hashes which cannot be split are left to the scheme.
+func (ctx *Context) nonCanonical(scheme abstract.Scheme, hash string) bool {
+	s, ok := scheme.(abstract.Splittable)
+	if !ctx.NormalizeEncoding || !ok {
+		return false
+	}
+
+	salt, digest, params, err := s.SplitHash(hash)
+	if err != nil {
+		return false
+	}
+
+	canonical, err := s.JoinHash(salt, digest, params)
+	return err == nil && canonical != hash
+}
+
+// Returns the scheme which hashes new passwords: the first of the context's
+// Schemes, or of the default schemes if Schemes is nil, e.g. to log its
+// description (see abstract.Describable). Returns ErrNoHashingScheme if
+// there is none.
+func (ctx *Context) PreferredScheme() (abstract.Scheme, error) {
+	schemes := ctx.schemes()
+	if len(schemes) == 0 {
+		return nil, ErrNoHashingScheme
+	}
+
+	return schemes[0], nil
+}
+
+// Returns the schemes which may verify a hash: the context's schemes,
+// followed by its deprecated schemes.
+func (ctx *Context) verifySchemes() []abstract.Scheme {
+	schemes := ctx.schemes()
+	if len(ctx.DeprecatedSchemes) == 0 {
+		return schemes
+	}
+
+	return append(append([]abstract.Scheme{}, schemes...), ctx.DeprecatedSchemes...)
+}
+
 // Hashes a UTF-8 plaintext password using the context and produces a password hash.
 //
 // If stub is "", one is generated automaticaly for the preferred password hashing
@@ -59,9 +405,156 @@ func (ctx *Context) schemes() []abstract.Scheme {
 // If the context has not been specifically configured, a sensible default policy
 // is used. See the fields of Context.
 func (ctx *Context) Hash(password string) (hash string, err error) {
+	return ctx.hash([]byte(password))
+}
+
+// Like Hash, but takes the password as a byte slice, which the caller may
+// zero once HashBytes returns. The slice is not retained.
+//
+// The slice is passed to schemes which implement abstract.ByteScheme without
+// being copied into a string. Other schemes receive a string copy, which
+// cannot be zeroed; to avoid this, use only schemes implementing ByteScheme.
+func (ctx *Context) HashBytes(password []byte) (hash string, err error) {
+	return ctx.hash(password)
+}
+
+// Indicates that a context has no scheme with which to hash new passwords,
+// because its Schemes are empty; DeprecatedSchemes are never used for hashing.
+var ErrNoHashingScheme = fmt.Errorf("no scheme available for hashing")
+
+// Indicates that HashWithScheme or VerifyParts was asked for a scheme which
+// is not among the context's schemes.
+type ErrSchemeNotInContext struct {
+	Name string
+}
+
+func (e *ErrSchemeNotInContext) Error() string {
+	return fmt.Sprintf("scheme %q is not one of the context's schemes", e.Name)
+}
+
+// Like Hash, but hashes with the named scheme, wherever it appears in the
+// context's Schemes, rather than the preferred one, so that one context can
+// serve callers needing different schemes, e.g. tenants of which some
+// require PBKDF2 for FIPS compliance. schemeName is the name Identify
+// reports for the scheme's hashes: its registered name, such as "argon2id",
+// or for an unregistered scheme, such as one with custom parameters, its
+// String.
+// Returns an *ErrSchemeNotInContext if no scheme in Schemes has that name;
+// DeprecatedSchemes are never used for hashing.
+//
+// Verify identifies the scheme from the hash as usual. Note that it upgrades
+// hashes made by any scheme but the preferred one; use VerifyNoUpgrade for
+// such hashes to keep them in their scheme.
+func (ctx *Context) HashWithScheme(schemeName, password string) (hash string, err error) {
+	for _, scheme := range ctx.schemes() {
+		if schemeDisplayName(scheme) == schemeName {
+			if err := ctx.checkPolicy([]byte(password)); err != nil {
+				return "", err
+			}
+			return ctx.hashWith(scheme, ctx.SaltReader, []byte(password))
+		}
+	}
+
+	return "", &ErrSchemeNotInContext{Name: schemeName}
+}
+
+// Hashes a new password with the preferred scheme, if it passes the
+// context's PasswordPolicy.
+func (ctx *Context) hash(password []byte) (hash string, err error) {
+	if err := ctx.checkPolicy(password); err != nil {
+		return "", err
+	}
+
+	return ctx.hashWith(nil, ctx.SaltReader, password)
+}
+
+// Returns the error from the context's PasswordPolicy, if it has one. Only
+// new passwords are checked; rehashing a verified password is not.
+func (ctx *Context) checkPolicy(password []byte) error {
+	if ctx.PasswordPolicy == nil {
+		return nil
+	}
+
+	return ctx.PasswordPolicy(string(password))
+}
+
+// Hashes password with scheme, or the preferred scheme if scheme is nil,
+// reading the salt from saltReader, if it is not nil and the scheme can.
+func (ctx *Context) hashWith(scheme abstract.Scheme, saltReader io.Reader, password []byte) (hash string, err error) {
 	cHashCalls.Add(1)
 
-	return ctx.schemes()[0].Hash(password)
+	password = ctx.normalize(password)
+
+	if err := ctx.checkPassword(password); err != nil {
+		return "", err
+	}
+
+	if scheme == nil {
+		if scheme, err = ctx.PreferredScheme(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := ctx.checkFIPS(scheme); err != nil {
+		return "", err
+	}
+
+	keyID, pepper, err := ctx.currentPepper()
+	if err != nil {
+		return "", err
+	}
+
+	if pepper != nil {
+		password = pepperPassword(pepper, password)
+	}
+
+	start := ctx.observeStart()
+	hash, err = ctx.hashBytes(scheme, saltReader, password)
+	if err != nil {
+		return "", err
+	}
+	ctx.observeHash(scheme, start)
+
+	if pepper != nil {
+		hash = joinPeppered(keyID, hash)
+	}
+
+	if ctx.EmbedTimestamp {
+		hash = joinTimestamped(time.Now(), hash)
+	}
+
+	return hash, nil
+}
+
+// Applies NFC normalization to password if the context requires it.
+func (ctx *Context) normalize(password []byte) []byte {
+	if !ctx.NormalizePassword {
+		return password
+	}
+
+	return norm.NFC.Bytes(password)
+}
+
+func (ctx *Context) hashBytes(scheme abstract.Scheme, saltReader io.Reader, password []byte) (string, error) {
+	if saltReader != nil {
+		if ss, ok := scheme.(abstract.SaltReaderScheme); ok {
+			return ss.HashWithSaltReader(password, saltReader)
+		}
+	}
+
+	if bs, ok := scheme.(abstract.ByteScheme); ok {
+		return bs.HashBytes(password)
+	}
+
+	return scheme.Hash(string(password))
+}
+
+func verifyBytes(scheme abstract.Scheme, password []byte, hash string) error {
+	if bs, ok := scheme.(abstract.ByteScheme); ok {
+		return bs.VerifyBytes(password, hash)
+	}
+
+	return scheme.Verify(string(password), hash)
 }
 
 // Verifies a UTF-8 plaintext password using a previously derived password hash
@@ -74,62 +567,496 @@ func (ctx *Context) Hash(password string) (hash string, err error) {
 //
 // newHash is empty if the password was not valid or if no upgrade is required.
 //
+// The hash is verified only by the first scheme whose SupportsStub accepts
+// it, trying Schemes in order and then DeprecatedSchemes, so that common
+// hashes are matched without consulting legacy schemes. If that scheme
+// rejects the password, its error is returned; no other scheme is tried.
+//
+// If hash is empty or only whitespace, err is ErrNoPasswordSet.
+//
 // You should treat any non-nil err as a password verification error.
 func (ctx *Context) Verify(password, hash string) (newHash string, err error) {
+	return ctx.verify([]byte(password), hash, true)
+}
+
+// Like Verify, but also reports explicitly whether an upgrade hash was
+// produced. upgraded is true only if err is nil and newHash holds a fresh
+// hash which should be stored in place of hash. If the hash needs no upgrade,
+// or rehashing it failed, newHash is empty and upgraded is false.
+func (ctx *Context) VerifyAndUpgrade(password, hash string) (newHash string, upgraded bool, err error) {
+	newHash, err = ctx.verify([]byte(password), hash, true)
+	return newHash, err == nil && newHash != "", err
+}
+
+// Verifies password against hash and, if it is correct and hash needs
+// upgrading, rehashes it with the preferred scheme. This is VerifyAndUpgrade
+// under the name used for lazy migration, in which a table of hashes is moved
+// to a new scheme one row at a time, as each user next logs in.
+//
+// Persist newHash only when err is nil and changed is true, and only after
+// verification has succeeded, as this ordering ensures: storing a hash before
+// the password is known to be correct would let a wrong password replace a
+// user's hash. Replace the stored hash only if it still equals hash (e.g. with
+// "UPDATE ... WHERE id = ? AND hash = ?"), so that a password changed
+// concurrently is not overwritten. If storing fails, the login can still
+// proceed: the old hash remains valid, and the upgrade is retried next time.
+//
+// Progress can be tracked by counting the stored hashes for which NeedsUpdate
+// reports true; see also VerifyDeferringUpgrade, for collecting rows to
+// rehash later.
+func (ctx *Context) UpgradeOnVerify(password, hash string) (newHash string, changed bool, err error) {
+	return ctx.VerifyAndUpgrade(password, hash)
+}
+
+// Like Verify, but takes the password as a byte slice, which the caller may
+// zero once VerifyBytes returns. See HashBytes.
+func (ctx *Context) VerifyBytes(password []byte, hash string) (newHash string, err error) {
 	return ctx.verify(password, hash, true)
 }
 
 // Like Verify, but does not hash an upgrade password when upgrade is required.
 func (ctx *Context) VerifyNoUpgrade(password, hash string) error {
-	_, err := ctx.verify(password, hash, false)
+	_, err := ctx.verify([]byte(password), hash, false)
 	return err
 }
 
-func (ctx *Context) verify(password, hash string, canUpgrade bool) (newHash string, err error) {
+// Like VerifyAndUpgrade, but never rehashes: needsUpdate reports whether
+// VerifyAndUpgrade would have produced an upgrade hash, so that accounts
+// needing one can be collected and rehashed later, e.g. outside a busy
+// period. needsUpdate is true only if err is nil, and then agrees with
+// NeedsUpdate for the same hash; unlike NeedsUpdate, it is only reported once
+// the password has been verified, so the caller can rehash it then or keep it
+// for later.
+func (ctx *Context) VerifyDeferringUpgrade(password, hash string) (needsUpdate bool, err error) {
+	_, needsUpdate, _, err = ctx.verifyScheme([]byte(password), hash, false)
+	return needsUpdate && err == nil, err
+}
+
+// Like VerifyNoUpgrade, but also returns the name of the scheme which
+// claimed the hash, as Identify would, so that the caller can record which
+// algorithm authenticated a login without identifying the hash separately.
+// The name is returned even if the password is wrong.
+//
+// If the hash is malformed or no scheme supports it, scheme is "" and err is
+// abstract.ErrNoMatchingScheme.
+func (ctx *Context) VerifyWithScheme(password, hash string) (scheme string, err error) {
+	_, _, s, err := ctx.verifyScheme([]byte(password), hash, false)
+	if errors.Is(err, abstract.ErrInvalidHash) {
+		return "", abstract.ErrNoMatchingScheme
+	}
+	if s == nil {
+		return "", err
+	}
+
+	return schemeDisplayName(s), err
+}
+
+// Indicates that the stored hash is empty or consists only of whitespace, as
+// for accounts which have no password, such as those using social login. No
+// password can match it; callers can use this error to send such users to
+// another sign-in flow rather than treat it as a wrong password.
+var ErrNoPasswordSet = fmt.Errorf("no password set")
+
+// Returns true iff hash is empty or only whitespace.
+func noPasswordSet(hash string) bool {
+	return strings.TrimSpace(hash) == ""
+}
+
+// Strips leading and trailing ASCII whitespace from hash, unless the context
+// has KeepHashWhitespace set, and then any creation timestamp (see
+// EmbedTimestamp).
+func (ctx *Context) trimHash(hash string) string {
+	_, hash, _ = splitTimestamped(ctx.trimSpace(hash))
+	return hash
+}
+
+// Strips leading and trailing ASCII whitespace from hash, unless the context
+// has KeepHashWhitespace set.
+func (ctx *Context) trimSpace(hash string) string {
+	if ctx.KeepHashWhitespace {
+		return hash
+	}
+
+	return strings.Trim(hash, " \t\n\v\f\r")
+}
+
+func (ctx *Context) verify(password []byte, hash string, canUpgrade bool) (newHash string, err error) {
+	newHash, _, _, err = ctx.verifyScheme(password, hash, canUpgrade)
+	return newHash, err
+}
+
+// Like verify, but also returns the scheme which claimed the hash, or nil if
+// none did, and whether the password was valid and the hash needs updating,
+// whether or not it was upgraded.
+func (ctx *Context) verifyScheme(password []byte, hash string, canUpgrade bool) (newHash string, needsUpdate bool, scheme abstract.Scheme, err error) {
 	cVerifyCalls.Add(1)
 
-	for i, scheme := range ctx.schemes() {
-		if !scheme.SupportsStub(hash) {
+	if ctx.MinVerifyDuration > 0 {
+		start := time.Now()
+		defer func() {
+			if err != nil {
+				ctx.pad(start)
+			}
+		}()
+	}
+
+	if noPasswordSet(hash) {
+		cFailedVerifyCalls.Add(1)
+		return "", false, nil, ErrNoPasswordSet
+	}
+
+	password = ctx.normalize(password)
+
+	if err = ctx.checkPassword(password); err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, nil, err
+	}
+
+	stored := hash
+	pepperedPassword, hash, stale, err := ctx.unpepper(password, ctx.trimHash(hash))
+	if err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, nil, err
+	}
+
+	var i int
+	i, scheme = ctx.findScheme(hash)
+	if scheme == nil {
+		return "", false, nil, abstract.ErrNoMatchingScheme
+	}
+
+	if err = ctx.checkFIPS(scheme); err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, scheme, err
+	}
+
+	if err = ctx.checkUniformParams(scheme, hash); err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, scheme, err
+	}
+
+	start := ctx.observeStart()
+	err = verifyBytes(scheme, pepperedPassword, hash)
+	ctx.observeVerify(scheme, err == nil, start)
+	if err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, scheme, err
+	}
+
+	if err = ctx.checkStrength(scheme, hash); err != nil {
+		cFailedVerifyCalls.Add(1)
+		return "", false, scheme, err
+	}
+
+	cSuccessfulVerifyCalls.Add(1)
+	needsUpdate = stale || i != 0 || deprecated(scheme) || ctx.nonCanonical(scheme, hash) || scheme.NeedsUpdate(hash)
+	if needsUpdate {
+		if canUpgrade {
+			cSuccessfulVerifyCallsWithUpgrade.Add(1)
+
+			// If the scheme is not the first scheme, try and rehash with the
+			// preferred scheme. The password was accepted when it was set,
+			// so the PasswordPolicy does not apply.
+			if newHash, err2 := ctx.hashWith(nil, ctx.SaltReader, password); err2 == nil {
+				ctx.observeUpgrade(scheme, ctx.schemes()[0])
+				return ctx.keepTimestamp(newHash, stored), true, scheme, nil
+			}
+		} else {
+			cSuccessfulVerifyCallsDeferringUpgrade.Add(1)
+		}
+	}
+
+	return "", needsUpdate, scheme, nil
+}
+
+// Returns the first of the context's schemes (or deprecated schemes) which
+// supports hash, and its index, or nil if there is none. If
+// ConstantTimeIdentify is set, every scheme is asked, not just those before
+// the match.
+func (ctx *Context) findScheme(hash string) (int, abstract.Scheme) {
+	found := -1
+	schemes := ctx.verifySchemes()
+	for i, scheme := range schemes {
+		if scheme.SupportsStub(hash) && found < 0 {
+			found = i
+			if !ctx.ConstantTimeIdentify {
+				break
+			}
+		}
+	}
+
+	if found < 0 {
+		return found, nil
+	}
+
+	return found, schemes[found]
+}
+
+// The result of a hash or verification run in the background.
+type result struct {
+	hash string
+	err  error
+}
+
+// Runs f in a goroutine, returning its result, or c.Err() if c is done first.
+func runContext(c context.Context, f func() (string, error)) (string, error) {
+	if err := c.Err(); err != nil {
+		return "", err
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		hash, err := f()
+		ch <- result{hash, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.hash, r.err
+	case <-c.Done():
+		return "", c.Err()
+	}
+}
+
+// Like Hash, but returns c.Err() if c is cancelled or its deadline passes
+// before hashing completes.
+//
+// None of the hashing schemes can be interrupted part way through, so the
+// hash is computed in a separate goroutine which is abandoned on
+// cancellation. The abandoned goroutine continues to run, and to use CPU
+// time and memory, until the hash is complete; cancellation only frees the
+// caller. If c is already done, no hashing is started.
+func (ctx *Context) HashContext(c context.Context, password string) (hash string, err error) {
+	return runContext(c, func() (string, error) {
+		return ctx.Hash(password)
+	})
+}
+
+// Like Verify, but returns c.Err() if c is cancelled or its deadline passes
+// before verification (and any upgrade hashing) completes. As with
+// HashContext, the abandoned work runs to completion in the background.
+func (ctx *Context) VerifyContext(c context.Context, password, hash string) (newHash string, err error) {
+	return runContext(c, func() (string, error) {
+		return ctx.Verify(password, hash)
+	})
+}
+
+// Determines whether a hash needs updating according to the policy of the
+// context, without needing the password. This is the case if the scheme
+// owning the hash is not the context's preferred (first) scheme, including
+// any of its DeprecatedSchemes, if the scheme is deprecated whatever its
+// position (see abstract.Deprecatable), if the context has NormalizeEncoding
+// set and the hash is not in its scheme's canonical encoding, or if that
+// scheme's NeedsUpdate reports it, for example because its parameters are
+// weaker than those configured.
+// Hashes which do not use the context's current pepper also need updating.
+//
+// Returns abstract.ErrUnsupportedScheme if no scheme in the context supports
+// the hash. To learn this while verifying a password, without rehashing it,
+// use VerifyDeferringUpgrade.
+func (ctx *Context) NeedsUpdate(hash string) (bool, error) {
+	_, hash, stale, err := ctx.unpepper(nil, ctx.trimHash(hash))
+	if err != nil {
+		return false, err
+	}
+
+	i, scheme := ctx.findScheme(hash)
+	if scheme == nil {
+		return false, abstract.ErrUnsupportedScheme
+	}
+
+	return stale || i != 0 || deprecated(scheme) || ctx.nonCanonical(scheme, hash) || scheme.NeedsUpdate(hash), nil
+}
+
+// Indicates that no scheme in the context supports a hash.
+var ErrUnidentifiableHash = fmt.Errorf("no scheme supports the hash")
+
+// Determines which of the context's schemes owns a hash, without verifying
+// anything, and returns the name under which that scheme is registered (see
+// SchemeFromName). Schemes are tried in order and the first to support the
+// hash wins.
+//
+// If the owning scheme is not a registered scheme (for example, one created
+// with a custom cost), its String method is used to name it instead.
+func (ctx *Context) Identify(hash string) (schemeName string, err error) {
+	_, hash, _ = splitPeppered(ctx.trimHash(hash))
+
+	_, scheme := ctx.findScheme(hash)
+	if scheme == nil {
+		return "", ErrUnidentifiableHash
+	}
+
+	return schemeDisplayName(scheme), nil
+}
+
+// Reports whether any of the context's schemes supports a hash, without
+// verifying anything. Equivalent to checking that Identify succeeds.
+func (ctx *Context) IsSupported(hash string) bool {
+	_, hash, _ = splitPeppered(ctx.trimHash(hash))
+	_, scheme := ctx.findScheme(hash)
+	return scheme != nil
+}
+
+// Indicates that no registered scheme recognises a hash passed to ParseHash.
+// errors.Is reports it as matching ErrUnidentifiableHash.
+type ErrUnrecognizedHash struct {
+	// The hash's identifier, e.g. "$6$", or "" if it has none.
+	Prefix string
+}
+
+func (e *ErrUnrecognizedHash) Error() string {
+	if e.Prefix == "" {
+		return "no registered scheme recognises the hash"
+	}
+	return fmt.Sprintf("no registered scheme recognises hashes starting %q", e.Prefix)
+}
+
+func (e *ErrUnrecognizedHash) Is(target error) bool {
+	return target == ErrUnidentifiableHash
+}
+
+// Identifies the registered scheme owning a hash and returns its name and
+// the parameters encoded in the hash (see abstract.ParamReader), without
+// needing the password; useful for auditing the strength of stored hashes.
+// Registered schemes are tried in order of name.
+//
+// params is nil if the scheme cannot report its parameters. For peppered
+// hashes, params also includes "pepper", holding the pepper's identifier.
+//
+// Returns an *ErrUnrecognizedHash if no registered scheme supports the hash.
+func ParseHash(hash string) (scheme string, params map[string]string, err error) {
+	_, hash, _ = splitTimestamped(hash)
+	keyID, inner, peppered := splitPeppered(hash)
+
+	for _, name := range SchemeNames() {
+		s := SchemeFromName(name)
+		if s == nil || !s.SupportsStub(inner) {
 			continue
 		}
 
-		err = scheme.Verify(password, hash)
-		if err != nil {
-			cFailedVerifyCalls.Add(1)
-			return "", err
+		if pr, ok := s.(abstract.ParamReader); ok {
+			params, err = pr.ReadParams(inner)
+			if err != nil {
+				return name, nil, err
+			}
 		}
 
-		cSuccessfulVerifyCalls.Add(1)
-		if i != 0 || scheme.NeedsUpdate(hash) {
-			if canUpgrade {
-				cSuccessfulVerifyCallsWithUpgrade.Add(1)
-
-				// If the scheme is not the first scheme, try and rehash with the
-				// preferred scheme.
-				if newHash, err2 := ctx.Hash(password); err2 == nil {
-					return newHash, nil
-				}
-			} else {
-				cSuccessfulVerifyCallsDeferringUpgrade.Add(1)
+		if peppered {
+			if params == nil {
+				params = map[string]string{}
 			}
+			params["pepper"] = keyID
+		}
+
+		return name, params, nil
+	}
+
+	prefix := ""
+	if strings.HasPrefix(inner, "$") {
+		if i := strings.IndexByte(inner[1:], '$'); i >= 0 {
+			prefix = inner[:i+2]
+		}
+	}
+
+	return "", nil, &ErrUnrecognizedHash{Prefix: prefix}
+}
+
+// Describes a stored hash, as returned by AnalyzeHash.
+type HashInfo struct {
+	// The name of the scheme owning the hash, as returned by Identify.
+	Scheme string
+
+	// The parameters encoded in the hash, as returned by ParseHash, or nil if
+	// the scheme does not implement abstract.ParamReader.
+	Params map[string]string
+
+	// Whether the hash needs updating, as returned by NeedsUpdate.
+	NeedsUpdate bool
+
+	// The name of the scheme which would be used for a new hash, or "" if the
+	// context has no scheme able to hash.
+	Target string
+}
+
+// Analyzes a stored hash according to the policy of the context, for
+// auditing a password database. This combines Identify, ParseHash and
+// NeedsUpdate, and names the scheme to which the hash would be upgraded. It
+// never attempts verification.
+//
+// Returns ErrUnidentifiableHash if no scheme in the context supports the hash.
+func (ctx *Context) AnalyzeHash(hash string) (HashInfo, error) {
+	hash = ctx.trimHash(hash)
+	keyID, inner, peppered := splitPeppered(hash)
+
+	_, _, stale, err := ctx.unpepper(nil, hash)
+	if err != nil {
+		return HashInfo{}, err
+	}
+
+	i, scheme := ctx.findScheme(inner)
+	if scheme == nil {
+		return HashInfo{}, ErrUnidentifiableHash
+	}
+
+	info := HashInfo{
+		Scheme:      schemeDisplayName(scheme),
+		NeedsUpdate: stale || i != 0 || deprecated(scheme) || ctx.nonCanonical(scheme, inner) || scheme.NeedsUpdate(inner),
+	}
+
+	if pr, ok := scheme.(abstract.ParamReader); ok {
+		info.Params, err = pr.ReadParams(inner)
+		if err != nil {
+			return HashInfo{}, err
+		}
+	}
+
+	if peppered {
+		if info.Params == nil {
+			info.Params = map[string]string{}
 		}
+		info.Params["pepper"] = keyID
+	}
 
-		return "", nil
+	if schemes := ctx.schemes(); len(schemes) != 0 {
+		info.Target = schemeDisplayName(schemes[0])
 	}
 
-	return "", abstract.ErrUnsupportedScheme
+	return info, nil
 }
 
-// Determines whether a stub or hash needs updating according to the policy of
-// the context.
-func (ctx *Context) NeedsUpdate(stub string) bool {
-	for i, scheme := range ctx.schemes() {
-		if scheme.SupportsStub(stub) {
-			return i != 0 || scheme.NeedsUpdate(stub)
+// Describes each of the context's schemes, followed by its deprecated
+// schemes, with the parameters used for new hashes where the scheme
+// implements abstract.Describable, e.g.
+//
+//   []string{"argon2id(t=2,m=19456,p=1)", "bcrypt(cost=12)", "md5-crypt"}
+//
+// This is intended for logging the active configuration at startup, for
+// audit. Other schemes are named as by Identify.
+func (ctx *Context) DescribeSchemes() []string {
+	schemes := ctx.verifySchemes()
+	descriptions := make([]string, len(schemes))
+	for i, scheme := range schemes {
+		if d, ok := scheme.(abstract.Describable); ok {
+			descriptions[i] = d.Describe()
+		} else {
+			descriptions[i] = schemeDisplayName(scheme)
 		}
 	}
+	return descriptions
+}
+
+// Returns the registered name of a scheme, falling back to its String
+// method, or failing that its type.
+func schemeDisplayName(scheme abstract.Scheme) string {
+	if name := nameOfScheme(scheme); name != "" {
+		return name
+	}
+
+	if s, ok := scheme.(fmt.Stringer); ok {
+		return s.String()
+	}
 
-	return false
+	return fmt.Sprintf("%T", scheme)
 }
 
 // The default context, which uses sensible defaults. Most users should not
@@ -145,6 +1072,18 @@ func Hash(password string) (hash string, err error) {
 	return DefaultContext.Hash(password)
 }
 
+// Uses the default context to hash a password with the named scheme. See
+// Context.HashWithScheme.
+func HashWithScheme(schemeName, password string) (hash string, err error) {
+	return DefaultContext.HashWithScheme(schemeName, password)
+}
+
+// Returns the scheme the default context uses to hash new passwords. See
+// Context.PreferredScheme.
+func PreferredScheme() (abstract.Scheme, error) {
+	return DefaultContext.PreferredScheme()
+}
+
 // Verifies a UTF-8 plaintext password using a previously derived password hash
 // and the default context. Returns nil err only if the password is valid.
 //
@@ -160,14 +1099,76 @@ func Verify(password, hash string) (newHash string, err error) {
 	return DefaultContext.Verify(password, hash)
 }
 
+// Uses the default context to hash a password, honouring cancellation of c.
+// See Context.HashContext.
+func HashContext(c context.Context, password string) (hash string, err error) {
+	return DefaultContext.HashContext(c, password)
+}
+
+// Uses the default context to verify a password, honouring cancellation of c.
+// See Context.VerifyContext.
+func VerifyContext(c context.Context, password, hash string) (newHash string, err error) {
+	return DefaultContext.VerifyContext(c, password, hash)
+}
+
+// Uses the default context to hash a password held in a byte slice. See
+// Context.HashBytes.
+func HashBytes(password []byte) (hash string, err error) {
+	return DefaultContext.HashBytes(password)
+}
+
+// Uses the default context to verify a password held in a byte slice. See
+// Context.VerifyBytes.
+func VerifyBytes(password []byte, hash string) (newHash string, err error) {
+	return DefaultContext.VerifyBytes(password, hash)
+}
+
+// Uses the default context to verify a password, reporting whether an
+// upgrade hash was produced. See Context.VerifyAndUpgrade.
+func VerifyAndUpgrade(password, hash string) (newHash string, upgraded bool, err error) {
+	return DefaultContext.VerifyAndUpgrade(password, hash)
+}
+
+// Verifies a password and upgrades its hash using the default context. See
+// Context.UpgradeOnVerify.
+func UpgradeOnVerify(password, hash string) (newHash string, changed bool, err error) {
+	return DefaultContext.UpgradeOnVerify(password, hash)
+}
+
 // Like Verify, but never upgrades.
 func VerifyNoUpgrade(password, hash string) error {
 	return DefaultContext.VerifyNoUpgrade(password, hash)
 }
 
-// Uses the default context to determine whether a stub or hash needs updating.
-func NeedsUpdate(stub string) bool {
-	return DefaultContext.NeedsUpdate(stub)
+// Like VerifyNoUpgrade, but reports whether the hash needs updating.
+func VerifyDeferringUpgrade(password, hash string) (needsUpdate bool, err error) {
+	return DefaultContext.VerifyDeferringUpgrade(password, hash)
+}
+
+// Like VerifyNoUpgrade, but also returns the name of the scheme which claimed
+// the hash.
+func VerifyWithScheme(password, hash string) (scheme string, err error) {
+	return DefaultContext.VerifyWithScheme(password, hash)
+}
+
+// Uses the default context to determine which scheme owns a hash.
+func Identify(hash string) (schemeName string, err error) {
+	return DefaultContext.Identify(hash)
+}
+
+// Uses the default context to determine whether any scheme supports a hash.
+func IsSupported(hash string) bool {
+	return DefaultContext.IsSupported(hash)
+}
+
+// Uses the default context to determine whether a hash needs updating.
+func NeedsUpdate(hash string) (bool, error) {
+	return DefaultContext.NeedsUpdate(hash)
+}
+
+// Uses the default context to analyze a stored hash.
+func AnalyzeHash(hash string) (HashInfo, error) {
+	return DefaultContext.AnalyzeHash(hash)
 }
 
 // © 2008-2012 Assurance Technologies LLC.  (Python passlib)  BSD License
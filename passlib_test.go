@@ -1,14 +1,31 @@
 package passlib
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/al45tair/passlib/abstract"
 	"github.com/al45tair/passlib/hash/argon2"
 	"github.com/al45tair/passlib/hash/bcrypt"
 	"github.com/al45tair/passlib/hash/bcryptsha256"
+	"github.com/al45tair/passlib/hash/bcryptsha512"
+	"github.com/al45tair/passlib/hash/descrypt"
+	"github.com/al45tair/passlib/hash/md5crypt"
+	"github.com/al45tair/passlib/hash/pbkdf2"
 	"github.com/al45tair/passlib/hash/scrypt"
 	"github.com/al45tair/passlib/hash/sha2crypt"
+	"github.com/al45tair/passlib/hash/yescrypt"
 )
 
 //import "github.com/al45tair/passlib/hash/scrypt"
@@ -123,6 +140,22 @@ func kat(t *testing.T, scheme abstract.Scheme, password, hash string) {
 	}
 }
 
+func sha256crypt(t *testing.T, rounds int) abstract.Scheme {
+	s, err := sha2crypt.NewCrypter256(rounds)
+	if err != nil {
+		t.Fatalf("sha256-crypt with %d rounds: %v", rounds, err)
+	}
+	return s
+}
+
+func sha512crypt(t *testing.T, rounds int) abstract.Scheme {
+	s, err := sha2crypt.NewCrypter512(rounds)
+	if err != nil {
+		t.Fatalf("sha512-crypt with %d rounds: %v", rounds, err)
+	}
+	return s
+}
+
 func TestKat(t *testing.T) {
 	for _, v := range []struct{ p, h string }{
 		{"foobar", "$5$rounds=110000$J672cUm182wrK1bX$0TzjpY6NV07r82J9YebG50dZuwHoQWrny9Q7y6ceO7/"},
@@ -233,6 +266,13 @@ func TestKat(t *testing.T) {
 		kat(t, bcryptsha256.Crypter, v.p, v.h)
 	}
 
+	// bcrypt's prehashing truncation policy uses the bcrypt-sha256 format.
+	for _, v := range []struct{ p, h string }{
+		{"abc123abc123abc123abc123abc123abc123abc123abc123abc123abc123abc123abc123qwr", "$bcrypt-sha256$2a,5$X1g1nh3g0v4h6970O68cxe$021KLEif6epjot5yoxk0m8I0929ohEa"},
+	} {
+		kat(t, bcrypt.NewWithTruncationPolicy(bcrypt.PreHashSHA256), v.p, v.h)
+	}
+
 	for _, v := range []struct{ p, h string }{
 		{"", "$s2$16384$8$1$5KHwLMZjMDiuPAhUYK/XcKZW$KZIGWg5XM1Xsh8X/wuBE1+KTeFImkuQn3gZpjUZcqns="},
 		{"foobar", "$s2$16384$8$1$qa9lVfhmTE8F2Jpwya9m7uoE$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI="},
@@ -246,6 +286,3087 @@ func TestKat(t *testing.T) {
 	} {
 		kat(t, argon2.Crypter, v.p, v.h)
 	}
+
+	for _, v := range []struct{ p, h string }{
+		{"", "$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo"},
+		{"foobar", "$argon2id$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA"},
+	} {
+		kat(t, argon2.IDCrypter, v.p, v.h)
+	}
+}
+
+func TestArgon2Variants(t *testing.T) {
+	const argon2iHash = "$argon2i$v=19$m=32768,t=4,p=4$uN6vgPBb8/liQld8lgFqew$KlvqGCHX7Cap0ohKY7YAUJsbzcnenCwvSAfhqtIA/Q0"
+	const argon2idHash = "$argon2id$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA"
+
+	if argon2.Crypter.SupportsStub(argon2idHash) {
+		t.Fatalf("argon2i crypter claims to support an argon2id hash")
+	}
+	if argon2.IDCrypter.SupportsStub(argon2iHash) {
+		t.Fatalf("argon2id crypter claims to support an argon2i hash")
+	}
+
+	schemes, err := DefaultSchemesFromDate(Defaults20201015)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := Context{Schemes: schemes}
+
+	newHash, err := c.Verify("foobar", argon2iHash)
+	if err != nil {
+		t.Fatalf("err verifying argon2i hash: %v", err)
+	}
+	if !argon2.IDCrypter.SupportsStub(newHash) {
+		t.Fatalf("argon2i hash was not upgraded to argon2id: %q", newHash)
+	}
+
+	newHash, err = c.Verify("foobar", argon2idHash)
+	if err != nil {
+		t.Fatalf("err verifying argon2id hash: %v", err)
+	}
+	if newHash != "" {
+		t.Fatalf("unexpected upgrade of argon2id hash")
+	}
+
+	// Listing argon2i as deprecated migrates its hashes by position alone.
+	c = Context{
+		Schemes:           []abstract.Scheme{argon2.IDCrypter},
+		DeprecatedSchemes: []abstract.Scheme{argon2.Crypter},
+	}
+	newHash, err = c.Verify("foobar", argon2iHash)
+	if err != nil {
+		t.Fatalf("err verifying argon2i hash: %v", err)
+	}
+	if !argon2.IDCrypter.SupportsStub(newHash) {
+		t.Fatalf("argon2i hash was not upgraded to argon2id: %q", newHash)
+	}
+}
+
+func TestArgon2AssumedType(t *testing.T) {
+	// The hashes of TestArgon2Variants, with their type removed.
+	const bareI = "$argon2$v=19$m=32768,t=4,p=4$uN6vgPBb8/liQld8lgFqew$KlvqGCHX7Cap0ohKY7YAUJsbzcnenCwvSAfhqtIA/Q0"
+	const bareID = "$argon2$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA"
+
+	assumeI, err := argon2.NewWithAssumedType(argon2.TypeI)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	assumeID, err := argon2.NewWithAssumedType(argon2.TypeID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := argon2.NewWithAssumedType(argon2.Type(7)); err == nil {
+		t.Errorf("unknown type accepted")
+	}
+
+	for _, scheme := range []abstract.Scheme{argon2.Crypter, argon2.IDCrypter} {
+		if scheme.SupportsStub(bareI) {
+			t.Errorf("%v claims a hash without a type", scheme)
+		}
+	}
+	if assumeID.SupportsStub("$argon2id$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA") {
+		t.Errorf("assumed type scheme claims a typed hash")
+	}
+
+	if err := assumeI.Verify("foobar", bareI); err != nil {
+		t.Errorf("err verifying as argon2i: %v", err)
+	}
+	if err := assumeID.Verify("foobar", bareID); err != nil {
+		t.Errorf("err verifying as argon2id: %v", err)
+	}
+	if err := assumeID.Verify("foobar", bareI); err != abstract.ErrInvalidPassword {
+		t.Errorf("expected mismatch assuming the wrong type, got %v", err)
+	}
+	if err := assumeI.Verify("x", bareI); err != abstract.ErrInvalidPassword {
+		t.Errorf("expected mismatch, got %v", err)
+	}
+
+	if !assumeI.NeedsUpdate(bareI) {
+		t.Errorf("hash without a type does not need updating")
+	}
+	if _, err := assumeI.Hash("foobar"); err != argon2.ErrHashNotSupported {
+		t.Errorf("expected ErrHashNotSupported, got %v", err)
+	}
+
+	c := Context{Schemes: []abstract.Scheme{argon2.IDCrypter, assumeI}}
+	newHash, err := c.Verify("foobar", bareI)
+	if err != nil || !argon2.IDCrypter.SupportsStub(newHash) {
+		t.Errorf("hash without a type was not upgraded: %q, %v", newHash, err)
+	}
+}
+
+func TestArgon2Params(t *testing.T) {
+	weak := argon2.NewID(1, 8*1024, 1, 16)
+	strong := argon2.NewID(2, 16*1024, 2, 32)
+
+	h, err := weak.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Verification honours the parameters embedded in the hash.
+	if err := strong.Verify("password", h); err != nil {
+		t.Fatalf("err verifying with different configured parameters: %v", err)
+	}
+	if !strong.NeedsUpdate(h) {
+		t.Fatalf("hash with weaker parameters does not need update")
+	}
+	if weak.NeedsUpdate(h) {
+		t.Fatalf("hash with configured parameters needs update")
+	}
+
+	if _, err := argon2.New(1, 31, 4, 32).Hash("password"); err == nil {
+		t.Fatalf("expected error with memory below 8*threads KiB")
+	}
+}
+
+func TestArgon2Version(t *testing.T) {
+	// A v=16 hash from the reference implementation.
+	const v16Hash = "$argon2i$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ"
+
+	if err := argon2.Crypter.Verify("password", v16Hash); err != nil {
+		t.Fatalf("err verifying v=16 hash: %v", err)
+	}
+	if err := argon2.Crypter.Verify("wrong", v16Hash); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if !argon2.Crypter.NeedsUpdate(v16Hash) {
+		t.Fatalf("v=16 hash does not need update by v=19 scheme")
+	}
+
+	v16, err := argon2.NewWithVersion(16, 2, 65536, 1, 32)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	h, err := v16.(abstract.SaltReaderScheme).HashWithSaltReader([]byte("password"), strings.NewReader("somesaltsomesalt"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$argon2i$v=16$m=65536,t=2,p=1$") {
+		t.Fatalf("unexpected hash: %q", h)
+	}
+	if err := argon2.Crypter.Verify("password", h); err != nil {
+		t.Fatalf("err verifying emitted v=16 hash: %v", err)
+	}
+	if v16.NeedsUpdate(h) {
+		t.Fatalf("v=16 hash needs update by v=16 scheme")
+	}
+
+	if _, err := argon2.NewIDWithVersion(18, 2, 65536, 1, 32); err == nil {
+		t.Fatalf("expected error for unknown version")
+	}
+	if err := argon2.Crypter.Verify("password", strings.Replace(v16Hash, "v=16", "v=18", 1)); err == nil {
+		t.Fatalf("expected error verifying hash with unknown version")
+	}
+}
+
+func TestArgon2SaltLength(t *testing.T) {
+	base := argon2.NewID(1, 8*1024, 1, 32)
+
+	for _, n := range []int{0, 7} {
+		if _, err := argon2.WithSaltLength(base, n); err == nil {
+			t.Fatalf("expected error for salt length %d", n)
+		}
+	}
+	if _, err := argon2.WithSaltLength(md5crypt.Crypter, 16); err == nil {
+		t.Fatalf("expected error for non-argon2 scheme")
+	}
+
+	var short string
+	for _, n := range []int{16, 32} {
+		s, err := argon2.WithSaltLength(base, n)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		h, err := s.Hash("password")
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+
+		salt := strings.Split(h, "$")[4]
+		if l := base64.RawStdEncoding.DecodedLen(len(salt)); l != n {
+			t.Fatalf("salt length %d: got %d bytes in %q", n, l, h)
+		}
+
+		// Verification uses the salt in the hash, whatever the configured
+		// length.
+		for _, c := range []abstract.Scheme{s, base, argon2.IDCrypter} {
+			if err := c.Verify("password", h); err != nil {
+				t.Fatalf("err verifying %q: %v", h, err)
+			}
+		}
+
+		if s.NeedsUpdate(h) {
+			t.Fatalf("hash with configured salt length needs update")
+		}
+		if short == "" {
+			short = h
+		} else if !s.NeedsUpdate(short) {
+			t.Fatalf("hash with shorter salt does not need update")
+		}
+
+		if p := s.(abstract.ParamScheme).Params(); p["salt_length"] != fmt.Sprint(n) {
+			t.Fatalf("unexpected params: %v", p)
+		}
+	}
+
+	s, err := base.(abstract.ParamScheme).WithParams(map[string]string{"salt_length": "32"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p := s.(abstract.ParamScheme).Params(); p["salt_length"] != "32" {
+		t.Fatalf("unexpected params: %v", p)
+	}
+	if _, err := base.(abstract.ParamScheme).WithParams(map[string]string{"salt_length": "4"}); err == nil {
+		t.Fatalf("expected error for short salt_length")
+	}
+}
+
+func TestArgon2Secret(t *testing.T) {
+	base := argon2.NewID(1, 8*1024, 1, 32)
+	s, err := argon2.WithSecret(base, []byte("secret key"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	h, err := s.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if err := s.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if err := base.Verify("password", h); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("hash with secret verified without it: %v", err)
+	}
+
+	other, _ := argon2.WithSecret(base, []byte("other key"))
+	if err := other.Verify("password", h); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("hash with secret verified with another: %v", err)
+	}
+
+	// The secret survives WithParams, and is never exposed as a parameter.
+	p, err := s.(abstract.ParamScheme).WithParams(map[string]string{"time": "2"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := p.Verify("password", h); err != nil {
+		t.Fatalf("err verifying after WithParams: %v", err)
+	}
+	for name := range p.(abstract.ParamScheme).Params() {
+		if strings.Contains(name, "secret") {
+			t.Fatalf("secret exposed as parameter %q", name)
+		}
+	}
+}
+
+func TestArgon2Calibrate(t *testing.T) {
+	passes, memory, threads, err := argon2.Calibrate(5*time.Millisecond, 4096)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if passes < 1 || memory > 4096 || memory < 8*uint32(threads) {
+		t.Fatalf("unreasonable calibration result: t=%d m=%d p=%d", passes, memory, threads)
+	}
+
+	if _, _, _, err := argon2.Calibrate(time.Second, 1); err == nil {
+		t.Fatalf("expected error with insufficient memory")
+	}
+}
+
+func TestLegacyUpgrade(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter}}
+
+	newHash, err := c.Verify("password", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/")
+	if err != nil {
+		t.Fatalf("err verifying md5-crypt hash: %v", err)
+	}
+	if !sha2crypt.Crypter512.SupportsStub(newHash) {
+		t.Fatalf("md5-crypt hash was not upgraded: %q", newHash)
+	}
+
+	if _, err := c.Verify("password2", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"); err == nil {
+		t.Fatalf("got nil error with wrong password")
+	}
+}
+
+func TestDESCrypt(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, descrypt.Crypter, descrypt.BSDiCrypter}}
+
+	for _, h := range []string{"abJnggxhB/yWI", "_J9..saltJW8FtKdEkNM"} {
+		newHash, err := c.Verify("password", h)
+		if err != nil {
+			t.Fatalf("err verifying %q: %v", h, err)
+		}
+		if !sha2crypt.Crypter512.SupportsStub(newHash) {
+			t.Fatalf("%q was not upgraded: %q", h, newHash)
+		}
+
+		if _, err := c.Verify("passwore", h); err == nil {
+			t.Fatalf("got nil error with wrong password for %q", h)
+		}
+	}
+
+	for _, s := range []abstract.Scheme{descrypt.Crypter, descrypt.BSDiCrypter} {
+		if _, err := s.Hash("password"); err != descrypt.ErrHashNotSupported {
+			t.Fatalf("%v: expected ErrHashNotSupported, got %v", s, err)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	c := Context{Schemes: append(defaultSchemes20201015, LegacySchemes...)}
+
+	for _, tst := range []struct{ hash, name string }{
+		{"$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo", "argon2id"},
+		{"$s2$16384$8$1$zK1HY8sNoU5wU0uF$vlV8fDWzU3YaNF8W8BEN5LdaUcKnxmt0LPhALOqTvkk=", "scrypt-sha256"},
+		{"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e", "bcrypt"},
+		{"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", "md5-crypt"},
+		{"abJnggxhB/yWI", "des-crypt"},
+		{"$nt$8846f7eaee8fb117ad06bdd830b7586c", "nthash"},
+		{"{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME", "ldap-ssha"},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "ldap-sha"},
+		{"*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF4", "mysql41"},
+	} {
+		name, err := c.Identify(tst.hash)
+		if err != nil || name != tst.name {
+			t.Errorf("%q: got %q, %v, expected %q", tst.hash, name, err, tst.name)
+		}
+	}
+
+	if _, err := c.Identify("$unknown$hash"); err != ErrUnidentifiableHash {
+		t.Errorf("expected ErrUnidentifiableHash, got %v", err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{bcrypt.New(5)}}
+	if name, _ := c.Identify("$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e"); name != "bcrypt(5)" {
+		t.Errorf("unexpected name for unregistered scheme: %q", name)
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter}}
+
+	for _, hash := range []string{
+		"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/",
+		"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		" $1$saltsalt$qjXMvbEw8oaL.CzflDtaK/\n",
+	} {
+		if !c.IsSupported(hash) {
+			t.Errorf("%q: expected supported", hash)
+		}
+	}
+
+	for _, hash := range []string{
+		"",
+		"$unknown$hash",
+		"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+		"{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME",
+	} {
+		if c.IsSupported(hash) {
+			t.Errorf("%q: expected unsupported", hash)
+		}
+	}
+
+	if !IsSupported("$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e") {
+		t.Errorf("default context should support bcrypt")
+	}
+}
+
+func TestContextNeedsUpdate(t *testing.T) {
+	weak := sha512crypt(t, 5000)
+	strong := sha512crypt(t, 10000)
+
+	h, err := weak.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := Context{Schemes: []abstract.Scheme{strong, md5crypt.Crypter}}
+	if nu, err := c.NeedsUpdate(h); err != nil || !nu {
+		t.Fatalf("hash with too few rounds does not need update: %v", err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{weak, md5crypt.Crypter}}
+	if nu, err := c.NeedsUpdate(h); err != nil || nu {
+		t.Fatalf("hash with configured rounds needs update: %v", err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{md5crypt.Crypter, weak}}
+	if nu, err := c.NeedsUpdate(h); err != nil || !nu {
+		t.Fatalf("hash from non-preferred scheme does not need update: %v", err)
+	}
+
+	if _, err := c.NeedsUpdate("$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e"); err != abstract.ErrUnsupportedScheme {
+		t.Fatalf("expected ErrUnsupportedScheme, got %v", err)
+	}
+}
+
+func TestHashContext(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{scrypt.SHA256Crypter, md5crypt.Crypter}}
+
+	h, err := c.HashContext(context.Background(), "password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+
+	newHash, err := c.VerifyContext(context.Background(), "password", h)
+	if err != nil || newHash != "" {
+		t.Fatalf("unexpected verification result: %q, %v", newHash, err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.HashContext(cancelled, "password"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+
+	if _, err := c.VerifyContext(expired, "password", h); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestMinVerifyDuration(t *testing.T) {
+	c := Context{
+		Schemes:           []abstract.Scheme{sha512crypt(t, 1000)},
+		MinVerifyDuration: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	if _, err := c.Verify("password", "$6$malformed"); err == nil {
+		t.Fatalf("expected error verifying malformed hash")
+	}
+	if d := time.Since(start); d < c.MinVerifyDuration {
+		t.Fatalf("failed verification was not padded: %v", d)
+	}
+
+	start = time.Now()
+	c.VerifyDummy("password")
+	if d := time.Since(start); d < c.MinVerifyDuration {
+		t.Fatalf("dummy verification was not padded: %v", d)
+	}
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+
+	start = time.Now()
+	if _, err := c.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+	if d := time.Since(start); d >= c.MinVerifyDuration {
+		t.Fatalf("successful verification was padded: %v", d)
+	}
+}
+
+func TestVerifyDummy(t *testing.T) {
+	c := Context{
+		Schemes:     []abstract.Scheme{sha2crypt.Crypter512},
+		DummyScheme: bcrypt.New(5),
+	}
+
+	c.VerifyDummy("password")
+
+	h, err := c.DummyHash()
+	if err != nil || !c.DummyScheme.SupportsStub(h) {
+		t.Fatalf("no decoy hash for the dummy scheme: %q", h)
+	}
+
+	// Verify-only schemes cannot produce a decoy, but must not fail.
+	c.DummyScheme = descrypt.Crypter
+	c.VerifyDummy("password")
+}
+
+func TestDummyHash(t *testing.T) {
+	c := Context{
+		Schemes:           []abstract.Scheme{sha256crypt(t, 1000)},
+		MinVerifyDuration: 50 * time.Millisecond,
+	}
+
+	h, err := c.DummyHash()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$5$rounds=1000$") {
+		t.Fatalf("decoy hash does not use the preferred scheme: %q", h)
+	}
+
+	if h2, err := c.DummyHash(); err != nil || h2 != h {
+		t.Fatalf("decoy hash was not cached: %q, %v", h2, err)
+	}
+
+	start := time.Now()
+	if _, err := c.Verify("password", h); err == nil {
+		t.Fatalf("password verified against decoy hash")
+	}
+	if d := time.Since(start); d < c.MinVerifyDuration {
+		t.Fatalf("verification against decoy was not padded: %v", d)
+	}
+
+	empty := Context{Schemes: []abstract.Scheme{}}
+	if _, err := empty.DummyHash(); err != ErrNoHashingScheme {
+		t.Fatalf("expected ErrNoHashingScheme, got %v", err)
+	}
+
+	// Each context has its own decoy, which follows the scheme.
+	other := Context{Schemes: c.Schemes}
+	if h2, err := other.DummyHash(); err != nil || h2 == h {
+		t.Fatalf("decoy hash shared between contexts: %q, %v", h2, err)
+	}
+	c.Schemes = []abstract.Scheme{sha512crypt(t, 1000)}
+	if h2, err := c.DummyHash(); err != nil || !strings.HasPrefix(h2, "$6$rounds=1000$") {
+		t.Fatalf("decoy hash not regenerated for the new scheme: %q, %v", h2, err)
+	}
+
+	// Schemes of types which cannot be compared with == work too.
+	c.DummyScheme = uncomparableScheme{Scheme: bcrypt.New(5)}
+	h, err = c.DummyHash()
+	if err != nil || !bcrypt.Crypter.SupportsStub(h) {
+		t.Fatalf("no decoy hash for an uncomparable scheme: %q, %v", h, err)
+	}
+	if h2, err := c.DummyHash(); err != nil || h2 != h {
+		t.Fatalf("decoy hash was not cached: %q, %v", h2, err)
+	}
+}
+
+// A scheme whose type cannot be compared with ==.
+type uncomparableScheme struct {
+	abstract.Scheme
+	tags []string
+}
+
+func TestPepper(t *testing.T) {
+	plain := Context{Schemes: []abstract.Scheme{sha512crypt(t, 1000)}}
+	c := plain
+	c.Pepper = []byte("0123456789abcdef0123456789abcdef")
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h, "$pepper$$$6$") {
+		t.Fatalf("peppered hash is not marked: %q", h)
+	}
+
+	if newHash, err := c.Verify("password", h); err != nil || newHash != "" {
+		t.Fatalf("unexpected verification result: %q, %v", newHash, err)
+	}
+	if _, err := c.Verify("password2", h); err == nil {
+		t.Fatalf("got nil error with wrong password")
+	}
+	if name, err := c.Identify(h); err != nil || name != "sha512-crypt(1000)" {
+		t.Fatalf("unexpected identification: %q, %v", name, err)
+	}
+
+	// The hash cannot be verified without the pepper, or with another one.
+	if _, err := plain.Verify("password", h); err != ErrPepperRequired {
+		t.Fatalf("expected ErrPepperRequired, got %v", err)
+	}
+	other := c
+	other.Pepper = []byte("fedcba9876543210fedcba9876543210")
+	if _, err := other.Verify("password", h); err != abstract.ErrInvalidPassword {
+		t.Fatalf("expected ErrInvalidPassword with wrong pepper, got %v", err)
+	}
+
+	// Unpeppered hashes are upgraded.
+	h, err = plain.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if nu, err := c.NeedsUpdate(h); err != nil || !nu {
+		t.Fatalf("unpeppered hash does not need update: %v", err)
+	}
+	newHash, err := c.Verify("password", h)
+	if err != nil || !strings.HasPrefix(newHash, "$pepper$$") {
+		t.Fatalf("unpeppered hash was not upgraded: %q, %v", newHash, err)
+	}
+}
+
+func TestPepperRotation(t *testing.T) {
+	c := Context{
+		Schemes:         []abstract.Scheme{sha512crypt(t, 1000)},
+		Peppers:         map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")},
+		CurrentPepperID: "k1",
+	}
+
+	h1, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if !strings.HasPrefix(h1, "$pepper$k1$$6$") {
+		t.Fatalf("hash does not carry key id: %q", h1)
+	}
+
+	// Rotate to a new pepper, keeping the old one.
+	c.Peppers["k2"] = []byte("fedcba9876543210fedcba9876543210")
+	c.CurrentPepperID = "k2"
+
+	if nu, err := c.NeedsUpdate(h1); err != nil || !nu {
+		t.Fatalf("hash with old pepper does not need update: %v", err)
+	}
+
+	h2, err := c.Verify("password", h1)
+	if err != nil || !strings.HasPrefix(h2, "$pepper$k2$") {
+		t.Fatalf("hash with old pepper was not upgraded: %q, %v", h2, err)
+	}
+
+	if newHash, err := c.Verify("password", h2); err != nil || newHash != "" {
+		t.Fatalf("unexpected verification result: %q, %v", newHash, err)
+	}
+
+	// Once the old pepper is removed, its hashes fail descriptively.
+	delete(c.Peppers, "k1")
+	if _, err := c.Verify("password", h1); err == nil || !strings.Contains(err.Error(), `"k1"`) {
+		t.Fatalf("expected error naming missing key, got %v", err)
+	}
+
+	c.CurrentPepperID = "k3"
+	if _, err := c.Hash("password"); err == nil {
+		t.Fatalf("expected error hashing with missing current pepper")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for _, scheme := range []abstract.Scheme{
+		argon2.IDCrypter,
+		argon2.Crypter,
+		scrypt.SHA256Crypter,
+		bcrypt.Crypter,
+		pbkdf2.SHA512Crypter,
+		pbkdf2.DjangoSHA256Crypter,
+	} {
+		if _, ok := scheme.(abstract.ByteScheme); !ok {
+			t.Errorf("%v does not implement ByteScheme", scheme)
+		}
+	}
+
+	c := Context{
+		Schemes: []abstract.Scheme{scrypt.SHA256Crypter, sha512crypt(t, 1000)},
+		Pepper:  []byte("0123456789abcdef0123456789abcdef"),
+	}
+
+	password := []byte("password")
+	h, err := c.HashBytes(password)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+
+	if newHash, err := c.VerifyBytes(password, h); err != nil || newHash != "" {
+		t.Fatalf("unexpected verification result: %q, %v", newHash, err)
+	}
+
+	// The string and byte APIs are interchangeable.
+	if _, err := c.Verify("password", h); err != nil {
+		t.Fatalf("err verifying with string: %v", err)
+	}
+
+	// Schemes which don't implement ByteScheme still work.
+	c.Schemes = c.Schemes[1:]
+	h, err = c.HashBytes(password)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if _, err := c.VerifyBytes(password, h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+
+	for i := range password {
+		password[i] = 0
+	}
+	if _, err := c.VerifyBytes(password, h); err == nil {
+		t.Fatalf("got nil error with zeroed password")
+	}
+}
+
+func TestUnregisterScheme(t *testing.T) {
+	if err := UnregisterScheme("bcrypt"); err != nil {
+		t.Fatalf("err unregistering: %v", err)
+	}
+	defer RegisterScheme("bcrypt", bcrypt.Crypter)
+
+	var unknown *ErrUnknownScheme
+	if _, err := SchemeFromNameE("bcrypt"); !errors.As(err, &unknown) || unknown.Name != "bcrypt" {
+		t.Errorf("expected ErrUnknownScheme, got %v", err)
+	}
+	if _, err := SchemesFromNames([]string{"argon2id", "bcrypt"}); !errors.As(err, &unknown) {
+		t.Errorf("expected ErrUnknownScheme, got %v", err)
+	}
+	if err := UnregisterScheme("bcrypt"); !errors.As(err, &unknown) {
+		t.Errorf("expected ErrUnknownScheme unregistering twice, got %v", err)
+	}
+	for _, name := range SchemeNames() {
+		if name == "bcrypt" {
+			t.Errorf("unregistered scheme still listed")
+		}
+	}
+}
+
+func TestReplaceScheme(t *testing.T) {
+	custom := bcrypt.New(14)
+
+	if err := ReplaceScheme("bcrypt", custom); err != nil {
+		t.Fatalf("err replacing: %v", err)
+	}
+	defer ReplaceScheme("bcrypt", bcrypt.Crypter)
+
+	if SchemeFromName("bcrypt") != custom {
+		t.Errorf("lookup did not return the replacement")
+	}
+	if schemes, err := SchemesFromNames([]string{"bcrypt"}); err != nil || schemes[0] != custom {
+		t.Errorf("SchemesFromNames did not return the replacement: %v", err)
+	}
+
+	var unknown *ErrUnknownScheme
+	if err := ReplaceScheme("test-missing", custom); !errors.As(err, &unknown) {
+		t.Errorf("expected ErrUnknownScheme, got %v", err)
+	}
+	if err := ReplaceScheme("bcrypt", nil); err == nil {
+		t.Errorf("nil replacement accepted")
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	custom := sha512crypt(t, 1000)
+
+	if err := RegisterScheme("sha512-crypt", custom); err == nil {
+		t.Fatalf("expected error shadowing a built-in scheme")
+	}
+	if SchemeFromName("sha512-crypt") != sha2crypt.Crypter512 {
+		t.Fatalf("built-in scheme was replaced")
+	}
+
+	if err := RegisterScheme("test-custom", custom); err != nil {
+		t.Fatalf("err registering: %v", err)
+	}
+	if err := RegisterScheme("test-custom", custom); err == nil {
+		t.Fatalf("expected error on duplicate registration")
+	}
+	if SchemeFromName("test-custom") != custom {
+		t.Fatalf("registered scheme not found")
+	}
+	if schemes, err := SchemesFromNames([]string{"test-custom", "bcrypt"}); err != nil || schemes[0] != custom {
+		t.Fatalf("registered scheme not found by SchemesFromNames: %v", err)
+	}
+
+	names := SchemeNames()
+	if !sort.StringsAreSorted(names) {
+		t.Fatalf("names are not sorted: %v", names)
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == "test-custom"
+	}
+	if !found {
+		t.Fatalf("registered scheme not in %v", names)
+	}
+}
+
+func TestSchemeFromNameE(t *testing.T) {
+	if scheme, err := SchemeFromNameE("bcrypt"); err != nil || scheme != bcrypt.Crypter {
+		t.Fatalf("unexpected result: %v, %v", scheme, err)
+	}
+
+	scheme, err := SchemeFromNameE("no-such-scheme")
+	if scheme != nil || err == nil || !strings.Contains(err.Error(), "no-such-scheme") {
+		t.Fatalf("unexpected result: %v, %v", scheme, err)
+	}
+	if e, ok := err.(*ErrUnknownScheme); !ok || e.Name != "no-such-scheme" {
+		t.Fatalf("unexpected error type: %#v", err)
+	}
+
+	if SchemeFromName("no-such-scheme") != nil {
+		t.Fatalf("SchemeFromName did not return nil")
+	}
+
+	if _, err := SchemesFromNames([]string{"bcrypt", "bad-name"}); err == nil || !strings.Contains(err.Error(), "bad-name") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPBKDF2SHA1Name(t *testing.T) {
+	if SchemeFromName("pbkdf2-sha1") != pbkdf2.SHA1Crypter || SchemeFromName("pbkdr2-sha1") != pbkdf2.SHA1Crypter {
+		t.Fatalf("pbkdf2-sha1 names do not resolve to the same scheme")
+	}
+
+	saved := DefaultSchemes
+	defer func() { DefaultSchemes = saved }()
+
+	if err := UseDefaultSchemes([]string{"pbkdf2-sha1"}); err != nil {
+		t.Fatalf("err using pbkdf2-sha1: %v", err)
+	}
+
+	if name := nameOfScheme(pbkdf2.SHA1Crypter); name != "pbkdf2-sha1" {
+		t.Fatalf("unexpected name: %q", name)
+	}
+}
+
+func TestFIPS(t *testing.T) {
+	ctx := NewFIPSContext()
+
+	h, err := ctx.Hash("password")
+	if err != nil || !strings.HasPrefix(h, "$pbkdf2-sha512$") {
+		t.Fatalf("unexpected result hashing: %q, %v", h, err)
+	}
+	if _, err := ctx.Verify("password", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+
+	bh, err := bcrypt.Crypter.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+
+	// bcrypt hashes are rejected even where a scheme supports them.
+	ctx.Schemes = append(append([]abstract.Scheme{}, DefaultSchemesFIPS...), bcrypt.Crypter)
+	_, err = ctx.Verify("password", bh)
+	if e, ok := err.(*ErrNotFIPSApproved); !ok || e.Name != "bcrypt" {
+		t.Fatalf("unexpected error verifying bcrypt hash: %v", err)
+	}
+
+	ctx.Schemes = []abstract.Scheme{bcrypt.Crypter}
+	if _, err := ctx.Hash("password"); err == nil {
+		t.Fatalf("hashed with bcrypt in FIPS mode")
+	}
+
+	if _, err := (&Context{FIPSOnly: true, Schemes: []abstract.Scheme{pbkdf2.SHA1Crypter}}).Hash("password"); err == nil {
+		t.Fatalf("hashed with pbkdf2-sha1 in FIPS mode")
+	}
+
+	// Without FIPSOnly, nothing changes.
+	if _, err := (&Context{Schemes: ctx.Schemes}).Verify("password", bh); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+}
+
+func TestVerifyShadowEntry(t *testing.T) {
+	// Generated with openssl passwd -6 and -5, as used by mkpasswd.
+	good := []string{
+		"$6$Zr3Qd8yX$CObjnz5TG.6HCqT1I2HG1TU0i.WyQ6nl9h9tArcUDt.bSGOXBDJS7Nq5Zmy0FRMqlyjvdTbftUoNiXJ5yuyB5.",
+		"$5$9jV2mPqA$e8hKF26rmbH5KLUyHBgJprdKcJ2RkVl55ei6ikXmihB",
+		"alice:$6$Zr3Qd8yX$CObjnz5TG.6HCqT1I2HG1TU0i.WyQ6nl9h9tArcUDt.bSGOXBDJS7Nq5Zmy0FRMqlyjvdTbftUoNiXJ5yuyB5.:18500:0:99999:7:::",
+		"bob:$5$9jV2mPqA$e8hKF26rmbH5KLUyHBgJprdKcJ2RkVl55ei6ikXmihB:18500::::::",
+	}
+
+	for _, entry := range good {
+		if err := VerifyShadowEntry("correcthorse", entry); err != nil {
+			t.Errorf("err verifying %q: %v", entry, err)
+		}
+		if err := VerifyShadowEntry("batterystaple", entry); !errors.Is(err, abstract.ErrPasswordMismatch) {
+			t.Errorf("unexpected error verifying %q: %v", entry, err)
+		}
+	}
+
+	for entry, expected := range map[string]error{
+		"":                     ErrNoPassword,
+		"carol::18500:0:":      ErrNoPassword,
+		"*":                    ErrAccountLocked,
+		"!!":                   ErrAccountLocked,
+		"daemon:*:18500::::::": ErrAccountLocked,
+		"dave:!$5$9jV2mPqA$e8hKF26rmbH5KLUyHBgJprdKcJ2RkVl55ei6ikXmihB:18500::::::": ErrAccountLocked,
+	} {
+		if err := VerifyShadowEntry("correcthorse", entry); err != expected {
+			t.Errorf("unexpected error verifying %q: %v", entry, err)
+		}
+	}
+
+	c := Context{Schemes: []abstract.Scheme{yescrypt.Crypter}}
+	if err := c.VerifyShadowEntry("password", "erin:$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC:19700:0:99999:7:::"); err != nil {
+		t.Errorf("err verifying yescrypt entry: %v", err)
+	}
+}
+
+func TestParseHash(t *testing.T) {
+	for _, tst := range []struct {
+		hash   string
+		scheme string
+		params map[string]string
+	}{
+		{"$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo",
+			"argon2id", map[string]string{"version": "19", "memory": "32768", "time": "4", "threads": "4"}},
+		{"$s2$16384$8$1$qa9lVfhmTE8F2Jpwya9m7uoE$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI=",
+			"scrypt-sha256", map[string]string{"N": "16384", "r": "8", "p": "1"}},
+		{"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+			"bcrypt", map[string]string{"cost": "5"}},
+		{"$pbkdf2-sha256$29000$FeKc8773HmOMcW7tHUPo/Q$Xc31n0kWSaQd7xXJkR0O5W7vHXVCLfKNdKsgiBW.aYc",
+			"pbkdf2-sha256", map[string]string{"rounds": "29000"}},
+		{"$6$Zr3Qd8yX$CObjnz5TG.6HCqT1I2HG1TU0i.WyQ6nl9h9tArcUDt.bSGOXBDJS7Nq5Zmy0FRMqlyjvdTbftUoNiXJ5yuyB5.",
+			"sha512-crypt", map[string]string{"rounds": "5000"}},
+		{"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", "md5-crypt", map[string]string{}},
+		{"$pepper$k1$$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+			"bcrypt", map[string]string{"cost": "5", "pepper": "k1"}},
+	} {
+		scheme, params, err := ParseHash(tst.hash)
+		if err != nil || scheme != tst.scheme || fmt.Sprint(params) != fmt.Sprint(tst.params) {
+			t.Errorf("unexpected result for %s: %q, %v, %v", tst.hash, scheme, params, err)
+		}
+	}
+
+	_, _, err := ParseHash("$unknown$foo$bar")
+	if e, ok := err.(*ErrUnrecognizedHash); !ok || e.Prefix != "$unknown$" || !errors.Is(err, ErrUnidentifiableHash) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, _, err := ParseHash("$argon2id$v=19$m=x"); !errors.Is(err, abstract.ErrInvalidHash) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNormalizePassword(t *testing.T) {
+	const nfc = "caf\u00e9"
+	const nfd = "cafe\u0301"
+
+	ctx := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter256}, NormalizePassword: true}
+
+	for _, pw := range []string{nfc, nfd} {
+		h, err := ctx.Hash(pw)
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+
+		for _, pw2 := range []string{nfc, nfd} {
+			if _, err := ctx.Verify(pw2, h); err != nil {
+				t.Fatalf("err verifying %q against hash of %q: %v", pw2, pw, err)
+			}
+		}
+	}
+
+	// Without normalization, the forms differ.
+	ctx.NormalizePassword = false
+	h, err := ctx.Hash(nfd)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if _, err := ctx.Verify(nfc, h); err == nil {
+		t.Fatalf("NFC password verified against NFD hash without normalization")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	ctx := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter256}}
+
+	// By default, passwords with NUL bytes are accepted.
+	h, err := ctx.Hash("pass\x00word")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if _, err := ctx.Verify("pass\x00word", h); err != nil {
+		t.Fatalf("err verifying: %v", err)
+	}
+
+	ctx.NULPolicy = RejectNUL
+	if _, err := ctx.Hash("pass\x00word"); err != ErrPasswordContainsNUL {
+		t.Fatalf("unexpected error hashing: %v", err)
+	}
+	if _, err := ctx.Verify("pass\x00word", h); err != ErrPasswordContainsNUL {
+		t.Fatalf("unexpected error verifying: %v", err)
+	}
+
+	ctx.MaxPasswordLength = 8
+	if _, err := ctx.Hash("password"); err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	_, err = ctx.Hash("password1")
+	if e, ok := err.(*ErrPasswordTooLong); !ok || e.Length != 9 || e.Max != 8 {
+		t.Fatalf("unexpected error hashing: %v", err)
+	}
+	if _, err := ctx.Verify("password1", h); err == nil {
+		t.Fatalf("verified overlong password")
+	}
+}
+
+// An endless stream of a single byte, for reproducible salts.
+type fixedReader byte
+
+func (r fixedReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestSaltReader(t *testing.T) {
+	for _, tst := range []struct {
+		scheme abstract.Scheme
+		hash   string
+	}{
+		{sha2crypt.Crypter256, "$5$rounds=10000$ecW8ecW8ecW8ecW8$fSod9pFwvDoG1pl9DUnxtkdVSw0y3AOodnyC5weStLA"},
+		{md5crypt.Crypter, "$1$ecW8ecW8$uLEVdnRXIPJ6Vo0uaWOrW/"},
+		{pbkdf2.SHA256Crypter, "$pbkdf2-sha256$29000$KioqKioqKioqKioqKioqKg$s6iXl3b/6qEjc4akcJxZIg/iLZ8PsrHWN7b9C9FaL5k"},
+		{scrypt.SHA256Crypter, "$s2$16384$8$1$KioqKioqKioqKioqKioqKioq$h/qQq/Ruj0OvbjhiSX3gh36YK+BCrSXv+tw/kgY3FZ0="},
+	} {
+		ctx := Context{Schemes: []abstract.Scheme{tst.scheme}, SaltReader: fixedReader('*')}
+
+		h1, err := ctx.Hash("password")
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+		h2, err := ctx.Hash("password")
+		if err != nil {
+			t.Fatalf("err hashing: %v", err)
+		}
+
+		if h1 != tst.hash || h2 != tst.hash {
+			t.Errorf("hashes not reproducible: %s, %s (expected %s)", h1, h2, tst.hash)
+		}
+	}
+}
+
+func TestContextJSON(t *testing.T) {
+	cost10, _ := bcrypt.NewWithCost(10)
+	ctx := Context{
+		Schemes:           []abstract.Scheme{argon2.NewID(2, 19*1024, 1, 32), cost10, pbkdf2.SHA1Crypter, md5crypt.Crypter},
+		MinVerifyDuration: 250 * time.Millisecond,
+		NULPolicy:         RejectNUL,
+		Pepper:            []byte("secret"),
+	}
+
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatalf("err marshalling: %v", err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "c2VjcmV0") {
+		t.Fatalf("pepper leaked into JSON: %s", data)
+	}
+
+	var ctx2 Context
+	if err := json.Unmarshal(data, &ctx2); err != nil {
+		t.Fatalf("err unmarshalling %s: %v", data, err)
+	}
+
+	if len(ctx2.Schemes) != len(ctx.Schemes) || ctx2.MinVerifyDuration != ctx.MinVerifyDuration ||
+		ctx2.NULPolicy != RejectNUL || ctx2.Pepper != nil {
+		t.Fatalf("unexpected result: %+v", ctx2)
+	}
+	for i := range ctx.Schemes {
+		if fmt.Sprint(ctx.Schemes[i]) != fmt.Sprint(ctx2.Schemes[i]) {
+			t.Errorf("scheme %d: got %v, expected %v", i, ctx2.Schemes[i], ctx.Schemes[i])
+		}
+	}
+
+	// Parameters can be changed through configuration.
+	err = json.Unmarshal([]byte(`{"schemes": [{"name": "bcrypt", "params": {"cost": 11}}, {"name": "sha256-crypt"}]}`), &ctx2)
+	if err != nil {
+		t.Fatalf("err unmarshalling: %v", err)
+	}
+	if fmt.Sprint(ctx2.Schemes) != "[bcrypt(11) sha256-crypt(10000)]" || ctx2.MinVerifyDuration != 0 {
+		t.Fatalf("unexpected result: %+v", ctx2)
+	}
+
+	err = json.Unmarshal([]byte(`{"schemes": [{"name": "bcrypt"}, {"name": "rot13"}]}`), &ctx2)
+	if e, ok := err.(*ErrUnknownScheme); !ok || e.Name != "rot13" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, bad := range []string{
+		`{"schemes": [{"name": "bcrypt", "params": {"cost": 99}}]}`,
+		`{"schemes": [{"name": "bcrypt", "params": {"rounds": 10}}]}`,
+		`{"schemes": [{"name": "md5-crypt", "params": {"rounds": 10}}]}`,
+		`{"nul_policy": "sometimes"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &ctx2); err == nil {
+			t.Errorf("no error unmarshalling %s", bad)
+		}
+	}
+}
+
+// Schemes survive a round trip through JSON with their behaviour intact, and
+// schemes whose configuration JSON cannot record are refused.
+func TestContextJSONFaithful(t *testing.T) {
+	scryptKey64, _ := scrypt.NewSHA256WithKeyLen(1<<10, 8, 1, 64)
+	pbkdf2Rounds, _ := pbkdf2.NewSHA512(2000)
+	argon2Salt, _ := argon2.WithSaltLength(argon2.NewID(1, 64, 1, 32), 24)
+
+	for _, scheme := range []abstract.Scheme{
+		argon2.New(1, 64, 1, 48),
+		argon2Salt,
+		bcrypt.New(5),
+		scryptKey64,
+		pbkdf2Rounds,
+		sha512crypt(t, 2000),
+		md5crypt.Crypter,
+	} {
+		// A scheme which has hashed is no different.
+		h, err := scheme.Hash("password")
+		if err != nil {
+			t.Fatalf("%v: err hashing: %v", scheme, err)
+		}
+
+		data, err := json.Marshal(Context{Schemes: []abstract.Scheme{scheme}})
+		if err != nil {
+			t.Fatalf("%v: err marshalling: %v", scheme, err)
+		}
+		var ctx Context
+		if err := json.Unmarshal(data, &ctx); err != nil {
+			t.Fatalf("%v: err unmarshalling %s: %v", scheme, data, err)
+		}
+		decoded := ctx.Schemes[0]
+
+		if err := decoded.Verify("password", h); err != nil || decoded.NeedsUpdate(h) != scheme.NeedsUpdate(h) {
+			t.Errorf("%v: decoded scheme does not accept original's hash: %v", scheme, err)
+		}
+		h2, err := decoded.Hash("password")
+		if err != nil {
+			t.Fatalf("%v: err hashing with decoded scheme: %v", scheme, err)
+		}
+		if err := scheme.Verify("password", h2); err != nil || scheme.NeedsUpdate(h2) != decoded.NeedsUpdate(h2) {
+			t.Errorf("%v: original does not accept decoded scheme's hash: %v", scheme, err)
+		}
+		if len(h2) != len(h) {
+			t.Errorf("%v: decoded scheme's hash %q differs in form from %q", scheme, h2, h)
+		}
+	}
+
+	scryptRaw, _ := scrypt.NewSHA256WithEncoding(1<<10, 8, 1, abstract.Base64RawStd)
+	scryptLegacy, _ := scrypt.NewSHA256WithLegacyFormats(1<<10, 8, 1, scrypt.LegacySimpleScrypt)
+	argon2Secret, _ := argon2.WithSecret(argon2.IDCrypter, []byte("secret"))
+	assumed, _ := argon2.NewWithAssumedType(argon2.TypeID)
+
+	for _, scheme := range []abstract.Scheme{
+		bcrypt.NewWithTruncationPolicy(bcrypt.PreHashSHA256),
+		bcrypt.NewWithTruncationPolicy(bcrypt.Reject),
+		scryptRaw,
+		scryptLegacy,
+		argon2Secret,
+		assumed,
+		WithVerifyTimeout(bcrypt.New(5), time.Second),
+	} {
+		if data, err := json.Marshal(Context{Schemes: []abstract.Scheme{scheme}}); err == nil {
+			t.Errorf("%v: encoded as %s", scheme, data)
+		}
+	}
+}
+
+// Every boolean option survives a round trip through JSON, and is reset if
+// absent.
+func TestContextJSONFlags(t *testing.T) {
+	for name, flag := range map[string]func(*Context) *bool{
+		"strict_uniform_params": func(c *Context) *bool { return &c.StrictUniformParams },
+		"normalize_encoding":    func(c *Context) *bool { return &c.NormalizeEncoding },
+		"embed_timestamp":       func(c *Context) *bool { return &c.EmbedTimestamp },
+		"keep_hash_whitespace":  func(c *Context) *bool { return &c.KeepHashWhitespace },
+	} {
+		var ctx Context
+		*flag(&ctx) = true
+
+		data, err := json.Marshal(ctx)
+		if err != nil {
+			t.Fatalf("%s: err marshalling: %v", name, err)
+		}
+		if !strings.Contains(string(data), `"`+name+`":true`) {
+			t.Errorf("%s: not encoded in %s", name, data)
+		}
+
+		var ctx2 Context
+		if err := json.Unmarshal(data, &ctx2); err != nil || !*flag(&ctx2) {
+			t.Errorf("%s: not decoded from %s, %v", name, data, err)
+		}
+
+		if err := json.Unmarshal([]byte(`{}`), &ctx2); err != nil || *flag(&ctx2) {
+			t.Errorf("%s: not reset, %v", name, err)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	base := &Context{
+		Schemes:         []abstract.Scheme{bcrypt.Crypter, sha2crypt.Crypter512},
+		Peppers:         map[string][]byte{"k1": []byte("pepper1")},
+		CurrentPepperID: "k1",
+	}
+
+	c := base.Clone()
+	cost14, _ := bcrypt.NewWithCost(14)
+	c.Schemes[0] = cost14
+	c.Schemes = append(c.Schemes, md5crypt.Crypter)
+	c.Peppers["k1"][0] = 'X'
+	c.Peppers["k2"] = []byte("pepper2")
+	c.CurrentPepperID = "k2"
+	c.FIPSOnly = true
+
+	if base.Schemes[0] != bcrypt.Crypter || len(base.Schemes) != 2 {
+		t.Fatalf("parent schemes modified: %v", base.Schemes)
+	}
+	if string(base.Peppers["k1"]) != "pepper1" || len(base.Peppers) != 1 || base.CurrentPepperID != "k1" || base.FIPSOnly {
+		t.Fatalf("parent modified: %+v", base)
+	}
+
+	if (&Context{}).Clone().Schemes != nil {
+		t.Fatalf("clone of default context does not use default schemes")
+	}
+}
+
+func TestDefaults20240101(t *testing.T) {
+	schemes, err := DefaultSchemesFromDate(Defaults20240101)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	latest, err := DefaultSchemesFromDate(DefaultsLatest)
+	if err != nil || latest[0] != schemes[0] {
+		t.Fatalf("DefaultsLatest does not select the 2024-01-01 defaults")
+	}
+
+	c := Context{Schemes: schemes}
+	h, err := c.Hash("foobar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("unexpected hash: %q", h)
+	}
+	if name, err := c.Identify(h); err != nil || name != "argon2id-20240101" {
+		t.Fatalf("identified as %q, %v", name, err)
+	}
+
+	const argon2iHash = "$argon2i$v=19$m=32768,t=4,p=4$uN6vgPBb8/liQld8lgFqew$KlvqGCHX7Cap0ohKY7YAUJsbzcnenCwvSAfhqtIA/Q0"
+	newHash, err := c.Verify("foobar", argon2iHash)
+	if err != nil {
+		t.Fatalf("err verifying argon2i hash: %v", err)
+	}
+	if !strings.HasPrefix(newHash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("argon2i hash was not upgraded: %q", newHash)
+	}
+}
+
+func TestDeprecatedSchemes(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	c := Context{
+		Schemes:           []abstract.Scheme{sha2crypt.Crypter256},
+		DeprecatedSchemes: []abstract.Scheme{md5crypt.Crypter},
+	}
+
+	h, err := c.Hash("U*U*U*U*")
+	if err != nil || !sha2crypt.Crypter256.SupportsStub(h) {
+		t.Fatalf("deprecated scheme used for hashing: %q, %v", h, err)
+	}
+
+	needsUpdate, err := c.NeedsUpdate(md5Hash)
+	if err != nil || !needsUpdate {
+		t.Fatalf("deprecated hash does not need update: %v, %v", needsUpdate, err)
+	}
+
+	if name, err := c.Identify(md5Hash); err != nil || name != "md5-crypt" {
+		t.Fatalf("unexpected identification: %q, %v", name, err)
+	}
+
+	newHash, err := c.Verify("U*U*U*U*", md5Hash)
+	if err != nil {
+		t.Fatalf("err verifying deprecated hash: %v", err)
+	}
+	if !sha2crypt.Crypter256.SupportsStub(newHash) {
+		t.Fatalf("deprecated hash was not upgraded: %q", newHash)
+	}
+
+	if _, err := c.Verify("wrong", md5Hash); err == nil {
+		t.Fatalf("wrong password verified")
+	}
+
+	// A deprecated scheme is never used for hashing, even with no others.
+	only := Context{Schemes: []abstract.Scheme{}, DeprecatedSchemes: []abstract.Scheme{md5crypt.Crypter}}
+	if _, err := only.Verify("U*U*U*U*", md5Hash); err != nil {
+		t.Fatalf("err verifying deprecated hash: %v", err)
+	}
+	if _, err := only.Hash("U*U*U*U*"); err != ErrNoHashingScheme {
+		t.Fatalf("expected ErrNoHashingScheme, got %v", err)
+	}
+}
+
+func TestHashReader(t *testing.T) {
+	c := Context{
+		Schemes:       []abstract.Scheme{sha256crypt(t, 1000)},
+		MaxSecretSize: 4096,
+	}
+
+	secret := strings.Repeat("0123456789abcdef", 256)
+	h, err := c.HashReader(strings.NewReader(secret))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := c.VerifyNoUpgrade(secret, h); err != nil {
+		t.Fatalf("hash of read secret does not verify: %v", err)
+	}
+	if _, err := c.VerifyReader(strings.NewReader(secret), h); err != nil {
+		t.Fatalf("err verifying read secret: %v", err)
+	}
+	if _, err := c.VerifyReader(strings.NewReader(secret[1:]), h); err == nil {
+		t.Fatalf("wrong secret verified")
+	}
+
+	_, err = c.HashReader(strings.NewReader(secret + "x"))
+	if e, ok := err.(*ErrSecretTooLarge); !ok || e.Max != 4096 {
+		t.Fatalf("expected *ErrSecretTooLarge, got %v", err)
+	}
+}
+
+func TestBcryptSHA512(t *testing.T) {
+	const sha256Hash = "$bcrypt-sha256$2a,05$R4VYL20Lcoz6acvvwQ1kX.$C/cKqtZJaowFuNLDLMob7GR.gk2lfOi"
+	const sha512Hash = "$bcrypt-sha512$2a,05$R4VYL20Lcoz6acvvwQ1kX.$HGjaU.5GIDYVhZ9L1OTKJsQsjp51J4W"
+
+	c := Context{Schemes: []abstract.Scheme{bcryptsha512.New(5), bcryptsha256.New(5)}}
+
+	if needsUpdate, err := c.NeedsUpdate(sha512Hash); err != nil || needsUpdate {
+		t.Fatalf("bcrypt-sha512 hash needs update: %v, %v", needsUpdate, err)
+	}
+	if needsUpdate, err := c.NeedsUpdate(sha256Hash); err != nil || !needsUpdate {
+		t.Fatalf("bcrypt-sha256 hash does not need update: %v, %v", needsUpdate, err)
+	}
+
+	newHash, err := c.Verify("password", sha256Hash)
+	if err != nil || !strings.HasPrefix(newHash, "$bcrypt-sha512$") {
+		t.Fatalf("bcrypt-sha256 hash was not upgraded: %q, %v", newHash, err)
+	}
+
+	if SchemeFromName("bcrypt-sha512") != bcryptsha512.Crypter {
+		t.Fatalf("bcrypt-sha512 is not registered")
+	}
+}
+
+// Counts calls to SupportsStub.
+type countingScheme struct {
+	abstract.Scheme
+	calls    int
+	verifies int
+}
+
+func (s *countingScheme) SupportsStub(stub string) bool {
+	s.calls++
+	return s.Scheme.SupportsStub(stub)
+}
+
+func (s *countingScheme) Verify(password, hash string) error {
+	s.verifies++
+	return s.Scheme.Verify(password, hash)
+}
+
+func TestConstantTimeIdentify(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	first := &countingScheme{Scheme: md5crypt.Crypter}
+	last := &countingScheme{Scheme: sha2crypt.Crypter512}
+	c := Context{Schemes: []abstract.Scheme{first, last}}
+
+	if _, err := c.Verify("U*U*U*U*", md5Hash); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if first.calls != 1 || last.calls != 0 {
+		t.Fatalf("unexpected calls: %d, %d", first.calls, last.calls)
+	}
+
+	c.ConstantTimeIdentify = true
+	for _, f := range []func() error{
+		func() error { _, err := c.Verify("U*U*U*U*", md5Hash); return err },
+		func() error { _, err := c.NeedsUpdate(md5Hash); return err },
+		func() error { _, err := c.Identify(md5Hash); return err },
+	} {
+		first.calls, last.calls = 0, 0
+		if err := f(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if first.calls != 1 || last.calls != 1 {
+			t.Fatalf("not every scheme was asked: %d, %d", first.calls, last.calls)
+		}
+	}
+
+	if _, err := c.Verify("password", "$unknown$"); err != abstract.ErrNoMatchingScheme {
+		t.Fatalf("expected ErrNoMatchingScheme, got %v", err)
+	}
+}
+
+func TestDescribeSchemes(t *testing.T) {
+	schemes, err := DefaultSchemesFromDate(Defaults20240101)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := Context{
+		Schemes:           append(append([]abstract.Scheme{}, schemes...), bcryptsha256.New(10), pbkdf2.DjangoSHA256Crypter),
+		DeprecatedSchemes: []abstract.Scheme{md5crypt.Crypter},
+	}
+
+	expected := []string{
+		"argon2id(t=2,m=19456,p=1)",
+		"argon2i(t=4,m=32768,p=4)",
+		"scrypt-sha256(N=16384,r=8,p=1)",
+		"sha512-crypt(rounds=10000)",
+		"sha256-crypt(rounds=10000)",
+		"bcrypt-sha256(cost=12)",
+		"pbkdf2-sha512(rounds=25000)",
+		"pbkdf2-sha256(rounds=29000)",
+		"bcrypt(cost=12)",
+		"pbkdf2-sha1(rounds=131000)",
+		"bcrypt-sha256(cost=10)",
+		"django-pbkdf2-sha256(rounds=1000000)",
+		"md5-crypt",
+	}
+
+	descriptions := c.DescribeSchemes()
+	if strings.Join(descriptions, " ") != strings.Join(expected, " ") {
+		t.Fatalf("unexpected descriptions:\n%q\nexpected:\n%q", descriptions, expected)
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	recommendations, err := RecommendWithTimings(5*time.Millisecond, 8<<20)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, name := range []string{"argon2id", "argon2", "scrypt-sha256", "bcrypt", "bcrypt-sha256"} {
+		r, ok := recommendations[name]
+		if !ok || r.Measured <= 0 {
+			t.Fatalf("no recommendation for %s", name)
+		}
+
+		h, err := r.Scheme.Hash("password")
+		if err != nil {
+			t.Fatalf("%s: err hashing: %v", name, err)
+		}
+		if SchemeFromName(name).SupportsStub(h) == false {
+			t.Fatalf("%s: recommended scheme produced %q", name, h)
+		}
+	}
+
+	if _, err := Recommend(time.Second, 1024); err == nil {
+		t.Fatalf("expected error for tiny memory budget")
+	}
+}
+
+func TestMinimumStrength(t *testing.T) {
+	weak, err := md5crypt.Crypter.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	strong, err := bcrypt.New(10).Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := Context{
+		Schemes:         []abstract.Scheme{bcrypt.New(10), sha2crypt.Crypter512, argon2.IDCrypter, md5crypt.Crypter},
+		MinimumStrength: 16,
+	}
+
+	for hash, want := range map[string]float64{
+		weak:                        math.Log2(1000),
+		strong:                      18,
+		"$6$rounds=10000$saltsalt$": math.Log2(10000) + 1,
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$": math.Log2(2*19456) + 4,
+	} {
+		got, err := c.Strength(hash)
+		if err != nil {
+			t.Fatalf("err computing strength of %q: %v", hash, err)
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("strength of %q: got %v, expected %v", hash, got, want)
+		}
+	}
+
+	if _, err := c.Verify("password", strong); err != nil {
+		t.Fatalf("err verifying strong hash: %v", err)
+	}
+
+	_, err = c.Verify("wrong", weak)
+	if !errors.Is(err, abstract.ErrPasswordMismatch) {
+		t.Fatalf("expected mismatch for wrong password, got %v", err)
+	}
+
+	newHash, err := c.Verify("password", weak)
+	var tooWeak *ErrHashTooWeak
+	if !errors.As(err, &tooWeak) || newHash != "" {
+		t.Fatalf("expected ErrHashTooWeak, got %v", err)
+	}
+	if tooWeak.Strength >= 16 || tooWeak.Minimum != 16 {
+		t.Fatalf("unexpected error: %+v", tooWeak)
+	}
+
+	c.MinimumStrength = 0
+	if _, err := c.Verify("password", weak); err != nil {
+		t.Fatalf("err verifying without minimum: %v", err)
+	}
+}
+
+func TestVerifyDispatch(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	modern := &countingScheme{Scheme: sha2crypt.Crypter512}
+	legacy := &countingScheme{Scheme: md5crypt.Crypter}
+	c := Context{
+		Schemes:           []abstract.Scheme{modern},
+		DeprecatedSchemes: []abstract.Scheme{legacy},
+	}
+
+	modernHash, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, err := c.Verify("password", modernHash); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if modern.verifies != 1 || legacy.calls != 0 || legacy.verifies != 0 {
+		t.Fatalf("legacy scheme consulted for modern hash: %+v, %+v", modern, legacy)
+	}
+
+	modern.calls, modern.verifies = 0, 0
+	if _, err := c.Verify("U*U*U*U*", md5Hash); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if modern.calls != 1 || modern.verifies != 0 || legacy.verifies != 1 {
+		t.Fatalf("unexpected calls for legacy hash: %+v, %+v", modern, legacy)
+	}
+
+	// A wrong password fails with the claiming scheme's error, without
+	// falling through to any other scheme.
+	other := &countingScheme{Scheme: sha2crypt.Crypter512}
+	c.DeprecatedSchemes = []abstract.Scheme{other}
+	if _, err := c.Verify("wrong", modernHash); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+	if other.calls != 0 || other.verifies != 0 {
+		t.Fatalf("second scheme consulted after first claimed the hash")
+	}
+}
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) OnHash(scheme string, dur time.Duration) {
+	o.events = append(o.events, "hash "+scheme)
+}
+
+func (o *recordingObserver) OnVerify(scheme string, ok bool, dur time.Duration) {
+	o.events = append(o.events, fmt.Sprintf("verify %s %v", scheme, ok))
+}
+
+func (o *recordingObserver) OnUpgrade(from, to string) {
+	o.events = append(o.events, "upgrade "+from+" "+to)
+}
+
+func TestObserver(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	o := &recordingObserver{}
+	c := Context{
+		Schemes:  []abstract.Scheme{sha2crypt.Crypter256, md5crypt.Crypter},
+		Observer: o,
+	}
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.Verify("password", h); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.Verify("wrong", h); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+	if _, err := c.Verify("U*U*U*U*", md5Hash); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.Verify("password", "$unknown$"); err != abstract.ErrNoMatchingScheme {
+		t.Fatalf("expected ErrNoMatchingScheme, got %v", err)
+	}
+
+	expected := []string{
+		"hash sha256-crypt",
+		"verify sha256-crypt true",
+		"verify sha256-crypt false",
+		"verify md5-crypt true",
+		"hash sha256-crypt",
+		"upgrade md5-crypt sha256-crypt",
+	}
+	if strings.Join(o.events, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected events: %q", o.events)
+	}
+}
+
+// Sample hashes of each built-in scheme, keyed by registered name.
+var schemeCorpus = map[string][]string{
+	"argon2":               {"$argon2i$v=19$m=32768,t=4,p=4$uN6vgPBb8/liQld8lgFqew$KlvqGCHX7Cap0ohKY7YAUJsbzcnenCwvSAfhqtIA/Q0"},
+	"argon2id":             {"$argon2id$v=19$m=32768,t=4,p=4$Z0UxSmIwaG5Ib3FFdkRzUg$eZ+shVXO8+5LPxuxD7Qo+877ultr5vkXvRZktEaDDiA"},
+	"scrypt-sha256":        {"$s2$1024$8$1$iSaMs4NXMLEAPxDXUBSb5+os$UIQzq9ZKNbTTEy0I9Ks3Fkaps9cwJB5OLRlHjbEt6Ok="},
+	"sha256-crypt":         {"$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC.", "$5$rounds=10000$saltsalt$"},
+	"sha512-crypt":         {"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/"},
+	"bcrypt":               {"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e", "$2b$05$Z17AXnnlpzddNUvnC6cZNOSwMA/8oNiKnHTHTwLlBijfucQQlHjaG", "$2y$05$/OK.fbVrR/bpIqNJ5ianF.Sa7shbm4.OzKpvFnX1pQLmQW96oUlCq"},
+	"bcrypt-sha256":        {"$bcrypt-sha256$2a,04$ZL/gMdCrNRvs4zmxX/5wAO$WvczAHuS9ldmWK6EtnFPxticgxCyfH2", "$bcrypt-sha256$v=2,t=2b,r=5$5Hg1DKFqPE8C2aflZ5vVoe$wOK1VFFtS8IGTrGa7.h5fs0u84qyPbS"},
+	"bcrypt-sha512":        {"$bcrypt-sha512$2a,04$GCJqb.ZtES/3a2tlTqKrY.$7JkMy1XzAXaAjJMhOX3FPKBXUUAzoa2"},
+	"pbkdf2-sha224":        {"$pbkdf2-sha224$1000$EkVRe2/UNM54MsO3Iqj1/w$twP3zttiBO6nLseKcdVxdDEqOTSA7GyRRcMg2g"},
+	"pbkdf2-sha256":        {"$pbkdf2-sha256$1000$4lDRhA0L/Yul5lOIFt1fCA$ocwENph876a/qZHBKEDKcDuKkSn5IgjDjNKkPqmy7fw"},
+	"pbkdf2-sha384":        {"$pbkdf2-sha384$1000$c5bMlfXqbAEmWDN7HHhzAw$ceo9VtGFKZunaH9AK6GwSj1TAFX3jGF2K40PLyuJpW20zR4ol6qzfCzZP4egDwFm"},
+	"pbkdf2-sha512":        {"$pbkdf2-sha512$1000$c.bxmQRpb32h/toxeAJJFA$N74v9Pr2B8QIb5aG8Kl/O13BIRxw1yFC.BoY9G59qsVF0RMtUzX3VcottkmipKITjXUy9gVHYaxe8njklx5q.Q"},
+	"pbkdf2-sha3-256":      {"$pbkdf2-sha3-256$1000$AAECAwQFBgcICQoLDA0ODw$iAe1hx21deBu8BIQlepAb70X5hG5R0b.YYHhHRJ8oYM"},
+	"pbkdf2-sha3-512":      {"$pbkdf2-sha3-512$1000$AAECAwQFBgcICQoLDA0ODw$3zyZnAXS/ncuOUCv/oC9DoQk2Upe.KQPMC5Ekzos6jlFqzGne6MKwTITcD/9B8uheHkAOaY8LCAvyr2F1fcY6Q"},
+	"pbkdf2-sha1":          {"$pbkdf2$1000$5jp8dB8mm1kuBMTzrH383g$BKUyW.fHX0bz1wfl7WJ1cQ6nyaY"},
+	"django-pbkdf2-sha256": {"pbkdf2_sha256$1000$7QvRkSOVOe51W2oRPYw9a2$3cD8KAjQXflEjjO2n1qVfY/1j0qMwQs1aKkZmigIuGo="},
+	"md5-crypt":            {"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"},
+	"sha1-crypt":           {"$sha1$19703$iVdJqfSE$v4qYKl1zqYThwpjJAoKX6UvlHq/a", "$sha1$480000$abcdefgh"},
+	"des-crypt":            {"abJnggxhB/yWI"},
+	"bsdi-crypt":           {"_J9..CCCC.MOp/ZbelpA", "_J9..CCCC"},
+	"phpass":               {"$P$62eM07xto6eHa08dSJgPbLinZFVEst1"},
+	"apr1":                 {"$apr1$FkJhrohe$bqA2mteQgQco/wa2eJWnU1"},
+	"nthash":               {"$nt$8846f7eaee8fb117ad06bdd830b7586c", "$3$$8846f7eaee8fb117ad06bdd830b7586c"},
+	"ldap-ssha":            {"{SSHA}ouUZQtFbhkQrfIJ43qx176Wfj4YBAgME"},
+	"ldap-sha":             {"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+	"mysql41":              {"*6C8989366EAF75BB670AD8EA7A7FC1176A95CEF4"},
+	"yescrypt":             {"$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC"},
+	"balloon":              {"$balloon$s=1024,t=3$ZXhhbXBsZXNhbHQ$cWBD3/d3tEqnuI3LqxLAeKvs+snSicW1GVlnqmNEDfs"},
+}
+
+// Returns the name of the registered scheme whose hashes in schemeCorpus the
+// named scheme supports: argon2id-20240101 is argon2id with other parameters.
+func corpusOwner(name string) string {
+	if name == "argon2id-20240101" {
+		return "argon2id"
+	}
+
+	return name
+}
+
+func TestSupportsStubMatrix(t *testing.T) {
+	for _, name := range SchemeNames() {
+		if strings.HasPrefix(name, "test-") {
+			continue
+		}
+
+		scheme := SchemeFromName(corpusOwner(name))
+		owned := false
+		for owner, hashes := range schemeCorpus {
+			mine := SchemeFromName(owner) == scheme
+			owned = owned || mine
+			for _, hash := range hashes {
+				if scheme.SupportsStub(hash) != mine {
+					t.Errorf("%s: SupportsStub(%q) = %v, but the hash is %s", name, hash, !mine, owner)
+				}
+			}
+		}
+		if !owned {
+			t.Errorf("%s: no sample hashes in schemeCorpus", name)
+		}
+
+		// Truncated identifiers are claimed by nobody.
+		for _, stub := range []string{"", " ", "\t\n", "$", "$2", "$5", "$argon2", "$argon2i", "$argon2id", "$s2", "$y", "$bcrypt-sha256", "$pbkdf2", "$pbkdf2-sha256", "$balloon", "$nt", "$3$", "{SSHA", "{SHA}", "*"} {
+			if scheme.SupportsStub(stub) {
+				t.Errorf("%s: SupportsStub(%q) = true", name, stub)
+			}
+		}
+	}
+}
+
+func TestAnalyzeHash(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter}}
+
+	info, err := c.AnalyzeHash(md5Hash)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Scheme != "md5-crypt" || !info.NeedsUpdate || info.Target != "sha512-crypt" {
+		t.Fatalf("unexpected analysis of md5-crypt hash: %+v", info)
+	}
+
+	md5 := &countingScheme{Scheme: md5crypt.Crypter}
+	counted := Context{Schemes: []abstract.Scheme{md5}}
+	if _, err := counted.AnalyzeHash(md5Hash); err != nil || md5.verifies != 0 {
+		t.Fatalf("AnalyzeHash verified the hash: %v", err)
+	}
+
+	h, err := sha512crypt(t, 5000).Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	info, err = c.AnalyzeHash(h)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Scheme != "sha512-crypt" || info.Params["rounds"] != "5000" || !info.NeedsUpdate {
+		t.Fatalf("unexpected analysis of weak sha512-crypt hash: %+v", info)
+	}
+
+	c.Schemes[0] = sha512crypt(t, 5000)
+	if info, err = c.AnalyzeHash(h); err != nil || info.NeedsUpdate {
+		t.Fatalf("hash with configured rounds needs update: %+v, %v", info, err)
+	}
+
+	if _, err := c.AnalyzeHash("$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e"); err != ErrUnidentifiableHash {
+		t.Fatalf("expected ErrUnidentifiableHash, got %v", err)
+	}
+}
+
+func TestVerifyWithScheme(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter}}
+
+	if name, err := c.VerifyWithScheme("U*U*U*U*", md5Hash); err != nil || name != "md5-crypt" {
+		t.Fatalf("unexpected result: %q, %v", name, err)
+	}
+
+	if name, err := c.VerifyWithScheme("wrong", md5Hash); err != abstract.ErrInvalidPassword || name != "md5-crypt" {
+		t.Fatalf("unexpected result for wrong password: %q, %v", name, err)
+	}
+
+	for _, h := range []string{
+		"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+		"$6$rounds=x$salt$hash",
+	} {
+		if name, err := c.VerifyWithScheme("U*U*U*U*", h); err != abstract.ErrNoMatchingScheme || name != "" {
+			t.Fatalf("unexpected result for %q: %q, %v", h, name, err)
+		}
+	}
+}
+
+func TestPasswordPolicyHook(t *testing.T) {
+	errTooShort := fmt.Errorf("password too short")
+
+	var seen []string
+	ctx := Context{
+		Schemes:           []abstract.Scheme{sha2crypt.Crypter256},
+		NormalizePassword: true,
+		PasswordPolicy: func(password string) error {
+			seen = append(seen, password)
+			if len(password) < 8 {
+				return errTooShort
+			}
+			return nil
+		},
+	}
+
+	if _, err := ctx.Hash("short"); err != errTooShort {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if _, err := ctx.HashBytes([]byte("short")); err != errTooShort {
+		t.Fatalf("expected policy error from HashBytes, got %v", err)
+	}
+
+	// The policy sees the password before normalization.
+	const decomposed = "cafe\u0301 au lait"
+	h, err := ctx.Hash(decomposed)
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if seen[len(seen)-1] != decomposed {
+		t.Fatalf("policy saw normalized password %q", seen[len(seen)-1])
+	}
+
+	// Verification does not apply the policy.
+	n := len(seen)
+	if _, err := ctx.Verify("short", h); err != abstract.ErrInvalidPassword || len(seen) != n {
+		t.Fatalf("policy applied on verify: %v", err)
+	}
+
+	// A password set before the policy still has its deprecated hash
+	// upgraded.
+	old, err := md5crypt.Crypter.Hash("short")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	ctx.DeprecatedSchemes = []abstract.Scheme{md5crypt.Crypter}
+	newHash, upgraded, err := ctx.VerifyAndUpgrade("short", old)
+	if err != nil || !upgraded || !strings.HasPrefix(newHash, "$5$") || len(seen) != n {
+		t.Fatalf("policy-failing password not upgraded: %q, %v, %v", newHash, upgraded, err)
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	for _, names := range [][]string{nil, {}} {
+		if ctx, err := NewContext(names); err != ErrNoHashingScheme || ctx != nil {
+			t.Fatalf("expected ErrNoHashingScheme for %v, got %v", names, err)
+		}
+	}
+
+	ctx, err := NewContext([]string{"sha512-crypt", "no-such-scheme"})
+	if e, ok := err.(*ErrUnknownScheme); !ok || e.Name != "no-such-scheme" || ctx != nil {
+		t.Fatalf("expected *ErrUnknownScheme, got %v", err)
+	}
+
+	ctx, err = NewContext([]string{"sha512-crypt", "md5-crypt"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(ctx.Schemes) != 2 || ctx.Schemes[0] != sha2crypt.Crypter512 || ctx.Schemes[1] != md5crypt.Crypter {
+		t.Fatalf("unexpected schemes: %v", ctx.Schemes)
+	}
+
+	ctx, err = NewContext([]string{"md5-crypt", "sha512-crypt"})
+	if e, ok := err.(*ErrLegacyScheme); !ok || e.Name != "md5-crypt" {
+		t.Fatalf("expected *ErrLegacyScheme, got %v", err)
+	}
+	if ctx == nil || ctx.Schemes[0] != md5crypt.Crypter {
+		t.Fatalf("no usable context returned with warning")
+	}
+}
+
+func TestVerifyDeferringUpgrade(t *testing.T) {
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+
+	obs := &recordingObserver{}
+	c := Context{
+		Schemes:  []abstract.Scheme{sha512crypt(t, 5000), md5crypt.Crypter},
+		Observer: obs,
+	}
+
+	if nu, err := c.VerifyDeferringUpgrade("U*U*U*U*", md5Hash); err != nil || !nu {
+		t.Fatalf("hash from non-preferred scheme not reported: %v, %v", nu, err)
+	}
+	if len(obs.events) != 1 || obs.events[0] != "verify md5-crypt true" {
+		t.Fatalf("VerifyDeferringUpgrade rehashed the password: %v", obs.events)
+	}
+
+	if nu, err := c.VerifyDeferringUpgrade("wrong", md5Hash); err != abstract.ErrInvalidPassword || nu {
+		t.Fatalf("unexpected result for wrong password: %v, %v", nu, err)
+	}
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if nu, err := c.VerifyDeferringUpgrade("password", h); err != nil || nu {
+		t.Fatalf("current hash reported as needing update: %v, %v", nu, err)
+	}
+
+	// The result agrees with NeedsUpdate.
+	for _, hash := range []string{md5Hash, h} {
+		want, err := c.NeedsUpdate(hash)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		password := "password"
+		if hash == md5Hash {
+			password = "U*U*U*U*"
+		}
+		if got, _ := c.VerifyDeferringUpgrade(password, hash); got != want {
+			t.Fatalf("VerifyDeferringUpgrade reported %v, NeedsUpdate %v", got, want)
+		}
+	}
+}
+
+func TestNeedsUpdateParams(t *testing.T) {
+	scryptBase, err := scrypt.NewSHA256(1024, 4, 2)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+	pbkdf2Base, err := pbkdf2.NewSHA256(1000)
+	if err != nil {
+		t.Fatalf("err creating scheme: %v", err)
+	}
+
+	// Each entry gives a parameter's value below, equal to and above the
+	// target; an empty value is skipped.
+	for _, tst := range []struct {
+		scheme              abstract.Scheme
+		param               string
+		below, equal, above string
+	}{
+		{bcrypt.New(5), "cost", "4", "5", "6"},
+		{bcryptsha256.New(5), "cost", "4", "5", "6"},
+		{argon2.New(2, 64, 2, 32), "time", "1", "2", "3"},
+		{argon2.New(2, 64, 2, 32), "memory", "32", "64", "128"},
+		{argon2.New(2, 64, 2, 32), "threads", "1", "2", "3"},
+		{argon2.New(2, 64, 2, 32), "key_length", "16", "32", "48"},
+		{argon2.New(2, 64, 2, 32), "salt_length", "8", "16", "24"},
+		{argon2.New(2, 64, 2, 32), "version", "16", "19", ""},
+		{scryptBase, "N", "512", "1024", "2048"},
+		{scryptBase, "r", "2", "4", "8"},
+		{scryptBase, "p", "1", "2", "3"},
+		{scryptBase, "key_length", "16", "32", "48"},
+		{pbkdf2Base, "rounds", "500", "1000", "2000"},
+		{pbkdf2.NewDjangoSHA256(1000), "rounds", "500", "1000", "2000"},
+		{sha512crypt(t, 2000), "rounds", "1000", "2000", "3000"},
+	} {
+		ps := tst.scheme.(abstract.ParamScheme)
+		target, err := ps.WithParams(map[string]string{tst.param: tst.equal})
+		if err != nil {
+			t.Fatalf("%v %s: err creating target: %v", tst.scheme, tst.param, err)
+		}
+
+		for _, c := range []struct {
+			value       string
+			needsUpdate bool
+		}{
+			{tst.below, true},
+			{tst.equal, false},
+			{tst.above, false},
+		} {
+			if c.value == "" {
+				continue
+			}
+
+			s, err := ps.WithParams(map[string]string{tst.param: c.value})
+			if err != nil {
+				t.Fatalf("%v %s=%s: err creating scheme: %v", tst.scheme, tst.param, c.value, err)
+			}
+
+			h, err := s.Hash("password")
+			if err != nil {
+				t.Fatalf("%v %s=%s: err hashing: %v", tst.scheme, tst.param, c.value, err)
+			}
+
+			if target.NeedsUpdate(h) != c.needsUpdate {
+				t.Errorf("%v %s=%s: NeedsUpdate(%q) should be %v", tst.scheme, tst.param, c.value, h, c.needsUpdate)
+			}
+		}
+	}
+}
+
+func TestSchemeIDs(t *testing.T) {
+	var all []abstract.Scheme
+	for _, name := range SchemeNames() {
+		if strings.HasPrefix(name, "test-") || name == "pbkdr2-sha1" {
+			continue
+		}
+		if name == "argon2id-20240101" {
+			if _, ok := schemeIDs[name]; ok {
+				t.Errorf("%s: has an identifier of its own", name)
+			}
+			continue
+		}
+		if _, ok := schemeIDs[name]; !ok {
+			t.Errorf("%s: no stable identifier", name)
+		}
+		all = append(all, SchemeFromName(name))
+	}
+
+	c := Context{Schemes: all}
+	for owner, hashes := range schemeCorpus {
+		for _, hash := range hashes {
+			id, err := c.SchemeIDFor(hash)
+			if err != nil || schemesByID[id] != SchemeFromName(owner) {
+				t.Errorf("%s: SchemeIDFor(%q) = %d, %v", owner, hash, id, err)
+			}
+		}
+	}
+
+	if _, err := c.SchemeIDFor("$unknown$"); err != abstract.ErrNoMatchingScheme {
+		t.Errorf("unexpected error for unknown hash: %v", err)
+	}
+
+	custom := &countingScheme{Scheme: sha2crypt.Crypter512}
+	c = Context{Schemes: []abstract.Scheme{custom}}
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	if id, err := c.SchemeIDFor(h); err != nil || id != 5 {
+		t.Errorf("unexpected identifier for sha512-crypt hash: %d, %v", id, err)
+	}
+}
+
+func TestVerifyByID(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter}}
+
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err hashing: %v", err)
+	}
+	id, err := c.SchemeIDFor(h)
+	if err != nil {
+		t.Fatalf("err identifying: %v", err)
+	}
+
+	if newHash, err := c.VerifyByID(id, "password", h); err != nil || newHash != "" {
+		t.Errorf("unexpected result verifying: %q, %v", newHash, err)
+	}
+	if _, err := c.VerifyByID(id, "wrong", h); err != abstract.ErrInvalidPassword {
+		t.Errorf("unexpected error for wrong password: %v", err)
+	}
+
+	// A mismatched or unknown identifier is rejected, as is a scheme the
+	// context does not list.
+	for _, bad := range []byte{0, schemeIDs["md5-crypt"], 255} {
+		if _, err := c.VerifyByID(bad, "password", h); err != abstract.ErrNoMatchingScheme {
+			t.Errorf("unexpected error for identifier %d: %v", bad, err)
+		}
+	}
+
+	const bcryptHash = "$2a$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu"
+	if _, err := c.VerifyByID(schemeIDs["bcrypt"], "password", bcryptHash); err != abstract.ErrNoMatchingScheme {
+		t.Errorf("unexpected error for unlisted scheme: %v", err)
+	}
+
+	// Hashes made by legacy schemes are upgraded as by Verify.
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+	newHash, err := c.VerifyByID(schemeIDs["md5-crypt"], "U*U*U*U*", md5Hash)
+	if err != nil || !strings.HasPrefix(newHash, "$6$") {
+		t.Errorf("unexpected result verifying md5-crypt hash: %q, %v", newHash, err)
+	}
+}
+
+func TestNoPasswordSet(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha2crypt.Crypter512, md5crypt.Crypter, descrypt.Crypter}}
+
+	for _, hash := range []string{"", " ", "\t\r\n "} {
+		if _, err := c.Verify("", hash); err != ErrNoPasswordSet {
+			t.Errorf("Verify(%q): unexpected error %v", hash, err)
+		}
+		if name, err := c.VerifyWithScheme("password", hash); err != ErrNoPasswordSet || name != "" {
+			t.Errorf("VerifyWithScheme(%q): unexpected result %q, %v", hash, name, err)
+		}
+		if _, err := c.VerifyByID(schemeIDs["sha512-crypt"], "password", hash); err != ErrNoPasswordSet {
+			t.Errorf("VerifyByID(%q): unexpected error %v", hash, err)
+		}
+	}
+
+	if _, err := c.Verify("password", "$"); err != abstract.ErrNoMatchingScheme {
+		t.Errorf("unexpected error for %q: %v", "$", err)
+	}
+}
+
+// Hashes whose parameters would need absurd amounts of memory, or whose
+// salts are absurdly long, and others which once made schemes panic.
+var absurdHashes = []string{
+	"$5$00000000000000000",
+	"$argon2i$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+	"$argon2id$v=19$m=4194304,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+	"$argon2id$v=19$m=65536,t=1,p=256$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+	"$argon2id$v=19$m=64,t=1,p=1$" + strings.Repeat("A", 2000) + "$aGFzaGhhc2hoYXNoaGFzaA",
+	"$s2$1073741824$8$1$iSaMs4NXMLEAPxDXUBSb5+os$UIQzq9ZKNbTTEy0I9Ks3Fkaps9cwJB5OLRlHjbEt6Ok=",
+	"$s2$2$1$1073741823$iSaMs4NXMLEAPxDXUBSb5+os$UIQzq9ZKNbTTEy0I9Ks3Fkaps9cwJB5OLRlHjbEt6Ok=",
+	"$s2$1024$8$1$iSaMs4NXMLEAPxDXUBSb5+os$" + strings.Repeat("A", 4000),
+	"$balloon$s=1099511627776,t=1$c2FsdHNhbHQ$" + strings.Repeat("A", 43),
+	"$pbkdf2-sha256$1000$" + strings.Repeat("A", 2000) + "$" + strings.Repeat("A", 43),
+}
+
+func allBuiltinSchemes() []abstract.Scheme {
+	var all []abstract.Scheme
+	for _, s := range schemesByID {
+		if s != nil {
+			all = append(all, s)
+		}
+	}
+	return all
+}
+
+func TestAbsurdParameters(t *testing.T) {
+	c := Context{Schemes: allBuiltinSchemes()}
+
+	for _, h := range absurdHashes {
+		if _, err := c.Verify("password", h); !errors.Is(err, abstract.ErrInvalidHash) {
+			t.Errorf("%.60s: expected ErrInvalidHash, got %v", h, err)
+		}
+		if _, err := c.Strength(h); !errors.Is(err, abstract.ErrInvalidHash) {
+			t.Errorf("%.60s: Strength: expected ErrInvalidHash, got %v", h, err)
+		}
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	c := Context{Schemes: allBuiltinSchemes()}
+
+	for _, hashes := range schemeCorpus {
+		for _, h := range hashes {
+			f.Add("password", h)
+		}
+	}
+	for _, h := range absurdHashes {
+		f.Add("password", h)
+	}
+
+	f.Fuzz(func(t *testing.T, password, hash string) {
+		// Hashes with sane but costly parameters are valid, and verifying
+		// them would only slow the fuzzer down.
+		if s, err := c.Strength(hash); err == nil && s > 20 {
+			t.Skip()
+		}
+
+		c.Verify(password, hash)
+		c.NeedsUpdate(hash)
+		c.AnalyzeHash(hash)
+	})
+}
+
+func TestMatchesAny(t *testing.T) {
+	c := Context{
+		Schemes:           []abstract.Scheme{sha512crypt(t, 1000)},
+		DeprecatedSchemes: []abstract.Scheme{md5crypt.Crypter},
+	}
+
+	h, err := c.Hash("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const md5Hash = "$1$dXc3I7Rw$ctlgjDdWJLMT.qwHsWhXR1"
+	history := []string{md5Hash, h}
+
+	for _, password := range []string{"current", "U*U*U*U*"} {
+		if matched, err := c.MatchesAny(password, history); err != nil || !matched {
+			t.Fatalf("%q: expected a match, got %v, %v", password, matched, err)
+		}
+	}
+
+	if matched, err := c.MatchesAny("new", history); err != nil || matched {
+		t.Fatalf("expected no match, got %v, %v", matched, err)
+	}
+
+	if matched, err := c.MatchesAny("new", nil); err != nil || matched {
+		t.Fatalf("expected no match for empty history, got %v, %v", matched, err)
+	}
+
+	// Malformed entries are skipped and reported.
+	history = append([]string{"garbage"}, history...)
+	if matched, err := c.MatchesAny("current", history); err != nil || !matched {
+		t.Fatalf("expected a match, got %v, %v", matched, err)
+	}
+	matched, err := c.MatchesAny("new", history)
+	var e *ErrNoHashMatched
+	if matched || !errors.As(err, &e) || e.Errs[0] != abstract.ErrNoMatchingScheme {
+		t.Fatalf("expected *ErrNoHashMatched, got %v, %v", matched, err)
+	}
+
+	// Old entries which today's checks reject still count as reused.
+	weak, err := bcrypt.New(bcrypt.MinimumCost).Hash("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = Context{
+		Schemes:         []abstract.Scheme{bcrypt.New(12)},
+		MinimumStrength: 30,
+	}
+	if _, err := c.Verify("old", weak); err == nil {
+		t.Fatalf("weak hash passed MinimumStrength")
+	}
+	if matched, err := c.MatchesAny("old", []string{weak}); err != nil || !matched {
+		t.Fatalf("weak hash: expected a match, got %v, %v", matched, err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{bcrypt.New(5)}, StrictUniformParams: true}
+	if _, err := c.Verify("old", weak); err == nil {
+		t.Fatalf("hash with old parameters passed StrictUniformParams")
+	}
+	if matched, err := c.MatchesAny("old", []string{weak}); err != nil || !matched {
+		t.Fatalf("hash with old parameters: expected a match, got %v, %v", matched, err)
+	}
+}
+
+func TestStrictUniformParams(t *testing.T) {
+	configured := argon2.NewID(1, 64, 1, 32)
+	cheap := argon2.NewID(1, 16, 1, 32)
+	s, err := scrypt.NewSHA256(1<<4, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Context{Schemes: []abstract.Scheme{configured, s}, StrictUniformParams: true}
+	good, err := c.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := cheap.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Verify("password", good); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if newHash, err := c.Verify("password", other); err != nil || newHash == "" {
+		t.Fatalf("expected an upgrade, got %q, %v", newHash, err)
+	}
+
+	// Mismatched parameters are rejected whether or not the password is right.
+	for _, password := range []string{"password", "wrong"} {
+		if _, err := c.Verify(password, bad); !errors.Is(err, ErrParameterMismatch) {
+			t.Fatalf("expected ErrParameterMismatch, got %v", err)
+		}
+	}
+
+	c.StrictUniformParams = false
+	if newHash, err := c.Verify("password", bad); err != nil || newHash == "" {
+		t.Fatalf("expected an upgrade, got %q, %v", newHash, err)
+	}
+}
+
+func TestHashBinary(t *testing.T) {
+	var corpus []string
+	for _, hashes := range schemeCorpus {
+		corpus = append(corpus, hashes...)
+	}
+	for _, scheme := range allBuiltinSchemes() {
+		if h, err := scheme.Hash("password"); err == nil {
+			corpus = append(corpus, h)
+		}
+	}
+
+	var textSize, binarySize int
+	for _, h := range corpus {
+		b, err := EncodeHashBinary(h)
+		if err != nil {
+			t.Fatalf("%q: %v", h, err)
+		}
+		if h2, err := DecodeHashBinary(b); err != nil || h2 != h {
+			t.Fatalf("%q: round trip gave %q, %v", h, h2, err)
+		}
+		textSize += len(h)
+		binarySize += len(b)
+	}
+	if binarySize >= textSize*7/8 {
+		t.Errorf("binary encoding takes %d bytes, against %d for text", binarySize, textSize)
+	}
+
+	if _, err := EncodeHashBinary("garbage"); err != ErrNoSchemeID {
+		t.Fatalf("expected ErrNoSchemeID, got %v", err)
+	}
+
+	b, _ := EncodeHashBinary(schemeCorpus["md5-crypt"][0])
+	for i := range b {
+		if _, err := DecodeHashBinary(b[:i]); err != ErrInvalidBinaryHash {
+			t.Fatalf("truncated to %d bytes: expected ErrInvalidBinaryHash, got %v", i, err)
+		}
+	}
+	b[0] = 0
+	if _, err := DecodeHashBinary(b); err != ErrInvalidBinaryHash {
+		t.Fatalf("expected ErrInvalidBinaryHash, got %v", err)
+	}
+}
+
+func TestHashWithScheme(t *testing.T) {
+	schemes, err := SchemesFromNames([]string{"argon2id", "pbkdf2-sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Context{Schemes: schemes}
+
+	for _, name := range []string{"pbkdf2-sha256", "argon2id"} {
+		h, err := c.HashWithScheme(name, "password")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if id, err := c.Identify(h); err != nil || id != name {
+			t.Fatalf("%s: hash identified as %q, %v", name, id, err)
+		}
+		if err := c.VerifyNoUpgrade("password", h); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := c.VerifyNoUpgrade("wrong", h); err != abstract.ErrPasswordMismatch {
+			t.Fatalf("%s: expected ErrPasswordMismatch, got %v", name, err)
+		}
+	}
+
+	// Unregistered schemes are named by their String.
+	custom, err := pbkdf2.NewSHA512(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Schemes = append(c.Schemes, custom)
+	name := fmt.Sprint(custom)
+	if h, err := c.HashWithScheme(name, "password"); err != nil || !strings.HasPrefix(h, "$pbkdf2-sha512$1000$") {
+		t.Fatalf("%s: unexpected result %q, %v", name, h, err)
+	}
+
+	var e *ErrSchemeNotInContext
+	for _, name := range []string{"bcrypt", ""} {
+		if _, err := c.HashWithScheme(name, "password"); !errors.As(err, &e) || e.Name != name {
+			t.Fatalf("%q: expected *ErrSchemeNotInContext, got %v", name, err)
+		}
+	}
+}
+
+func TestPreferredCost(t *testing.T) {
+	s, err := scrypt.NewSHA256(1<<15, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		scheme abstract.Scheme
+		want   Cost
+	}{
+		{argon2.NewID(2, 19456, 1, 32), Cost{"argon2id(19,19456,2,1)", abstract.Cost{
+			Memory: 19456 * 1024, Threads: 1, Time: map[string]uint64{"time": 2, "memory": 19456}, Strength: math.Log2(2*19456) + 4,
+		}}},
+		{argon2.New(3, 65536, 4, 32), Cost{"argon2(19,65536,3,4)", abstract.Cost{
+			Memory: 64 << 20, Threads: 4, Time: map[string]uint64{"time": 3, "memory": 65536}, Strength: math.Log2(3*65536) + 4,
+		}}},
+		{s, Cost{"scrypt-sha256(32768,8,1)", abstract.Cost{
+			Memory: 128 * 8 * (1<<15 + 3), Threads: 1, Time: map[string]uint64{"N": 1 << 15, "r": 8, "p": 1}, Strength: 19,
+		}}},
+		{bcrypt.New(12), Cost{"bcrypt(12)", abstract.Cost{
+			Memory: 4168, Threads: 1, Time: map[string]uint64{"cost": 12}, Strength: 20,
+		}}},
+	} {
+		c := Context{Schemes: []abstract.Scheme{v.scheme}}
+		cost, err := c.PreferredCost()
+		if err != nil || !reflect.DeepEqual(cost, v.want) {
+			t.Errorf("%v: got %+v, %v, expected %+v", v.scheme, cost, err, v.want)
+		}
+	}
+
+	c := Context{Schemes: []abstract.Scheme{md5crypt.Crypter}}
+	if _, err := c.PreferredCost(); err != ErrCostUnknown {
+		t.Fatalf("expected ErrCostUnknown, got %v", err)
+	}
+	c.Schemes = []abstract.Scheme{}
+	if _, err := c.PreferredCost(); err != ErrNoHashingScheme {
+		t.Fatalf("expected ErrNoHashingScheme, got %v", err)
+	}
+
+	// Estimates agree with the strength of the hashes the schemes make.
+	for _, scheme := range allBuiltinSchemes() {
+		coster, ok := scheme.(abstract.Coster)
+		if !ok {
+			continue
+		}
+		h, err := scheme.Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err := strength(scheme, h); err != nil || s != coster.EstimateCost().Strength {
+			t.Errorf("%v: estimated strength %v, but hash has %v, %v", scheme, coster.EstimateCost().Strength, s, err)
+		}
+	}
+}
+
+func TestWithVerifyTimeout(t *testing.T) {
+	s := WithVerifyTimeout(bcrypt.New(bcrypt.MinimumCost), 50*time.Millisecond)
+	h, err := s.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify("password", h); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Verify("wrong", h); err != abstract.ErrPasswordMismatch {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+
+	// The same hash at cost 16 takes seconds to verify.
+	costly := h[:4] + "16" + h[6:]
+	start := time.Now()
+	if err := s.Verify("password", costly); err != ErrVerifyTimeout {
+		t.Fatalf("expected ErrVerifyTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timed out after %v", elapsed)
+	}
+
+	c := Context{Schemes: []abstract.Scheme{s}}
+	if _, err := c.Verify("password", costly); err != ErrVerifyTimeout {
+		t.Fatalf("expected ErrVerifyTimeout from the context, got %v", err)
+	}
+	if name, err := c.Identify(h); err != nil || name != "bcrypt(4)" {
+		t.Fatalf("identified as %q, %v", name, err)
+	}
+	if strength, err := c.Strength(costly); err != nil || strength != 24 {
+		t.Fatalf("unexpected strength %v, %v", strength, err)
+	}
+}
+
+func TestWithVerifyTimeoutPassthrough(t *testing.T) {
+	s := WithVerifyTimeout(bcrypt.New(bcrypt.MinimumCost), 50*time.Millisecond)
+	h, err := s.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	costly := h[:4] + "16" + h[6:]
+
+	bs := s.(abstract.ByteScheme)
+	if err := bs.VerifyBytes([]byte("password"), h); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bs.VerifyBytes([]byte("password"), costly); err != ErrVerifyTimeout {
+		t.Fatalf("expected ErrVerifyTimeout from VerifyBytes, got %v", err)
+	}
+
+	// bcrypt cannot be given a salt, so neither can the wrapper.
+	if _, ok := s.(abstract.SaltReaderScheme); ok {
+		t.Fatalf("wrapper claims to read salts for bcrypt")
+	}
+	c := Context{Schemes: []abstract.Scheme{s}}
+	if _, err := c.HashWithSalt("password", []byte("salt")); err != ErrSaltNotSupported {
+		t.Fatalf("expected ErrSaltNotSupported, got %v", err)
+	}
+
+	c.Schemes = []abstract.Scheme{WithVerifyTimeout(pbkdf2.SHA256Crypter, time.Second)}
+	salt := []byte("0123456789abcdef")[:pbkdf2.SaltLength]
+	h1, err := c.HashWithSalt("password", salt)
+	if err != nil {
+		t.Fatalf("err hashing with salt: %v", err)
+	}
+	if h2, err := c.HashWithSalt("password", salt); err != nil || h2 != h1 {
+		t.Fatalf("hashes with the same salt differ: %q, %q, %v", h1, h2, err)
+	}
+}
+
+func TestHashParts(t *testing.T) {
+	for _, name := range []string{"argon2id", "bcrypt", "scrypt-sha256", "pbkdf2-sha256"} {
+		schemes, err := SchemesFromNames([]string{name, "md5-crypt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pepper := range [][]byte{nil, []byte("pepper")} {
+			c := Context{Schemes: schemes, Pepper: pepper}
+			scheme, salt, digest, params, err := c.HashParts("password")
+			if err != nil || scheme != name || len(salt) == 0 || len(digest) == 0 {
+				t.Fatalf("%s: unexpected parts %q, %x, %x, %v, %v", name, scheme, salt, digest, params, err)
+			}
+			if _, ok := params["pepper"]; ok != (pepper != nil) {
+				t.Fatalf("%s: unexpected params %v", name, params)
+			}
+
+			if needsUpdate, err := c.VerifyParts("password", scheme, salt, digest, params); err != nil || needsUpdate {
+				t.Fatalf("%s: %v, %v", name, needsUpdate, err)
+			}
+			if _, err := c.VerifyParts("wrong", scheme, salt, digest, params); err != abstract.ErrPasswordMismatch {
+				t.Fatalf("%s: expected ErrPasswordMismatch, got %v", name, err)
+			}
+
+			// Once the preferred scheme changes, the parts need updating.
+			c.Schemes = []abstract.Scheme{schemes[1], schemes[0]}
+			if needsUpdate, err := c.VerifyParts("password", scheme, salt, digest, params); err != nil || !needsUpdate {
+				t.Fatalf("%s: %v, %v", name, needsUpdate, err)
+			}
+		}
+	}
+
+	c := Context{Schemes: []abstract.Scheme{md5crypt.Crypter}}
+	if _, _, _, _, err := c.HashParts("password"); err != ErrNotSplittable {
+		t.Fatalf("expected ErrNotSplittable, got %v", err)
+	}
+	if _, err := c.VerifyParts("password", "md5-crypt", []byte("salt"), []byte("digest"), nil); err != ErrNotSplittable {
+		t.Fatalf("expected ErrNotSplittable, got %v", err)
+	}
+	var e *ErrSchemeNotInContext
+	if _, err := c.VerifyParts("password", "bcrypt", []byte("salt"), []byte("digest"), nil); !errors.As(err, &e) {
+		t.Fatalf("expected *ErrSchemeNotInContext, got %v", err)
+	}
+
+	// Splitting and joining reproduces canonical hashes exactly.
+	for _, scheme := range allBuiltinSchemes() {
+		s, ok := scheme.(abstract.Splittable)
+		if !ok {
+			continue
+		}
+		h, err := scheme.Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		salt, digest, params, err := s.SplitHash(h)
+		if err != nil {
+			t.Fatalf("%v: %v", scheme, err)
+		}
+		if h2, err := s.JoinHash(salt, digest, params); err != nil || h2 != h {
+			t.Fatalf("%v: rejoined %q as %q, %v", scheme, h, h2, err)
+		}
+		if _, _, _, err := s.SplitHash("garbage"); !errors.Is(err, abstract.ErrInvalidHash) {
+			t.Fatalf("%v: expected ErrInvalidHash, got %v", scheme, err)
+		}
+		delete(params, "p")
+		delete(params, "cost")
+		delete(params, "rounds")
+		delete(params, "threads")
+		if _, err := s.JoinHash(salt, digest, params); err == nil {
+			t.Fatalf("%v: joined with missing parameters", scheme)
+		}
+	}
+}
+
+func TestDetectNesting(t *testing.T) {
+	bh, err := bcrypt.New(bcrypt.MinimumCost).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bcrypt hash mistakenly used as an argon2id salt.
+	a, err := argon2.WithSaltLength(argon2.NewID(1, 64, 1, 32), len(bh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := a.(abstract.SaltReaderScheme).HashWithSaltReader([]byte("password"), strings.NewReader(bh))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []string{
+		nested,
+		"$argon2id$v=19$m=64,t=1,p=1$" + bh,
+		base64.StdEncoding.EncodeToString([]byte(bh)),
+		hex.EncodeToString([]byte(bh)) + "\n",
+	} {
+		if ok, inner := DetectNesting(h); !ok || inner != "bcrypt" {
+			t.Errorf("%q: got %v, %q", h, ok, inner)
+		}
+	}
+
+	// Ordinary hashes are not nested.
+	var corpus []string
+	for _, hashes := range schemeCorpus {
+		corpus = append(corpus, hashes...)
+	}
+	for _, scheme := range allBuiltinSchemes() {
+		if h, err := scheme.Hash("password"); err == nil {
+			corpus = append(corpus, h)
+		}
+	}
+	for _, h := range append(corpus, "", "garbage") {
+		if ok, inner := DetectNesting(h); ok {
+			t.Errorf("%q: detected %q", h, inner)
+		}
+	}
+}
+
+func TestPreferredScheme(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{md5crypt.Crypter, bcrypt.Crypter}}
+	if s, err := c.PreferredScheme(); err != nil || s != md5crypt.Crypter {
+		t.Fatalf("unexpected result %v, %v", s, err)
+	}
+
+	c.Schemes = nil
+	if s, err := c.PreferredScheme(); err != nil || s != DefaultSchemes[0] {
+		t.Fatalf("unexpected result %v, %v", s, err)
+	}
+
+	c.Schemes = []abstract.Scheme{}
+	if s, err := c.PreferredScheme(); err != ErrNoHashingScheme || s != nil {
+		t.Fatalf("expected ErrNoHashingScheme, got %v, %v", s, err)
+	}
+}
+
+func TestValidateDeployment(t *testing.T) {
+	threads := runtime.NumCPU() + 1
+	if threads > math.MaxUint8 {
+		t.Skip("too many CPUs to exceed with argon2's thread count")
+	}
+
+	wide := argon2.NewID(1, 64, uint8(threads), 32)
+	c := Context{Schemes: []abstract.Scheme{wide, argon2.NewID(1, 64, 1, 32), bcrypt.New(4), md5crypt.Crypter}}
+
+	diagnostics := c.ValidateDeployment()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic, got %v", diagnostics)
+	}
+
+	var e *ErrExcessParallelism
+	if !errors.As(diagnostics[0], &e) || e.Threads != threads || e.CPUs != runtime.NumCPU() || e.Scheme != schemeDisplayName(wide) {
+		t.Errorf("unexpected diagnostic: %v", diagnostics[0])
+	}
+
+	// The hash is unaffected, and records the configured parallelism.
+	h, err := c.Hash("password")
+	if err != nil || !strings.Contains(h, fmt.Sprintf(",p=%d$", threads)) {
+		t.Errorf("unexpected hash %q, %v", h, err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{argon2.NewID(1, 64, 1, 32)}}
+	if diagnostics := c.ValidateDeployment(); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+}
+
+func TestDeprecatable(t *testing.T) {
+	legacy := map[abstract.Scheme]bool{}
+	for _, scheme := range LegacySchemes {
+		legacy[scheme] = true
+	}
+
+	for _, scheme := range allBuiltinSchemes() {
+		if deprecated(scheme) != legacy[scheme] {
+			t.Errorf("%v: expected deprecated to be %v", scheme, legacy[scheme])
+		}
+	}
+
+	if !deprecated(WithVerifyTimeout(md5crypt.Crypter, time.Second)) {
+		t.Errorf("timeout wrapper hides deprecation")
+	}
+
+	// apr1's own NeedsUpdate never asks for an upgrade, but the context
+	// upgrades apr1 hashes even when it is the preferred scheme.
+	apr1 := SchemeFromName("apr1")
+	h, err := apr1.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if apr1.NeedsUpdate(h) {
+		t.Fatalf("apr1 scheme unexpectedly asks for an upgrade")
+	}
+
+	c := Context{Schemes: []abstract.Scheme{apr1, bcrypt.New(4)}}
+	if nu, err := c.NeedsUpdate(h); err != nil || !nu {
+		t.Errorf("deprecated preferred scheme's hash does not need updating: %v, %v", nu, err)
+	}
+	if newHash, err := c.Verify("password", h); err != nil || newHash == "" {
+		t.Errorf("deprecated preferred scheme's hash was not upgraded: %q, %v", newHash, err)
+	}
+	if info, err := c.AnalyzeHash(h); err != nil || !info.NeedsUpdate {
+		t.Errorf("unexpected analysis %+v, %v", info, err)
+	}
+
+	c = Context{Schemes: []abstract.Scheme{bcrypt.New(4), apr1}}
+	h, err = c.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if nu, err := c.NeedsUpdate(h); err != nil || nu {
+		t.Errorf("modern preferred scheme's hash needs updating: %v, %v", nu, err)
+	}
+}
+
+func TestEmbedTimestamp(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{bcrypt.New(5), bcrypt.New(4)}, EmbedTimestamp: true}
+
+	before := time.Now().Truncate(time.Second)
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(h, "$created$") {
+		t.Fatalf("hash has no timestamp: %q", h)
+	}
+
+	created, err := c.HashAge(h + "\n")
+	if err != nil || created.Before(before) || created.After(time.Now()) {
+		t.Errorf("unexpected creation time %v, %v", created, err)
+	}
+
+	if newHash, err := c.Verify("password", h); err != nil || newHash != "" {
+		t.Errorf("unexpected verify result %q, %v", newHash, err)
+	}
+	if _, err := c.Verify("wrong", h); err != abstract.ErrInvalidPassword {
+		t.Errorf("expected ErrInvalidPassword, got %v", err)
+	}
+	if nu, err := c.NeedsUpdate(h); err != nil || nu {
+		t.Errorf("unexpected NeedsUpdate result %v, %v", nu, err)
+	}
+	if name, err := c.Identify(h); err != nil || name != "bcrypt(5)" {
+		t.Errorf("unexpected scheme %q, %v", name, err)
+	}
+
+	// Contexts without EmbedTimestamp still understand the wrapper.
+	plain := Context{Schemes: []abstract.Scheme{bcrypt.New(5)}}
+	if _, err := plain.Verify("password", h); err != nil {
+		t.Errorf("err verifying without EmbedTimestamp: %v", err)
+	}
+	plainHash, err := plain.Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.HashAge(plainHash); err != ErrNoTimestamp {
+		t.Errorf("expected ErrNoTimestamp, got %v", err)
+	}
+	if nested, _ := DetectNesting(h); nested {
+		t.Errorf("timestamped hash reported as nested")
+	}
+
+	// Upgrading a hash keeps its creation time.
+	weak, err := bcrypt.New(4).Hash("password")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	newHash, err := c.Verify("password", "$created$1600000000$"+weak)
+	if err != nil || newHash == "" {
+		t.Fatalf("hash was not upgraded: %q, %v", newHash, err)
+	}
+	if created, err := c.HashAge(newHash); err != nil || created.Unix() != 1600000000 {
+		t.Errorf("upgrade changed creation time to %v, %v", created, err)
+	}
+
+	for _, bad := range []string{"$created$$" + weak, "$created$-1$" + weak, "$created$x$" + weak} {
+		if _, err := c.HashAge(bad); err != ErrNoTimestamp {
+			t.Errorf("%q: expected ErrNoTimestamp, got %v", bad, err)
+		}
+	}
+
+	// The timestamp wraps the pepper, and is carried through HashParts.
+	c = Context{Schemes: []abstract.Scheme{bcrypt.New(4)}, EmbedTimestamp: true, Pepper: []byte("pepper")}
+	h, err = c.Hash("password")
+	if err != nil || !strings.Contains(h, "$$pepper$$") {
+		t.Fatalf("unexpected peppered hash %q, %v", h, err)
+	}
+	if _, err := c.Verify("password", h); err != nil {
+		t.Errorf("err verifying peppered hash: %v", err)
+	}
+
+	scheme, salt, digest, params, err := c.HashParts("password")
+	if err != nil || params["created"] == "" {
+		t.Fatalf("unexpected parts %v, %v", params, err)
+	}
+	if _, err := c.VerifyParts("password", scheme, salt, digest, params); err != nil {
+		t.Errorf("err verifying parts: %v", err)
+	}
+}
+
+func TestNormalizeEncoding(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{bcrypt.New(5)}}
+	h, err := c.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last character of a bcrypt salt has four unused bits; set one.
+	const alphabet = "./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	i := strings.IndexByte(alphabet, h[28])
+	if i%16 != 0 {
+		t.Fatalf("salt of %q not canonical", h)
+	}
+	odd := h[:28] + alphabet[i+1:i+2] + h[29:]
+
+	if err := c.VerifyNoUpgrade("password", odd); err != nil {
+		t.Fatalf("non-canonical hash does not verify: %v", err)
+	}
+	if nu, err := c.NeedsUpdate(odd); err != nil || nu {
+		t.Errorf("unexpected NeedsUpdate result %v, %v", nu, err)
+	}
+
+	c.NormalizeEncoding = true
+	if nu, err := c.NeedsUpdate(h); err != nil || nu {
+		t.Errorf("canonical hash needs updating: %v, %v", nu, err)
+	}
+	if nu, err := c.NeedsUpdate(odd); err != nil || !nu {
+		t.Errorf("non-canonical hash does not need updating: %v, %v", nu, err)
+	}
+	if info, err := c.AnalyzeHash(odd); err != nil || !info.NeedsUpdate {
+		t.Errorf("unexpected analysis %+v, %v", info, err)
+	}
+
+	newHash, upgraded, err := c.VerifyAndUpgrade("password", odd)
+	if err != nil || !upgraded {
+		t.Fatalf("not upgraded: %v, %v", upgraded, err)
+	}
+	if nu, err := c.NeedsUpdate(newHash); err != nil || nu {
+		t.Errorf("upgraded hash %q needs updating: %v, %v", newHash, nu, err)
+	}
+
+	// Schemes which cannot re-encode their hashes are unaffected.
+	c = Context{Schemes: []abstract.Scheme{sha2crypt.Crypter256}, NormalizeEncoding: true}
+	if h, err = c.Hash("password"); err != nil {
+		t.Fatal(err)
+	}
+	if nu, err := c.NeedsUpdate(h); err != nil || nu {
+		t.Errorf("unexpected NeedsUpdate result %v, %v", nu, err)
+	}
+}
+
+func TestStrengthOrdering(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{argon2.IDCrypter, bcrypt.Crypter}}
+
+	var last float64
+	for cost := bcrypt.MinimumCost; cost <= bcrypt.MinimumCost+4; cost++ {
+		h, err := bcrypt.New(cost).Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.Strength(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s <= last {
+			t.Errorf("bcrypt cost %d has strength %v, no more than %v", cost, s, last)
+		}
+		last = s
+	}
+
+	last = 0
+	for memory := uint32(64); memory <= 1024; memory *= 2 {
+		h, err := argon2.NewID(1, memory, 1, 32).Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.Strength(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s <= last {
+			t.Errorf("argon2id memory %d has strength %v, no more than %v", memory, s, last)
+		}
+		last = s
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	for name, hashes := range schemeCorpus {
+		for _, h := range hashes {
+			s, err := EstimateStrength(h)
+			if err != nil {
+				t.Errorf("%s: EstimateStrength(%q): %v", name, h, err)
+				continue
+			}
+
+			if w, err := EstimateStrength(" " + h + "\n"); err != nil || w != s {
+				t.Errorf("%s: EstimateStrength of %q with whitespace = %v, %v; want %v", name, h, w, err, s)
+			}
+		}
+	}
+
+	// Neither scheme is in the default context, but both are registered.
+	for _, name := range []string{"balloon", "yescrypt"} {
+		h := schemeCorpus[name][0]
+		if _, err := Strength(h); err != abstract.ErrNoMatchingScheme {
+			t.Errorf("Strength of %s hash: got %v, want ErrNoMatchingScheme", name, err)
+		}
+		if s, err := EstimateStrength(h); err != nil || s <= 0 {
+			t.Errorf("EstimateStrength of %s hash = %v, %v", name, s, err)
+		}
+	}
+
+	var last float64
+	for cost := bcrypt.MinimumCost; cost <= bcrypt.MinimumCost+4; cost++ {
+		h, err := bcrypt.New(cost).Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := EstimateStrength(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s <= last {
+			t.Errorf("bcrypt cost %d has strength %v, no more than %v", cost, s, last)
+		}
+		last = s
+	}
+
+	if _, err := EstimateStrength("$unknown$abc"); err != abstract.ErrNoMatchingScheme {
+		t.Errorf("EstimateStrength of an unknown hash: got %v, want ErrNoMatchingScheme", err)
+	}
+}
+
+func TestHashWithSalt(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	for _, v := range []struct {
+		scheme abstract.Scheme
+		n      int
+	}{
+		{argon2.NewID(1, 64, 1, 32), 16},
+		{pbkdf2.SHA256Crypter, pbkdf2.SaltLength},
+		{sha2crypt.Crypter512, 12},
+	} {
+		c := Context{Schemes: []abstract.Scheme{v.scheme}}
+		s := salt[:v.n]
+
+		h1, err := c.HashWithSalt("password", s)
+		if err != nil {
+			t.Fatalf("%v: %v", v.scheme, err)
+		}
+		h2, err := c.HashWithSalt("password", s)
+		if err != nil || h1 != h2 {
+			t.Fatalf("%v: same salt gave %q and %q, %v", v.scheme, h1, h2, err)
+		}
+		if _, err := c.Verify("password", h1); err != nil {
+			t.Fatalf("%v: %v", v.scheme, err)
+		}
+
+		other := append([]byte(nil), s...)
+		other[0] ^= 1
+		if h3, err := c.HashWithSalt("password", other); err != nil || h3 == h1 {
+			t.Fatalf("%v: different salt gave %q, %v", v.scheme, h3, err)
+		}
+
+		for _, bad := range [][]byte{nil, s[:v.n-1], append(other, 0)} {
+			if _, err := c.HashWithSalt("password", bad); !errors.Is(err, ErrSaltLength) {
+				t.Errorf("%v: %d-byte salt: expected ErrSaltLength, got %v", v.scheme, len(bad), err)
+			}
+		}
+	}
+
+	c := Context{Schemes: []abstract.Scheme{bcrypt.New(bcrypt.MinimumCost)}}
+	if _, err := c.HashWithSalt("password", salt); err != ErrSaltNotSupported {
+		t.Errorf("expected ErrSaltNotSupported, got %v", err)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	c := Context{Schemes: append(append([]abstract.Scheme{}, defaultSchemes20201015...), LegacySchemes...)}
+
+	for _, h := range []string{
+		"$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo",
+		"$s2$16384$8$1$qa9lVfhmTE8F2Jpwya9m7uoE$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI=",
+		"$2a$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+		"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"abJnggxhB/yWI",
+	} {
+		_, err := c.Verify("wrong password", h)
+		if !errors.Is(err, abstract.ErrPasswordMismatch) || errors.Is(err, abstract.ErrInvalidHash) {
+			t.Errorf("%q: expected ErrPasswordMismatch, got %v", h, err)
+		}
+	}
+
+	for _, h := range []string{
+		"$argon2id$v=19$m=32768,t=4$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo",
+		"$argon2i$v=19$m=0,t=0,p=0$NXJyTlBETVIwclJiYXhkbA$wdq6At1pxiIBu15AO9yEkbzQhFquZzmTKP6pmBI6uRo",
+		"$s2$16384$8$1$!!!$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI=",
+		"$s2$3$8$1$qa9lVfhmTE8F2Jpwya9m7uoE$Q7dSPqhZQCLWpjniaz7RVm+xorpSAPTvOCP2uoZmoiI=",
+		"$6$rounds=x$salt$hash",
+		"$5$",
+		"$2a$99$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e",
+		"$2a$05$short",
+		"$bcrypt-sha256$2a,05$x$y",
+		"$pbkdf2-sha256$x$salt$hash",
+		"$pbkdf2-sha512$",
+		"$pbkdf2$1000$c2FsdA$",
+		"$argon2id$v=19$m=32768,t=4,p=4$NXJyTlBETVIwclJiYXhkbA",
+		"$s2$16384$8$1$qa9lVfhmTE8F2Jpwya9m7uoE",
+		"$1$saltsalt",
+		"$P$Babcdefgh",
+		"ab",
+		"$1$saltsaltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"$apr1$a$b$c",
+		"$P$!abcdefghrBY/znFl0cIh22fo6F2px.",
+		"_J9..sal",
+	} {
+		_, err := c.Verify("password", h)
+		if !errors.Is(err, abstract.ErrInvalidHash) || errors.Is(err, abstract.ErrPasswordMismatch) {
+			t.Errorf("%q: expected ErrInvalidHash, got %v", h, err)
+		}
+	}
+
+	for _, h := range []string{"$unknown$hash", "abc"} {
+		_, err := c.Verify("password", h)
+		if !errors.Is(err, abstract.ErrNoMatchingScheme) {
+			t.Errorf("%q: expected ErrNoMatchingScheme, got %v", h, err)
+		}
+	}
+}
+
+func TestHashWhitespace(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{bcrypt.New(bcrypt.MinimumCost), sha512crypt(t, 1000)}}
+
+	for _, scheme := range c.Schemes {
+		h, err := scheme.Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, _ := c.Identify(h)
+
+		for _, padded := range []string{h + "\n", h + "\r\n", "  " + h, "\t" + h + " \n"} {
+			if _, err := c.Verify("password", padded); err != nil {
+				t.Errorf("%q: %v", padded, err)
+			}
+			if _, err := c.Verify("wrong", padded); err != abstract.ErrPasswordMismatch {
+				t.Errorf("%q: expected ErrPasswordMismatch, got %v", padded, err)
+			}
+			if id, err := c.Identify(padded); err != nil || id != name {
+				t.Errorf("%q: identified as %q, %v", padded, id, err)
+			}
+			if _, err := c.NeedsUpdate(padded); err != nil {
+				t.Errorf("%q: %v", padded, err)
+			}
+		}
+
+		// Interior whitespace is kept.
+		inner := h[:10] + " " + h[10:]
+		if _, err := c.Verify("password", inner); err == nil {
+			t.Errorf("%q: verified", inner)
+		}
+
+		// bcrypt ignores trailing bytes, so only leading whitespace is sure
+		// to be rejected.
+		c.KeepHashWhitespace = true
+		for _, padded := range []string{" " + h, "\n" + h} {
+			if _, err := c.Verify("password", padded); err == nil {
+				t.Errorf("%q: verified with KeepHashWhitespace", padded)
+			}
+		}
+		c.KeepHashWhitespace = false
+	}
+}
+
+func TestVerifyAndUpgrade(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha512crypt(t, 1000), md5crypt.Crypter}}
+
+	newHash, upgraded, err := c.VerifyAndUpgrade("password", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/")
+	if err != nil || !upgraded || !sha2crypt.Crypter512.SupportsStub(newHash) {
+		t.Fatalf("expected upgrade: %q, %v, %v", newHash, upgraded, err)
+	}
+
+	newHash, upgraded, err = c.VerifyAndUpgrade("password", newHash)
+	if err != nil || upgraded || newHash != "" {
+		t.Fatalf("unexpected upgrade: %q, %v, %v", newHash, upgraded, err)
+	}
+
+	newHash, upgraded, err = c.VerifyAndUpgrade("wrong", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/")
+	if err == nil || upgraded || newHash != "" {
+		t.Fatalf("unexpected result with wrong password: %q, %v, %v", newHash, upgraded, err)
+	}
+}
+
+func TestHashBatch(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha512crypt(t, 1000)}}
+
+	passwords := []string{"a", "b", "c", "d", "e", "f", "g"}
+	for _, concurrency := range []int{0, 1, 3, 100} {
+		hashes, errs := c.HashBatch(passwords, concurrency)
+		if len(hashes) != len(passwords) || len(errs) != len(passwords) {
+			t.Fatalf("concurrency %d: result lengths do not match input", concurrency)
+		}
+
+		for i, h := range hashes {
+			if errs[i] != nil {
+				t.Fatalf("concurrency %d: err hashing %q: %v", concurrency, passwords[i], errs[i])
+			}
+			if _, err := c.Verify(passwords[i], h); err != nil {
+				t.Fatalf("concurrency %d: hash %d does not match its password: %v", concurrency, i, err)
+			}
+		}
+	}
+
+	// Errors are reported per item.
+	c.Schemes = []abstract.Scheme{bcrypt.NewWithTruncationPolicy(bcrypt.Reject)}
+	hashes, errs := c.HashBatch([]string{"short", strings.Repeat("x", 100)}, 2)
+	if errs[0] != nil || hashes[0] == "" || errs[1] != bcrypt.ErrPasswordTooLong || hashes[1] != "" {
+		t.Fatalf("unexpected results: %q, %v", hashes, errs)
+	}
+
+	if hashes, errs := c.HashBatch(nil, 4); len(hashes) != 0 || len(errs) != 0 {
+		t.Fatalf("unexpected results for empty batch")
+	}
+}
+
+func TestVerifyMultiple(t *testing.T) {
+	c := Context{Schemes: []abstract.Scheme{sha512crypt(t, 1000)}}
+
+	hashes, _ := c.HashBatch([]string{"a", "b", "c"}, 1)
+	for i, password := range []string{"a", "b", "c"} {
+		if index, err := c.VerifyMultiple(password, hashes); err != nil || index != i {
+			t.Fatalf("%q: expected index %d, got %d, %v", password, i, index, err)
+		}
+	}
+
+	for _, hs := range [][]string{hashes, nil} {
+		if index, err := c.VerifyMultiple("d", hs); err != abstract.ErrPasswordMismatch || index != -1 {
+			t.Fatalf("expected ErrPasswordMismatch, got %d, %v", index, err)
+		}
+	}
+
+	// Malformed hashes do not stop later ones from being tried.
+	mixed := []string{"$6$rounds=x$bad", "garbage", hashes[2]}
+	if index, err := c.VerifyMultiple("c", mixed); err != nil || index != 2 {
+		t.Fatalf("expected index 2, got %d, %v", index, err)
+	}
+
+	index, err := c.VerifyMultiple("a", mixed)
+	var e *ErrNoHashMatched
+	if index != -1 || !errors.As(err, &e) || !errors.Is(err, abstract.ErrPasswordMismatch) {
+		t.Fatalf("expected *ErrNoHashMatched, got %d, %v", index, err)
+	}
+	if len(e.Errs) != 3 || e.Errs[0] == nil || e.Errs[1] != abstract.ErrNoMatchingScheme || e.Errs[2] != abstract.ErrPasswordMismatch {
+		t.Fatalf("unexpected errors: %v", e.Errs)
+	}
+
+	// A matching hash which is too weak is still found.
+	c.MinimumStrength = 1000
+	index, err = c.VerifyMultiple("b", hashes)
+	var weak *ErrHashTooWeak
+	if index != 1 || !errors.As(err, &weak) {
+		t.Fatalf("expected index 1 and *ErrHashTooWeak, got %d, %v", index, err)
+	}
 }
 
 // © 2008-2012 Assurance Technologies LLC.  (Python passlib)  BSD License
@@ -0,0 +1,112 @@
+package passlib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// The prefix marking a peppered hash. It is followed by a key identifier
+// (empty for Context.Pepper), a '$' and the hash produced by the scheme:
+//
+//   $pepper$$$argon2id$v=19$...
+//   $pepper$2020-10$$argon2id$v=19$...
+//
+const pepperPrefix = "$pepper$"
+
+// Indicates that a hash was made with a pepper, but the context verifying it
+// has none.
+var ErrPepperRequired = fmt.Errorf("hash is peppered but no pepper is configured")
+
+// Applies the pepper to a password. The result is the base64 encoding of
+// HMAC-SHA256(pepper, password), which is short enough for bcrypt and
+// contains no NUL bytes.
+func pepperPassword(pepper, password []byte) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(password)
+	sum := mac.Sum(nil)
+
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(sum)))
+	base64.StdEncoding.Encode(out, sum)
+	return out
+}
+
+// Splits a peppered hash into its key identifier and the scheme's hash.
+// ok is false if the hash is not peppered.
+func splitPeppered(hash string) (keyID, inner string, ok bool) {
+	if !strings.HasPrefix(hash, pepperPrefix) {
+		return "", hash, false
+	}
+
+	rest := hash[len(pepperPrefix):]
+	i := strings.IndexByte(rest, '$')
+	if i < 0 {
+		return "", hash, false
+	}
+
+	return rest[:i], rest[i+1:], true
+}
+
+// Marks a hash made from a peppered password.
+func joinPeppered(keyID, inner string) string {
+	return pepperPrefix + keyID + "$" + inner
+}
+
+// Returns the identifier and value of the pepper to use for new hashes, or a
+// nil pepper if there is none.
+func (ctx *Context) currentPepper() (keyID string, pepper []byte, err error) {
+	if ctx.CurrentPepperID == "" {
+		if len(ctx.Pepper) == 0 {
+			return "", nil, nil
+		}
+		return "", ctx.Pepper, nil
+	}
+
+	if strings.IndexByte(ctx.CurrentPepperID, '$') >= 0 {
+		return "", nil, fmt.Errorf("pepper key %q must not contain '$'", ctx.CurrentPepperID)
+	}
+
+	pepper, ok := ctx.Peppers[ctx.CurrentPepperID]
+	if !ok || len(pepper) == 0 {
+		return "", nil, fmt.Errorf("current pepper key %q is not in Peppers", ctx.CurrentPepperID)
+	}
+
+	return ctx.CurrentPepperID, pepper, nil
+}
+
+// Returns the pepper with the given identifier; "" names Context.Pepper.
+func (ctx *Context) lookupPepper(keyID string) []byte {
+	if keyID == "" {
+		return ctx.Pepper
+	}
+
+	return ctx.Peppers[keyID]
+}
+
+// Prepares a password and hash for verification by a scheme. If the hash is
+// peppered, the pepper it names is applied to the password and the marker
+// removed. stale is true if the hash does not use the context's current
+// pepper, so that it should be rehashed.
+func (ctx *Context) unpepper(password []byte, hash string) (pepperedPassword []byte, inner string, stale bool, err error) {
+	currentID, current, err := ctx.currentPepper()
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	keyID, inner, peppered := splitPeppered(hash)
+	if !peppered {
+		return password, hash, current != nil, nil
+	}
+
+	pepper := ctx.lookupPepper(keyID)
+	if len(pepper) == 0 {
+		if keyID == "" {
+			return nil, "", false, ErrPepperRequired
+		}
+		return nil, "", false, fmt.Errorf("hash uses pepper key %q, which is not configured", keyID)
+	}
+
+	return pepperPassword(pepper, password), inner, keyID != currentID || current == nil, nil
+}
@@ -0,0 +1,105 @@
+package passlib
+
+import (
+	"fmt"
+	"io"
+)
+
+// The limit on the size of secrets read by HashReader and VerifyReader if
+// the context's MaxSecretSize is zero.
+const DefaultMaxSecretSize = 1 << 20
+
+// Indicates that a secret read by HashReader or VerifyReader is larger than
+// the context's MaxSecretSize.
+type ErrSecretTooLarge struct {
+	Max int64
+}
+
+func (e *ErrSecretTooLarge) Error() string {
+	return fmt.Sprintf("secret exceeds the limit of %d bytes", e.Max)
+}
+
+// Like HashBytes, but reads the secret from r, which is read until EOF. This
+// is intended for secrets which are not typed passwords, such as API key
+// material or the contents of key files.
+//
+// None of the schemes can hash incrementally, so the whole secret is held in
+// memory; reading stops with an *ErrSecretTooLarge as soon as it exceeds
+// MaxSecretSize, so at most that much (plus one byte) is buffered per call.
+// The buffer is zeroed before returning. MaxPasswordLength, if set, also
+// applies.
+func (ctx *Context) HashReader(r io.Reader) (hash string, err error) {
+	secret, err := ctx.readSecret(r)
+	if err != nil {
+		return "", err
+	}
+	defer zero(secret)
+
+	return ctx.hash(secret)
+}
+
+// Like VerifyBytes, but reads the secret from r. See HashReader.
+func (ctx *Context) VerifyReader(r io.Reader, hash string) (newHash string, err error) {
+	secret, err := ctx.readSecret(r)
+	if err != nil {
+		return "", err
+	}
+	defer zero(secret)
+
+	return ctx.verify(secret, hash, true)
+}
+
+func (ctx *Context) readSecret(r io.Reader) ([]byte, error) {
+	max := ctx.MaxSecretSize
+	if max <= 0 {
+		max = DefaultMaxSecretSize
+	}
+
+	buf := make([]byte, 0, 512)
+	lr := io.LimitReader(r, max+1)
+	for {
+		if len(buf) == cap(buf) {
+			// Grow by hand, rather than with append, so that no copies of the
+			// secret are left behind.
+			newBuf := make([]byte, len(buf), 2*cap(buf))
+			copy(newBuf, buf)
+			zero(buf)
+			buf = newBuf
+		}
+
+		n, err := lr.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			zero(buf)
+			return nil, err
+		}
+	}
+
+	if int64(len(buf)) > max {
+		zero(buf)
+		return nil, &ErrSecretTooLarge{Max: max}
+	}
+
+	return buf, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Hashes a secret read from r using the default context. See
+// Context.HashReader.
+func HashReader(r io.Reader) (hash string, err error) {
+	return DefaultContext.HashReader(r)
+}
+
+// Verifies a secret read from r using the default context. See
+// Context.VerifyReader.
+func VerifyReader(r io.Reader, hash string) (newHash string, err error) {
+	return DefaultContext.VerifyReader(r, hash)
+}
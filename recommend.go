@@ -0,0 +1,113 @@
+package passlib
+
+import (
+	"math"
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+	"github.com/al45tair/passlib/hash/argon2"
+	argon2raw "github.com/al45tair/passlib/hash/argon2/raw"
+	"github.com/al45tair/passlib/hash/bcrypt"
+	"github.com/al45tair/passlib/hash/bcryptsha256"
+	"github.com/al45tair/passlib/hash/scrypt"
+)
+
+// A scheme tuned by RecommendWithTimings, with the time it took to hash a
+// password.
+type Recommendation struct {
+	Scheme   abstract.Scheme
+	Measured time.Duration
+}
+
+// Returns schemes tuned so that hashing a password takes roughly target on
+// the current machine, using no more than maxMemory bytes, keyed by scheme
+// name: "argon2id", "argon2", "scrypt-sha256", "bcrypt" and "bcrypt-sha256".
+// See RecommendWithTimings.
+func Recommend(target time.Duration, maxMemory int) (map[string]abstract.Scheme, error) {
+	recommendations, err := RecommendWithTimings(target, maxMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	schemes := map[string]abstract.Scheme{}
+	for name, r := range recommendations {
+		schemes[name] = r.Scheme
+	}
+	return schemes, nil
+}
+
+// Like Recommend, but also returns how long each scheme took to hash a
+// password, so that the results can be logged and sanity-checked, e.g.
+//
+//   recommendations, err := passlib.RecommendWithTimings(250*time.Millisecond, 64<<20)
+//   for name, r := range recommendations {
+//     log.Printf("%s: %s takes %v", name, r.Scheme.(abstract.Describable).Describe(), r.Measured)
+//   }
+//
+// Each scheme is tuned with its package's Calibrate function; bcrypt-sha256
+// uses the cost found for bcrypt, as the prehash is negligible. Schemes
+// without one, such as pbkdf2 and sha512-crypt, are not included.
+//
+// This takes several times target for each scheme, and the results are
+// specific to the machine and its load at the time. Call it once, during
+// setup, and store the parameters in your configuration (see
+// Context.MarshalJSON), rather than calling it in every process.
+func RecommendWithTimings(target time.Duration, maxMemory int) (map[string]Recommendation, error) {
+	recommendations := map[string]Recommendation{}
+
+	// argon2 measures memory in KiB.
+	memoryKiB := uint64(0)
+	if maxMemory > 0 {
+		memoryKiB = uint64(maxMemory) / 1024
+	}
+	if memoryKiB > math.MaxUint32 {
+		memoryKiB = math.MaxUint32
+	}
+
+	for name, newArgon2 := range map[string]func(time, memory uint32, threads uint8, keyLen uint32) abstract.Scheme{
+		"argon2id": argon2.NewID,
+		"argon2":   argon2.New,
+	} {
+		passes, memory, threads, err := argon2.Calibrate(target, uint32(memoryKiB))
+		if err != nil {
+			return nil, err
+		}
+
+		scheme := newArgon2(passes, memory, threads, argon2raw.RecommendedKeyLength)
+		measured, err := timeHash(scheme)
+		if err != nil {
+			return nil, err
+		}
+
+		recommendations[name] = Recommendation{scheme, measured}
+	}
+
+	N, r, p, measured, err := scrypt.Calibrate(target, maxMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, err := scrypt.NewSHA256(N, r, p)
+	if err != nil {
+		return nil, err
+	}
+	recommendations["scrypt-sha256"] = Recommendation{scheme, measured}
+
+	cost, measured, err := bcrypt.Calibrate(target)
+	if err != nil {
+		return nil, err
+	}
+	recommendations["bcrypt"] = Recommendation{bcrypt.New(cost), measured}
+	recommendations["bcrypt-sha256"] = Recommendation{bcryptsha256.New(cost), measured}
+
+	return recommendations, nil
+}
+
+// Returns how long scheme takes to hash a password.
+func timeHash(scheme abstract.Scheme) (time.Duration, error) {
+	start := time.Now()
+	if _, err := scheme.Hash("passlib calibration"); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,70 @@
+package passlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that a salt passed to HashWithSalt is not the length the
+// preferred scheme needs.
+var ErrSaltLength = fmt.Errorf("salt is the wrong length for the scheme")
+
+// Indicates that the preferred scheme cannot be given a salt, because it
+// does not implement abstract.SaltReaderScheme.
+var ErrSaltNotSupported = fmt.Errorf("scheme cannot hash with a given salt")
+
+// Like Hash, but the preferred scheme uses salt instead of generating a
+// random one, so that the result can be compared with the hash another
+// system makes from the same salt and password, e.g. to check that two
+// implementations agree while dual-writing during a migration. Apart from
+// any creation timestamp (see EmbedTimestamp), the result is the same for
+// the same salt and password.
+//
+// salt holds the raw bytes the scheme would otherwise read from its random
+// source (see abstract.SaltReaderScheme), and must be exactly as long as the
+// scheme needs, e.g. pbkdf2.SaltLength bytes for pbkdf2; returns an error
+// wrapping ErrSaltLength otherwise. Returns ErrSaltNotSupported if the
+// scheme cannot be given a salt, as bcrypt cannot.
+//
+// This is a testing and verification tool. Never use it to hash passwords
+// for storage: salts chosen by the caller are easily reused or predicted,
+// which lets hashes of the same password be recognized and attacked
+// together.
+func (ctx *Context) HashWithSalt(password string, salt []byte) (string, error) {
+	scheme, err := ctx.PreferredScheme()
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := scheme.(abstract.SaltReaderScheme); !ok {
+		return "", ErrSaltNotSupported
+	}
+
+	if err := ctx.checkPolicy([]byte(password)); err != nil {
+		return "", err
+	}
+
+	r := bytes.NewReader(salt)
+	hash, err := ctx.hashWith(scheme, r, []byte(password))
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%w: %s needs more than %d bytes", ErrSaltLength, schemeDisplayName(scheme), len(salt))
+	} else if err != nil {
+		return "", err
+	}
+
+	if r.Len() != 0 {
+		return "", fmt.Errorf("%w: %s needs %d bytes, got %d", ErrSaltLength, schemeDisplayName(scheme), len(salt)-r.Len(), len(salt))
+	}
+
+	return hash, nil
+}
+
+// Uses the default context to hash a password with a given salt, for testing
+// only. See Context.HashWithSalt.
+func HashWithSalt(password string, salt []byte) (string, error) {
+	return DefaultContext.HashWithSalt(password, salt)
+}
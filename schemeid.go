@@ -0,0 +1,138 @@
+package passlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Stable identifiers for the built-in schemes, for storing alongside hashes;
+// see SchemeIDFor. Identifiers are never renumbered or reused: new schemes
+// are given the next free one, and those of removed schemes are retired.
+// Zero is never assigned. pbkdr2-sha1 is an alias of pbkdf2-sha1, and
+// argon2id-20240101 is argon2id with other parameters, so neither has an
+// identifier of its own.
+var schemeIDs = map[string]byte{
+	"argon2":               1,
+	"argon2id":             2,
+	"scrypt-sha256":        3,
+	"sha256-crypt":         4,
+	"sha512-crypt":         5,
+	"bcrypt":               6,
+	"bcrypt-sha256":        7,
+	"bcrypt-sha512":        8,
+	"pbkdf2-sha224":        9,
+	"pbkdf2-sha256":        10,
+	"pbkdf2-sha384":        11,
+	"pbkdf2-sha512":        12,
+	"pbkdf2-sha1":          13,
+	"django-pbkdf2-sha256": 14,
+	"md5-crypt":            15,
+	"des-crypt":            16,
+	"bsdi-crypt":           17,
+	"phpass":               18,
+	"apr1":                 19,
+	"nthash":               20,
+	"ldap-ssha":            21,
+	"ldap-sha":             22,
+	"mysql41":              23,
+	"yescrypt":             24,
+	"balloon":              25,
+	"pbkdf2-sha3-256":      26,
+	"pbkdf2-sha3-512":      27,
+	"sha1-crypt":           28,
+}
+
+// The built-in schemes indexed by identifier.
+var schemesByID [256]abstract.Scheme
+
+func init() {
+	for name, id := range schemeIDs {
+		schemesByID[id] = schemes[name]
+	}
+}
+
+// Indicates that the scheme which handles a hash has no stable identifier,
+// because it is not one of the built-in schemes.
+var ErrNoSchemeID = fmt.Errorf("scheme has no stable identifier")
+
+// Returns the stable identifier of the scheme used by hash, so that it can
+// be stored alongside the hash and passed to VerifyByID. The identifiers of
+// the built-in schemes are:
+//
+//    1 argon2               10 pbkdf2-sha256          19 apr1
+//    2 argon2id             11 pbkdf2-sha384          20 nthash
+//    3 scrypt-sha256        12 pbkdf2-sha512          21 ldap-ssha
+//    4 sha256-crypt         13 pbkdf2-sha1            22 ldap-sha
+//    5 sha512-crypt         14 django-pbkdf2-sha256   23 mysql41
+//    6 bcrypt               15 md5-crypt              24 yescrypt
+//    7 bcrypt-sha256        16 des-crypt              25 balloon
+//    8 bcrypt-sha512        17 bsdi-crypt             26 pbkdf2-sha3-256
+//    9 pbkdf2-sha224        18 phpass                 27 pbkdf2-sha3-512
+//                                                     28 sha1-crypt
+//
+// These will not change in future releases. The identifier depends only on
+// the format of the hash, not on the parameters of the context's schemes.
+//
+// Returns abstract.ErrNoMatchingScheme if none of the context's schemes
+// supports hash, and ErrNoSchemeID if the one which does is not a built-in
+// scheme.
+func (ctx *Context) SchemeIDFor(hash string) (byte, error) {
+	_, inner, _ := splitPeppered(ctx.trimHash(hash))
+	if _, scheme := ctx.findScheme(inner); scheme == nil {
+		return 0, abstract.ErrNoMatchingScheme
+	}
+
+	if id, ok := builtinSchemeID(inner); ok {
+		return id, nil
+	}
+
+	return 0, ErrNoSchemeID
+}
+
+// Returns the lowest identifier whose scheme supports hash.
+func builtinSchemeID(hash string) (byte, bool) {
+	for id, scheme := range schemesByID {
+		if scheme != nil && scheme.SupportsStub(hash) {
+			return byte(id), true
+		}
+	}
+
+	return 0, false
+}
+
+// Like Verify, but first checks that hash is in the format of the scheme
+// with the given identifier (see SchemeIDFor), failing with
+// abstract.ErrNoMatchingScheme if it is not, or if id is unknown. This costs
+// a single SupportsStub call, so that records whose stored identifier does
+// not match their hash are rejected without trying every scheme.
+//
+// The hash is still verified by whichever of the context's schemes supports
+// it, exactly as Verify would, so a stored identifier can never make the
+// context accept a scheme it does not list, nor change when hashes are
+// upgraded.
+func (ctx *Context) VerifyByID(id byte, password, hash string) (newHash string, err error) {
+	_, inner, _ := splitPeppered(ctx.trimHash(hash))
+	scheme := schemesByID[id]
+	if (scheme == nil || !scheme.SupportsStub(inner)) && !noPasswordSet(hash) {
+		if ctx.MinVerifyDuration > 0 {
+			ctx.pad(time.Now())
+		}
+		return "", abstract.ErrNoMatchingScheme
+	}
+
+	return ctx.verify([]byte(password), hash, true)
+}
+
+// Returns the stable identifier of the scheme used by hash, using the
+// default context. See Context.SchemeIDFor.
+func SchemeIDFor(hash string) (byte, error) {
+	return DefaultContext.SchemeIDFor(hash)
+}
+
+// Verifies a password against a hash whose scheme identifier was recorded
+// by SchemeIDFor, using the default context. See Context.VerifyByID.
+func VerifyByID(id byte, password, hash string) (newHash string, err error) {
+	return DefaultContext.VerifyByID(id, password, hash)
+}
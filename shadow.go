@@ -0,0 +1,43 @@
+package passlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Indicates that a shadow entry's password field marks the account as
+// locked ("!" or "*", possibly followed by a disabled hash).
+var ErrAccountLocked = fmt.Errorf("account is locked")
+
+// Indicates that a shadow entry's password field is empty, so the account
+// has no password. Such entries never verify.
+var ErrNoPassword = fmt.Errorf("account has no password")
+
+// Verifies a password against an /etc/shadow-style entry. shadowField may be
+// a complete shadow line (user:hash:...), in which case the second field is
+// used, or just the hash field itself.
+//
+// Returns ErrAccountLocked if the field starts with "!" or "*", and
+// ErrNoPassword if it is empty; otherwise behaves as VerifyNoUpgrade, as
+// shadow files are not normally rewritten by authenticators.
+func (ctx *Context) VerifyShadowEntry(password, shadowField string) error {
+	field := shadowField
+	if strings.Contains(field, ":") {
+		field = strings.SplitN(field, ":", 3)[1]
+	}
+
+	switch {
+	case field == "":
+		return ErrNoPassword
+	case field[0] == '!' || field[0] == '*':
+		return ErrAccountLocked
+	}
+
+	return ctx.VerifyNoUpgrade(password, field)
+}
+
+// Uses the default context to verify a password against an
+// /etc/shadow-style entry. See Context.VerifyShadowEntry.
+func VerifyShadowEntry(password, shadowField string) error {
+	return DefaultContext.VerifyShadowEntry(password, shadowField)
+}
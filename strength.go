@@ -0,0 +1,98 @@
+package passlib
+
+import (
+	"fmt"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that a password matched its stored hash, but the hash is weaker
+// than the context's MinimumStrength. The password is correct, but the user
+// should be made to reset it, as the stored hash may already be crackable.
+type ErrHashTooWeak struct {
+	Name     string
+	Strength float64
+	Minimum  float64
+}
+
+func (e *ErrHashTooWeak) Error() string {
+	return fmt.Sprintf("%s hash has strength %.1f, below the minimum of %.1f", e.Name, e.Strength, e.Minimum)
+}
+
+// Returns the estimated strength of hash, in bits, as computed by the scheme
+// which supports it (see abstract.StrengthScheme). Hashes made by schemes
+// which cannot estimate their strength, such as unsalted legacy schemes,
+// have strength 0.
+//
+// Returns abstract.ErrNoMatchingScheme if no scheme supports the hash.
+func (ctx *Context) Strength(hash string) (float64, error) {
+	hash = ctx.trimHash(hash)
+	_, scheme := ctx.findScheme(hash)
+	if scheme == nil {
+		return 0, abstract.ErrNoMatchingScheme
+	}
+
+	return strength(scheme, hash)
+}
+
+// Uses the default context to estimate the strength of a hash.
+func Strength(hash string) (float64, error) {
+	return DefaultContext.Strength(hash)
+}
+
+// Like Strength, but uses whichever registered scheme (see RegisterScheme)
+// supports hash, rather than only the default context's schemes, so that
+// hashes from every scheme passlib knows can be ranked against each other,
+// e.g. on a dashboard. Hashes which are peppered or record their creation
+// time are scored as the hash within.
+//
+// The score is the scheme's estimate (see abstract.StrengthEstimator): log2
+// of the work needed to test one guess, in SHA-256 compressions, which
+// always rises with the scheme's cost parameters. Hashes made by schemes
+// which cannot estimate their strength score 0.
+//
+// Returns abstract.ErrNoMatchingScheme if no registered scheme supports the
+// hash.
+func EstimateStrength(hash string) (float64, error) {
+	var ctx Context
+	_, hash, _ = splitPeppered(ctx.trimHash(hash))
+
+	scheme := registeredScheme(hash)
+	if scheme == nil {
+		return 0, abstract.ErrNoMatchingScheme
+	}
+
+	return strength(scheme, hash)
+}
+
+func strength(scheme abstract.Scheme, hash string) (float64, error) {
+	ss, ok := scheme.(abstract.StrengthScheme)
+	if !ok {
+		return 0, nil
+	}
+
+	return ss.Strength(hash)
+}
+
+// Returns an *ErrHashTooWeak if the context has a MinimumStrength and hash,
+// made by scheme, falls below it.
+func (ctx *Context) checkStrength(scheme abstract.Scheme, hash string) error {
+	if ctx.MinimumStrength <= 0 {
+		return nil
+	}
+
+	s, err := strength(scheme, hash)
+	if err != nil {
+		return err
+	}
+
+	if s < ctx.MinimumStrength {
+		return &ErrHashTooWeak{
+			Name:     schemeDisplayName(scheme),
+			Strength: s,
+			Minimum:  ctx.MinimumStrength,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package passlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that a scheme wrapped by WithVerifyTimeout took too long to
+// verify a password.
+var ErrVerifyTimeout = fmt.Errorf("password verification timed out")
+
+type timeoutScheme struct {
+	abstract.Scheme
+	timeout time.Duration
+}
+
+// A timeoutScheme wrapping an abstract.SaltReaderScheme.
+type saltReaderTimeoutScheme struct {
+	*timeoutScheme
+}
+
+// Wraps s so that Verify fails with ErrVerifyTimeout if s takes longer than
+// d to verify a password, e.g. because an imported hash has absurdly costly
+// parameters, rather than tying up the caller for minutes. Hash is not
+// limited. For a context in which every hash should use the same parameters,
+// StrictUniformParams rejects such hashes before any work is done; this
+// limits the damage from those which get through.
+//
+// None of the schemes can be interrupted part way through, so verification
+// runs in a separate goroutine, which is abandoned on timeout. The abandoned
+// goroutine continues to run, and to use CPU time and memory, until the
+// scheme finishes; the timeout only frees the caller. Many timed-out
+// verifications at once can still exhaust the machine.
+//
+// The wrapper passes through abstract.ByteScheme, Deprecatable, FIPSScheme,
+// ParamReader, ParamScheme and StrengthScheme, behaving as a scheme without
+// them would where s does not implement them; VerifyBytes is limited like
+// Verify. It implements abstract.SaltReaderScheme only if s does. Other
+// optional interfaces are not passed through.
+func WithVerifyTimeout(s abstract.Scheme, d time.Duration) abstract.Scheme {
+	ts := &timeoutScheme{Scheme: s, timeout: d}
+	if _, ok := s.(abstract.SaltReaderScheme); ok {
+		return saltReaderTimeoutScheme{ts}
+	}
+
+	return ts
+}
+
+func (s *timeoutScheme) Verify(password, hash string) error {
+	return s.verify(func() error {
+		return s.Scheme.Verify(password, hash)
+	})
+}
+
+func (s *timeoutScheme) VerifyBytes(password []byte, hash string) error {
+	return s.verify(func() error {
+		return verifyBytes(s.Scheme, password, hash)
+	})
+}
+
+// Runs verify, giving up with ErrVerifyTimeout after the timeout.
+func (s *timeoutScheme) verify(verify func() error) error {
+	c, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	_, err := runContext(c, func() (string, error) {
+		return "", verify()
+	})
+	if err == context.DeadlineExceeded {
+		return ErrVerifyTimeout
+	}
+
+	return err
+}
+
+func (s *timeoutScheme) HashBytes(password []byte) (string, error) {
+	if bs, ok := s.Scheme.(abstract.ByteScheme); ok {
+		return bs.HashBytes(password)
+	}
+
+	return s.Scheme.Hash(string(password))
+}
+
+func (s saltReaderTimeoutScheme) HashWithSaltReader(password []byte, saltReader io.Reader) (string, error) {
+	return s.Scheme.(abstract.SaltReaderScheme).HashWithSaltReader(password, saltReader)
+}
+
+func (s *timeoutScheme) FIPSApproved() bool {
+	return fipsApproved(s.Scheme)
+}
+
+func (s *timeoutScheme) IsDeprecated() bool {
+	return deprecated(s.Scheme)
+}
+
+func (s *timeoutScheme) ReadParams(hash string) (map[string]string, error) {
+	if pr, ok := s.Scheme.(abstract.ParamReader); ok {
+		return pr.ReadParams(hash)
+	}
+
+	return nil, nil
+}
+
+func (s *timeoutScheme) Params() map[string]string {
+	if ps, ok := s.Scheme.(abstract.ParamScheme); ok {
+		return ps.Params()
+	}
+
+	return nil
+}
+
+func (s *timeoutScheme) WithParams(params map[string]string) (abstract.Scheme, error) {
+	ps, ok := s.Scheme.(abstract.ParamScheme)
+	if !ok {
+		return nil, fmt.Errorf("%v has no parameters", s.Scheme)
+	}
+
+	scheme, err := ps.WithParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return WithVerifyTimeout(scheme, s.timeout), nil
+}
+
+func (s *timeoutScheme) Strength(hash string) (float64, error) {
+	return strength(s.Scheme, hash)
+}
+
+func (s *timeoutScheme) String() string {
+	return schemeDisplayName(s.Scheme)
+}
@@ -0,0 +1,83 @@
+package passlib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prefix marking a hash which records when it was created (see
+// Context.EmbedTimestamp). It is followed by the creation time in seconds
+// since the Unix epoch, a '$' and the hash, which may itself be peppered:
+//
+//   $created$1602720000$$argon2id$v=19$...
+//   $created$1602720000$$pepper$2020-10$$argon2id$v=19$...
+//
+const timestampPrefix = "$created$"
+
+// Indicates that a hash does not record when it was created.
+var ErrNoTimestamp = fmt.Errorf("hash has no creation timestamp")
+
+// Splits a hash into its creation time and the hash within. ok is false if
+// the hash has no creation timestamp.
+func splitTimestamped(hash string) (created time.Time, inner string, ok bool) {
+	if !strings.HasPrefix(hash, timestampPrefix) {
+		return time.Time{}, hash, false
+	}
+
+	rest := hash[len(timestampPrefix):]
+	i := strings.IndexByte(rest, '$')
+	if i <= 0 || rest[0] == '+' || rest[0] == '-' {
+		return time.Time{}, hash, false
+	}
+
+	seconds, err := strconv.ParseInt(rest[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, hash, false
+	}
+
+	return time.Unix(seconds, 0), rest[i+1:], true
+}
+
+// Records the creation time of a hash.
+func joinTimestamped(created time.Time, inner string) string {
+	return timestampPrefix + strconv.FormatInt(created.Unix(), 10) + "$" + inner
+}
+
+// Gives newHash, which replaces oldHash, the creation time recorded in
+// oldHash, if both record one: upgrading a hash does not change the
+// password, so it should not reset the password's age.
+func (ctx *Context) keepTimestamp(newHash, oldHash string) string {
+	created, _, ok := splitTimestamped(ctx.trimSpace(oldHash))
+	if !ok {
+		return newHash
+	}
+
+	if _, inner, ok := splitTimestamped(newHash); ok {
+		return joinTimestamped(created, inner)
+	}
+
+	return newHash
+}
+
+// Returns the time at which a hash made by a context with EmbedTimestamp set
+// was created, to the second, e.g. to require passwords older than 90 days
+// to be changed. Hashes which replace others when they are upgraded keep the
+// creation time of the original, as the password is unchanged.
+//
+// Returns ErrNoTimestamp if the hash does not record its creation time.
+func (ctx *Context) HashAge(hash string) (time.Time, error) {
+	created, _, ok := splitTimestamped(ctx.trimSpace(hash))
+	if !ok {
+		return time.Time{}, ErrNoTimestamp
+	}
+
+	return created, nil
+}
+
+// Returns the time at which a hash was created, using the default context.
+// See Context.HashAge.
+func HashAge(hash string) (time.Time, error) {
+	return DefaultContext.HashAge(hash)
+}
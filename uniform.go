@@ -0,0 +1,53 @@
+package passlib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/al45tair/passlib/abstract"
+)
+
+// Indicates that the context's StrictUniformParams is set, and a hash's
+// encoded parameters differ from those its scheme is configured with.
+var ErrParameterMismatch = fmt.Errorf("hash parameters differ from the configured parameters")
+
+// Returns an error wrapping ErrParameterMismatch if the context's
+// StrictUniformParams is set and the parameters encoded in hash differ from
+// those scheme uses for new hashes. Only parameters which scheme reports both
+// for hashes (see abstract.ParamReader) and for itself (see
+// abstract.ParamScheme) are compared; schemes which do not implement both
+// have no parameters to compare.
+func (ctx *Context) checkUniformParams(scheme abstract.Scheme, hash string) error {
+	if !ctx.StrictUniformParams {
+		return nil
+	}
+
+	pr, ok := scheme.(abstract.ParamReader)
+	if !ok {
+		return nil
+	}
+	ps, ok := scheme.(abstract.ParamScheme)
+	if !ok {
+		return nil
+	}
+
+	stored, err := pr.ReadParams(hash)
+	if err != nil {
+		return err
+	}
+
+	configured := ps.Params()
+	names := make([]string, 0, len(stored))
+	for name := range stored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if want, ok := configured[name]; ok && stored[name] != want {
+			return fmt.Errorf("%w: %s %s is %s, not %s", ErrParameterMismatch, schemeDisplayName(scheme), name, stored[name], want)
+		}
+	}
+
+	return nil
+}